@@ -1,61 +1,20 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	sqlite3 "github.com/gimpldo/go-sqlite3"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3trace"
 	"github.com/gimpldo/sqlite3-util-go/sqlite3tracemask"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3txwrap"
 )
 
-func traceCallback(info sqlite3.TraceInfo) int {
-	// Not very readable but may be useful; uncomment next line in case of doubt:
-	//fmt.Printf("Trace: %#v\n", info)
-
-	var dbErrText string
-	if info.DBError.Code != 0 || info.DBError.ExtendedCode != 0 {
-		dbErrText = fmt.Sprintf("; DB error: %#v", info.DBError)
-	} else {
-		dbErrText = "."
-	}
-
-	// Show the Statement-or-Trigger text in curly braces ('{', '}')
-	// since from the *paired* ASCII characters they are
-	// the least used in SQL syntax, therefore better visual delimiters.
-	// Maybe show 'ExpandedSQL' the same way as 'StmtOrTrigger'.
-	//
-	// A known use of curly braces (outside strings) is
-	// for ODBC escape sequences. Not likely to appear here.
-	//
-	// Template languages, etc. don't matter, we should see their *result*
-	// at *this* level.
-	// Strange curly braces in SQL code that reached the database driver
-	// suggest that there is a bug in the application.
-	// The braces are likely to be either template syntax or
-	// a programming language's string interpolation syntax.
-
-	var expandedText string
-	if info.ExpandedSQL != "" {
-		if info.ExpandedSQL == info.StmtOrTrigger {
-			expandedText = " no change when expanded"
-		} else {
-			expandedText = fmt.Sprintf(" expanded {%q}", info.ExpandedSQL)
-		}
-	} else {
-		expandedText = ""
-	}
-
-	fmt.Printf("Trace: ev 0x%x, conn 0x%x, stmt 0x%x {%q}%s; %d ns%s\n",
-		info.EventCode, info.ConnHandle, info.StmtHandle,
-		info.StmtOrTrigger, expandedText,
-		info.RunTimeNanosec,
-		dbErrText)
-	return 0
-}
-
 var nRows int     // Number of Rows to generate (for *each* approach tested)
 var rowSeqNum int // Row Sequence Number
 
@@ -63,94 +22,6 @@ var noteTextPattern string
 
 var rollbackAlways bool // Rollback (abort) transactions instead of committing
 
-// txWrap is a kind of "Transaction Wrapper", very specialized (and simplified)
-// for this test's needs:
-//
-// Usually the function that does the work (txFunc) should return error
-// and the transaction wrapper should pass that error back to its caller,
-// but here we use 'log.Panic...' since it simplifies test code
-// and still allows cleanup to work.
-//
-// Based on idea posted by user 'user7610' (January 18, 2016) on Stack Overflow:
-// http://stackoverflow.com/a/34851179   (see the long URL below)
-// http://stackoverflow.com/questions/34842322/can-i-recover-from-panic-handle-the-error-then-panic-again-and-keep-the-origin/34851179#34851179
-//
-func txWrap(db *sql.DB, txFunc func(*sql.Tx)) (err error) {
-	panicked := true
-
-	tx, txErr := db.Begin()
-	if txErr != nil {
-		return txErr
-		//TODO: return errors.Wrap(err, "Begin transaction failed in wrapper")
-		// but it's not available in go1.6
-	}
-
-	defer func() {
-		// DO NOT call recover(), check the flag ('panicked') instead
-		// because after recover() neither rethrowing
-		// nor accessing the stack trace (of received panic) is possible.
-		// A new panic() would be unrelated to the old one.
-		if panicked {
-			tx.Rollback()
-			return
-		}
-
-		if rollbackAlways { // unusual handling introduced for testing purpose
-			tx.Rollback()
-		} else { // the reasonable thing to do: commit if all went OK
-			err = tx.Commit()
-		}
-	}()
-
-	txFunc(tx)
-
-	panicked = false // we know for sure, since we reached the end
-
-	return nil // no error returned does *not* necessarily mean success
-	// in *this* case: remember that txFunc reports problems with panic()
-}
-
-// TxWrapErr (draft) is a kind of "Transaction Wrapper";
-// not used or needed here (just saved the work in progress).
-//
-// Based on idea posted by user 'Luke' (May 6, 2014) on Stack Overflow:
-// http://stackoverflow.com/a/23502629   (see the long URL below)
-// http://stackoverflow.com/questions/16184238/database-sql-tx-detecting-commit-or-rollback/23502629#23502629
-//
-// TODO: pass an interface instead of *sql.Tx
-//        to prevent unwanted calls to Commit() or Rollback();
-//        may also help with the lack of common interface covering DB and Tx.
-//
-func TxWrapErr(db *sql.DB, txFunc func(*sql.Tx) error) (err error) {
-	tx, txErr := db.Begin()
-	if txErr != nil {
-		return txErr
-	}
-
-	defer func() {
-		if p := recover(); p != nil {
-			switch p := p.(type) {
-			case error:
-				err = p
-			default:
-				err = fmt.Errorf("%s", p)
-			}
-		}
-		if err != nil {
-			tx.Rollback()
-			return
-		}
-
-		if rollbackAlways { // unusual handling introduced for testing purpose
-			tx.Rollback()
-		} else { // the reasonable thing to do: commit if all went OK
-			err = tx.Commit()
-		}
-	}()
-
-	return txFunc(tx)
-}
-
 func main() {
 	var dbFilename string
 	var maskStr string
@@ -167,21 +38,36 @@ func main() {
 
 	flag.Parse()
 
-	sqlite3tracemask.DecodeStringArg(&maskConf, maskStr)
+	var strConf sqlite3tracemask.Config
+	sqlite3tracemask.DecodeStringArg(&strConf, maskStr)
 
 	// The event mask will be the union of boolean flags and string flag.
 	// This is for illustration purpose. Probably you should use
 	// either the boolean flags or the string flag (short form), not both.
+	maskConf = maskConf.Union(strConf)
 
 	fmt.Printf("Short form of mask: {%s}\n", maskConf.GenerateStringArg())
 	fmt.Printf("Long form of mask (separate flags): {%s}\n", maskConf.GenerateBoolArgs())
 	fmt.Printf("Numeric mask: 0x%x\n", maskConf.EventMask())
+	fmt.Printf("Events: %v\n%s", maskConf, maskConf.Describe())
+
+	// Profile and Row events show the statement text of their
+	// Stmt event, when the mask includes Stmt.
+	// Colors only on a terminal, slow statements in red.
+	traceFormat := &sqlite3trace.TextFormatter{
+		Prefix: "Trace: ",
+		Color:  sqlite3trace.UseColor(os.Stdout),
+		Slow:   time.Millisecond,
+	}
+	traceOutput := sqlite3trace.NewOutput(
+		sqlite3trace.NewWriterSink(os.Stdout, traceFormat),
+		func(err error) { log.Printf("trace output: %v", err) })
 
 	sql.Register("sqlite3_tracing",
 		&sqlite3.SQLiteDriver{
 			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
 				err := conn.SetTrace(&sqlite3.TraceConfig{
-					Callback:        traceCallback,
+					Callback:        traceOutput.Callback(nil),
 					EventMask:       maskConf.EventMask(),
 					WantExpandedSQL: true,
 				})
@@ -222,32 +108,49 @@ func dbMain(filename string) int {
 
 	dbSetup(db)
 
-	dbDoInsert(db)
-
-	err = txWrap(db, txDoInsert)
-	if err != nil {
-		log.Panicf("Transaction Wrapper error: %v\n", err)
-	}
-
-	dbDoInsertPrepared(db)
-
-	err = txWrap(db, txDoInsertPrepared)
-	if err != nil {
-		log.Panicf("Transaction Wrapper error: %v\n", err)
-	}
-
-	dbDoSelect(db)
-
-	err = txWrap(db, txDoSelect)
-	if err != nil {
-		log.Panicf("Transaction Wrapper error: %v\n", err)
-	}
-
-	dbDoSelectPrepared(db)
-
-	err = txWrap(db, txDoSelectPrepared)
-	if err != nil {
-		log.Panicf("Transaction Wrapper error: %v\n", err)
+	ctx := context.Background()
+	txOpts := &sqlite3txwrap.Options{Rollback: rollbackAlways}
+
+	// The same work with each execution strategy, to compare their traces:
+	// inserts first (so the selects have rows to find), then selects.
+	// The rows are generated here rather than by sqlite3loadgen, whose
+	// operations run on the pool in random order and concurrently: the
+	// point is the same few statements, in order, through each strategy.
+	for _, s := range sqlite3txwrap.Strategies {
+		seqNums := make([]int, nRows)
+		for i := range seqNums {
+			seqNums[i] = rowSeqNum
+			rowSeqNum++
+		}
+		res, err := sqlite3txwrap.Run(ctx, db, s, txOpts, insertDML, seqNums,
+			func(ctx context.Context, st sqlite3txwrap.Stmt, seqNum int) error {
+				result, err := st.ExecContext(ctx, seqNum, noteTextPrefix+s.String())
+				if err != nil {
+					return err
+				}
+				resultDoCheck(result, s.String(), seqNum)
+				return nil
+			})
+		if err != nil {
+			log.Panic(err)
+		}
+		log.Printf("Insert: %v\n", res)
+	}
+
+	for _, s := range sqlite3txwrap.Strategies {
+		res, err := sqlite3txwrap.Run(ctx, db, s, txOpts, selectDML, []string{noteTextPattern},
+			func(ctx context.Context, st sqlite3txwrap.Stmt, pattern string) error {
+				rows, err := st.QueryContext(ctx, pattern)
+				if err != nil {
+					return err
+				}
+				defer rows.Close()
+				return rowsDoFetch(rows)
+			})
+		if err != nil {
+			log.Panic(err)
+		}
+		log.Printf("Select: %v\n", res)
 	}
 
 	return 0
@@ -283,76 +186,6 @@ func dbSetup(db *sql.DB) {
 	}
 }
 
-func dbDoInsert(db *sql.DB) {
-	const Descr = "DB-imm"
-	for i := 0; i < nRows; i++ {
-		result, err := db.Exec(insertDML, rowSeqNum, noteTextPrefix+Descr)
-		if err != nil {
-			log.Panic(err)
-		}
-
-		resultDoCheck(result, Descr, i)
-
-		rowSeqNum++
-	}
-}
-
-func txDoInsert(tx *sql.Tx) {
-	const Descr = "Tx-imm"
-	for i := 0; i < nRows; i++ {
-		result, err := tx.Exec(insertDML, rowSeqNum, noteTextPrefix+Descr)
-		if err != nil {
-			log.Panic(err)
-		}
-
-		resultDoCheck(result, Descr, i)
-
-		rowSeqNum++
-	}
-}
-
-func dbDoInsertPrepared(db *sql.DB) {
-	const Descr = "DB-Prepare"
-
-	stmt, err := db.Prepare(insertDML)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer stmt.Close()
-
-	for i := 0; i < nRows; i++ {
-		result, err := stmt.Exec(rowSeqNum, noteTextPrefix+Descr)
-		if err != nil {
-			log.Panic(err)
-		}
-
-		resultDoCheck(result, Descr, i)
-
-		rowSeqNum++
-	}
-}
-
-func txDoInsertPrepared(tx *sql.Tx) {
-	const Descr = "Tx-Prepare"
-
-	stmt, err := tx.Prepare(insertDML)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer stmt.Close()
-
-	for i := 0; i < nRows; i++ {
-		result, err := stmt.Exec(rowSeqNum, noteTextPrefix+Descr)
-		if err != nil {
-			log.Panic(err)
-		}
-
-		resultDoCheck(result, Descr, i)
-
-		rowSeqNum++
-	}
-}
-
 func resultDoCheck(result sql.Result, callerDescr string, callIndex int) {
 	lastID, err := result.LastInsertId()
 	if err != nil {
@@ -366,71 +199,9 @@ func resultDoCheck(result sql.Result, callerDescr string, callIndex int) {
 	log.Printf("Exec result for %s (%d): ID = %d, affected = %d\n", callerDescr, callIndex, lastID, nAffected)
 }
 
-func dbDoSelect(db *sql.DB) {
-	rows, err := db.Query(selectDML, noteTextPattern)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer rows.Close()
-
-	rowsDoFetch(rows)
-}
-
-func txDoSelect(tx *sql.Tx) {
-	rows, err := tx.Query(selectDML, noteTextPattern)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer rows.Close()
-
-	rowsDoFetch(rows)
-}
-
-func dbDoSelectPrepared(db *sql.DB) {
-	stmt, err := db.Prepare(selectDML)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer stmt.Close()
-
-	rows, err := stmt.Query(noteTextPattern)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer rows.Close()
-
-	rowsDoFetch(rows)
-}
-
-func txDoSelectPrepared(tx *sql.Tx) {
-	stmt, err := tx.Prepare(selectDML)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer stmt.Close()
-
-	rows, err := stmt.Query(noteTextPattern)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer rows.Close()
-
-	rowsDoFetch(rows)
-}
-
-func rowsDoFetch(rows *sql.Rows) {
+func rowsDoFetch(rows *sql.Rows) error {
 	for rows.Next() {
 		// ...
 	}
-	if err := rows.Err(); err != nil {
-		log.Panic(err)
-	}
-}
-
-func txDoX(tx *sql.Tx) {
-
-}
-
-func dbDoX(db *sql.DB) {
-
+	return rows.Err()
 }
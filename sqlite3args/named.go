@@ -0,0 +1,49 @@
+package sqlite3args
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// ErrMixedParams is returned by Named for a query that also has
+// positional ('?' or '?NNN') parameters.
+var ErrMixedParams = errors.New("sqlite3args: named and positional parameters mixed")
+
+// Named rewrites the :name, @name and $name parameters of query into
+// '?' placeholders and returns the arguments in matching order,
+// looked up in params by name (with or without the prefix character).
+// A name used several times gets its value repeated. Parameters inside
+// string literals, quoted identifiers and comments are left alone.
+//
+//	q, args, err := sqlite3args.Named(
+//		"SELECT * FROM t WHERE owner = :owner AND id IN (:ids)",
+//		map[string]interface{}{"owner": owner, "ids": ids})
+//	rows, err := db.Query(q, args...)
+//
+// Slice values are then expanded as by In.
+func Named(query string, params map[string]interface{}) (string, []interface{}, error) {
+	var b strings.Builder
+	var args []interface{}
+	for _, t := range sqlite3lex.Tokenize(query) {
+		if t.Kind != sqlite3lex.Param {
+			b.WriteString(t.Text)
+			continue
+		}
+		if t.Text[0] == '?' {
+			return "", nil, ErrMixedParams
+		}
+		v, ok := params[t.Text]
+		if !ok {
+			v, ok = params[t.Text[1:]]
+		}
+		if !ok {
+			return "", nil, fmt.Errorf("sqlite3args: no value for parameter %s", t.Text)
+		}
+		b.WriteString("?")
+		args = append(args, v)
+	}
+	return In(b.String(), args...)
+}
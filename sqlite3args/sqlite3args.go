@@ -0,0 +1,136 @@
+// Package sqlite3args solves the "WHERE id IN (?)" with-a-slice problem:
+// slice arguments are expanded into as many placeholders as elements,
+// or, past a placeholder budget, passed as a single JSON array read
+// back with the table-valued json_each().
+//
+// Named adds named parameters on top, rewritten into positional ones
+// in the order database/sql expects.
+package sqlite3args
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// DefaultMaxParams is SQLITE_MAX_VARIABLE_NUMBER of SQLite before
+// 3.32.0; newer builds default to 32766.
+const DefaultMaxParams = 999
+
+// Expander rewrites queries with slice arguments.
+type Expander struct {
+	// MaxParams is the placeholder budget for the whole statement;
+	// when expanding would exceed it, slices are passed as JSON instead.
+	// 0 means DefaultMaxParams.
+	MaxParams int
+	// AlwaysJSON passes every slice as JSON: one placeholder per slice
+	// and a statement text independent of the slice lengths (so prepared
+	// statement caches work), at the price of JSON encoding.
+	AlwaysJSON bool
+}
+
+// ErrNumberedParams is returned when a query mixing slice arguments
+// uses numbered or named parameters, whose positions cannot be
+// rewritten safely.
+var ErrNumberedParams = errors.New("sqlite3args: slice arguments need plain '?' placeholders")
+
+// In expands slice arguments with the default Expander.
+//
+//	q, args, err := sqlite3args.In("SELECT * FROM t WHERE id IN (?) AND kind = ?", ids, kind)
+//	rows, err := db.Query(q, args...)
+//
+// An empty slice becomes NULL, so "IN (?)" matches nothing.
+func In(query string, args ...interface{}) (string, []interface{}, error) {
+	return Expander{}.Expand(query, args...)
+}
+
+// isSlice reports whether v is a slice to expand. Arrays (such as
+// a UUID), slices of bytes (blobs, json.RawMessage) and values that
+// convert themselves (driver.Valuer) are single arguments.
+func isSlice(v interface{}) (reflect.Value, bool) {
+	if v == nil {
+		return reflect.Value{}, false
+	}
+	if _, ok := v.(driver.Valuer); ok {
+		return reflect.Value{}, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return reflect.Value{}, false
+	}
+	return rv, true
+}
+
+// Expand rewrites query and args; queries without slice arguments are
+// returned unchanged.
+func (e Expander) Expand(query string, args ...interface{}) (string, []interface{}, error) {
+	budget := e.MaxParams
+	if budget <= 0 {
+		budget = DefaultMaxParams
+	}
+
+	total, anySlice := 0, false
+	for _, a := range args {
+		if rv, ok := isSlice(a); ok {
+			anySlice = true
+			total += rv.Len()
+		} else {
+			total++
+		}
+	}
+	if !anySlice {
+		return query, args, nil
+	}
+	useJSON := e.AlwaysJSON || total > budget
+
+	var b strings.Builder
+	var out []interface{}
+	n := 0
+	for _, t := range sqlite3lex.Tokenize(query) {
+		if t.Kind != sqlite3lex.Param {
+			b.WriteString(t.Text)
+			continue
+		}
+		if t.Text != "?" {
+			return "", nil, ErrNumberedParams
+		}
+		if n >= len(args) {
+			return "", nil, fmt.Errorf("sqlite3args: more placeholders than the %d arguments", len(args))
+		}
+		a := args[n]
+		n++
+
+		rv, ok := isSlice(a)
+		switch {
+		case !ok:
+			b.WriteString("?")
+			out = append(out, a)
+		case rv.Len() == 0:
+			b.WriteString("NULL")
+		case useJSON:
+			doc, err := json.Marshal(a)
+			if err != nil {
+				return "", nil, fmt.Errorf("sqlite3args: argument %d: %w", n, err)
+			}
+			b.WriteString("SELECT value FROM json_each(?)")
+			out = append(out, string(doc))
+		default:
+			for i := 0; i < rv.Len(); i++ {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString("?")
+				out = append(out, rv.Index(i).Interface())
+			}
+		}
+	}
+	if n != len(args) {
+		return "", nil, fmt.Errorf("sqlite3args: %d placeholders for %d arguments", n, len(args))
+	}
+	return b.String(), out, nil
+}
@@ -0,0 +1,123 @@
+package sqlite3authz
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action is an SQLite authorizer action code (SQLITE_CREATE_INDEX, ...).
+type Action int
+
+// Action codes, same values as in sqlite3.h.
+const (
+	Copy            Action = 0 // no longer used by SQLite
+	CreateIndex     Action = 1
+	CreateTable     Action = 2
+	CreateTempIndex Action = 3
+	CreateTempTable Action = 4
+	CreateTempTrig  Action = 5
+	CreateTempView  Action = 6
+	CreateTrigger   Action = 7
+	CreateView      Action = 8
+	Delete          Action = 9
+	DropIndex       Action = 10
+	DropTable       Action = 11
+	DropTempIndex   Action = 12
+	DropTempTable   Action = 13
+	DropTempTrigger Action = 14
+	DropTempView    Action = 15
+	DropTrigger     Action = 16
+	DropView        Action = 17
+	Insert          Action = 18
+	Pragma          Action = 19
+	Read            Action = 20
+	Select          Action = 21
+	Transaction     Action = 22
+	Update          Action = 23
+	Attach          Action = 24
+	Detach          Action = 25
+	AlterTable      Action = 26
+	Reindex         Action = 27
+	Analyze         Action = 28
+	CreateVTable    Action = 29
+	DropVTable      Action = 30
+	Function        Action = 31
+	Savepoint       Action = 32
+	Recursive       Action = 33
+)
+
+var actionNames = []string{
+	"copy", "create_index", "create_table", "create_temp_index",
+	"create_temp_table", "create_temp_trigger", "create_temp_view",
+	"create_trigger", "create_view", "delete", "drop_index", "drop_table",
+	"drop_temp_index", "drop_temp_table", "drop_temp_trigger",
+	"drop_temp_view", "drop_trigger", "drop_view", "insert", "pragma",
+	"read", "select", "transaction", "update", "attach", "detach",
+	"alter_table", "reindex", "analyze", "create_vtable", "drop_vtable",
+	"function", "savepoint", "recursive",
+}
+
+func (a Action) String() string {
+	if a >= 0 && int(a) < len(actionNames) {
+		return actionNames[a]
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// ParseAction accepts the names returned by Action.String
+// (case-insensitive, with or without the "SQLITE_" prefix).
+func ParseAction(name string) (Action, error) {
+	n := strings.TrimPrefix(strings.ToLower(name), "sqlite_")
+	for i, s := range actionNames {
+		if s == n {
+			return Action(i), nil
+		}
+	}
+	return 0, fmt.Errorf("sqlite3authz: unknown action %q", name)
+}
+
+// WriteActions are the actions that modify the database file
+// (data or schema); useful for read-only policies.
+var WriteActions = []Action{
+	CreateIndex, CreateTable, CreateTrigger, CreateView,
+	Delete, DropIndex, DropTable, DropTrigger, DropView,
+	Insert, Update, AlterTable, Reindex, Analyze,
+	CreateVTable, DropVTable,
+}
+
+// target extracts from the authorizer arguments the table, column and
+// name (pragma, function, file, operation) an action is about,
+// following the argument table in the SQLite documentation of
+// sqlite3_set_authorizer().
+func target(a Action, arg1, arg2 string) (table, column, name string) {
+	switch a {
+	case Read, Update:
+		return arg1, arg2, ""
+	case CreateTable, CreateTempTable, DropTable, DropTempTable,
+		Insert, Delete, Analyze, CreateVTable, DropVTable:
+		return arg1, "", arg2
+	case CreateIndex, CreateTempIndex, DropIndex, DropTempIndex,
+		CreateTrigger, CreateTempTrig, DropTrigger, DropTempTrigger:
+		return arg2, "", arg1
+	case AlterTable:
+		return arg2, "", ""
+	case CreateView, CreateTempView, DropView, DropTempView, Reindex:
+		return "", "", arg1
+	case Function:
+		return "", "", arg2
+	case Pragma, Transaction, Savepoint, Attach, Detach:
+		return "", "", arg1
+	}
+	return "", "", ""
+}
+
+// isTableAction reports whether Rule.Table (and Column) refer to
+// a real table for this action, so that Compile can check them.
+func isTableAction(a Action) bool {
+	switch a {
+	case Read, Update, Insert, Delete, DropTable, AlterTable, Analyze,
+		CreateIndex, DropIndex, CreateTrigger:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package sqlite3authz
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// Compiled is a Policy validated against a schema, ready to be
+// installed as the authorizer of connections.
+type Compiled struct {
+	policy Policy
+}
+
+// Compile checks every rule of p against the schema visible through db:
+// literal (non-pattern) table names must exist in the named (or any)
+// database, literal column names must exist in the matching tables.
+// All problems are reported together.
+func Compile(ctx context.Context, db *sql.DB, p *Policy) (*Compiled, error) {
+	schema, err := loadSchema(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3authz: reading schema: %w", err)
+	}
+
+	var problems []string
+	for i, r := range p.Rules {
+		if msg := schema.check(&r); msg != "" {
+			problems = append(problems, fmt.Sprintf("rule %d (%s): %s", i+1, r.String(), msg))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New("sqlite3authz: invalid policy:\n\t" + strings.Join(problems, "\n\t"))
+	}
+	return CompileUnchecked(p), nil
+}
+
+// CompileUnchecked compiles p without looking at any schema,
+// e.g. for policies that only use patterns.
+func CompileUnchecked(p *Policy) *Compiled {
+	c := &Compiled{policy: *p}
+	c.policy.Rules = append([]Rule(nil), p.Rules...)
+	return c
+}
+
+// Decide returns the effect of the policy for one authorizer request
+// (arguments as passed by SQLite) and the index of the deciding rule
+// (-1 for the default).
+func (c *Compiled) Decide(action Action, arg1, arg2, database string) (Effect, int) {
+	table, column, name := target(action, arg1, arg2)
+	for i := range c.policy.Rules {
+		if c.policy.Rules[i].matches(action, table, column, name, database) {
+			return c.policy.Rules[i].Effect, i
+		}
+	}
+	return c.policy.Default, -1
+}
+
+// Authorize has the signature expected by SQLiteConn.RegisterAuthorizer.
+func (c *Compiled) Authorize(op int, arg1, arg2, database string) int {
+	e, _ := c.Decide(Action(op), arg1, arg2, database)
+	return int(e)
+}
+
+// Install makes the policy the authorizer of conn.
+func (c *Compiled) Install(conn *sqlite3.SQLiteConn) {
+	conn.RegisterAuthorizer(c.Authorize)
+}
+
+// ConnectHook installs the policy; suitable for sqlite3.SQLiteDriver
+// or sqlite3conn.Config.
+func (c *Compiled) ConnectHook(conn *sqlite3.SQLiteConn) error {
+	c.Install(conn)
+	return nil
+}
+
+// Step is one authorizer request made while preparing a statement.
+type Step struct {
+	Action   Action
+	Arg1     string
+	Arg2     string
+	Database string
+	Effect   Effect
+	Rule     int // index of the deciding rule, -1 for the default
+}
+
+// Report is the outcome of Test.
+type Report struct {
+	SQL     string
+	Steps   []Step
+	Allowed bool // no step was denied
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q allowed=%v\n", r.SQL, r.Allowed)
+	for _, s := range r.Steps {
+		fmt.Fprintf(&b, "\t%s(%q, %q) on %q -> %s (rule %d)\n",
+			s.Action, s.Arg1, s.Arg2, s.Database, s.Effect, s.Rule+1)
+	}
+	return b.String()
+}
+
+// Test prepares query on a connection of db with a recording authorizer
+// and reports every authorization request it makes and what the policy
+// would answer. The query is not executed.
+//
+// The connection used is discarded from the pool afterwards,
+// since its authorizer has been replaced.
+func (c *Compiled) Test(ctx context.Context, db *sql.DB, query string) (*Report, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	report := &Report{SQL: query, Allowed: true}
+	var prepErr error
+	err = conn.Raw(func(driverConn interface{}) error {
+		sc, ok := driverConn.(*sqlite3.SQLiteConn)
+		if u, isWrapped := driverConn.(interface{ Unwrap() *sqlite3.SQLiteConn }); isWrapped {
+			sc, ok = u.Unwrap(), true // sqlite3conn pool with StatementTimeout
+		}
+		if !ok {
+			prepErr = fmt.Errorf("sqlite3authz: unexpected driver connection %T", driverConn)
+			return nil
+		}
+		sc.RegisterAuthorizer(func(op int, arg1, arg2, database string) int {
+			e, rule := c.Decide(Action(op), arg1, arg2, database)
+			report.Steps = append(report.Steps, Step{
+				Action: Action(op), Arg1: arg1, Arg2: arg2, Database: database,
+				Effect: e, Rule: rule,
+			})
+			if e == Deny {
+				report.Allowed = false
+			}
+			return int(Allow) // record everything, deny nothing
+		})
+		stmt, err := sc.Prepare(query)
+		if err != nil {
+			prepErr = err
+		} else {
+			stmt.Close()
+		}
+		return driver.ErrBadConn // make database/sql drop this connection
+	})
+	if err != nil && err != driver.ErrBadConn {
+		return nil, err
+	}
+	if prepErr != nil {
+		return nil, prepErr
+	}
+	return report, nil
+}
+
+// schema maps lowercased database name -> table name -> column set.
+type schema map[string]map[string]map[string]bool
+
+func loadSchema(ctx context.Context, db *sql.DB) (schema, error) {
+	dbNames, err := queryStrings(ctx, db, "SELECT name FROM pragma_database_list")
+	if err != nil {
+		return nil, err
+	}
+	s := make(schema)
+	for _, dbName := range dbNames {
+		master := quoteIdent(dbName) + ".sqlite_master"
+		if dbName == "temp" {
+			master = "temp.sqlite_temp_master"
+		}
+		tables, err := queryStrings(ctx, db,
+			"SELECT name FROM "+master+" WHERE type IN ('table', 'view')")
+		if err != nil {
+			return nil, err
+		}
+		s[strings.ToLower(dbName)] = make(map[string]map[string]bool)
+		for _, t := range tables {
+			cols, err := queryStrings(ctx, db,
+				"SELECT name FROM pragma_table_info(?, ?)", t, dbName)
+			if err != nil {
+				return nil, err
+			}
+			set := make(map[string]bool)
+			for _, col := range cols {
+				set[strings.ToLower(col)] = true
+			}
+			s[strings.ToLower(dbName)][strings.ToLower(t)] = set
+		}
+	}
+	return s, nil
+}
+
+func (s schema) check(r *Rule) string {
+	if r.Table == "" || hasMeta(r.Table) {
+		return ""
+	}
+	tableActions := len(r.Actions) == 0
+	for _, a := range r.Actions {
+		if isTableAction(a) {
+			tableActions = true
+		}
+	}
+	if !tableActions {
+		return ""
+	}
+
+	found := false
+	for dbName, tables := range s {
+		if !globMatch(r.Database, dbName) {
+			continue
+		}
+		cols, ok := tables[strings.ToLower(r.Table)]
+		if !ok {
+			continue
+		}
+		found = true
+		if r.Column != "" && !hasMeta(r.Column) && !cols[strings.ToLower(r.Column)] {
+			return fmt.Sprintf("no column %q in %s.%s", r.Column, dbName, r.Table)
+		}
+	}
+	if !found {
+		return fmt.Sprintf("no table %q in database %q", r.Table, orStar(r.Database))
+	}
+	return ""
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
@@ -0,0 +1,276 @@
+// Package sqlite3authz builds SQLite authorizer callbacks from
+// declarative policies.
+//
+// A Policy is an ordered list of rules (first match wins) plus a default
+// effect. Rules can be written with the builder methods or parsed from
+// a small text language (see Parse). Before use, a Policy is compiled
+// against the actual schema, which catches misspelled table and column
+// names that would otherwise silently never match.
+package sqlite3authz
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// Effect is what the authorizer answers for a matching action.
+type Effect int
+
+const (
+	Allow  Effect = 0 // SQLITE_OK
+	Deny   Effect = 1 // SQLITE_DENY: the statement fails to prepare
+	Ignore Effect = 2 // SQLITE_IGNORE: column reads as NULL, write is skipped
+)
+
+func (e Effect) String() string {
+	switch e {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	case Ignore:
+		return "ignore"
+	}
+	return fmt.Sprintf("Effect(%d)", int(e))
+}
+
+// Rule matches authorizer requests. Empty fields match anything;
+// non-empty ones are case-insensitive glob patterns ('*' and '?').
+type Rule struct {
+	Effect   Effect
+	Actions  []Action // empty: any action
+	Database string   // schema name: "main", "temp", or an attached name
+	Table    string
+	Column   string
+	Name     string // pragma, function, view, index, attached file, transaction operation
+}
+
+func (r *Rule) String() string {
+	var acts []string
+	for _, a := range r.Actions {
+		acts = append(acts, a.String())
+	}
+	if len(acts) == 0 {
+		acts = []string{"*"}
+	}
+	s := r.Effect.String() + " " + strings.Join(acts, ",")
+	if r.Database != "" || r.Table != "" || r.Column != "" {
+		s += " " + orStar(r.Database) + "." + orStar(r.Table) + "." + orStar(r.Column)
+	}
+	if r.Name != "" {
+		s += " name=" + r.Name
+	}
+	return s
+}
+
+func orStar(s string) string {
+	if s == "" {
+		return "*"
+	}
+	return s
+}
+
+func (r *Rule) matches(a Action, table, column, name, database string) bool {
+	if len(r.Actions) > 0 {
+		found := false
+		for _, ra := range r.Actions {
+			if ra == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return globMatch(r.Database, database) &&
+		globMatch(r.Table, table) &&
+		globMatch(r.Column, column) &&
+		globMatch(r.Name, name)
+}
+
+// Policy is an ordered rule list; the first matching rule decides,
+// Default applies when none matches.
+type Policy struct {
+	Rules   []Rule
+	Default Effect
+}
+
+// NewPolicy starts a policy with the given default effect.
+func NewPolicy(def Effect) *Policy {
+	return &Policy{Default: def}
+}
+
+// RuleBuilder narrows the rule most recently added to a Policy.
+type RuleBuilder struct {
+	p *Policy
+	i int
+}
+
+func (p *Policy) add(e Effect, actions []Action) *RuleBuilder {
+	p.Rules = append(p.Rules, Rule{Effect: e, Actions: actions})
+	return &RuleBuilder{p: p, i: len(p.Rules) - 1}
+}
+
+// Allow appends a rule allowing the actions (none: any action).
+func (p *Policy) Allow(actions ...Action) *RuleBuilder { return p.add(Allow, actions) }
+
+// Deny appends a rule denying the actions (none: any action).
+func (p *Policy) Deny(actions ...Action) *RuleBuilder { return p.add(Deny, actions) }
+
+// Ignore appends a rule answering SQLITE_IGNORE for the actions.
+func (p *Policy) Ignore(actions ...Action) *RuleBuilder { return p.add(Ignore, actions) }
+
+// On restricts the rule to a database, table and column pattern.
+func (b *RuleBuilder) On(database, table, column string) *RuleBuilder {
+	r := &b.p.Rules[b.i]
+	r.Database, r.Table, r.Column = database, table, column
+	return b
+}
+
+// Table restricts the rule to a table pattern (in any database).
+func (b *RuleBuilder) Table(table string) *RuleBuilder {
+	b.p.Rules[b.i].Table = table
+	return b
+}
+
+// Named restricts the rule to a pragma/function/... name pattern.
+func (b *RuleBuilder) Named(name string) *RuleBuilder {
+	b.p.Rules[b.i].Name = name
+	return b
+}
+
+// Policy returns the policy being built, for chaining further rules.
+func (b *RuleBuilder) Policy() *Policy { return b.p }
+
+// Parse reads a policy written one rule per line:
+//
+//	default deny
+//	allow select,read,function
+//	deny read main.users.password
+//	allow insert,update main.audit_*
+//	allow pragma name=table_info
+//
+// A line is an effect (allow, deny, ignore), a comma-separated action
+// list ('*' for any), an optional [database.]table[.column] pattern
+// and an optional name=pattern. '#' starts a comment.
+// Without a "default" line the default is deny.
+func Parse(text string) (*Policy, error) {
+	p := NewPolicy(Deny)
+	sc := bufio.NewScanner(strings.NewReader(text))
+	lineNum := 0
+	for sc.Scan() {
+		lineNum++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := parseLine(p, fields); err != nil {
+			return nil, fmt.Errorf("sqlite3authz: line %d: %v", lineNum, err)
+		}
+	}
+	return p, sc.Err()
+}
+
+func parseEffect(s string) (Effect, error) {
+	switch strings.ToLower(s) {
+	case "allow":
+		return Allow, nil
+	case "deny":
+		return Deny, nil
+	case "ignore":
+		return Ignore, nil
+	}
+	return 0, fmt.Errorf("unknown effect %q", s)
+}
+
+func parseLine(p *Policy, fields []string) error {
+	if strings.ToLower(fields[0]) == "default" {
+		if len(fields) != 2 {
+			return fmt.Errorf("expected 'default <effect>'")
+		}
+		e, err := parseEffect(fields[1])
+		p.Default = e
+		return err
+	}
+
+	e, err := parseEffect(fields[0])
+	if err != nil {
+		return err
+	}
+	if len(fields) < 2 {
+		return fmt.Errorf("missing action list")
+	}
+	r := Rule{Effect: e}
+	if fields[1] != "*" {
+		for _, name := range strings.Split(fields[1], ",") {
+			a, err := ParseAction(name)
+			if err != nil {
+				return err
+			}
+			r.Actions = append(r.Actions, a)
+		}
+	}
+	for _, f := range fields[2:] {
+		if strings.HasPrefix(f, "name=") {
+			r.Name = strings.TrimPrefix(f, "name=")
+			continue
+		}
+		parts := strings.Split(f, ".")
+		switch len(parts) {
+		case 1:
+			r.Table = parts[0]
+		case 2:
+			r.Database, r.Table = parts[0], parts[1]
+		case 3:
+			r.Database, r.Table, r.Column = parts[0], parts[1], parts[2]
+		default:
+			return fmt.Errorf("bad object pattern %q", f)
+		}
+	}
+	p.Rules = append(p.Rules, r)
+	return nil
+}
+
+// globMatch matches s against a case-insensitive pattern where '*' is
+// any sequence and '?' any single character; an empty pattern matches
+// everything.
+func globMatch(pattern, s string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	return glob(strings.ToLower(pattern), strings.ToLower(s))
+}
+
+func glob(p, s string) bool {
+	for len(p) > 0 {
+		switch p[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if glob(p[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != p[0] {
+				return false
+			}
+		}
+		p, s = p[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?")
+}
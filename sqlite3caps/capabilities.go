@@ -0,0 +1,134 @@
+package sqlite3caps
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Caps describes the SQLite library behind a database handle.
+type Caps struct {
+	// Version is the library version, e.g. "3.45.1", and VersionNumber
+	// its SQLITE_VERSION_NUMBER form, e.g. 3045001.
+	Version       string
+	VersionNumber int
+
+	// CompileOptions are as returned by CompileOptions.
+	CompileOptions map[string]string
+
+	// Extensions, probed by using them.
+	FTS3  bool
+	FTS4  bool
+	FTS5  bool
+	JSON1 bool
+	RTree bool
+	// Session and Snapshot are compiled in (SQLITE_ENABLE_SESSION,
+	// SQLITE_ENABLE_SNAPSHOT); using them also needs driver support.
+	Session  bool
+	Snapshot bool
+	// MathFunctions are sqrt(), ln(), ... (3.35, when enabled).
+	MathFunctions bool
+
+	// SQL features, by version.
+	Upsert           bool // INSERT ... ON CONFLICT DO UPDATE (3.24)
+	WindowFunctions  bool // 3.25
+	VacuumInto       bool // 3.27
+	GeneratedColumns bool // 3.31
+	Returning        bool // 3.35
+	DropColumn       bool // ALTER TABLE ... DROP COLUMN (3.35)
+	Strict           bool // STRICT tables (3.37)
+	UnixEpoch        bool // unixepoch() (3.38)
+	Unhex            bool // unhex() (3.41)
+}
+
+// versionNumber converts "3.45.1" to 3045001.
+func versionNumber(version string) int {
+	parts := strings.SplitN(version, ".", 3)
+	n := 0
+	for i, scale := range []int{1000000, 1000, 1} {
+		if i < len(parts) {
+			v, _ := strconv.Atoi(parts[i])
+			n += v * scale
+		}
+	}
+	return n
+}
+
+// Capabilities reports what the SQLite library of db supports.
+// Extensions are probed on one connection with temporary tables,
+// so db must not be read-only in a way that forbids those.
+func Capabilities(ctx context.Context, db *sql.DB) (*Caps, error) {
+	c := &Caps{}
+	if err := db.QueryRowContext(ctx, "SELECT sqlite_version()").Scan(&c.Version); err != nil {
+		return nil, fmt.Errorf("sqlite3caps: version: %w", err)
+	}
+	c.VersionNumber = versionNumber(c.Version)
+	opts, err := CompileOptions(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3caps: compile options: %w", err)
+	}
+	c.CompileOptions = opts
+	_, c.Session = opts["ENABLE_SESSION"]
+	_, c.Snapshot = opts["ENABLE_SNAPSHOT"]
+
+	at := func(min int) bool { return c.VersionNumber >= min }
+	c.Upsert = at(3024000)
+	c.WindowFunctions = at(3025000)
+	c.VacuumInto = at(3027000)
+	c.GeneratedColumns = at(3031000)
+	c.Returning = at(3035000)
+	c.DropColumn = at(3035000)
+	c.Strict = at(3037000)
+	c.UnixEpoch = at(3038000)
+	c.Unhex = at(3041000)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	works := func(stmts ...string) bool {
+		for _, s := range stmts {
+			if _, err := conn.ExecContext(ctx, s); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+	vtab := func(module, args string) bool {
+		name := "temp.sqlite3caps_probe"
+		defer conn.ExecContext(context.Background(), "DROP TABLE IF EXISTS "+name)
+		return works("CREATE VIRTUAL TABLE " + name + " USING " + module + "(" + args + ")")
+	}
+	c.FTS3 = vtab("fts3", "a")
+	c.FTS4 = vtab("fts4", "a")
+	c.FTS5 = vtab("fts5", "a")
+	c.RTree = vtab("rtree", "id, x0, x1")
+	c.JSON1 = works("SELECT json('{}')")
+	c.MathFunctions = works("SELECT sqrt(4)")
+	return c, ctx.Err()
+}
+
+// Missing returns the names of the features in want (as named by the
+// Caps fields: "FTS5", "Returning", ...) that c lacks, for start-up
+// checks; unknown names are reported as missing.
+func (c *Caps) Missing(want ...string) []string {
+	have := map[string]bool{
+		"FTS3": c.FTS3, "FTS4": c.FTS4, "FTS5": c.FTS5, "JSON1": c.JSON1,
+		"RTree": c.RTree, "Session": c.Session, "Snapshot": c.Snapshot,
+		"MathFunctions": c.MathFunctions, "Upsert": c.Upsert,
+		"WindowFunctions": c.WindowFunctions, "VacuumInto": c.VacuumInto,
+		"GeneratedColumns": c.GeneratedColumns, "Returning": c.Returning,
+		"DropColumn": c.DropColumn, "Strict": c.Strict,
+		"UnixEpoch": c.UnixEpoch, "Unhex": c.Unhex,
+	}
+	var missing []string
+	for _, w := range want {
+		if !have[w] {
+			missing = append(missing, w)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,36 @@
+// Package sqlite3caps reports what the SQLite library linked into the
+// program can do: its threading mode, compile options, optional
+// features and version, so that code can check its needs at startup
+// and fail with a clear message rather than with an obscure SQL error
+// (or a crash) later.
+package sqlite3caps
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// CompileOptions returns the options SQLite was compiled with
+// (PRAGMA compile_options, i.e. sqlite3_compileoption_get), without
+// the "SQLITE_" prefix, by name: "THREADSAFE" -> "1", "ENABLE_FTS5" -> "".
+func CompileOptions(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, "PRAGMA compile_options")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	opts := make(map[string]string)
+	for rows.Next() {
+		var opt string
+		if err := rows.Scan(&opt); err != nil {
+			return nil, err
+		}
+		name, value := opt, ""
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			name, value = opt[:i], opt[i+1:]
+		}
+		opts[name] = value
+	}
+	return opts, rows.Err()
+}
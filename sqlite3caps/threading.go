@@ -0,0 +1,98 @@
+package sqlite3caps
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ThreadingMode is how SQLite protects itself from concurrent use.
+type ThreadingMode int
+
+const (
+	// SingleThread (THREADSAFE=0): no mutexes at all; SQLite must not
+	// be used by two goroutines at once, even on different connections.
+	SingleThread ThreadingMode = iota
+	// MultiThread (THREADSAFE=2): connections may be used concurrently,
+	// each by one goroutine at a time (database/sql ensures that).
+	MultiThread
+	// Serialized (THREADSAFE=1, the default): no restriction.
+	Serialized
+)
+
+var threadingModeNames = map[ThreadingMode]string{
+	SingleThread: "single-thread",
+	MultiThread:  "multi-thread",
+	Serialized:   "serialized",
+}
+
+func (m ThreadingMode) String() string {
+	if n, ok := threadingModeNames[m]; ok {
+		return n
+	}
+	return fmt.Sprintf("ThreadingMode(%d)", int(m))
+}
+
+// ErrUnsafeThreading is returned by CheckThreading for a pool that
+// may use a single-thread build from several goroutines at once.
+var ErrUnsafeThreading = errors.New("sqlite3caps: SQLite is built single-threaded (THREADSAFE=0) but the pool may open several connections")
+
+// ThreadingReport describes the compiled threading mode.
+type ThreadingReport struct {
+	Mode ThreadingMode
+	// Options are the compile options about threading and mutexes
+	// (THREADSAFE, MUTEX_*, ...), as "NAME=value" or "NAME", sorted.
+	Options []string
+	// MaxOpenConns is the pool limit checked (0 for unlimited).
+	MaxOpenConns int
+}
+
+func (r *ThreadingReport) String() string {
+	return fmt.Sprintf("threading mode %s (%s), pool limit %d",
+		r.Mode, strings.Join(r.Options, ", "), r.MaxOpenConns)
+}
+
+// Threading reports the threading mode SQLite was compiled with.
+// (The mode can still be lowered at start-up or per connection;
+// the driver asks for serialized connections.)
+func Threading(ctx context.Context, db *sql.DB) (*ThreadingReport, error) {
+	opts, err := CompileOptions(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3caps: compile options: %w", err)
+	}
+	r := &ThreadingReport{Mode: Serialized, MaxOpenConns: db.Stats().MaxOpenConnections}
+	switch opts["THREADSAFE"] {
+	case "0":
+		r.Mode = SingleThread
+	case "2":
+		r.Mode = MultiThread
+	}
+	for name, value := range opts {
+		if name == "THREADSAFE" || strings.Contains(name, "MUTEX") {
+			if value != "" {
+				name += "=" + value
+			}
+			r.Options = append(r.Options, name)
+		}
+	}
+	sort.Strings(r.Options)
+	return r, nil
+}
+
+// CheckThreading reports the threading mode like Threading and, when
+// refuse is set, returns ErrUnsafeThreading (with the report) if the
+// build is single-threaded and db may use more than one connection:
+// call db.SetMaxOpenConns(1) first for such builds.
+func CheckThreading(ctx context.Context, db *sql.DB, refuse bool) (*ThreadingReport, error) {
+	r, err := Threading(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if refuse && r.Mode == SingleThread && r.MaxOpenConns != 1 {
+		return r, ErrUnsafeThreading
+	}
+	return r, nil
+}
@@ -0,0 +1,74 @@
+package sqlite3caps
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// DriverModule is the module path of the driver.
+const DriverModule = "github.com/gimpldo/go-sqlite3"
+
+// VersionInfo identifies the SQLite library and driver in use.
+type VersionInfo struct {
+	Library       string // e.g. "3.45.1"
+	LibraryNumber int    // e.g. 3045001
+	SourceID      string // check-in date and hash of the library sources
+	// Driver is the version of DriverModule the program was built
+	// with, "(devel)" for a replaced or local module, or "" when the
+	// build information is unavailable (e.g. in tests).
+	Driver string
+}
+
+func (v VersionInfo) String() string {
+	s := "SQLite " + v.Library
+	if v.Driver != "" {
+		s += ", " + DriverModule + " " + v.Driver
+	}
+	return s
+}
+
+// Version returns the versions of the SQLite library linked into the
+// program and of its driver; no database is needed.
+func Version() VersionInfo {
+	lib, num, src := sqlite3.Version()
+	v := VersionInfo{Library: lib, LibraryNumber: num, SourceID: src}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, m := range bi.Deps {
+			if m.Path != DriverModule {
+				continue
+			}
+			v.Driver = m.Version
+			if m.Replace != nil {
+				v.Driver = m.Replace.Version
+				if v.Driver == "" {
+					v.Driver = "(devel)"
+				}
+			}
+		}
+	}
+	return v
+}
+
+// ErrTooOld is returned (wrapped) by RequireAtLeast.
+var ErrTooOld = errors.New("sqlite3caps: SQLite library too old")
+
+// AtLeast reports whether the linked SQLite library is version min
+// ("3.35.0", or "3.35") or later.
+func AtLeast(min string) bool {
+	_, num, _ := sqlite3.Version()
+	return num >= versionNumber(min)
+}
+
+// RequireAtLeast returns an error, naming feature (e.g. "RETURNING"),
+// if the linked SQLite library is older than version min: for code
+// to fail fast with a clear message instead of a syntax error later.
+func RequireAtLeast(min, feature string) error {
+	if AtLeast(min) {
+		return nil
+	}
+	lib, _, _ := sqlite3.Version()
+	return fmt.Errorf("%w: %s needs SQLite %s or later, have %s", ErrTooOld, feature, min, lib)
+}
@@ -0,0 +1,109 @@
+package sqlite3conn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// OpenOrReadOnly opens dsn like Open, checking that the database can be
+// written; if it cannot because the file or its filesystem is read-only,
+// it opens it read-only instead (as with Config.ReadOnly) and reports
+// readOnly = true, so that services on read-only volumes can still serve
+// queries in a degraded mode.
+//
+// On a read-only filesystem, the database is also opened with
+// immutable=1 when that is safe, i.e. when no -wal file holds changes
+// the immutable mode would ignore: SQLite then skips locking and the
+// -shm file it could not create anyway.
+func OpenOrReadOnly(ctx context.Context, dsn string, c *Config) (db *sql.DB, readOnly bool, err error) {
+	if c == nil {
+		c = &Config{}
+	}
+	if !c.ReadOnly {
+		db, err := Open(dsn, c)
+		if err != nil {
+			return nil, false, err
+		}
+		err = checkWritable(ctx, db)
+		if err == nil {
+			return db, false, nil
+		}
+		db.Close()
+		if !isReadOnlyErr(err) {
+			return nil, false, err
+		}
+	}
+
+	ro := *c
+	ro.ReadOnly = true
+	ro.JournalMode = "" // changing it needs write access
+	roDSN := ReadOnlyDSN(dsn)
+	if path := dsnPath(dsn); path != "" && readOnlyFS(filepath.Dir(path)) && !walPending(path) {
+		roDSN += "&immutable=1"
+	}
+	db, err = Open(roDSN, &ro)
+	if err != nil {
+		return nil, false, err
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		db.Close()
+		return nil, false, fmt.Errorf("sqlite3conn: read-only open failed too: %w", err)
+	}
+	return db, true, nil
+}
+
+// checkWritable reads the schema and takes the write lock for a moment.
+func checkWritable(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var n int
+	if err := conn.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "ROLLBACK")
+	return err
+}
+
+// isReadOnlyErr reports whether err comes from a read-only database
+// file or filesystem (including the -shm file of a WAL database
+// that cannot be created).
+func isReadOnlyErr(err error) bool {
+	var se sqlite3.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	return se.Code == sqlite3.ErrReadonly || se.SystemErrno == syscall.EROFS ||
+		(se.Code == sqlite3.ErrCantOpen && se.SystemErrno == syscall.EACCES)
+}
+
+// readOnlyFS reports whether the filesystem of dir refuses writes
+// for being read-only (as opposed to permissions).
+func readOnlyFS(dir string) bool {
+	f, err := os.CreateTemp(dir, ".sqlite3conn-rofs-*")
+	if err == nil {
+		f.Close()
+		os.Remove(f.Name())
+		return false
+	}
+	return errors.Is(err, syscall.EROFS)
+}
+
+// walPending reports whether path has a non-empty -wal file.
+func walPending(path string) bool {
+	fi, err := os.Stat(path + "-wal")
+	return err == nil && fi.Size() > 0
+}
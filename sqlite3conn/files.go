@@ -0,0 +1,80 @@
+package sqlite3conn
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrWorldWritable is returned by Open when the database or its
+// directory is writable by everyone and FilePolicy.AllowWorldWritable
+// is not set: any local user could then replace the database or plant
+// a -journal or -wal file that SQLite would replay into it.
+var ErrWorldWritable = errors.New("sqlite3conn: world-writable database location")
+
+// FilePolicy hardens the files of a database; Open applies it to the
+// database file of the DSN before opening the pool.
+type FilePolicy struct {
+	// CreateDirs creates the missing parent directories with DirMode
+	// (0 means 0750).
+	CreateDirs bool
+	DirMode    os.FileMode
+
+	// FileMode, if not 0, is the permission of the database file,
+	// created empty with it if missing. SQLite creates -wal, -shm and
+	// -journal files with the permissions of the database file.
+	FileMode os.FileMode
+	// RestrictCompanions also applies FileMode to existing -wal,
+	// -shm and -journal files, left over with other permissions.
+	RestrictCompanions bool
+
+	// AllowWorldWritable accepts a world-writable directory or database
+	// file, e.g. for tests under /tmp.
+	AllowWorldWritable bool
+}
+
+// apply enforces the policy on the database file at path.
+func (p *FilePolicy) apply(path string) error {
+	dir := filepath.Dir(path)
+	if p.CreateDirs {
+		mode := p.DirMode
+		if mode == 0 {
+			mode = 0o750
+		}
+		if err := os.MkdirAll(dir, mode); err != nil {
+			return fmt.Errorf("sqlite3conn: %w", err)
+		}
+	}
+	if !p.AllowWorldWritable {
+		for _, name := range []string{dir, path} {
+			fi, err := os.Stat(name)
+			if err == nil && fi.Mode().Perm()&0o002 != 0 {
+				return fmt.Errorf("%w: %s (mode %v)", ErrWorldWritable, name, fi.Mode())
+			}
+		}
+	}
+	if p.FileMode == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, p.FileMode)
+	if err == nil {
+		f.Close()
+	} else if !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("sqlite3conn: %w", err)
+	}
+	// Chmod also when just created: the umask may have masked bits.
+	if err := os.Chmod(path, p.FileMode); err != nil {
+		return fmt.Errorf("sqlite3conn: %w", err)
+	}
+	if p.RestrictCompanions {
+		for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+			err := os.Chmod(path+suffix, p.FileMode)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("sqlite3conn: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package sqlite3conn
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// FootprintReport compares the per-connection memory settings of a
+// Config with those of a connection of its pool.
+type FootprintReport struct {
+	// ConfiguredCacheSize (0 if not configured) and CacheSize are
+	// 'PRAGMA cache_size' values: pages if positive, KiB if negative.
+	ConfiguredCacheSize int
+	CacheSize           int
+	// CacheKiB is the actual limit in KiB (with PageSize).
+	CacheKiB int
+	PageSize int
+}
+
+// Mismatch reports whether the actual cache size differs from the
+// configured one.
+func (r *FootprintReport) Mismatch() bool {
+	return r.ConfiguredCacheSize != 0 && r.ConfiguredCacheSize != r.CacheSize
+}
+
+func (r *FootprintReport) String() string {
+	s := fmt.Sprintf("cache_size %d (%d KiB of %d-byte pages)", r.CacheSize, r.CacheKiB, r.PageSize)
+	if r.ConfiguredCacheSize != 0 {
+		s += fmt.Sprintf(", configured %d", r.ConfiguredCacheSize)
+	}
+	return s
+}
+
+// Footprint returns the per-connection memory settings of a connection
+// of db compared with those configured in c (nil for none).
+func (c *Config) Footprint(ctx context.Context, db *sql.DB) (*FootprintReport, error) {
+	r := &FootprintReport{}
+	if c != nil {
+		switch {
+		case c.CachePages > 0:
+			r.ConfiguredCacheSize = c.CachePages
+		case c.CacheKiB > 0:
+			r.ConfiguredCacheSize = -c.CacheKiB
+		}
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.QueryRowContext(ctx, "PRAGMA cache_size").Scan(&r.CacheSize); err != nil {
+		return nil, err
+	}
+	if err := conn.QueryRowContext(ctx, "PRAGMA page_size").Scan(&r.PageSize); err != nil {
+		return nil, err
+	}
+	if r.CacheSize < 0 {
+		r.CacheKiB = -r.CacheSize
+	} else {
+		r.CacheKiB = r.CacheSize * r.PageSize / 1024
+	}
+	return r, nil
+}
@@ -0,0 +1,204 @@
+package sqlite3conn
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// ErrUnsupported is returned when the driver build lacks an API
+// an option needs.
+var ErrUnsupported = errors.New("sqlite3conn: not supported by this driver")
+
+// Unwrap returns the *sqlite3.SQLiteConn of a driver connection,
+// as given by sql.Conn.Raw: pools created by Open with
+// StatementTimeout wrap their connections.
+func Unwrap(driverConn interface{}) (*sqlite3.SQLiteConn, bool) {
+	switch c := driverConn.(type) {
+	case *sqlite3.SQLiteConn:
+		return c, true
+	case interface{ Unwrap() *sqlite3.SQLiteConn }:
+		return c.Unwrap(), true
+	}
+	return nil, false
+}
+
+// interruptConn gives each Exec and Query call (and its rows, until
+// closed) of a connection a context with the call's budget as deadline:
+// the driver interrupts the statement once it expires.
+type interruptConn struct {
+	*sqlite3.SQLiteConn
+	timeout time.Duration
+}
+
+func newInterruptConn(conn driver.Conn, timeout time.Duration) (driver.Conn, error) {
+	sc, ok := conn.(*sqlite3.SQLiteConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("sqlite3conn: unexpected driver connection %T", conn)
+	}
+	return &interruptConn{SQLiteConn: sc, timeout: timeout}, nil
+}
+
+func (c *interruptConn) Unwrap() *sqlite3.SQLiteConn { return c.SQLiteConn }
+
+// call is one Exec or Query call: ctx is the caller's context,
+// budget the one given to the driver.
+type call struct {
+	ctx    context.Context
+	budget context.Context
+	cancel context.CancelFunc
+}
+
+// watch starts a call with ctx; its cancel must be called once the
+// call (or its rows) is done.
+func (c *interruptConn) watch(ctx context.Context) *call {
+	d := c.timeout
+	if v, ok := ctx.Value(statementTimeoutKey{}).(time.Duration); ok {
+		d = v
+	}
+	if d <= 0 {
+		return &call{ctx: ctx, budget: ctx, cancel: func() {}}
+	}
+	budget, cancel := context.WithTimeout(ctx, d)
+	return &call{ctx: ctx, budget: budget, cancel: cancel}
+}
+
+// err returns the error of a call that failed: the caller's context
+// error if it was canceled, or ErrStatementTimeout if its budget was
+// spent.
+func (k *call) err(err error) error {
+	switch {
+	case err == nil || err == io.EOF:
+		return err
+	case k.ctx.Err() != nil:
+		return k.ctx.Err()
+	case k.budget.Err() != nil:
+		return fmt.Errorf("%w: %v", ErrStatementTimeout, err)
+	}
+	return err
+}
+
+func values(args []driver.NamedValue) ([]driver.Value, error) {
+	vals := make([]driver.Value, len(args))
+	for i, a := range args {
+		if a.Name != "" {
+			return nil, fmt.Errorf("sqlite3conn: named argument %q: %w", a.Name, ErrUnsupported)
+		}
+		vals[i] = a.Value
+	}
+	return vals, nil
+}
+
+func (c *interruptConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	k := c.watch(ctx)
+	defer k.cancel()
+	if ec, ok := interface{}(c.SQLiteConn).(driver.ExecerContext); ok {
+		r, err := ec.ExecContext(k.budget, query, args)
+		return r, k.err(err)
+	}
+	vals, err := values(args)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.SQLiteConn.Exec(query, vals)
+	return r, k.err(err)
+}
+
+func (c *interruptConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	k := c.watch(ctx)
+	var rows driver.Rows
+	var err error
+	if qc, ok := interface{}(c.SQLiteConn).(driver.QueryerContext); ok {
+		rows, err = qc.QueryContext(k.budget, query, args)
+	} else {
+		var vals []driver.Value
+		if vals, err = values(args); err == nil {
+			rows, err = c.SQLiteConn.Query(query, vals)
+		}
+	}
+	if err != nil {
+		k.cancel()
+		return nil, k.err(err)
+	}
+	return &interruptRows{Rows: rows, k: k}, nil
+}
+
+func (c *interruptConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var st driver.Stmt
+	var err error
+	if pc, ok := interface{}(c.SQLiteConn).(driver.ConnPrepareContext); ok {
+		st, err = pc.PrepareContext(ctx, query)
+	} else {
+		st, err = c.SQLiteConn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &interruptStmt{Stmt: st, c: c}, nil
+}
+
+func (c *interruptConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// interruptRows ends the call of its query when closed.
+type interruptRows struct {
+	driver.Rows
+	k *call
+}
+
+func (r *interruptRows) Next(dest []driver.Value) error {
+	return r.k.err(r.Rows.Next(dest))
+}
+
+func (r *interruptRows) Close() error {
+	err := r.Rows.Close()
+	r.k.cancel()
+	return err
+}
+
+// interruptStmt gives prepared statement executions their budget.
+type interruptStmt struct {
+	driver.Stmt
+	c *interruptConn
+}
+
+func (s *interruptStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	k := s.c.watch(ctx)
+	defer k.cancel()
+	if ec, ok := s.Stmt.(driver.StmtExecContext); ok {
+		r, err := ec.ExecContext(k.budget, args)
+		return r, k.err(err)
+	}
+	vals, err := values(args)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.Stmt.Exec(vals)
+	return r, k.err(err)
+}
+
+func (s *interruptStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	k := s.c.watch(ctx)
+	var rows driver.Rows
+	var err error
+	if qc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = qc.QueryContext(k.budget, args)
+	} else {
+		var vals []driver.Value
+		if vals, err = values(args); err == nil {
+			rows, err = s.Stmt.Query(vals)
+		}
+	}
+	if err != nil {
+		k.cancel()
+		return nil, k.err(err)
+	}
+	return &interruptRows{Rows: rows, k: k}, nil
+}
@@ -0,0 +1,107 @@
+package sqlite3conn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// ErrWrongKey is returned when a keyed connection cannot read the schema,
+// which is how SQLCipher and SEE report a wrong (or missing) key.
+var ErrWrongKey = errors.New("sqlite3conn: cannot decrypt database (wrong key, or not encrypted with this key)")
+
+// ErrKeyConflict is returned when both Key and HexKey are set.
+var ErrKeyConflict = errors.New("sqlite3conn: Key and HexKey are mutually exclusive")
+
+var validHexKey = regexp.MustCompile(`^([0-9A-Fa-f]{2})+$`)
+
+// quoteLiteral returns s as an SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// keyStatement returns the PRAGMA setting the encryption key,
+// or "" when no key is configured.
+// Only meaningful with SQLite builds that support encryption
+// (SQLCipher, SEE); plain SQLite silently ignores the PRAGMA,
+// so the database is then simply not encrypted.
+func (c *Config) keyStatement() (string, error) {
+	switch {
+	case c.Key != "" && c.HexKey != "":
+		return "", ErrKeyConflict
+	case c.Key != "":
+		return "PRAGMA key = " + quoteLiteral(c.Key), nil
+	case c.HexKey != "":
+		if !validHexKey.MatchString(c.HexKey) {
+			return "", errors.New("sqlite3conn: HexKey is not an even-length hex string")
+		}
+		return "PRAGMA hexkey = " + quoteLiteral(c.HexKey), nil
+	}
+	return "", nil
+}
+
+// applyKey must run before any other statement on the connection:
+// the key has to be set before SQLite reads the first page.
+// Errors never include the key itself.
+func (c *Config) applyKey(conn *sqlite3.SQLiteConn) error {
+	stmt, err := c.keyStatement()
+	if err != nil || stmt == "" {
+		return err
+	}
+	if _, err := conn.Exec(stmt, nil); err != nil {
+		return errors.New("sqlite3conn: setting the encryption key failed")
+	}
+
+	// The key is only checked when the database is first read.
+	rows, err := conn.Query("SELECT count(*) FROM sqlite_master", nil)
+	if err != nil {
+		if isNotADB(err) {
+			return ErrWrongKey
+		}
+		return fmt.Errorf("sqlite3conn: verifying the encryption key: %w", err)
+	}
+	return rows.Close()
+}
+
+func isNotADB(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrNotADB
+}
+
+// Rekey changes the encryption key of the database behind db
+// ('PRAGMA rekey'), using one connection of the pool.
+//
+// Other connections already open in the pool keep working (the key only
+// matters when pages are read from the file), but new connections use
+// the Config they were opened with: update Config.Key (or rebuild
+// the pool) right after a successful Rekey.
+func Rekey(ctx context.Context, db *sql.DB, newKey string) error {
+	return rekey(ctx, db, "PRAGMA rekey = "+quoteLiteral(newKey))
+}
+
+// RekeyHex is Rekey with the new key given as a hex string
+// ('PRAGMA hexrekey').
+func RekeyHex(ctx context.Context, db *sql.DB, newHexKey string) error {
+	if !validHexKey.MatchString(newHexKey) {
+		return errors.New("sqlite3conn: new key is not an even-length hex string")
+	}
+	return rekey(ctx, db, "PRAGMA hexrekey = "+quoteLiteral(newHexKey))
+}
+
+func rekey(ctx context.Context, db *sql.DB, stmt string) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, stmt); err != nil {
+		return errors.New("sqlite3conn: rekey failed")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+//go:build linux
+
+package sqlite3conn
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockHolders finds the POSIX locks on the database and -shm files
+// in /proc/locks, which lists "<id>: POSIX ADVISORY <READ|WRITE> <pid>
+// <major>:<minor>:<inode> <start> <end|EOF>" lines (and "->" lines
+// for waiters, skipped).
+func lockHolders(path string) []LockHolder {
+	type fileID struct {
+		name string
+		dev  uint64
+		ino  uint64
+		shm  bool
+	}
+	var files []fileID
+	for _, f := range []struct {
+		name string
+		shm  bool
+	}{{path, false}, {path + "-shm", true}} {
+		var st syscall.Stat_t
+		if syscall.Stat(f.name, &st) == nil {
+			files = append(files, fileID{f.name, uint64(st.Dev), uint64(st.Ino), f.shm})
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	lf, err := os.Open("/proc/locks")
+	if err != nil {
+		return nil
+	}
+	defer lf.Close()
+
+	var holders []LockHolder
+	sc := bufio.NewScanner(lf)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 8 || fields[1] == "->" || fields[1] != "POSIX" && fields[1] != "OFDLCK" {
+			continue
+		}
+		id := strings.Split(fields[5], ":")
+		if len(id) != 3 {
+			continue
+		}
+		major, err1 := strconv.ParseUint(id[0], 16, 32)
+		minor, err2 := strconv.ParseUint(id[1], 16, 32)
+		ino, err3 := strconv.ParseUint(id[2], 10, 64)
+		pid, err4 := strconv.Atoi(fields[4])
+		start, err5 := strconv.ParseInt(fields[6], 10, 64)
+		end := int64(math.MaxInt64)
+		if fields[7] != "EOF" {
+			end, _ = strconv.ParseInt(fields[7], 10, 64)
+		}
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
+			continue
+		}
+		for _, f := range files {
+			if f.ino != ino || devMajor(f.dev) != major || devMinor(f.dev) != minor {
+				continue
+			}
+			h := LockHolder{
+				PID:   pid,
+				File:  f.name,
+				Lock:  sqliteLockName(f.shm, start, end, fields[3] == "WRITE"),
+				Write: fields[3] == "WRITE",
+				Self:  pid == os.Getpid(),
+			}
+			if comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+				h.Command = strings.TrimSpace(string(comm))
+			}
+			holders = append(holders, h)
+		}
+	}
+	return holders
+}
+
+// devMajor and devMinor decode a Linux dev_t (see <sys/sysmacros.h>).
+func devMajor(dev uint64) uint64 {
+	return (dev>>8)&0xfff | (dev>>32)&^0xfff
+}
+
+func devMinor(dev uint64) uint64 {
+	return dev&0xff | (dev>>12)&^0xff
+}
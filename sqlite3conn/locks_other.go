@@ -0,0 +1,8 @@
+//go:build !linux
+
+package sqlite3conn
+
+// lockHolders is only implemented on Linux.
+func lockHolders(path string) []LockHolder {
+	return nil
+}
@@ -0,0 +1,51 @@
+package sqlite3conn
+
+import (
+	"strings"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3authz"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3probe"
+)
+
+// readOnlyPolicy denies everything that could modify a database file,
+// plus ATTACH (which could bring in a writable one).
+var readOnlyPolicy = func() *sqlite3authz.Compiled {
+	p := sqlite3authz.NewPolicy(sqlite3authz.Allow)
+	p.Deny(sqlite3authz.WriteActions...)
+	p.Deny(sqlite3authz.Attach)
+	return sqlite3authz.CompileUnchecked(p)
+}()
+
+// applyReadOnly enforces Config.ReadOnly on one connection.
+// It installs an authorizer, replacing any other one: combine
+// ReadOnly with your own authorizer policy by denying
+// sqlite3authz.WriteActions in that policy instead.
+func applyReadOnly(conn *sqlite3.SQLiteConn) error {
+	if _, err := conn.Exec("PRAGMA query_only = ON", nil); err != nil {
+		return err
+	}
+	readOnlyPolicy.Install(conn)
+	return nil
+}
+
+// ReadOnlyDSN turns a filename or URI filename into a URI filename
+// with mode=ro (replacing any other mode).
+func ReadOnlyDSN(dsn string) string {
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = sqlite3probe.FileURI(dsn)
+	}
+	base, query := dsn, ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		base, query = dsn[:i], dsn[i+1:]
+	}
+	var params []string
+	for _, p := range strings.Split(query, "&") {
+		if p != "" && !strings.HasPrefix(p, "mode=") {
+			params = append(params, p)
+		}
+	}
+	params = append(params, "mode=ro")
+	return base + "?" + strings.Join(params, "&")
+}
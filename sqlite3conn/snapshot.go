@@ -0,0 +1,156 @@
+package sqlite3conn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SnapshotHandle is a driver's sqlite3_snapshot.
+type SnapshotHandle interface {
+	// Free releases the handle (sqlite3_snapshot_free).
+	Free()
+}
+
+// SnapshotConn is implemented by driver connections exposing
+// the sqlite3_snapshot API (SQLite built with SQLITE_ENABLE_SNAPSHOT).
+type SnapshotConn interface {
+	// SnapshotGet records the snapshot of the read transaction open
+	// on schema (sqlite3_snapshot_get).
+	SnapshotGet(schema string) (SnapshotHandle, error)
+	// SnapshotOpen makes the read transaction about to start
+	// on schema read at s (sqlite3_snapshot_open).
+	SnapshotOpen(schema string, s SnapshotHandle) error
+}
+
+// ErrSnapshotClosed is returned by ReadAtSnapshot for a closed Snapshot.
+var ErrSnapshotClosed = errors.New("sqlite3conn: snapshot closed")
+
+// Snapshot pins a state of a WAL database that several read
+// transactions, on different connections, can read at: a consistent
+// view across the queries of a report, while writes continue.
+//
+// The connection it was taken on keeps its read transaction open
+// until Close, so that checkpoints cannot overwrite the pages the
+// snapshot needs; the WAL grows meanwhile, so close it promptly.
+type Snapshot struct {
+	mu     sync.Mutex
+	conn   *sql.Conn
+	handle SnapshotHandle
+}
+
+// snapshotConn returns the SnapshotConn of a driver connection.
+func snapshotConn(driverConn interface{}) (SnapshotConn, error) {
+	sc, ok := Unwrap(driverConn)
+	if !ok {
+		return nil, fmt.Errorf("sqlite3conn: unexpected driver connection %T", driverConn)
+	}
+	s, ok := interface{}(sc).(SnapshotConn)
+	if !ok {
+		return nil, fmt.Errorf("%w: no sqlite3_snapshot API", ErrUnsupported)
+	}
+	return s, nil
+}
+
+// OpenSnapshot takes a snapshot of the current state of the "main"
+// database of db, which must be in WAL mode.
+func OpenSnapshot(ctx context.Context, db *sql.DB) (*Snapshot, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{conn: conn}
+	if err := s.open(ctx); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Snapshot) open(ctx context.Context) error {
+	if _, err := s.conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return err
+	}
+	// sqlite3_snapshot_get needs the read transaction to have started.
+	var n int
+	if err := s.conn.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		return err
+	}
+	return s.conn.Raw(func(dc interface{}) error {
+		sc, err := snapshotConn(dc)
+		if err != nil {
+			return err
+		}
+		s.handle, err = sc.SnapshotGet("main")
+		if err != nil {
+			return fmt.Errorf("sqlite3conn: snapshot: %w", err)
+		}
+		return nil
+	})
+}
+
+// ReadAtSnapshot runs fn in a read transaction on a connection of db
+// (a pool on the same database file as the one of the snapshot)
+// reading at snapshot s. fn must not begin or end transactions on
+// conn; the read transaction is ended after fn returns.
+func ReadAtSnapshot(ctx context.Context, db *sql.DB, s *Snapshot, fn func(conn *sql.Conn) error) error {
+	s.mu.Lock()
+	handle := s.handle
+	s.mu.Unlock()
+	if handle == nil {
+		return ErrSnapshotClosed
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "ROLLBACK")
+
+	err = conn.Raw(func(dc interface{}) error {
+		sc, err := snapshotConn(dc)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.handle == nil {
+			return ErrSnapshotClosed
+		}
+		if err := sc.SnapshotOpen("main", s.handle); err != nil {
+			return fmt.Errorf("sqlite3conn: snapshot: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// Close releases the snapshot and the read transaction holding it.
+// Reads in progress are not affected.
+func (s *Snapshot) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	if s.handle != nil {
+		s.handle.Free()
+		s.handle = nil
+	}
+	_, err := s.conn.ExecContext(context.Background(), "ROLLBACK")
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,157 @@
+package sqlite3conn
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// TokenTable is the table holding the commit counter of Split.
+const TokenTable = "sqlite3_rw_token"
+
+// Token identifies the state of the database after a write made
+// through Split.Write; it is a plain counter, easy to carry between
+// requests (e.g. in a session or a cookie).
+type Token int64
+
+// Split routes writes to a single-connection writer pool and reads to
+// a reader pool, with opt-in read-your-writes: Write returns a Token,
+// and a Read given that token reads data at least that recent.
+//
+// The reader pool may lag behind the writer: a read-only pool on the
+// same WAL database sees each commit at once, but a replica (such as
+// a sqlite3ship.Replica pool) only after it synced. Reads on a reader
+// that has not caught up wait up to MaxWait, then go to the writer.
+type Split struct {
+	Writer *sql.DB
+	Reader *sql.DB
+
+	// MaxWait is how long a Read waits for the reader to reach its
+	// token before using the writer; 0 uses the writer at once.
+	MaxWait time.Duration
+	// Poll is the interval between checks while waiting;
+	// 0 means 10ms.
+	Poll time.Duration
+}
+
+// OpenSplit opens a Split on dsn: the writer pool with c and a single
+// connection, the reader pool with c made ReadOnly and up to readers
+// connections (0 keeps c.MaxOpenConns). It creates TokenTable if needed.
+func OpenSplit(ctx context.Context, dsn string, c *Config, readers int) (*Split, error) {
+	if c == nil {
+		c = &Config{}
+	}
+	wc, rc := *c, *c
+	wc.MaxOpenConns, wc.MaxIdleConns = 1, 1
+	rc.ReadOnly = true
+	if readers > 0 {
+		rc.MaxOpenConns = readers
+	}
+	w, err := Open(dsn, &wc)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Open(dsn, &rc)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	s := &Split{Writer: w, Reader: r}
+	if err := s.Init(ctx); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Init creates TokenTable on the writer if needed.
+func (s *Split) Init(ctx context.Context) error {
+	_, err := s.Writer.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+TokenTable+` (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	n INTEGER NOT NULL
+);
+INSERT OR IGNORE INTO `+TokenTable+` (id, n) VALUES (1, 0)`)
+	return err
+}
+
+// Write runs fn in a transaction on the writer, commits it together
+// with an increment of the commit counter, and returns the Token
+// of the new state.
+func (s *Split) Write(ctx context.Context, fn func(*sql.Tx) error) (Token, error) {
+	tx, err := s.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE "+TokenTable+" SET n = n + 1 WHERE id = 1"); err != nil {
+		return 0, err
+	}
+	var n int64
+	if err := tx.QueryRowContext(ctx, "SELECT n FROM "+TokenTable+" WHERE id = 1").Scan(&n); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return Token(n), nil
+}
+
+// Read runs fn in a transaction seeing at least the writes
+// up to tok (0 for no requirement): on the reader if it has caught up
+// (or does within MaxWait), else on the writer.
+func (s *Split) Read(ctx context.Context, tok Token, fn func(*sql.Tx) error) error {
+	poll := s.Poll
+	if poll <= 0 {
+		poll = 10 * time.Millisecond
+	}
+	deadline := time.Now().Add(s.MaxWait)
+	for {
+		tx, err := s.Reader.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if tok <= 0 || readerToken(ctx, tx) >= tok {
+			err := fn(tx)
+			tx.Rollback()
+			return err
+		}
+		tx.Rollback()
+		if !time.Now().Add(poll).Before(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(poll):
+		}
+	}
+
+	tx, err := s.Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// readerToken returns the commit counter seen by tx, 0 if unknown
+// (e.g. a replica that does not have TokenTable yet).
+func readerToken(ctx context.Context, tx *sql.Tx) Token {
+	var n int64
+	if err := tx.QueryRowContext(ctx, "SELECT n FROM "+TokenTable+" WHERE id = 1").Scan(&n); err != nil {
+		return 0
+	}
+	return Token(n)
+}
+
+// Close closes both pools.
+func (s *Split) Close() error {
+	err := s.Reader.Close()
+	if werr := s.Writer.Close(); err == nil {
+		err = werr
+	}
+	return err
+}
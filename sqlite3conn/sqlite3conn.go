@@ -0,0 +1,187 @@
+// Package sqlite3conn holds the standard per-connection configuration
+// used by the other packages of this repository: the PRAGMAs every new
+// connection gets, the optional trace setup, and the pool limits.
+//
+// The configuration is applied from the driver's ConnectHook, so it holds
+// for every connection database/sql opens, not just the first one.
+//
+// Canceling the context of an Exec or Query call needs no configuration:
+// the driver interrupts (sqlite3_interrupt) the statement, also while
+// its rows are read, and the call fails with the context's error.
+package sqlite3conn
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// Config is the standard connection configuration.
+// The zero value leaves every SQLite default untouched.
+type Config struct {
+	// Key (passphrase) or HexKey (raw key, hex encoded) set the encryption
+	// key for SQLite builds with encryption support (SQLCipher, SEE).
+	// The key is applied before any other statement and checked by reading
+	// the schema; a wrong key gives ErrWrongKey. Never both.
+	Key    string
+	HexKey string
+
+	// JournalMode is the argument of 'PRAGMA journal_mode', e.g. "WAL".
+	JournalMode string
+	// Synchronous is the argument of 'PRAGMA synchronous', e.g. "NORMAL".
+	Synchronous string
+	// BusyTimeout sets 'PRAGMA busy_timeout' (millisecond resolution).
+	BusyTimeout time.Duration
+	// ForeignKeys turns on 'PRAGMA foreign_keys'.
+	ForeignKeys bool
+	// CachePages or CacheKiB sets 'PRAGMA cache_size', the page cache
+	// limit of each connection, in pages or in KiB. Never both.
+	CachePages int
+	CacheKiB   int
+	// Pragmas are extra statements executed, in order, after the above
+	// (e.g. "PRAGMA temp_store = MEMORY").
+	Pragmas []string
+
+	// ReadOnly makes every connection of the pool unable to modify
+	// the database, three ways at once: Open adds mode=ro to the DSN
+	// (with Register, pass ReadOnlyDSN(dsn) to sql.Open yourself),
+	// 'PRAGMA query_only' is set, and an authorizer denies all writes
+	// and ATTACH. Meant for analytics/reporting pools.
+	ReadOnly bool
+
+	// Trace, if not nil, is passed to SetTrace on every connection.
+	Trace *sqlite3.TraceConfig
+
+	// ConnectHook, if not nil, runs last, after everything above.
+	ConnectHook func(*sqlite3.SQLiteConn) error
+
+	// StatementTimeout, if positive, is the budget of every Exec and
+	// Query call (including the reading of its rows) of pools created
+	// by Open, whether or not the caller's context has a deadline:
+	// the call's context is given the budget as deadline, so the driver
+	// interrupts statements still running past it, and the call fails
+	// with ErrStatementTimeout. Override it per call with
+	// WithStatementTimeout. Use Unwrap in sql.Conn.Raw callbacks.
+	StatementTimeout time.Duration
+
+	// Files, if not nil, is applied by Open to the database file
+	// (not to in-memory databases) before creating the pool.
+	Files *FilePolicy
+
+	// MaxOpenConns and MaxIdleConns are applied to pools created by Open
+	// (0 keeps the database/sql defaults).
+	MaxOpenConns int
+	MaxIdleConns int
+}
+
+// Statements returns the SQL executed on every new connection, in order.
+// The encryption key statement is deliberately not included.
+func (c *Config) Statements() []string {
+	var stmts []string
+	if c.JournalMode != "" {
+		stmts = append(stmts, "PRAGMA journal_mode = "+c.JournalMode)
+	}
+	if c.Synchronous != "" {
+		stmts = append(stmts, "PRAGMA synchronous = "+c.Synchronous)
+	}
+	if c.BusyTimeout > 0 {
+		stmts = append(stmts, fmt.Sprintf("PRAGMA busy_timeout = %d",
+			c.BusyTimeout/time.Millisecond))
+	}
+	if c.ForeignKeys {
+		stmts = append(stmts, "PRAGMA foreign_keys = ON")
+	}
+	if c.CachePages > 0 {
+		stmts = append(stmts, fmt.Sprintf("PRAGMA cache_size = %d", c.CachePages))
+	} else if c.CacheKiB > 0 {
+		stmts = append(stmts, fmt.Sprintf("PRAGMA cache_size = -%d", c.CacheKiB))
+	}
+	return append(stmts, c.Pragmas...)
+}
+
+// Apply configures a single, freshly opened connection.
+func (c *Config) Apply(conn *sqlite3.SQLiteConn) error {
+	if err := c.applyKey(conn); err != nil {
+		return err
+	}
+	for _, s := range c.Statements() {
+		if _, err := conn.Exec(s, nil); err != nil {
+			return fmt.Errorf("sqlite3conn: %q: %w", s, err)
+		}
+	}
+	if c.ReadOnly {
+		if err := applyReadOnly(conn); err != nil {
+			return fmt.Errorf("sqlite3conn: read-only mode: %w", err)
+		}
+	}
+	if c.Trace != nil {
+		if err := conn.SetTrace(c.Trace); err != nil {
+			return fmt.Errorf("sqlite3conn: SetTrace: %w", err)
+		}
+	}
+	if c.ConnectHook != nil {
+		return c.ConnectHook(conn)
+	}
+	return nil
+}
+
+// Driver returns a driver whose ConnectHook applies c.
+func (c *Config) Driver() *sqlite3.SQLiteDriver {
+	return &sqlite3.SQLiteDriver{ConnectHook: c.Apply}
+}
+
+// Register makes c available to sql.Open under the given driver name.
+// Like sql.Register, it panics if the name is already taken.
+func Register(driverName string, c *Config) {
+	sql.Register(driverName, c.Driver())
+}
+
+// connector lets Open create pools without registering a driver name
+// (important when many databases each get their own Config).
+type connector struct {
+	drv     *sqlite3.SQLiteDriver
+	dsn     string
+	timeout time.Duration
+}
+
+func (cn connector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := cn.drv.Open(cn.dsn)
+	if err != nil || cn.timeout <= 0 {
+		return conn, err
+	}
+	return newInterruptConn(conn, cn.timeout)
+}
+
+func (cn connector) Driver() driver.Driver {
+	return cn.drv
+}
+
+// Open returns a pool for dsn whose connections are configured by c
+// (nil means the zero Config). Like sql.Open it does not connect yet;
+// call Ping to find out whether the configuration actually works.
+// Only c.Files is checked right away.
+func Open(dsn string, c *Config) (*sql.DB, error) {
+	if c == nil {
+		c = &Config{}
+	}
+	if path := dsnPath(dsn); c.Files != nil && path != "" {
+		if err := c.Files.apply(path); err != nil {
+			return nil, err
+		}
+	}
+	if c.ReadOnly {
+		dsn = ReadOnlyDSN(dsn)
+	}
+	db := sql.OpenDB(connector{drv: c.Driver(), dsn: dsn, timeout: c.StatementTimeout})
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	return db, nil
+}
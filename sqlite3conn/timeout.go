@@ -0,0 +1,21 @@
+package sqlite3conn
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrStatementTimeout is returned (wrapped) for a call whose
+// statement ran past its StatementTimeout budget.
+var ErrStatementTimeout = errors.New("sqlite3conn: statement timeout")
+
+type statementTimeoutKey struct{}
+
+// WithStatementTimeout returns a context giving the calls made with it
+// a budget of d instead of Config.StatementTimeout (0 for none), for
+// the few queries known to be long, or to be tighter than the default.
+// It has no effect on pools without StatementTimeout.
+func WithStatementTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, statementTimeoutKey{}, d)
+}
@@ -0,0 +1,208 @@
+package sqlite3conn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3probe"
+)
+
+// WaitOptions configure OpenWait.
+type WaitOptions struct {
+	// Config of the pool; nil means the zero Config.
+	Config *Config
+	// Interval is the first delay between attempts, doubled after each
+	// one up to 2 seconds; 0 means 50 milliseconds.
+	Interval time.Duration
+}
+
+// LockHolder is a process holding a POSIX lock on the database
+// or its -shm file (only found on Linux, through /proc/locks).
+type LockHolder struct {
+	PID     int
+	Command string // from /proc/<pid>/comm; "" if unknown
+	File    string // the locked file
+	Lock    string // what SQLite uses the locked bytes for, e.g. "RESERVED"
+	Write   bool   // exclusive (write) lock, as opposed to shared (read)
+	Self    bool   // this process
+}
+
+func (h LockHolder) String() string {
+	kind := "read"
+	if h.Write {
+		kind = "write"
+	}
+	who := fmt.Sprintf("process %d", h.PID)
+	if h.Command != "" {
+		who += " (" + h.Command + ")"
+	}
+	if h.Self {
+		who += " (this process)"
+	}
+	return fmt.Sprintf("%s holds a %s lock (%s) on %s", who, kind, h.Lock, h.File)
+}
+
+// OpenError is returned by OpenWait when the database stayed
+// unavailable until the deadline; it says what seems to hold it.
+type OpenError struct {
+	Path     string
+	Attempts int
+	Waited   time.Duration
+	Err      error // from the last attempt
+
+	Probe   *sqlite3probe.Result // the database file and its companions; nil if not probed
+	Holders []LockHolder
+}
+
+func (e *OpenError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "sqlite3conn: %s still unavailable after %d attempts in %v: %v",
+		e.Path, e.Attempts, e.Waited.Round(time.Millisecond), e.Err)
+	for _, h := range e.Holders {
+		b.WriteString("; " + h.String())
+	}
+	if p := e.Probe; p != nil {
+		switch {
+		case p.JournalPresent:
+			b.WriteString("; a rollback journal is present: a writer is in a transaction" +
+				" or crashed in one (recovery needs write access to the directory)")
+		case p.WALPresent && !p.SHMPresent:
+			b.WriteString("; a -wal file without -shm: the last writer did not close cleanly")
+		case p.WALPresent:
+			fmt.Fprintf(&b, "; WAL mode, -wal is %d bytes", p.WALBytes)
+		}
+	}
+	if len(e.Holders) == 0 && e.Probe != nil && !e.Probe.JournalPresent {
+		b.WriteString("; no lock holder found: another host (network filesystem)" +
+			" or a long-running transaction in another process may be holding it")
+	}
+	return b.String()
+}
+
+func (e *OpenError) Unwrap() error { return e.Err }
+
+// retryable reports whether err means the database is temporarily
+// unavailable: locked by another connection, or being recovered.
+func retryable(err error) bool {
+	var se sqlite3.Error
+	if errors.As(err, &se) {
+		return se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// OpenWait is Open followed by a read of the schema, retried while
+// the database is locked by another process or in recovery, until ctx
+// is done. On timeout it returns an *OpenError telling what holds the
+// database. Other errors are returned at once.
+func OpenWait(ctx context.Context, dsn string, opts *WaitOptions) (*sql.DB, error) {
+	if opts == nil {
+		opts = &WaitOptions{}
+	}
+	delay := opts.Interval
+	if delay <= 0 {
+		delay = 50 * time.Millisecond
+	}
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		db, err := Open(dsn, opts.Config)
+		if err == nil {
+			var n int
+			err = db.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").Scan(&n)
+			if err == nil {
+				return db, nil
+			}
+			db.Close()
+		}
+		if !retryable(err) {
+			return nil, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, diagnose(dsn, attempt, time.Since(start), err)
+		case <-timer.C:
+		}
+		if delay *= 2; delay > 2*time.Second {
+			delay = 2 * time.Second
+		}
+	}
+}
+
+func diagnose(dsn string, attempts int, waited time.Duration, err error) *OpenError {
+	e := &OpenError{Path: dsnPath(dsn), Attempts: attempts, Waited: waited, Err: err}
+	if e.Path == "" {
+		return e
+	}
+	if p, perr := sqlite3probe.Probe(e.Path); perr == nil {
+		e.Probe = p
+	}
+	e.Holders = lockHolders(e.Path)
+	return e
+}
+
+// dsnPath returns the file name of a filename or URI DSN,
+// or "" for in-memory databases.
+func dsnPath(dsn string) string {
+	path, query := dsn, ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		path, query = dsn[:i], dsn[i+1:]
+	}
+	if strings.HasPrefix(path, "file:") {
+		path = strings.TrimPrefix(path, "file:")
+		if strings.HasPrefix(path, "//") { // file://host/path: only "" and localhost are valid
+			path = path[strings.IndexByte(path[2:]+"/", '/')+2:]
+		}
+		if p, err := url.PathUnescape(path); err == nil {
+			path = p
+		}
+	}
+	if path == "" || path == ":memory:" || strings.Contains(query, "mode=memory") {
+		return ""
+	}
+	return path
+}
+
+// sqliteLockName names the lock SQLite takes on bytes start to end
+// (inclusive) of the database file (see os_unix.c) or of the -shm file.
+// The kernel merges adjacent locks of a process, so a range may cover
+// several of them; the strongest is named.
+func sqliteLockName(shm bool, start, end int64, write bool) string {
+	const pendingByte = 0x40000000
+	const reservedByte, sharedFirst = pendingByte + 1, pendingByte + 2
+	in := func(b int64) bool { return start <= b && b <= end }
+	if shm {
+		switch {
+		case in(120):
+			return "WAL write"
+		case in(121):
+			return "WAL checkpoint"
+		case in(122):
+			return "WAL recovery"
+		case start >= 123 && start < 128:
+			return "WAL read"
+		case in(128):
+			return "WAL dead-man switch"
+		}
+		return "shm"
+	}
+	switch {
+	case write && in(sharedFirst):
+		return "EXCLUSIVE"
+	case in(pendingByte):
+		return "PENDING"
+	case in(reservedByte):
+		return "RESERVED"
+	case in(sharedFirst):
+		return "SHARED"
+	}
+	return "unknown"
+}
@@ -0,0 +1,64 @@
+//go:build linux
+
+package sqlite3env
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mountOf returns the mount point and filesystem type of dir,
+// from /proc/self/mountinfo: the longest mount point containing dir.
+func mountOf(dir string) (mountPoint, fsType string) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// "36 35 98:0 /root /mnt rw,noatime master:1 - ext3 /dev/root rw"
+		line := sc.Text()
+		sep := strings.Index(line, " - ")
+		if sep < 0 {
+			continue
+		}
+		fields, after := strings.Fields(line[:sep]), strings.Fields(line[sep+3:])
+		if len(fields) < 5 || len(after) < 1 {
+			continue
+		}
+		mp := unescapeMount(fields[4])
+		if !within(dir, mp) || len(mp) < len(mountPoint) {
+			continue
+		}
+		mountPoint, fsType = mp, after[0]
+	}
+	return mountPoint, fsType
+}
+
+func within(dir, mp string) bool {
+	return mp == "/" || dir == mp || strings.HasPrefix(dir, mp+"/")
+}
+
+// unescapeMount decodes the octal escapes (\040 for space...)
+// of mountinfo paths.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
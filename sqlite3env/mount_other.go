@@ -0,0 +1,8 @@
+//go:build !linux
+
+package sqlite3env
+
+// mountOf is only implemented on Linux.
+func mountOf(dir string) (mountPoint, fsType string) {
+	return "", ""
+}
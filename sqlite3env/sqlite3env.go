@@ -0,0 +1,200 @@
+// Package sqlite3env inspects where a database lives for setups known
+// to corrupt SQLite databases or to defeat its locking: network
+// filesystems, WAL mode without shared memory, replication layers that
+// have their own rules, mixed journal modes. See "How To Corrupt An
+// SQLite Database File" (https://www.sqlite.org/howtocorrupt.html).
+package sqlite3env
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3probe"
+)
+
+// Severity grades a Warning.
+type Severity int
+
+const (
+	Info     Severity = iota // worth knowing, not a problem by itself
+	Warn                     // works, with caveats that can bite
+	Critical                 // known to corrupt databases or break locking
+)
+
+var severityNames = map[Severity]string{
+	Info:     "info",
+	Warn:     "warning",
+	Critical: "critical",
+}
+
+func (s Severity) String() string {
+	if n, ok := severityNames[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Warning codes.
+const (
+	CodeNetworkFS   = "network-fs"   // the database is on a network filesystem
+	CodeWALNetwork  = "wal-network"  // WAL mode on a network filesystem
+	CodeSharedFS    = "shared-fs"    // a host directory shared into a VM or container
+	CodeOverlayFS   = "overlay-fs"   // a container overlay filesystem
+	CodeTmpFS       = "tmpfs"        // memory-backed filesystem
+	CodeLiteFS      = "litefs"       // the database is managed by LiteFS
+	CodeLitestream  = "litestream"   // Litestream replicates the database
+	CodeMmap        = "mmap"         // memory-mapped I/O is unreliable or limited here
+	CodeJournalMix  = "journal-mix"  // companion files of both journal modes
+	CodeHotJournal  = "hot-journal"  // a rollback journal awaits recovery
+	CodeUnreadable  = "unreadable"   // the file is not a usable database
+	CodeNoDirectory = "no-directory" // the directory does not exist
+)
+
+// Warning is one hazard found by Check.
+type Warning struct {
+	Code     string
+	Severity Severity
+	Message  string
+}
+
+func (w Warning) String() string {
+	return w.Severity.String() + ": " + w.Code + ": " + w.Message
+}
+
+// Report is the result of Check.
+type Report struct {
+	Path       string
+	MountPoint string // "" when unknown (not Linux)
+	FSType     string // as in /proc/self/mountinfo, e.g. "ext4", "nfs4", "fuse.litefs"
+	Probe      *sqlite3probe.Result
+	Warnings   []Warning
+}
+
+// Worst returns the highest severity among the warnings (Info if none).
+func (r *Report) Worst() Severity {
+	worst := Info
+	for _, w := range r.Warnings {
+		if w.Severity > worst {
+			worst = w.Severity
+		}
+	}
+	return worst
+}
+
+func (r *Report) add(code string, sev Severity, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, Warning{Code: code, Severity: sev, Message: fmt.Sprintf(format, args...)})
+}
+
+// networkFS are filesystem types whose locking SQLite cannot rely on.
+var networkFS = map[string]bool{
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "smbfs": true,
+	"9p": true, "afs": true, "ceph": true, "glusterfs": true, "lustre": true,
+	"gpfs": true, "fuse.sshfs": true, "fuse.glusterfs": true, "fuse.s3fs": true,
+	"fuse.rclone": true, "fuse.gcsfuse": true, "fuse.juicefs": true,
+}
+
+// sharedFS are filesystems sharing host directories with VMs and
+// containers (Docker Desktop, WSL, Vagrant...): locks and shared memory
+// may not be coherent between the two sides.
+var sharedFS = map[string]bool{
+	"virtiofs": true, "fuse.grpcfuse": true, "fakeowner": true, "vboxsf": true,
+	"drvfs": true, "fuse.osxfs": true, "prl_fs": true, "vmhgfs": true, "fuse.vmhgfs-fuse": true,
+}
+
+// Check inspects the database at path (which need not exist yet:
+// its directory is checked) and its environment.
+func Check(path string) (*Report, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{Path: abs}
+	dir := filepath.Dir(abs)
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	} else {
+		r.add(CodeNoDirectory, Warn, "directory %s: %v", dir, err)
+	}
+	r.MountPoint, r.FSType = mountOf(dir)
+
+	if r.Probe, err = sqlite3probe.Probe(abs); err != nil {
+		return nil, err
+	}
+
+	r.checkFS()
+	r.checkReplication(dir)
+	r.checkFiles()
+	if strconv.IntSize == 32 {
+		r.add(CodeMmap, Info, "32-bit process (%s): keep PRAGMA mmap_size well below the address space", runtime.GOARCH)
+	}
+	return r, nil
+}
+
+func (r *Report) checkFS() {
+	fs, wal := r.FSType, r.Probe != nil && (r.Probe.WALMode || r.Probe.WALPresent)
+	switch {
+	case networkFS[fs]:
+		r.add(CodeNetworkFS, Critical, "%s is a network filesystem (%s): file locking is often broken"+
+			" or missing there, and concurrent access corrupts databases", r.MountPoint, fs)
+		r.add(CodeMmap, Warn, "memory-mapped I/O (PRAGMA mmap_size) is not coherent on %s; keep it 0", fs)
+		if wal {
+			r.add(CodeWALNetwork, Critical, "WAL mode needs shared memory between all processes,"+
+				" which %s cannot provide across hosts", fs)
+		}
+	case sharedFS[fs]:
+		r.add(CodeSharedFS, Warn, "%s (%s) shares a host directory into a VM or container:"+
+			" use the database from one side only", r.MountPoint, fs)
+		if wal {
+			r.add(CodeWALNetwork, Warn, "WAL shared memory is not coherent between host and guest on %s", fs)
+		}
+	case fs == "overlay" || fs == "aufs":
+		r.add(CodeOverlayFS, Warn, "container overlay filesystem (%s): the database is lost with the"+
+			" container and locks are not shared with other containers; use a volume", fs)
+	case fs == "tmpfs" || fs == "ramfs":
+		r.add(CodeTmpFS, Info, "%s is memory-backed (%s): the database does not survive a reboot", r.MountPoint, fs)
+	}
+}
+
+func (r *Report) checkReplication(dir string) {
+	base := filepath.Base(r.Path)
+	if r.FSType == "fuse.litefs" || exists(filepath.Join(dir, ".primary")) {
+		r.add(CodeLiteFS, Info, "managed by LiteFS: write only on the primary node, never to the"+
+			" underlying data directory, and leave checkpoints and journal mode to LiteFS")
+	}
+	if exists(filepath.Join(dir, "."+base+"-litestream")) {
+		r.add(CodeLitestream, Info, "replicated by Litestream: it controls checkpoints; do not run"+
+			" wal_checkpoint(TRUNCATE) or another WAL shipper on this database, and keep the"+
+			" application's busy_timeout set")
+	}
+}
+
+func (r *Report) checkFiles() {
+	p := r.Probe
+	if p == nil {
+		return
+	}
+	if err := p.Err(); err != nil && p.Kind != sqlite3probe.KindMissing {
+		r.add(CodeUnreadable, Critical, "%v", err)
+	}
+	if p.JournalPresent {
+		if p.WALMode || p.WALPresent {
+			r.add(CodeJournalMix, Warn, "both a rollback journal and WAL-mode files are present:"+
+				" some process uses another journal mode; all must agree")
+		} else {
+			r.add(CodeHotJournal, Warn, "a rollback journal is present: a transaction is running"+
+				" or was interrupted; never delete it, the next open recovers it")
+		}
+	}
+	if p.Kind == sqlite3probe.KindPlain && !p.WALMode && p.WALPresent && p.WALBytes > 0 {
+		r.add(CodeJournalMix, Warn, "the database is in rollback-journal mode but a non-empty -wal"+
+			" file exists: a process switched modes, or the -wal belongs to another file")
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
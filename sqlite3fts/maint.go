@@ -0,0 +1,97 @@
+package sqlite3fts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3maint"
+)
+
+// Fragmentation describes the on-disk state of an FTS5 index,
+// read from its shadow tables.
+type Fragmentation struct {
+	Segments  int   // b-tree segments; each query has to look at all of them
+	DataBytes int64 // total size of the index blocks
+}
+
+// ReadFragmentation inspects the %_idx and %_data shadow tables of the index.
+func ReadFragmentation(ctx context.Context, db *sql.DB, ix *Index) (Fragmentation, error) {
+	var f Fragmentation
+	err := db.QueryRowContext(ctx, "SELECT count(DISTINCT segid) FROM "+
+		sqlite3lex.QuoteIdent(ix.Name+"_idx")).Scan(&f.Segments)
+	if err != nil {
+		return f, err
+	}
+	err = db.QueryRowContext(ctx, "SELECT coalesce(sum(length(block)), 0) FROM "+
+		sqlite3lex.QuoteIdent(ix.Name+"_data")).Scan(&f.DataBytes)
+	return f, err
+}
+
+// MaintenancePolicy decides what Maintain does.
+type MaintenancePolicy struct {
+	// MinSegments: below this many segments nothing is done; 0 means 8.
+	MinSegments int
+	// OptimizeMaxBytes: indexes up to this size are fully optimized
+	// (merged into a single segment); larger ones get an incremental
+	// 'merge' instead, which bounds the work per run. 0 means 64 MiB.
+	OptimizeMaxBytes int64
+	// MergePages is the amount of work per 'merge' command
+	// (pages written); 0 means 500.
+	MergePages int
+}
+
+func (p *MaintenancePolicy) withDefaults() MaintenancePolicy {
+	q := *p
+	if q.MinSegments <= 0 {
+		q.MinSegments = 8
+	}
+	if q.OptimizeMaxBytes <= 0 {
+		q.OptimizeMaxBytes = 64 << 20
+	}
+	if q.MergePages <= 0 {
+		q.MergePages = 500
+	}
+	return q
+}
+
+// Maintain looks at the fragmentation of the index and runs 'optimize'
+// or 'merge' as the policy says. It returns what it did: "", "optimize"
+// or "merge".
+func (ix *Index) Maintain(ctx context.Context, db *sql.DB, policy *MaintenancePolicy) (string, error) {
+	if policy == nil {
+		policy = &MaintenancePolicy{}
+	}
+	p := policy.withDefaults()
+
+	f, err := ReadFragmentation(ctx, db, ix)
+	if err != nil {
+		return "", err
+	}
+	if f.Segments < p.MinSegments {
+		return "", nil
+	}
+	if f.DataBytes <= p.OptimizeMaxBytes {
+		return "optimize", Command(ctx, db, ix, "optimize")
+	}
+
+	name := sqlite3lex.QuoteIdent(ix.Name)
+	_, err = db.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s(%s, rank) VALUES ('merge', ?)", name, name),
+		p.MergePages)
+	return "merge", err
+}
+
+// MaintenanceTask wraps Maintain for a sqlite3maint.Scheduler.
+func (ix *Index) MaintenanceTask(policy *MaintenancePolicy, every time.Duration) sqlite3maint.Task {
+	return sqlite3maint.Task{
+		Name:  "fts_" + ix.Name,
+		Every: every,
+		Run: func(ctx context.Context, db *sql.DB) error {
+			_, err := ix.Maintain(ctx, db, policy)
+			return err
+		},
+	}
+}
@@ -0,0 +1,138 @@
+package sqlite3fts
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Term returns s as an FTS5 string: inside it, every character
+// (operators, column filters, parentheses) is taken literally.
+func Term(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// PrefixTerm matches tokens starting with s.
+func PrefixTerm(s string) string {
+	return Term(s) + " *"
+}
+
+func group(op string, exprs []string) string {
+	var nonEmpty []string
+	for _, e := range exprs {
+		if e != "" {
+			nonEmpty = append(nonEmpty, e)
+		}
+	}
+	switch len(nonEmpty) {
+	case 0:
+		return ""
+	case 1:
+		return nonEmpty[0]
+	}
+	return "(" + strings.Join(nonEmpty, " "+op+" ") + ")"
+}
+
+// And combines MATCH expressions (empty ones are skipped).
+func And(exprs ...string) string { return group("AND", exprs) }
+
+// Or combines MATCH expressions (empty ones are skipped).
+func Or(exprs ...string) string { return group("OR", exprs) }
+
+// Not matches rows matching a but not b.
+func Not(a, b string) string { return "(" + a + " NOT " + b + ")" }
+
+// Phrase matches the words in sequence.
+func Phrase(words ...string) string {
+	return Term(strings.Join(words, " "))
+}
+
+// Near matches the terms within distance tokens of each other
+// (distance <= 0 means the FTS5 default, 10).
+func Near(distance int, terms ...string) string {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = Term(t)
+	}
+	s := "NEAR(" + strings.Join(quoted, " ")
+	if distance > 0 {
+		s += ", " + strconv.Itoa(distance)
+	}
+	return s + ")"
+}
+
+// Columns restricts expr to the given columns.
+func Columns(expr string, columns ...string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = Term(c)
+	}
+	return "{" + strings.Join(quoted, " ") + "} : (" + expr + ")"
+}
+
+// UserQuery turns free-form user input into a safe MATCH expression:
+// every whitespace-separated word must appear; a word ending in '*'
+// is a prefix search. Quotes and operators typed by the user lose
+// their special meaning. Returns "" for input without words,
+// which callers should treat as "no search".
+func UserQuery(input string) string {
+	var terms []string
+	for _, w := range strings.Fields(input) {
+		if strings.HasSuffix(w, "*") {
+			if w = strings.TrimRight(w, "*"); w != "" {
+				terms = append(terms, PrefixTerm(w))
+			}
+			continue
+		}
+		terms = append(terms, Term(w))
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// BM25 returns the bm25() ranking expression for the index, with
+// optional per-column weights. Smaller values are better matches,
+// so ORDER BY it ascending.
+func (ix *Index) BM25(weights ...float64) string {
+	args := []string{sqlite3lex.QuoteIdent(ix.Name)}
+	for _, w := range weights {
+		args = append(args, strconv.FormatFloat(w, 'g', -1, 64))
+	}
+	return "bm25(" + strings.Join(args, ", ") + ")"
+}
+
+// Snippet returns a snippet() expression: up to maxTokens tokens
+// (at most 64) of column around the match, matches wrapped in
+// before/after, elided text replaced by ellipsis.
+func (ix *Index) Snippet(column int, before, after, ellipsis string, maxTokens int) string {
+	return fmt.Sprintf("snippet(%s, %d, %s, %s, %s, %d)",
+		sqlite3lex.QuoteIdent(ix.Name), column,
+		sqlite3lex.QuoteString(before), sqlite3lex.QuoteString(after),
+		sqlite3lex.QuoteString(ellipsis), maxTokens)
+}
+
+// Highlight returns a highlight() expression: the whole column
+// with matches wrapped in before/after.
+func (ix *Index) Highlight(column int, before, after string) string {
+	return fmt.Sprintf("highlight(%s, %d, %s, %s)",
+		sqlite3lex.QuoteIdent(ix.Name), column,
+		sqlite3lex.QuoteString(before), sqlite3lex.QuoteString(after))
+}
+
+// SearchSQL returns a query selecting the rowid, the given extra result
+// expressions (e.g. Snippet, or content table columns as "t.title")
+// and the rank, for rows matching the first parameter,
+// best first, limited by the second parameter:
+//
+//	rows, err := db.Query(ix.SearchSQL(ix.Snippet(0, "[", "]", "…", 10)),
+//		sqlite3fts.UserQuery(input), 20)
+func (ix *Index) SearchSQL(extra ...string) string {
+	cols := []string{"t." + sqlite3lex.QuoteIdent(ix.rowID())}
+	cols = append(cols, extra...)
+	cols = append(cols, ix.BM25()+" AS rank")
+	name := sqlite3lex.QuoteIdent(ix.Name)
+	return fmt.Sprintf("SELECT %s FROM %s JOIN %s AS t ON t.%s = %s.rowid WHERE %s MATCH ? ORDER BY rank LIMIT ?",
+		strings.Join(cols, ", "), name, sqlite3lex.QuoteIdent(ix.Table),
+		sqlite3lex.QuoteIdent(ix.rowID()), name, name)
+}
@@ -0,0 +1,125 @@
+// Package sqlite3fts helps with FTS5 full-text indexes over existing
+// tables: creating an external-content index together with the triggers
+// that keep it in sync, building MATCH expressions without syntax errors
+// or injection, and ranking/snippet SQL.
+package sqlite3fts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Index describes an FTS5 external-content index over a regular table.
+type Index struct {
+	// Name of the FTS5 virtual table, e.g. "notes_fts".
+	Name string
+	// Table is the content table, e.g. "notes".
+	Table string
+	// RowID is the INTEGER PRIMARY KEY (or "rowid") of Table;
+	// empty means "rowid".
+	RowID string
+	// Columns of Table to index.
+	Columns []string
+	// Tokenize is the FTS5 tokenize option, e.g. "porter unicode61";
+	// empty for the default.
+	Tokenize string
+	// Prefix is the FTS5 prefix option, e.g. "2 3"; empty for none.
+	Prefix string
+}
+
+func (ix *Index) rowID() string {
+	if ix.RowID == "" {
+		return "rowid"
+	}
+	return ix.RowID
+}
+
+func (ix *Index) triggerName(suffix string) string {
+	return sqlite3lex.QuoteIdent(ix.Name + "_" + suffix)
+}
+
+// columnList returns the quoted columns, each prefixed by prefix
+// ("new.", "old." or "").
+func (ix *Index) columnList(prefix string) string {
+	cols := make([]string, len(ix.Columns))
+	for i, c := range ix.Columns {
+		cols[i] = prefix + sqlite3lex.QuoteIdent(c)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// Statements returns the DDL that Create executes, in order.
+func (ix *Index) Statements() []string {
+	name := sqlite3lex.QuoteIdent(ix.Name)
+	table := sqlite3lex.QuoteIdent(ix.Table)
+	rowID := sqlite3lex.QuoteIdent(ix.rowID())
+
+	opts := []string{ix.columnList("")}
+	opts = append(opts, "content="+sqlite3lex.QuoteString(ix.Table))
+	opts = append(opts, "content_rowid="+sqlite3lex.QuoteString(ix.rowID()))
+	if ix.Tokenize != "" {
+		opts = append(opts, "tokenize="+sqlite3lex.QuoteString(ix.Tokenize))
+	}
+	if ix.Prefix != "" {
+		opts = append(opts, "prefix="+sqlite3lex.QuoteString(ix.Prefix))
+	}
+
+	insertNew := fmt.Sprintf("INSERT INTO %s(rowid, %s) VALUES (new.%s, %s);",
+		name, ix.columnList(""), rowID, ix.columnList("new."))
+	deleteOld := fmt.Sprintf("INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.%s, %s);",
+		name, name, ix.columnList(""), rowID, ix.columnList("old."))
+
+	return []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(%s)", name, strings.Join(opts, ", ")),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s BEGIN\n  %s\nEND",
+			ix.triggerName("ai"), table, insertNew),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s BEGIN\n  %s\nEND",
+			ix.triggerName("ad"), table, deleteOld),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s BEGIN\n  %s\n  %s\nEND",
+			ix.triggerName("au"), table, deleteOld, insertNew),
+		fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", name, name),
+	}
+}
+
+// Create creates the index and its triggers and indexes the rows
+// already in the table, all in one transaction.
+func Create(ctx context.Context, db *sql.DB, ix *Index) error {
+	return inTx(ctx, db, ix.Statements())
+}
+
+// Drop removes the triggers and the index (the content table is untouched).
+func Drop(ctx context.Context, db *sql.DB, ix *Index) error {
+	return inTx(ctx, db, []string{
+		"DROP TRIGGER IF EXISTS " + ix.triggerName("ai"),
+		"DROP TRIGGER IF EXISTS " + ix.triggerName("ad"),
+		"DROP TRIGGER IF EXISTS " + ix.triggerName("au"),
+		"DROP TABLE IF EXISTS " + sqlite3lex.QuoteIdent(ix.Name),
+	})
+}
+
+// Command runs an FTS5 special command such as 'optimize', 'rebuild'
+// or 'integrity-check' on the index.
+func Command(ctx context.Context, db *sql.DB, ix *Index, command string) error {
+	name := sqlite3lex.QuoteIdent(ix.Name)
+	_, err := db.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s(%s) VALUES (?)", name, name), command)
+	return err
+}
+
+func inTx(ctx context.Context, db *sql.DB, stmts []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, s := range stmts {
+		if _, err := tx.ExecContext(ctx, s); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite3fts: %q: %w", s, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package sqlite3health
+
+func freeBytes(dir string) (uint64, error) {
+	return 0, errFreeSpaceUnsupported
+}
@@ -0,0 +1,237 @@
+// Package sqlite3health implements a health check for SQLite databases
+// opened through database/sql, meant to back readiness/liveness endpoints.
+package sqlite3health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errFreeSpaceUnsupported = errors.New("sqlite3health: free space check not supported on this platform")
+
+// Status is the outcome of a single check or of the whole health check.
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // still usable, but needs attention
+	StatusFailed   Status = "failed"
+)
+
+// worse returns the more severe of two statuses.
+func worse(a, b Status) Status {
+	rank := map[Status]int{StatusOK: 0, StatusDegraded: 1, StatusFailed: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// Options tune what Health checks. The zero value (or nil) gives
+// the cheapest useful check: ping plus reading the schema version.
+type Options struct {
+	// QuickCheck runs 'PRAGMA quick_check(N)' instead of only reading
+	// the schema version. It reads the whole database, so it is
+	// better suited for an occasional deep probe than for a liveness
+	// endpoint polled every few seconds.
+	QuickCheck bool
+	// QuickCheckMaxErrors is N above; 0 means 1 (stop at the first problem).
+	QuickCheckMaxErrors int
+
+	// MaxWALBytes marks the result degraded when the -wal file is larger;
+	// 0 disables the WAL size check (the size is still reported).
+	MaxWALBytes int64
+
+	// MinFreeBytes marks the result degraded when the filesystem
+	// holding the database has less free space; 0 disables the check.
+	MinFreeBytes uint64
+}
+
+// Check is the result of one step of the health check.
+type Check struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Result is the structured outcome of Health, ready to be encoded as JSON.
+type Result struct {
+	Status        Status    `json:"status"`
+	Time          time.Time `json:"time"`
+	Filename      string    `json:"filename,omitempty"`
+	SchemaVersion int64     `json:"schema_version"`
+	WALBytes      int64     `json:"wal_bytes"`
+	FreeBytes     uint64    `json:"free_bytes,omitempty"`
+	Checks        []Check   `json:"checks"`
+}
+
+// Live reports whether the database answered at all
+// (suitable for a liveness probe).
+func (r *Result) Live() bool {
+	return len(r.Checks) > 0 && r.Checks[0].Status == StatusOK
+}
+
+// Ready reports whether nothing failed (suitable for a readiness probe);
+// degraded checks do not make a database unready.
+func (r *Result) Ready() bool {
+	return r.Status != StatusFailed
+}
+
+func (r *Result) add(name string, start time.Time, status Status, msg string) {
+	r.Checks = append(r.Checks, Check{
+		Name:     name,
+		Status:   status,
+		Message:  msg,
+		Duration: time.Since(start),
+	})
+	r.Status = worse(r.Status, status)
+}
+
+// Health pings db and runs the checks selected by opts (nil means defaults).
+// It never returns an error: problems are reported in the Result,
+// and the remaining checks are skipped once the database is unreachable.
+func Health(ctx context.Context, db *sql.DB, opts *Options) *Result {
+	if opts == nil {
+		opts = &Options{}
+	}
+	r := &Result{Status: StatusOK, Time: time.Now()}
+
+	start := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		r.add("ping", start, StatusFailed, err.Error())
+		return r
+	}
+	r.add("ping", start, StatusOK, "")
+
+	start = time.Now()
+	if err := db.QueryRowContext(ctx, "PRAGMA schema_version").Scan(&r.SchemaVersion); err != nil {
+		r.add("schema_version", start, StatusFailed, err.Error())
+		return r
+	}
+	r.add("schema_version", start, StatusOK, "")
+
+	if opts.QuickCheck {
+		start = time.Now()
+		status, msg := quickCheck(ctx, db, opts.QuickCheckMaxErrors)
+		r.add("quick_check", start, status, msg)
+	}
+
+	start = time.Now()
+	filename, err := mainFilename(ctx, db)
+	if err != nil {
+		r.add("filename", start, StatusDegraded, err.Error())
+		return r
+	}
+	r.Filename = filename
+	if filename == "" { // in-memory or temporary database: no files to check
+		return r
+	}
+
+	start = time.Now()
+	fi, err := os.Stat(filename + "-wal")
+	switch {
+	case os.IsNotExist(err):
+		r.add("wal_size", start, StatusOK, "no WAL file")
+	case err != nil:
+		r.add("wal_size", start, StatusDegraded, err.Error())
+	default:
+		r.WALBytes = fi.Size()
+		if opts.MaxWALBytes > 0 && r.WALBytes > opts.MaxWALBytes {
+			r.add("wal_size", start, StatusDegraded,
+				fmt.Sprintf("WAL is %d bytes, limit %d", r.WALBytes, opts.MaxWALBytes))
+		} else {
+			r.add("wal_size", start, StatusOK, "")
+		}
+	}
+
+	start = time.Now()
+	free, err := freeBytes(filepath.Dir(filename))
+	switch {
+	case err == errFreeSpaceUnsupported:
+		// nothing to report on this platform
+	case err != nil:
+		r.add("free_space", start, StatusDegraded, err.Error())
+	default:
+		r.FreeBytes = free
+		if opts.MinFreeBytes > 0 && free < opts.MinFreeBytes {
+			r.add("free_space", start, StatusDegraded,
+				fmt.Sprintf("%d bytes free, minimum %d", free, opts.MinFreeBytes))
+		} else {
+			r.add("free_space", start, StatusOK, "")
+		}
+	}
+
+	return r
+}
+
+func quickCheck(ctx context.Context, db *sql.DB, maxErrors int) (Status, string) {
+	if maxErrors <= 0 {
+		maxErrors = 1
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA quick_check(%d)", maxErrors))
+	if err != nil {
+		return StatusFailed, err.Error()
+	}
+	defer rows.Close()
+
+	var msgs []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return StatusFailed, err.Error()
+		}
+		if s != "ok" {
+			msgs = append(msgs, s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return StatusFailed, err.Error()
+	}
+	if len(msgs) > 0 {
+		return StatusFailed, fmt.Sprintf("%q", msgs)
+	}
+	return StatusOK, ""
+}
+
+// mainFilename returns the file backing the "main" schema,
+// "" for in-memory and temporary databases.
+func mainFilename(ctx context.Context, db *sql.DB) (string, error) {
+	rows, err := db.QueryContext(ctx, "PRAGMA database_list")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seq int
+		var name, file string
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			return "", err
+		}
+		if name == "main" {
+			return file, nil
+		}
+	}
+	return "", rows.Err()
+}
+
+// Handler serves Health results as JSON: status 200 when ready,
+// 503 otherwise.
+func Handler(db *sql.DB, opts *Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r := Health(req.Context(), db, opts)
+		w.Header().Set("Content-Type", "application/json")
+		if !r.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(r)
+	})
+}
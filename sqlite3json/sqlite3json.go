@@ -0,0 +1,249 @@
+// Package sqlite3json smooths the common "JSON document in a TEXT column"
+// pattern with the SQLite JSON1 functions: path building with proper
+// escaping, expression builders that bind paths and values as parameters,
+// and Scanner/Valuer adapters converting between columns and Go values.
+package sqlite3json
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Path builds a JSON path from object keys (string) and array indexes
+// (int; negative counts from the end, -1 being the last element):
+//
+//	Path("user", "emails", 0)      // $.user.emails[0]
+//	Path("a.b", -1)                // $."a.b"[#-1]
+//
+// Keys that are not plain identifiers are double-quoted. SQLite has
+// no escape for '"' inside a quoted key, so such keys are an error.
+func Path(elems ...interface{}) (string, error) {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, e := range elems {
+		switch v := e.(type) {
+		case string:
+			if strings.Contains(v, `"`) {
+				return "", fmt.Errorf("sqlite3json: key %q contains '\"', not expressible in a JSON path", v)
+			}
+			b.WriteByte('.')
+			if plainKey(v) {
+				b.WriteString(v)
+			} else {
+				b.WriteString(`"` + v + `"`)
+			}
+		case int:
+			if v < 0 {
+				b.WriteString("[#" + strconv.Itoa(v) + "]")
+			} else {
+				b.WriteString("[" + strconv.Itoa(v) + "]")
+			}
+		default:
+			return "", fmt.Errorf("sqlite3json: path element %v: want string or int, got %T", e, e)
+		}
+	}
+	return b.String(), nil
+}
+
+// MustPath is Path for constant paths; it panics on error.
+func MustPath(elems ...interface{}) string {
+	p, err := Path(elems...)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func plainKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for i, c := range k {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Expr is an SQL expression with its parameters, ready to be spliced
+// into a statement (keeping the parameters in the same order).
+// The column given to the builders may be qualified ("t.doc"); names
+// containing '.' are not supported.
+type Expr struct {
+	SQL  string
+	Args []interface{}
+}
+
+func (e Expr) String() string { return e.SQL }
+
+// quoteColumn quotes a column name, possibly qualified ("t.doc",
+// "main.t.doc"): each part is quoted, so names containing '.'
+// cannot be used.
+func quoteColumn(column string) string {
+	parts := strings.Split(column, ".")
+	for i, p := range parts {
+		parts[i] = sqlite3lex.QuoteIdent(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Extract returns json_extract(column, path).
+func Extract(column, path string) Expr {
+	return Expr{"json_extract(" + quoteColumn(column) + ", ?)", []interface{}{path}}
+}
+
+// Arrow returns column ->> path (SQLite 3.38+), the SQL-typed
+// value at path; unlike json_extract it never returns JSON text
+// for strings.
+func Arrow(column, path string) Expr {
+	return Expr{quoteColumn(column) + " ->> ?", []interface{}{path}}
+}
+
+// Type returns json_type(column, path).
+func Type(column, path string) Expr {
+	return Expr{"json_type(" + quoteColumn(column) + ", ?)", []interface{}{path}}
+}
+
+// setLike builds json_set/json_insert/json_replace: every value is
+// marshaled with encoding/json and passed through json() so that
+// objects and arrays are stored as JSON, not as quoted strings.
+func setLike(fn, column string, pairs []interface{}) (Expr, error) {
+	if len(pairs)%2 != 0 {
+		return Expr{}, fmt.Errorf("sqlite3json: %s needs path/value pairs", fn)
+	}
+	e := Expr{SQL: fn + "(" + quoteColumn(column)}
+	for i := 0; i < len(pairs); i += 2 {
+		path, ok := pairs[i].(string)
+		if !ok {
+			return Expr{}, fmt.Errorf("sqlite3json: %s: path %v is not a string", fn, pairs[i])
+		}
+		doc, err := json.Marshal(pairs[i+1])
+		if err != nil {
+			return Expr{}, fmt.Errorf("sqlite3json: %s %s: %w", fn, path, err)
+		}
+		e.SQL += ", ?, json(?)"
+		e.Args = append(e.Args, path, string(doc))
+	}
+	e.SQL += ")"
+	return e, nil
+}
+
+// Set returns json_set(column, path1, value1, ...): creates or overwrites.
+func Set(column string, pathValuePairs ...interface{}) (Expr, error) {
+	return setLike("json_set", column, pathValuePairs)
+}
+
+// Insert returns json_insert(...): only creates, never overwrites.
+func Insert(column string, pathValuePairs ...interface{}) (Expr, error) {
+	return setLike("json_insert", column, pathValuePairs)
+}
+
+// Replace returns json_replace(...): only overwrites existing values.
+func Replace(column string, pathValuePairs ...interface{}) (Expr, error) {
+	return setLike("json_replace", column, pathValuePairs)
+}
+
+// Remove returns json_remove(column, paths...).
+func Remove(column string, paths ...string) Expr {
+	e := Expr{SQL: "json_remove(" + quoteColumn(column)}
+	for _, p := range paths {
+		e.SQL += ", ?"
+		e.Args = append(e.Args, p)
+	}
+	e.SQL += ")"
+	return e
+}
+
+// Each returns the table-valued json_each(column[, path]), for FROM:
+//
+//	e := sqlite3json.Each("doc", "$.tags")
+//	db.Query("SELECT t.id, j.value FROM t, "+e.SQL+" AS j", e.Args...)
+//
+// An empty path iterates the top-level value.
+func Each(column, path string) Expr {
+	if path == "" {
+		return Expr{"json_each(" + quoteColumn(column) + ")", nil}
+	}
+	return Expr{"json_each(" + quoteColumn(column) + ", ?)", []interface{}{path}}
+}
+
+// Tree is like Each but walks recursively (json_tree).
+func Tree(column, path string) Expr {
+	e := Each(column, path)
+	e.SQL = "json_tree" + strings.TrimPrefix(e.SQL, "json_each")
+	return e
+}
+
+// scanner unmarshals a JSON column into dest.
+type scanner struct {
+	dest interface{}
+}
+
+// Into returns a sql.Scanner unmarshaling a JSON text (or blob) column
+// into dest, which must be a pointer. NULL leaves dest untouched.
+// Text that is not JSON is stored as is into a string dest, as
+// json_extract and ->> return JSON strings unquoted.
+//
+//	var prefs Preferences
+//	err := row.Scan(&id, sqlite3json.Into(&prefs))
+func Into(dest interface{}) sql.Scanner {
+	return scanner{dest}
+}
+
+func (s scanner) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return s.text([]byte(v))
+	case []byte:
+		return s.text(v)
+	case int64, float64, bool:
+		// json_extract of a scalar gives the SQL value
+		b, _ := json.Marshal(v)
+		return json.Unmarshal(b, s.dest)
+	}
+	return fmt.Errorf("sqlite3json: cannot unmarshal %T column", src)
+}
+
+func (s scanner) text(b []byte) error {
+	err := json.Unmarshal(b, s.dest)
+	if err == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(s.dest); v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.String {
+		v.Elem().SetString(string(b))
+		return nil
+	}
+	return err
+}
+
+// valuer marshals a Go value to a JSON text parameter.
+type valuer struct {
+	v interface{}
+}
+
+// Marshal returns a driver.Valuer storing v as JSON text;
+// a nil v is stored as NULL.
+func Marshal(v interface{}) driver.Valuer {
+	return valuer{v}
+}
+
+func (m valuer) Value() (driver.Value, error) {
+	if m.v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m.v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,13 @@
+package sqlite3lex
+
+import "strings"
+
+// QuoteIdent returns name as a double-quoted SQL identifier.
+func QuoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// QuoteString returns s as a single-quoted SQL string literal.
+func QuoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,301 @@
+// Package sqlite3lex splits SQL text into tokens the way SQLite does,
+// closely enough for tools that must not be fooled by quotes and comments:
+// statement analysis, parameter rewriting, literal redaction,
+// normalization.
+//
+// It is not a parser: keywords are reported as identifiers
+// (use Token.Is to compare them), and invalid input never fails,
+// it just produces Illegal tokens.
+package sqlite3lex
+
+import (
+	"strings"
+)
+
+// Kind classifies a Token.
+type Kind int
+
+const (
+	Space       Kind = iota // whitespace
+	Comment                 // -- to end of line, or /* ... */
+	String                  // 'text', quotes doubled inside
+	Blob                    // x'hex'
+	Number                  // 12, 1.5e3, 0x1F, .5
+	Ident                   // bare identifier or keyword
+	QuotedIdent             // "ident", [ident] or `ident`
+	Param                   // ?, ?NNN, :name, @name, $name
+	Punct                   // operators and punctuation: ( ) , ; = <> || ->> ...
+	Illegal                 // anything SQLite would reject, e.g. an unterminated string
+)
+
+var kindNames = []string{
+	"Space", "Comment", "String", "Blob", "Number", "Ident",
+	"QuotedIdent", "Param", "Punct", "Illegal",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "Kind(?)"
+}
+
+// Token is a piece of SQL text; Pos is its byte offset in the input.
+// Concatenating the Text of all tokens gives back the input exactly.
+type Token struct {
+	Kind Kind
+	Text string
+	Pos  int
+}
+
+// Is reports whether t is the (case-insensitive) keyword or bare
+// identifier kw.
+func (t Token) Is(kw string) bool {
+	return t.Kind == Ident && strings.EqualFold(t.Text, kw)
+}
+
+// IsPunct reports whether t is the punctuation p.
+func (t Token) IsPunct(p string) bool {
+	return t.Kind == Punct && t.Text == p
+}
+
+// Significant reports whether t is neither whitespace nor a comment.
+func (t Token) Significant() bool {
+	return t.Kind != Space && t.Kind != Comment
+}
+
+// IsLiteral reports whether t is a string, blob or number literal.
+func (t Token) IsLiteral() bool {
+	return t.Kind == String || t.Kind == Blob || t.Kind == Number
+}
+
+// Tokenize splits sql into tokens.
+func Tokenize(sql string) []Token {
+	var toks []Token
+	for pos := 0; pos < len(sql); {
+		k, n := next(sql[pos:])
+		toks = append(toks, Token{Kind: k, Text: sql[pos : pos+n], Pos: pos})
+		pos += n
+	}
+	return toks
+}
+
+// SignificantTokens is Tokenize without whitespace and comments.
+func SignificantTokens(sql string) []Token {
+	var toks []Token
+	for _, t := range Tokenize(sql) {
+		if t.Significant() {
+			toks = append(toks, t)
+		}
+	}
+	return toks
+}
+
+// SplitStatements splits tokens at top-level ';' tokens (which are
+// dropped), returning only statements with at least one significant token.
+func SplitStatements(toks []Token) [][]Token {
+	var stmts [][]Token
+	start := 0
+	flush := func(end int) {
+		for _, t := range toks[start:end] {
+			if t.Significant() {
+				stmts = append(stmts, toks[start:end])
+				return
+			}
+		}
+	}
+	for i, t := range toks {
+		if t.IsPunct(";") {
+			flush(i)
+			start = i + 1
+		}
+	}
+	flush(len(toks))
+	return stmts
+}
+
+// FirstKeyword returns the first significant token of sql in upper case
+// (e.g. "SELECT", "PRAGMA"), or "" if there is none.
+func FirstKeyword(sql string) string {
+	for _, t := range Tokenize(sql) {
+		if t.Significant() {
+			if t.Kind == Ident {
+				return strings.ToUpper(t.Text)
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9' || c == '$'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// quoted scans a token delimited by open/close; a doubled close
+// character stands for itself (except for ']').
+// It returns the length and whether the token was terminated.
+func quoted(s string, close byte, doubling bool) (int, bool) {
+	for i := 1; i < len(s); i++ {
+		if s[i] == close {
+			if doubling && i+1 < len(s) && s[i+1] == close {
+				i++
+				continue
+			}
+			return i + 1, true
+		}
+	}
+	return len(s), false
+}
+
+// next returns the kind and length of the token at the start of s
+// (s is not empty).
+func next(s string) (Kind, int) {
+	c := s[0]
+	switch {
+	case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+		n := 1
+		for n < len(s) && strings.IndexByte(" \t\n\r\f\v", s[n]) >= 0 {
+			n++
+		}
+		return Space, n
+
+	case c == '-' && len(s) > 1 && s[1] == '-':
+		n := strings.IndexByte(s, '\n')
+		if n < 0 {
+			return Comment, len(s)
+		}
+		return Comment, n
+
+	case c == '/' && len(s) > 1 && s[1] == '*':
+		n := strings.Index(s[2:], "*/")
+		if n < 0 {
+			return Comment, len(s) // SQLite accepts an unterminated final comment
+		}
+		return Comment, n + 4
+
+	case c == '\'':
+		n, ok := quoted(s, '\'', true)
+		if !ok {
+			return Illegal, n
+		}
+		return String, n
+
+	case c == '"' || c == '`':
+		n, ok := quoted(s, c, true)
+		if !ok {
+			return Illegal, n
+		}
+		return QuotedIdent, n
+
+	case c == '[':
+		n, ok := quoted(s, ']', false)
+		if !ok {
+			return Illegal, n
+		}
+		return QuotedIdent, n
+
+	case (c == 'x' || c == 'X') && len(s) > 1 && s[1] == '\'':
+		n, ok := quoted(s[1:], '\'', false)
+		if !ok {
+			return Illegal, n + 1
+		}
+		for i := 2; i < n; i++ {
+			if !isHexDigit(s[i]) {
+				return Illegal, n + 1
+			}
+		}
+		if (n-2)%2 != 0 {
+			return Illegal, n + 1
+		}
+		return Blob, n + 1
+
+	case isDigit(c) || c == '.' && len(s) > 1 && isDigit(s[1]):
+		return number(s)
+
+	case c == '?':
+		n := 1
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+		return Param, n
+
+	case c == ':' || c == '@' || c == '$' || c == '#':
+		n := 1
+		for n < len(s) && isIdentChar(s[n]) {
+			n++
+		}
+		if n == 1 {
+			return Illegal, 1
+		}
+		return Param, n
+
+	case isIdentStart(c):
+		n := 1
+		for n < len(s) && isIdentChar(s[n]) {
+			n++
+		}
+		return Ident, n
+	}
+
+	for _, op := range []string{"->>", "||", "<=", ">=", "==", "!=", "<>", "<<", ">>", "->"} {
+		if strings.HasPrefix(s, op) {
+			return Punct, len(op)
+		}
+	}
+	if strings.IndexByte("()[],;+-*/%=<>&|~.", c) >= 0 {
+		return Punct, 1
+	}
+	return Illegal, 1
+}
+
+func number(s string) (Kind, int) {
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') && isHexDigit(s[2]) {
+		n := 2
+		for n < len(s) && isHexDigit(s[n]) {
+			n++
+		}
+		return Number, n
+	}
+	n := 0
+	digits := func() {
+		for n < len(s) && (isDigit(s[n]) || s[n] == '_' && n+1 < len(s) && isDigit(s[n+1])) {
+			n++
+		}
+	}
+	digits()
+	if n < len(s) && s[n] == '.' {
+		n++
+		digits()
+	}
+	if n < len(s) && (s[n] == 'e' || s[n] == 'E') {
+		m := n + 1
+		if m < len(s) && (s[m] == '+' || s[m] == '-') {
+			m++
+		}
+		if m < len(s) && isDigit(s[m]) {
+			n = m
+			digits()
+		}
+	}
+	if n < len(s) && isIdentStart(s[n]) {
+		// "12abc" is an error in SQLite, keep it one token
+		for n < len(s) && isIdentChar(s[n]) {
+			n++
+		}
+		return Illegal, n
+	}
+	return Number, n
+}
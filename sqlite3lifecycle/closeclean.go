@@ -0,0 +1,66 @@
+package sqlite3lifecycle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrWALRemains is returned by CloseClean when the -wal file still
+// holds frames after closing: another process has the database open,
+// or kept the checkpoint from completing.
+var ErrWALRemains = errors.New("sqlite3lifecycle: -wal file not emptied")
+
+// CloseClean closes db so that the database file alone is complete,
+// ready to be copied without its -wal:
+//
+//  1. wait (until ctx is done) for in-flight work, as Shutdown;
+//  2. shrink the pool to a single connection;
+//  3. 'PRAGMA wal_checkpoint(TRUNCATE)' on it, which must succeed;
+//  4. Close, then check that the -wal file is gone or empty.
+//
+// Unlike Shutdown, a busy checkpoint is an error, and so is
+// a leftover -wal file (ErrWALRemains). db is closed in any case.
+func CloseClean(ctx context.Context, db *sql.DB) error {
+	var path, mode string
+	err := db.QueryRowContext(ctx, "SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&path)
+	if err == nil {
+		err = db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode)
+	}
+	if err == nil {
+		err = WaitIdle(ctx, db)
+	}
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if mode != "wal" || path == "" {
+		return db.Close() // no WAL to empty (or an in-memory database)
+	}
+
+	// Other idle connections are closed; the last one checkpoints
+	// once more, and deletes the -wal file, when it closes.
+	db.SetMaxIdleConns(1)
+	db.SetMaxOpenConns(1)
+	_, _, err = Checkpoint(ctx, db, "TRUNCATE")
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("sqlite3lifecycle: close clean: %w", err)
+	}
+
+	fi, err := os.Stat(path + "-wal")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("sqlite3lifecycle: %w", err)
+	}
+	if fi.Size() > 0 {
+		return fmt.Errorf("%w: %s-wal is %d bytes", ErrWALRemains, path, fi.Size())
+	}
+	return nil
+}
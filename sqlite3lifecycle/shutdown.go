@@ -0,0 +1,85 @@
+// Package sqlite3lifecycle contains helpers for opening and closing
+// SQLite databases the way long-running services need to.
+package sqlite3lifecycle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCheckpointBusy is returned when 'PRAGMA wal_checkpoint' could not
+// complete because other connections (possibly in other processes)
+// were still reading or writing.
+var ErrCheckpointBusy = errors.New("sqlite3lifecycle: WAL checkpoint could not complete (database busy)")
+
+const inFlightPollInterval = 20 * time.Millisecond
+
+// WaitIdle waits until db has no connection in use, that is until
+// in-flight queries and transactions started through this *sql.DB
+// have finished, or until ctx is done.
+func WaitIdle(ctx context.Context, db *sql.DB) error {
+	ticker := time.NewTicker(inFlightPollInterval)
+	defer ticker.Stop()
+
+	for db.Stats().InUse > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("sqlite3lifecycle: %d connection(s) still in use: %w",
+				db.Stats().InUse, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Checkpoint runs 'PRAGMA wal_checkpoint(<mode>)' (mode is one of
+// PASSIVE, FULL, RESTART, TRUNCATE) and returns the number of frames
+// in the WAL and how many of them were checkpointed.
+// For a database not in WAL mode both numbers are -1 and err is nil.
+func Checkpoint(ctx context.Context, db *sql.DB, mode string) (logFrames, checkpointed int, err error) {
+	var busy int
+	err = db.QueryRowContext(ctx, "PRAGMA wal_checkpoint("+mode+")").
+		Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		return 0, 0, err
+	}
+	if busy != 0 {
+		return logFrames, checkpointed, ErrCheckpointBusy
+	}
+	return logFrames, checkpointed, nil
+}
+
+// Shutdown closes db the way a service should on redeploy:
+//
+//  1. wait (until ctx is done) for in-flight transactions to finish;
+//  2. 'PRAGMA optimize', so the next process starts with fresh statistics;
+//  3. 'PRAGMA wal_checkpoint(TRUNCATE)', so no large -wal file is left behind;
+//  4. Close.
+//
+// Close is always attempted, even when an earlier step failed or ctx
+// expired; the first error encountered is returned.
+// Steps 2 and 3 are skipped if the in-flight work did not finish in time:
+// a checkpoint could not truncate the WAL anyway.
+func Shutdown(ctx context.Context, db *sql.DB) error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := WaitIdle(ctx, db); err != nil {
+		keep(err)
+	} else {
+		_, err := db.ExecContext(ctx, "PRAGMA optimize")
+		keep(err)
+		_, _, err = Checkpoint(ctx, db, "TRUNCATE")
+		keep(err)
+	}
+
+	keep(db.Close())
+	return firstErr
+}
@@ -0,0 +1,287 @@
+// Package sqlite3loadgen generates database load: a weighted mix of
+// operations run by concurrent workers on keys drawn from a uniform
+// or Zipf distribution, for a duration or a number of operations,
+// with a summary of throughput, latencies and errors.
+//
+// Operations are plain functions, so the load can target any schema;
+// Table provides insert/update/select operations on a simple table
+// for quick comparisons of settings.
+package sqlite3loadgen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3trace"
+)
+
+// Op is one kind of operation of the mix.
+type Op struct {
+	// Name identifies the operation in the summary.
+	Name string
+	// Weight is the relative frequency of the operation; 0 disables it.
+	Weight int
+	// Run does one operation on key (in [0, Config.Keys)). rnd belongs
+	// to the worker, for generating values.
+	Run func(ctx context.Context, db *sql.DB, key int64, rnd *rand.Rand) error
+}
+
+// Distribution is how keys are drawn.
+type Distribution int
+
+const (
+	Uniform Distribution = iota // every key equally likely
+	Zipf                        // a few hot keys, most rarely used
+)
+
+var distributionNames = map[Distribution]string{
+	Uniform: "uniform",
+	Zipf:    "zipf",
+}
+
+func (d Distribution) String() string {
+	if n, ok := distributionNames[d]; ok {
+		return n
+	}
+	return fmt.Sprintf("Distribution(%d)", int(d))
+}
+
+// ParseDistribution returns the Distribution named s (as by String).
+func ParseDistribution(s string) (Distribution, error) {
+	for d, n := range distributionNames {
+		if s == n {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("sqlite3loadgen: unknown distribution %q", s)
+}
+
+// Config describes a load.
+type Config struct {
+	Ops []Op
+
+	// Concurrency is the number of workers; 0 means 1.
+	Concurrency int
+
+	// Keys is the size of the key space; 0 means 1000.
+	Keys int64
+	// Distribution of the keys; with Zipf, key 0 is the hottest.
+	Distribution Distribution
+	// ZipfS is the Zipf exponent (> 1; larger is more skewed);
+	// 0 means 1.1.
+	ZipfS float64
+
+	// Duration and MaxOps bound the run; the first reached ends it.
+	// At least one must be set (or ctx be cancelable).
+	Duration time.Duration
+	MaxOps   int64
+
+	// Seed makes the key and operation sequences reproducible
+	// (per worker); 0 seeds from the clock.
+	Seed int64
+
+	// StopOnError ends the run at the first failed operation; otherwise
+	// errors are counted and the run goes on.
+	StopOnError bool
+}
+
+// ErrNoOps is returned when no operation has a positive weight.
+var ErrNoOps = errors.New("sqlite3loadgen: no operation to run")
+
+// ErrUnbounded is returned when neither Duration nor MaxOps is set
+// and ctx cannot be canceled.
+var ErrUnbounded = errors.New("sqlite3loadgen: no Duration, MaxOps or cancelable context")
+
+// OpSummary is the result of one operation of the mix.
+type OpSummary struct {
+	Name   string
+	Count  int64 // successful operations
+	Errors int64 // failed operations, busy ones included
+	Busy   int64 // failed with SQLITE_BUSY or SQLITE_LOCKED
+	// Latency of successful operations, in nanoseconds.
+	Latency sqlite3trace.Histogram
+}
+
+// Summary is the result of Run.
+type Summary struct {
+	Elapsed time.Duration
+	Ops     []*OpSummary // in Config.Ops order, without disabled ones
+	// Err is the error that stopped the run with StopOnError.
+	Err error
+}
+
+// Total returns the number of successful operations.
+func (s *Summary) Total() int64 {
+	var n int64
+	for _, o := range s.Ops {
+		n += o.Count
+	}
+	return n
+}
+
+// Throughput returns the successful operations per second.
+func (s *Summary) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Total()) / s.Elapsed.Seconds()
+}
+
+// WriteText writes the summary as a table, one line per operation.
+func (s *Summary) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%d ops in %v: %.1f ops/s\n", s.Total(), s.Elapsed.Round(time.Millisecond), s.Throughput())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%-12s %10s %8s %8s %10s %10s %10s %10s\n",
+		"op", "count", "errors", "busy", "mean", "p50", "p99", "max")
+	for _, o := range s.Ops {
+		h := &o.Latency
+		d := func(ns int64) time.Duration { return time.Duration(ns).Round(time.Microsecond) }
+		_, err = fmt.Fprintf(w, "%-12s %10d %8d %8d %10v %10v %10v %10v\n",
+			o.Name, o.Count, o.Errors, o.Busy, d(int64(h.Mean())),
+			d(h.Percentile(50)), d(h.Percentile(99)), d(h.Max()))
+		if err != nil {
+			return err
+		}
+	}
+	if s.Err != nil {
+		_, err = fmt.Fprintf(w, "stopped: %v\n", s.Err)
+	}
+	return err
+}
+
+// Run runs the load on db and returns its summary. The error is
+// for invalid configurations; operation errors are in the summary.
+func Run(ctx context.Context, db *sql.DB, cfg Config) (*Summary, error) {
+	var ops []Op
+	totalWeight := 0
+	for _, op := range cfg.Ops {
+		if op.Weight > 0 {
+			ops = append(ops, op)
+			totalWeight += op.Weight
+		}
+	}
+	if len(ops) == 0 {
+		return nil, ErrNoOps
+	}
+	if cfg.Duration <= 0 && cfg.MaxOps <= 0 && ctx.Done() == nil {
+		return nil, ErrUnbounded
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Keys <= 0 {
+		cfg.Keys = 1000
+	}
+	if cfg.ZipfS <= 1 {
+		cfg.ZipfS = 1.1
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		issued  int64 // operations started, for MaxOps
+		mu      sync.Mutex
+		stopErr error
+		wg      sync.WaitGroup
+	)
+	sum := &Summary{Ops: make([]*OpSummary, len(ops))}
+	for i, op := range ops {
+		sum.Ops[i] = &OpSummary{Name: op.Name}
+	}
+
+	start := time.Now()
+	for w := 0; w < cfg.Concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(cfg.Seed + int64(w)))
+			nextKey := func() int64 { return rnd.Int63n(cfg.Keys) }
+			if cfg.Distribution == Zipf && cfg.Keys > 1 {
+				z := rand.NewZipf(rnd, cfg.ZipfS, 1, uint64(cfg.Keys-1))
+				nextKey = func() int64 { return int64(z.Uint64()) }
+			}
+			local := make([]OpSummary, len(ops))
+
+			for ctx.Err() == nil {
+				if cfg.MaxOps > 0 && atomic.AddInt64(&issued, 1) > cfg.MaxOps {
+					break
+				}
+				i := pick(ops, totalWeight, rnd)
+				t0 := time.Now()
+				err := ops[i].Run(ctx, db, nextKey(), rnd)
+				switch {
+				case err == nil:
+					local[i].Count++
+					local[i].Latency.Record(int64(time.Since(t0)))
+				case ctx.Err() != nil:
+					// interrupted by the end of the run: not an error
+				default:
+					local[i].Errors++
+					if isBusy(err) {
+						local[i].Busy++
+					}
+					if cfg.StopOnError {
+						mu.Lock()
+						if stopErr == nil {
+							stopErr = fmt.Errorf("sqlite3loadgen: %s: %w", ops[i].Name, err)
+						}
+						mu.Unlock()
+						cancel()
+					}
+				}
+			}
+
+			mu.Lock()
+			for i := range local {
+				o := sum.Ops[i]
+				o.Count += local[i].Count
+				o.Errors += local[i].Errors
+				o.Busy += local[i].Busy
+				o.Latency.Merge(&local[i].Latency)
+			}
+			mu.Unlock()
+		}(w)
+	}
+	wg.Wait()
+	sum.Elapsed = time.Since(start)
+	sum.Err = stopErr
+	return sum, nil
+}
+
+// pick returns the index of a random operation, by weight.
+func pick(ops []Op, total int, rnd *rand.Rand) int {
+	n := rnd.Intn(total)
+	for i, op := range ops {
+		if n < op.Weight {
+			return i
+		}
+		n -= op.Weight
+	}
+	return len(ops) - 1
+}
+
+// isBusy reports whether err is SQLITE_BUSY or SQLITE_LOCKED.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
@@ -0,0 +1,109 @@
+package sqlite3loadgen
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Table is a ready-made workload on a table with an integer key
+// and a text payload, like the one of the trysqlite3trace1 example.
+type Table struct {
+	// Name of the table; "" means "loadgen".
+	Name string
+	// PayloadSize is the length of the text written; 0 means 100.
+	PayloadSize int
+}
+
+func (t Table) name() string {
+	if t.Name == "" {
+		return sqlite3lex.QuoteIdent("loadgen")
+	}
+	return sqlite3lex.QuoteIdent(t.Name)
+}
+
+func (t Table) payload(rnd *rand.Rand) string {
+	n := t.PayloadSize
+	if n <= 0 {
+		n = 100
+	}
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	var b strings.Builder
+	b.Grow(n)
+	for i := 0; i < n; i++ {
+		b.WriteByte(letters[rnd.Intn(len(letters))])
+	}
+	return b.String()
+}
+
+// Setup creates the table if needed and fills keys [0, keys) that are
+// missing, so updates and selects find rows from the start.
+func (t Table) Setup(ctx context.Context, db *sql.DB, keys int64) error {
+	_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+t.name()+
+		" (id INTEGER PRIMARY KEY, seq_num INTEGER NOT NULL DEFAULT 0, note TEXT NOT NULL)")
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	st, err := tx.PrepareContext(ctx, "INSERT OR IGNORE INTO "+t.name()+" (id, note) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	rnd := rand.New(rand.NewSource(1))
+	for k := int64(0); k < keys; k++ {
+		if _, err := st.ExecContext(ctx, k, t.payload(rnd)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Insert returns an operation inserting or replacing the row of the key.
+func (t Table) Insert(weight int) Op {
+	q := "INSERT OR REPLACE INTO " + t.name() + " (id, note) VALUES (?, ?)"
+	return Op{Name: "insert", Weight: weight,
+		Run: func(ctx context.Context, db *sql.DB, key int64, rnd *rand.Rand) error {
+			_, err := db.ExecContext(ctx, q, key, t.payload(rnd))
+			return err
+		}}
+}
+
+// Update returns an operation updating the row of the key.
+func (t Table) Update(weight int) Op {
+	q := "UPDATE " + t.name() + " SET seq_num = seq_num + 1, note = ? WHERE id = ?"
+	return Op{Name: "update", Weight: weight,
+		Run: func(ctx context.Context, db *sql.DB, key int64, rnd *rand.Rand) error {
+			_, err := db.ExecContext(ctx, q, t.payload(rnd), key)
+			return err
+		}}
+}
+
+// Select returns an operation reading the row of the key
+// (a missing row is not an error).
+func (t Table) Select(weight int) Op {
+	q := "SELECT seq_num, note FROM " + t.name() + " WHERE id = ?"
+	return Op{Name: "select", Weight: weight,
+		Run: func(ctx context.Context, db *sql.DB, key int64, rnd *rand.Rand) error {
+			var seq int64
+			var note string
+			err := db.QueryRowContext(ctx, q, key).Scan(&seq, &note)
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}}
+}
+
+// Mix returns the three operations with the given weights,
+// e.g. Mix(10, 20, 70) for a read-mostly load.
+func (t Table) Mix(inserts, updates, selects int) []Op {
+	return []Op{t.Insert(inserts), t.Update(updates), t.Select(selects)}
+}
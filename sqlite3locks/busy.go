@@ -0,0 +1,15 @@
+package sqlite3locks
+
+import (
+	"errors"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// isBusy reports whether err is SQLITE_BUSY or SQLITE_LOCKED,
+// i.e. another connection held the write lock longer than busy_timeout.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
@@ -0,0 +1,97 @@
+package sqlite3locks
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// ElectorOptions configure an Elector.
+type ElectorOptions struct {
+	// Role is the name of the lock representing leadership.
+	Role string
+	// TTL is the leadership lease; a crashed leader is replaced after
+	// at most TTL. 0 means 15 seconds.
+	TTL time.Duration
+	// OnElected is called when this process becomes leader. ctx is
+	// cancelled when leadership ends (lease lost, or Run returning);
+	// start leader-only work bound to ctx and return promptly.
+	OnElected func(ctx context.Context)
+	// OnResigned is called when leadership ends, after ctx of OnElected
+	// has been cancelled; err is nil for a normal shutdown, otherwise
+	// the reason the lease was lost.
+	OnResigned func(err error)
+}
+
+// Elector campaigns for leadership of a role: among all processes
+// running an Elector for the same role on the same database,
+// at most one is leader at any time.
+type Elector struct {
+	l      *Locker
+	opts   ElectorOptions
+	leader int32
+}
+
+// NewElector returns an Elector using l for its lock.
+func NewElector(l *Locker, opts ElectorOptions) *Elector {
+	if opts.TTL <= 0 {
+		opts.TTL = 15 * time.Second
+	}
+	return &Elector{l: l, opts: opts}
+}
+
+// IsLeader reports whether this process currently holds leadership.
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Run campaigns until ctx is done: it waits for the role lock, acts as
+// leader while the lease can be renewed, and campaigns again after
+// losing it. Leadership is released when ctx is done.
+func (e *Elector) Run(ctx context.Context) error {
+	for {
+		lock, err := e.l.Acquire(ctx, e.opts.Role, e.opts.TTL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// transient database error: wait a little and campaign again
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(e.l.retry):
+				continue
+			}
+		}
+
+		e.lead(ctx, lock)
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (e *Elector) lead(ctx context.Context, lock *Lock) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	atomic.StoreInt32(&e.leader, 1)
+	if e.opts.OnElected != nil {
+		e.opts.OnElected(leaderCtx)
+	}
+
+	var lostErr error
+	select {
+	case <-ctx.Done():
+	case <-lock.Lost():
+		lostErr = lock.Err()
+	}
+
+	atomic.StoreInt32(&e.leader, 0)
+	cancel()
+	if e.opts.OnResigned != nil {
+		e.opts.OnResigned(lostErr)
+	}
+
+	releaseCtx, cancelRelease := context.WithTimeout(context.Background(), e.opts.TTL)
+	lock.Release(releaseCtx)
+	cancelRelease()
+}
@@ -0,0 +1,318 @@
+// Package sqlite3locks implements named advisory locks shared by all
+// processes using the same SQLite database file.
+//
+// A lock is a row in a lock table, with an owner, a token identifying
+// the acquisition and a lease expiry.
+// Acquiring takes the database write lock (BEGIN IMMEDIATE) so that
+// checking and taking a lock are atomic across processes; a holder that
+// dies simply stops renewing its lease, and the lock becomes free when
+// the lease expires.
+package sqlite3locks
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// DefaultTable is the lock table name used when Options.Table is empty.
+const DefaultTable = "sqlite3_util_locks"
+
+// ErrNotAcquired is returned by TryAcquire when the lock is held, by
+// another owner or through another Lock of the same Locker.
+var ErrNotAcquired = errors.New("sqlite3locks: lock already held")
+
+// ErrLost is returned by Renew (and signalled by Lock.Lost) when the lease
+// expired and the lock was taken by someone else, or removed.
+var ErrLost = errors.New("sqlite3locks: lock lost")
+
+// Options configure a Locker.
+type Options struct {
+	// Table holds the locks; created if missing. Empty means DefaultTable.
+	Table string
+	// Owner identifies this Locker in the table; empty means
+	// "<hostname>:<pid>:<random>".
+	Owner string
+	// RetryInterval is the polling interval of Acquire; 0 means 100ms.
+	RetryInterval time.Duration
+	// Now returns the current time; nil means time.Now.
+	// All processes compare leases with their own clock,
+	// so clocks must roughly agree (same host, or NTP).
+	Now func() time.Time
+}
+
+// Locker acquires locks on behalf of one owner.
+type Locker struct {
+	db    *sql.DB
+	table string
+	owner string
+	retry time.Duration
+	now   func() time.Time
+}
+
+// NewLocker creates the lock table if needed and returns a Locker.
+func NewLocker(ctx context.Context, db *sql.DB, opts Options) (*Locker, error) {
+	l := &Locker{
+		db:    db,
+		table: opts.Table,
+		owner: opts.Owner,
+		retry: opts.RetryInterval,
+		now:   opts.Now,
+	}
+	if l.table == "" {
+		l.table = DefaultTable
+	}
+	if l.owner == "" {
+		l.owner = defaultOwner()
+	}
+	if l.retry <= 0 {
+		l.retry = 100 * time.Millisecond
+	}
+	if l.now == nil {
+		l.now = time.Now
+	}
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+sqlite3lex.QuoteIdent(l.table)+` (
+ name TEXT PRIMARY KEY NOT NULL,
+ owner TEXT NOT NULL,
+ token TEXT NOT NULL,
+ acquired_at INTEGER NOT NULL,
+ expires_at INTEGER NOT NULL
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3locks: creating lock table: %w", err)
+	}
+	return l, nil
+}
+
+func defaultOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), randomHex(4))
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Owner returns the owner string written in the lock table.
+func (l *Locker) Owner() string { return l.owner }
+
+// Lock is a held lock. Its lease is renewed automatically
+// until Release; Lost is closed if renewal fails.
+type Lock struct {
+	l     *Locker
+	name  string
+	token string // of this acquisition: Renew and Release touch no other
+	ttl   time.Duration
+
+	lost     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	lostOnce sync.Once
+	stopOnce sync.Once
+	mu       sync.Mutex
+	err      error
+}
+
+// Name returns the lock name.
+func (k *Lock) Name() string { return k.name }
+
+// Lost is closed when the lock could not be renewed (the work protected
+// by the lock must stop; Err tells why) and after Release.
+func (k *Lock) Lost() <-chan struct{} { return k.lost }
+
+// Err returns the renewal error after Lost is closed, nil before.
+func (k *Lock) Err() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.err
+}
+
+// withImmediateTx runs fn inside BEGIN IMMEDIATE ... COMMIT on one connection.
+func (l *Locker) withImmediateTx(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	if err := fn(conn); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		return err
+	}
+	return nil
+}
+
+// TryAcquire takes the lock if it is free (or expired) and returns
+// ErrNotAcquired otherwise, also when this Locker holds it: locks are
+// not re-entrant, so that they exclude the goroutines of one process
+// as well. ttl is the lease duration.
+func (l *Locker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	table := sqlite3lex.QuoteIdent(l.table)
+	token := randomHex(8)
+	var now time.Time
+	err := l.withImmediateTx(ctx, func(conn *sql.Conn) error {
+		now = l.now()
+		var expires int64
+		err := conn.QueryRowContext(ctx,
+			"SELECT expires_at FROM "+table+" WHERE name = ?", name).Scan(&expires)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return err
+		case expires > now.UnixNano()/1e6:
+			return ErrNotAcquired
+		}
+		_, err = conn.ExecContext(ctx, "INSERT OR REPLACE INTO "+table+
+			" (name, owner, token, acquired_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+			name, l.owner, token, now.UnixNano()/1e6, now.Add(ttl).UnixNano()/1e6)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Lock{
+		l:     l,
+		name:  name,
+		token: token,
+		ttl:   ttl,
+		lost:  make(chan struct{}),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go k.renewLoop(now)
+	return k, nil
+}
+
+// Acquire waits until the lock can be taken or ctx is done.
+func (l *Locker) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	for {
+		k, err := l.TryAcquire(ctx, name, ttl)
+		if err != ErrNotAcquired && !isBusy(err) {
+			return k, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(l.retry):
+		}
+	}
+}
+
+// Renew extends the lease by its ttl; ErrLost if it is no longer ours.
+// The renewal goroutine calls it every ttl/3, there is normally no need
+// to call it directly.
+func (k *Lock) Renew(ctx context.Context) error {
+	l := k.l
+	res, err := l.db.ExecContext(ctx, "UPDATE "+sqlite3lex.QuoteIdent(l.table)+
+		" SET expires_at = ? WHERE name = ? AND token = ?",
+		l.now().Add(k.ttl).UnixNano()/1e6, k.name, k.token)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return ErrLost
+	}
+	return nil
+}
+
+func (k *Lock) markLost(err error) {
+	k.lostOnce.Do(func() {
+		k.mu.Lock()
+		k.err = err
+		k.mu.Unlock()
+		close(k.lost)
+	})
+}
+
+func (k *Lock) renewLoop(acquired time.Time) {
+	defer close(k.done)
+	interval := k.ttl / 3
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// The lease is given up one interval before it runs out, so that
+	// the holder stops before another process can take the lock over.
+	deadline := acquired.Add(k.ttl - interval)
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+		}
+		start := k.l.now()
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := k.Renew(ctx)
+		cancel()
+		switch {
+		case err == nil:
+			deadline = start.Add(k.ttl - interval)
+		case err == ErrLost || !k.l.now().Before(deadline):
+			// taken over, or transient errors lasted until the lease
+			// was about to run out
+			k.markLost(err)
+			return
+		}
+	}
+}
+
+// Release stops renewal and frees the lock (if still ours).
+func (k *Lock) Release(ctx context.Context) error {
+	k.stopOnce.Do(func() { close(k.stop) })
+	<-k.done
+
+	_, err := k.l.db.ExecContext(ctx, "DELETE FROM "+sqlite3lex.QuoteIdent(k.l.table)+
+		" WHERE name = ? AND token = ?", k.name, k.token)
+	k.markLost(nil)
+	return err
+}
+
+// Holder describes the current owner of a lock.
+type Holder struct {
+	Owner      string
+	AcquiredAt time.Time
+	ExpiresAt  time.Time
+}
+
+// Holder returns who holds the named lock; nil if it is free or expired.
+func (l *Locker) Holder(ctx context.Context, name string) (*Holder, error) {
+	var owner string
+	var acquired, expires int64
+	err := l.db.QueryRowContext(ctx, "SELECT owner, acquired_at, expires_at FROM "+
+		sqlite3lex.QuoteIdent(l.table)+" WHERE name = ?", name).Scan(&owner, &acquired, &expires)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	h := &Holder{
+		Owner:      owner,
+		AcquiredAt: time.Unix(0, acquired*1e6),
+		ExpiresAt:  time.Unix(0, expires*1e6),
+	}
+	if !h.ExpiresAt.After(l.now()) {
+		return nil, nil
+	}
+	return h, nil
+}
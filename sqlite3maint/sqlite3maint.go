@@ -0,0 +1,219 @@
+// Package sqlite3maint runs database maintenance tasks (index merges,
+// checkpoints, ANALYZE, ...) in the background, preferably during quiet
+// periods when the application is not using the database.
+package sqlite3maint
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3metrics"
+)
+
+// Task is a unit of periodic maintenance.
+type Task struct {
+	// Name identifies the task in logs and metrics (as a label value).
+	Name string
+	// Every is the desired interval between runs.
+	Every time.Duration
+	// Run does the work. It should respect ctx: the scheduler cancels it
+	// on Stop.
+	Run func(ctx context.Context, db *sql.DB) error
+}
+
+// Options configure a Scheduler.
+type Options struct {
+	// PollInterval is how often the scheduler looks for due tasks and
+	// quiet periods; 0 means 1 second.
+	PollInterval time.Duration
+
+	// QuietFor is how long the pool must have had no connection in use
+	// before a due task starts; 0 means 2 seconds.
+	QuietFor time.Duration
+
+	// MaxDelay lets a due task run even without a quiet period once it
+	// is that late; 0 means never force (wait for quiet).
+	MaxDelay time.Duration
+
+	// IsQuiet, if not nil, is consulted in addition to the pool usage,
+	// e.g. to look at the application's own request rate.
+	IsQuiet func() bool
+
+	// OnError receives task errors; nil ignores them (they are still counted).
+	OnError func(task string, err error)
+
+	// Metrics, if not nil, receives sqlite3_maint_* metrics.
+	Metrics *sqlite3metrics.Registry
+}
+
+type taskState struct {
+	Task
+	lastRun time.Time
+	due     time.Time
+}
+
+// Scheduler runs Tasks against one database. Tasks run one at a time.
+type Scheduler struct {
+	db   *sql.DB
+	opts Options
+
+	runs     sqlite3metrics.Counter
+	errors   sqlite3metrics.Counter
+	duration sqlite3metrics.Histogram
+
+	mu        sync.Mutex
+	tasks     []*taskState
+	busySince time.Time // last time the pool was seen in use
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewScheduler returns a stopped Scheduler.
+func NewScheduler(db *sql.DB, opts Options) *Scheduler {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.QuietFor <= 0 {
+		opts.QuietFor = 2 * time.Second
+	}
+	m := sqlite3metrics.OrNop(opts.Metrics)
+	return &Scheduler{
+		db:   db,
+		opts: opts,
+		runs: m.Counter("maint", "task_runs_total",
+			"Maintenance task runs.", "task"),
+		errors: m.Counter("maint", "task_errors_total",
+			"Maintenance task runs that failed.", "task"),
+		duration: m.Histogram("maint", "task_duration_seconds",
+			"Duration of maintenance task runs.", nil, "task"),
+		busySince: time.Now(),
+	}
+}
+
+// Add registers a task; its first run is due one interval from now.
+func (s *Scheduler) Add(t Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, &taskState{Task: t, due: time.Now().Add(t.Every)})
+}
+
+// RunNow marks the named task as due immediately
+// (it still waits for a quiet period).
+func (s *Scheduler) RunNow(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tasks {
+		if t.Name == name {
+			t.due = time.Now()
+		}
+	}
+}
+
+// Start launches the scheduler goroutine.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.loop(ctx, s.done)
+}
+
+// Stop cancels a running task and waits for the scheduler to exit.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if t := s.pick(time.Now()); t != nil {
+			s.run(ctx, t)
+		}
+	}
+}
+
+// pick returns the most overdue task that may run now, if any.
+func (s *Scheduler) pick(now time.Time) *taskState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db.Stats().InUse > 0 || (s.opts.IsQuiet != nil && !s.opts.IsQuiet()) {
+		s.busySince = now
+	}
+	quiet := now.Sub(s.busySince) >= s.opts.QuietFor
+
+	var best *taskState
+	for _, t := range s.tasks {
+		if now.Before(t.due) {
+			continue
+		}
+		forced := s.opts.MaxDelay > 0 && now.Sub(t.due) >= s.opts.MaxDelay
+		if !quiet && !forced {
+			continue
+		}
+		if best == nil || t.due.Before(best.due) {
+			best = t
+		}
+	}
+	return best
+}
+
+func (s *Scheduler) run(ctx context.Context, t *taskState) {
+	start := time.Now()
+	err := t.Run(ctx, s.db)
+	elapsed := time.Since(start)
+
+	s.runs.Add(1, t.Name)
+	s.duration.Observe(elapsed.Seconds(), t.Name)
+	if err != nil {
+		s.errors.Add(1, t.Name)
+		if s.opts.OnError != nil {
+			s.opts.OnError(t.Name, err)
+		}
+	}
+
+	s.mu.Lock()
+	t.lastRun = start
+	t.due = start.Add(t.Every)
+	s.mu.Unlock()
+}
+
+// TaskStatus describes a registered task.
+type TaskStatus struct {
+	Name    string
+	LastRun time.Time
+	Due     time.Time
+}
+
+// Status returns the state of all tasks, in registration order.
+func (s *Scheduler) Status() []TaskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := make([]TaskStatus, len(s.tasks))
+	for i, t := range s.tasks {
+		st[i] = TaskStatus{Name: t.Name, LastRun: t.lastRun, Due: t.due}
+	}
+	return st
+}
@@ -0,0 +1,92 @@
+package sqlite3metrics
+
+import (
+	"expvar"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Expvar is a Backend publishing metrics through the standard 'expvar'
+// package (visible at /debug/vars when net/http's default mux is served).
+//
+// Every metric becomes an expvar.Map keyed by the label values
+// joined with ','; a metric without labels uses the single key "".
+// Histograms publish "count", "sum" and one "le_<bound>" entry per bucket
+// (cumulative, like Prometheus) under each label key.
+//
+// expvar names are process-global: creating two Registries with
+// the Expvar backend and the same namespace panics on the second
+// registration of a name, as expvar.Publish does.
+type Expvar struct{}
+
+func labelKey(labelValues []string) string {
+	return strings.Join(labelValues, ",")
+}
+
+type expvarCounter struct {
+	m *expvar.Map
+}
+
+func (c expvarCounter) Add(delta float64, labelValues ...string) {
+	c.m.AddFloat(labelKey(labelValues), delta)
+}
+
+type expvarGauge struct {
+	mu sync.Mutex
+	m  *expvar.Map
+}
+
+func (g *expvarGauge) Set(value float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.m.Get(key).(*expvar.Float); ok {
+		f.Set(value)
+		return
+	}
+	f := new(expvar.Float)
+	f.Set(value)
+	g.m.Set(key, f)
+}
+
+func (g *expvarGauge) Add(delta float64, labelValues ...string) {
+	g.m.AddFloat(labelKey(labelValues), delta)
+}
+
+type expvarHistogram struct {
+	mu      sync.Mutex
+	m       *expvar.Map
+	buckets []float64
+}
+
+func (h *expvarHistogram) Observe(value float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	sub, ok := h.m.Get(key).(*expvar.Map)
+	if !ok {
+		sub = new(expvar.Map).Init()
+		h.m.Set(key, sub)
+	}
+	h.mu.Unlock()
+
+	sub.Add("count", 1)
+	sub.AddFloat("sum", value)
+	for _, b := range h.buckets {
+		if value <= b {
+			sub.Add("le_"+strconv.FormatFloat(b, 'g', -1, 64), 1)
+		}
+	}
+}
+
+func (Expvar) NewCounter(d Desc) Counter {
+	return expvarCounter{m: expvar.NewMap(d.Name)}
+}
+
+func (Expvar) NewGauge(d Desc) Gauge {
+	return &expvarGauge{m: expvar.NewMap(d.Name)}
+}
+
+func (Expvar) NewHistogram(d Desc) Histogram {
+	return &expvarHistogram{m: expvar.NewMap(d.Name), buckets: d.Buckets}
+}
@@ -0,0 +1,15 @@
+package sqlite3metrics
+
+// Nop is the Backend that discards everything.
+// It is what components use when no Registry is configured.
+type Nop struct{}
+
+type nopMetric struct{}
+
+func (nopMetric) Add(float64, ...string)     {}
+func (nopMetric) Set(float64, ...string)     {}
+func (nopMetric) Observe(float64, ...string) {}
+
+func (Nop) NewCounter(Desc) Counter     { return nopMetric{} }
+func (Nop) NewGauge(Desc) Gauge         { return nopMetric{} }
+func (Nop) NewHistogram(Desc) Histogram { return nopMetric{} }
@@ -0,0 +1,75 @@
+// Package prommetrics is the Prometheus Backend for sqlite3metrics.
+//
+// It lives in its own package so that only programs which want Prometheus
+// depend on the client library.
+package prommetrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3metrics"
+)
+
+// Backend registers every metric with its Registerer.
+type Backend struct {
+	reg prometheus.Registerer
+}
+
+// New returns a Backend registering with reg;
+// nil means prometheus.DefaultRegisterer.
+func New(reg prometheus.Registerer) *Backend {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	return &Backend{reg: reg}
+}
+
+type counter struct{ v *prometheus.CounterVec }
+
+func (c counter) Add(delta float64, labelValues ...string) {
+	c.v.WithLabelValues(labelValues...).Add(delta)
+}
+
+type gauge struct{ v *prometheus.GaugeVec }
+
+func (g gauge) Set(value float64, labelValues ...string) {
+	g.v.WithLabelValues(labelValues...).Set(value)
+}
+
+func (g gauge) Add(delta float64, labelValues ...string) {
+	g.v.WithLabelValues(labelValues...).Add(delta)
+}
+
+type histogram struct{ v *prometheus.HistogramVec }
+
+func (h histogram) Observe(value float64, labelValues ...string) {
+	h.v.WithLabelValues(labelValues...).Observe(value)
+}
+
+func (b *Backend) NewCounter(d sqlite3metrics.Desc) sqlite3metrics.Counter {
+	v := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: d.Name,
+		Help: d.Help,
+	}, d.LabelNames)
+	b.reg.MustRegister(v)
+	return counter{v}
+}
+
+func (b *Backend) NewGauge(d sqlite3metrics.Desc) sqlite3metrics.Gauge {
+	v := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: d.Name,
+		Help: d.Help,
+	}, d.LabelNames)
+	b.reg.MustRegister(v)
+	return gauge{v}
+}
+
+func (b *Backend) NewHistogram(d sqlite3metrics.Desc) sqlite3metrics.Histogram {
+	v := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    d.Name,
+		Help:    d.Help,
+		Buckets: d.Buckets,
+	}, d.LabelNames)
+	b.reg.MustRegister(v)
+	return histogram{v}
+}
@@ -0,0 +1,227 @@
+// Package sqlite3metrics is the small metrics abstraction shared by
+// the subsystems of this repository (trace statistics, checkpointer,
+// backup, transaction wrappers, ...).
+//
+// Subsystems never talk to a metrics library directly: they ask a Registry
+// for a Counter, Gauge or Histogram. The Registry enforces one naming scheme
+// (namespace_subsystem_name, lowercase with underscores) and hands
+// the actual work to a pluggable Backend: no-op (the default), expvar
+// (standard library only) or Prometheus (see subpackage prommetrics).
+package sqlite3metrics
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultNamespace is the first component of every metric name
+// unless a Registry is created with a different namespace.
+const DefaultNamespace = "sqlite3"
+
+// Counter is a monotonically increasing value.
+// Label values (if any) must match, in order, the label names given
+// at registration time.
+type Counter interface {
+	Add(delta float64, labelValues ...string)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge interface {
+	Set(value float64, labelValues ...string)
+	Add(delta float64, labelValues ...string)
+}
+
+// Histogram records observations (typically durations in seconds
+// or sizes in bytes) into buckets.
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+// Desc fully describes a metric as passed to a Backend.
+// Name is already the complete, validated name (namespace included).
+type Desc struct {
+	Name       string
+	Help       string
+	LabelNames []string
+	Buckets    []float64 // only meaningful for histograms
+}
+
+// Backend creates the concrete metric implementations.
+// Each method is called at most once per metric name by a Registry.
+type Backend interface {
+	NewCounter(d Desc) Counter
+	NewGauge(d Desc) Gauge
+	NewHistogram(d Desc) Histogram
+}
+
+// DefaultBuckets are used for histograms registered without buckets;
+// suitable for latencies expressed in seconds.
+var DefaultBuckets = []float64{
+	0.00001, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10,
+}
+
+type kind int
+
+const (
+	counterKind kind = iota
+	gaugeKind
+	histogramKind
+)
+
+func (k kind) String() string {
+	switch k {
+	case counterKind:
+		return "counter"
+	case gaugeKind:
+		return "gauge"
+	case histogramKind:
+		return "histogram"
+	}
+	return "unknown"
+}
+
+type entry struct {
+	kind   kind
+	labels []string
+	metric interface{}
+}
+
+// Registry hands out metrics with consistent names.
+// Asking twice for the same name returns the same metric,
+// so independent components (or several instances of one component)
+// can share it safely.
+//
+// Registration mistakes (invalid names, same name with a different kind
+// or different label names) are programming errors and cause a panic,
+// the same way prometheus.MustRegister does.
+type Registry struct {
+	backend   Backend
+	namespace string
+
+	mu      sync.Mutex
+	metrics map[string]*entry
+}
+
+// NewRegistry returns a Registry using DefaultNamespace.
+// A nil backend means Nop.
+func NewRegistry(backend Backend) *Registry {
+	return NewRegistryNamespace(backend, DefaultNamespace)
+}
+
+// NewRegistryNamespace returns a Registry whose metric names start
+// with the given namespace instead of DefaultNamespace.
+func NewRegistryNamespace(backend Backend, namespace string) *Registry {
+	if backend == nil {
+		backend = Nop{}
+	}
+	if !validName.MatchString(namespace) {
+		panic(fmt.Sprintf("sqlite3metrics: invalid namespace %q", namespace))
+	}
+	return &Registry{
+		backend:   backend,
+		namespace: namespace,
+		metrics:   make(map[string]*entry),
+	}
+}
+
+var nopRegistry = NewRegistry(Nop{})
+
+// OrNop returns r, or a shared no-op Registry if r is nil.
+// Components accepting an optional *Registry use it so they never
+// have to check for nil at every update.
+func OrNop(r *Registry) *Registry {
+	if r == nil {
+		return nopRegistry
+	}
+	return r
+}
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// FullName builds the metric name used for the given subsystem and name.
+func (r *Registry) FullName(subsystem, name string) string {
+	parts := []string{r.namespace}
+	if subsystem != "" {
+		parts = append(parts, subsystem)
+	}
+	return strings.Join(append(parts, name), "_")
+}
+
+func (r *Registry) lookup(k kind, subsystem, name string, labelNames []string,
+	create func(d Desc) interface{}, buckets []float64, help string) interface{} {
+	if subsystem != "" && !validName.MatchString(subsystem) {
+		panic(fmt.Sprintf("sqlite3metrics: invalid subsystem %q", subsystem))
+	}
+	if !validName.MatchString(name) {
+		panic(fmt.Sprintf("sqlite3metrics: invalid metric name %q", name))
+	}
+	for _, l := range labelNames {
+		if !validName.MatchString(l) {
+			panic(fmt.Sprintf("sqlite3metrics: invalid label name %q for %s", l, name))
+		}
+	}
+	full := r.FullName(subsystem, name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.metrics[full]; ok {
+		if e.kind != k {
+			panic(fmt.Sprintf("sqlite3metrics: %s already registered as %s, not %s",
+				full, e.kind, k))
+		}
+		if strings.Join(e.labels, ",") != strings.Join(labelNames, ",") {
+			panic(fmt.Sprintf("sqlite3metrics: %s already registered with labels %v, not %v",
+				full, e.labels, labelNames))
+		}
+		return e.metric
+	}
+
+	m := create(Desc{
+		Name:       full,
+		Help:       help,
+		LabelNames: append([]string(nil), labelNames...),
+		Buckets:    buckets,
+	})
+	r.metrics[full] = &entry{kind: k, labels: labelNames, metric: m}
+	return m
+}
+
+// Counter returns the counter subsystem_name, registering it on first use.
+func (r *Registry) Counter(subsystem, name, help string, labelNames ...string) Counter {
+	return r.lookup(counterKind, subsystem, name, labelNames,
+		func(d Desc) interface{} { return r.backend.NewCounter(d) },
+		nil, help).(Counter)
+}
+
+// Gauge returns the gauge subsystem_name, registering it on first use.
+func (r *Registry) Gauge(subsystem, name, help string, labelNames ...string) Gauge {
+	return r.lookup(gaugeKind, subsystem, name, labelNames,
+		func(d Desc) interface{} { return r.backend.NewGauge(d) },
+		nil, help).(Gauge)
+}
+
+// Histogram returns the histogram subsystem_name, registering it
+// on first use. Nil buckets means DefaultBuckets.
+func (r *Registry) Histogram(subsystem, name, help string, buckets []float64,
+	labelNames ...string) Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return r.lookup(histogramKind, subsystem, name, labelNames,
+		func(d Desc) interface{} { return r.backend.NewHistogram(d) },
+		buckets, help).(Histogram)
+}
+
+// Names returns the full names of all metrics registered so far.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.metrics))
+	for n := range r.metrics {
+		names = append(names, n)
+	}
+	return names
+}
@@ -0,0 +1,244 @@
+// Package sqlite3probe classifies files before (or instead of) opening
+// them as SQLite databases, so that tools can report precisely what is
+// wrong instead of SQLite's generic "file is not a database".
+package sqlite3probe
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// Kind is the classification of a probed file.
+type Kind int
+
+const (
+	KindMissing      Kind = iota // no such file
+	KindEmpty                    // zero-length file (SQLite treats it as a new, empty database)
+	KindPlain                    // regular, unencrypted SQLite 3 database
+	KindEncrypted                // looks like an encrypted database (SQLCipher, SEE, ...)
+	KindNotADatabase             // something else entirely
+)
+
+var kindNames = map[Kind]string{
+	KindMissing:      "missing",
+	KindEmpty:        "empty",
+	KindPlain:        "plain SQLite",
+	KindEncrypted:    "encrypted SQLite (probably)",
+	KindNotADatabase: "not a database",
+}
+
+func (k Kind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Errors returned by Result.Err, one per unusable Kind.
+var (
+	ErrMissing      = errors.New("sqlite3probe: database file does not exist")
+	ErrEncrypted    = errors.New("sqlite3probe: database file appears to be encrypted; a key is required")
+	ErrNotADatabase = errors.New("sqlite3probe: file is not an SQLite database")
+	ErrUnreadable   = errors.New("sqlite3probe: SQLite header present but the database could not be read")
+)
+
+var errShortHeader = errors.New("short header")
+
+var headerMagic = []byte("SQLite format 3\x00")
+
+// minEncryptedSize is the smallest page size SQLite supports:
+// an encrypted database has at least one full page.
+const minEncryptedSize = 512
+
+const headerSize = 100
+
+// Result is what Probe found out about a file.
+type Result struct {
+	Path string
+	Kind Kind
+	Size int64
+
+	// Fields decoded from the header; only set for KindPlain.
+	PageSize     int
+	WALMode      bool   // header says the database is in WAL mode
+	SQLiteVerNum uint32 // SQLITE_VERSION_NUMBER that last wrote the file
+
+	// Companion files next to the database.
+	WALPresent     bool
+	WALBytes       int64
+	SHMPresent     bool
+	JournalPresent bool // rollback journal: an interrupted transaction awaits recovery
+
+	// OpenErr is the error from the no-key, read-only open attempt
+	// (nil if it succeeded or was not attempted).
+	OpenErr error
+}
+
+// Err returns nil if the file can be opened as a database without a key,
+// otherwise a precise error.
+func (r *Result) Err() error {
+	switch r.Kind {
+	case KindMissing:
+		return fmt.Errorf("%w: %s", ErrMissing, r.Path)
+	case KindEncrypted:
+		return fmt.Errorf("%w: %s", ErrEncrypted, r.Path)
+	case KindNotADatabase:
+		return fmt.Errorf("%w: %s", ErrNotADatabase, r.Path)
+	case KindPlain:
+		if r.OpenErr != nil {
+			return fmt.Errorf("%w: %s: %v", ErrUnreadable, r.Path, r.OpenErr)
+		}
+	}
+	return nil
+}
+
+// String summarizes the result in one line.
+func (r *Result) String() string {
+	var extra []string
+	if r.WALMode {
+		extra = append(extra, "WAL mode")
+	}
+	if r.WALPresent {
+		extra = append(extra, fmt.Sprintf("-wal %d bytes", r.WALBytes))
+	}
+	if r.SHMPresent {
+		extra = append(extra, "-shm present")
+	}
+	if r.JournalPresent {
+		extra = append(extra, "hot journal")
+	}
+	if r.OpenErr != nil {
+		extra = append(extra, "open failed: "+r.OpenErr.Error())
+	}
+	s := fmt.Sprintf("%s: %s, %d bytes", r.Path, r.Kind, r.Size)
+	if len(extra) > 0 {
+		s += " (" + strings.Join(extra, ", ") + ")"
+	}
+	return s
+}
+
+// Probe inspects the file at path. The returned error is only about
+// probing itself (e.g. permission denied); what the file is, or why it
+// cannot be used, is described by the Result.
+func Probe(path string) (*Result, error) {
+	r := &Result{Path: path}
+
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		r.Kind = KindMissing
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		r.Kind = KindNotADatabase
+		return r, nil
+	}
+	r.Size = fi.Size()
+	probeCompanions(r)
+
+	if r.Size == 0 {
+		r.Kind = KindEmpty
+		return r, nil
+	}
+
+	header, err := readHeader(path)
+	if err != nil && err != errShortHeader {
+		return nil, err
+	}
+	if err == nil && bytes.HasPrefix(header, headerMagic) {
+		r.Kind = KindPlain
+		decodeHeader(r, header)
+		r.OpenErr = tryOpen(path)
+		return r, nil
+	}
+
+	// No plain header. SQLCipher (and SEE) files start with random-looking
+	// bytes and have a size that is a multiple of the page size;
+	// confirm that SQLite itself refuses the file before calling it
+	// encrypted.
+	r.OpenErr = tryOpen(path)
+	if r.Size >= minEncryptedSize && r.Size%512 == 0 && isNotADB(r.OpenErr) {
+		r.Kind = KindEncrypted
+	} else {
+		r.Kind = KindNotADatabase
+	}
+	return r, nil
+}
+
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, errShortHeader
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// decodeHeader reads the fields documented in "Database File Format",
+// section 1.3 (The Database Header).
+func decodeHeader(r *Result, h []byte) {
+	ps := int(h[16])<<8 | int(h[17])
+	if ps == 1 {
+		ps = 65536
+	}
+	r.PageSize = ps
+	r.WALMode = h[18] == 2 && h[19] == 2
+	r.SQLiteVerNum = uint32(h[96])<<24 | uint32(h[97])<<16 | uint32(h[98])<<8 | uint32(h[99])
+}
+
+func probeCompanions(r *Result) {
+	if fi, err := os.Stat(r.Path + "-wal"); err == nil {
+		r.WALPresent = true
+		r.WALBytes = fi.Size()
+	}
+	if _, err := os.Stat(r.Path + "-shm"); err == nil {
+		r.SHMPresent = true
+	}
+	if fi, err := os.Stat(r.Path + "-journal"); err == nil && fi.Size() > 0 {
+		r.JournalPresent = true
+	}
+}
+
+// uriEscaper escapes the characters that have a meaning in SQLite URI filenames.
+var uriEscaper = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+
+// FileURI returns the URI filename ("file:...") of path, with the
+// characters that have a meaning in URIs escaped; query parameters
+// can be appended after a '?'.
+func FileURI(path string) string {
+	return "file:" + uriEscaper.Replace(path)
+}
+
+// tryOpen opens path read-only, without a key, and reads the schema.
+func tryOpen(path string) error {
+	db, err := sql.Open("sqlite3", FileURI(path)+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var n int
+	return db.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&n)
+}
+
+func isNotADB(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrNotADB
+}
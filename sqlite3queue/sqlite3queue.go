@@ -0,0 +1,419 @@
+// Package sqlite3queue is a durable job queue stored in an SQLite
+// database, usable by several processes sharing the file.
+//
+// Jobs have a payload, a priority and a visibility timeout: a claimed
+// job that is neither completed nor failed before the timeout becomes
+// claimable again (its worker is presumed dead). Failed jobs are retried
+// with exponential backoff and end up in a dead-letter table after
+// MaxAttempts, as do the jobs whose last attempt timed out. A claim is
+// identified by the job's attempt number: once the job is claimed
+// again, the previous worker can no longer extend, complete or fail it.
+package sqlite3queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3caps"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3metrics"
+)
+
+// ErrEmpty is returned by Claim when no job is ready.
+var ErrEmpty = errors.New("sqlite3queue: no job ready")
+
+// ErrLostClaim is returned by Extend, Complete and Fail when the job
+// is no longer the caller's: its visibility timeout expired and another
+// worker claimed it (or it was completed, failed or dead-lettered since).
+// The job is left to its current owner.
+var ErrLostClaim = errors.New("sqlite3queue: job claim lost")
+
+// Options configure a Queue.
+type Options struct {
+	// Table prefix; the job table is <Prefix>jobs and the dead-letter
+	// table <Prefix>dead. Empty means "sqlite3_queue_".
+	Prefix string
+	// Visibility is how long a claimed job stays invisible to other
+	// workers; 0 means 5 minutes.
+	Visibility time.Duration
+	// MaxAttempts before a job goes to the dead-letter table
+	// (default for Enqueue); 0 means 5.
+	MaxAttempts int
+	// BackoffBase and BackoffMax bound the retry delay
+	// base * 2^(attempt-1) (with ±20% jitter); 0 means 1s and 1h.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Classic forces the claim to use SELECT + UPDATE in a BEGIN IMMEDIATE
+	// transaction even when the SQLite library supports UPDATE ...
+	// RETURNING (3.35.0+).
+	Classic bool
+	// Metrics, if not nil, receives sqlite3_queue_* metrics.
+	Metrics *sqlite3metrics.Registry
+}
+
+// Job is a claimed job.
+type Job struct {
+	ID          int64
+	Queue       string
+	Payload     []byte
+	Priority    int
+	Attempts    int // including the current one
+	MaxAttempts int
+	LastError   string
+	CreatedAt   time.Time
+}
+
+// EnqueueOptions are per-job settings.
+type EnqueueOptions struct {
+	Priority    int           // higher runs first
+	Delay       time.Duration // not claimable before now + Delay
+	MaxAttempts int           // 0: the queue default
+}
+
+// Queue is a handle on the queue tables.
+type Queue struct {
+	db        *sql.DB
+	opts      Options
+	jobs      string
+	dead      string
+	returning bool
+
+	enqueued     sqlite3metrics.Counter
+	completed    sqlite3metrics.Counter
+	failed       sqlite3metrics.Counter
+	deadLettered sqlite3metrics.Counter
+}
+
+// New creates the queue tables if needed.
+func New(ctx context.Context, db *sql.DB, opts Options) (*Queue, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "sqlite3_queue_"
+	}
+	if opts.Visibility <= 0 {
+		opts.Visibility = 5 * time.Minute
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.BackoffBase <= 0 {
+		opts.BackoffBase = time.Second
+	}
+	if opts.BackoffMax <= 0 {
+		opts.BackoffMax = time.Hour
+	}
+	m := sqlite3metrics.OrNop(opts.Metrics)
+	q := &Queue{
+		db:   db,
+		opts: opts,
+		jobs: sqlite3lex.QuoteIdent(opts.Prefix + "jobs"),
+		dead: sqlite3lex.QuoteIdent(opts.Prefix + "dead"),
+		enqueued: m.Counter("queue", "enqueued_total",
+			"Jobs enqueued.", "queue"),
+		completed: m.Counter("queue", "completed_total",
+			"Jobs completed.", "queue"),
+		failed: m.Counter("queue", "failed_total",
+			"Job attempts that failed.", "queue"),
+		deadLettered: m.Counter("queue", "dead_lettered_total",
+			"Jobs moved to the dead-letter table.", "queue"),
+	}
+
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + q.jobs + ` (
+ id INTEGER PRIMARY KEY AUTOINCREMENT,
+ queue TEXT NOT NULL,
+ payload BLOB,
+ priority INTEGER NOT NULL DEFAULT 0,
+ attempts INTEGER NOT NULL DEFAULT 0,
+ max_attempts INTEGER NOT NULL,
+ run_at INTEGER NOT NULL,
+ locked_until INTEGER NOT NULL DEFAULT 0,
+ last_error TEXT NOT NULL DEFAULT '',
+ created_at INTEGER NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS ` + sqlite3lex.QuoteIdent(opts.Prefix+"jobs_ready") +
+			` ON ` + q.jobs + ` (queue, priority DESC, run_at, id)`,
+		`CREATE TABLE IF NOT EXISTS ` + q.dead + ` (
+ id INTEGER PRIMARY KEY,
+ queue TEXT NOT NULL,
+ payload BLOB,
+ priority INTEGER NOT NULL,
+ attempts INTEGER NOT NULL,
+ last_error TEXT NOT NULL,
+ created_at INTEGER NOT NULL,
+ failed_at INTEGER NOT NULL
+)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.ExecContext(ctx, s); err != nil {
+			return nil, fmt.Errorf("sqlite3queue: creating tables: %w", err)
+		}
+	}
+
+	if !opts.Classic {
+		q.returning = sqlite3caps.AtLeast("3.35.0")
+	}
+	return q, nil
+}
+
+func ms(t time.Time) int64 {
+	return t.UnixNano() / 1e6
+}
+
+func fromMs(v int64) time.Time {
+	return time.Unix(0, v*1e6)
+}
+
+// Enqueue adds a job and returns its ID.
+func (q *Queue) Enqueue(ctx context.Context, queue string, payload []byte, opts *EnqueueOptions) (int64, error) {
+	if opts == nil {
+		opts = &EnqueueOptions{}
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = q.opts.MaxAttempts
+	}
+	now := time.Now()
+	res, err := q.db.ExecContext(ctx, `INSERT INTO `+q.jobs+
+		` (queue, payload, priority, max_attempts, run_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		queue, payload, opts.Priority, maxAttempts, ms(now.Add(opts.Delay)), ms(now))
+	if err != nil {
+		return 0, err
+	}
+	q.enqueued.Add(1, queue)
+	return res.LastInsertId()
+}
+
+const jobColumns = "id, queue, payload, priority, attempts, max_attempts, last_error, created_at"
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var j Job
+	var created int64
+	err := row.Scan(&j.ID, &j.Queue, &j.Payload, &j.Priority, &j.Attempts,
+		&j.MaxAttempts, &j.LastError, &created)
+	if err == sql.ErrNoRows {
+		return nil, ErrEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+	j.CreatedAt = fromMs(created)
+	return &j, nil
+}
+
+// Claim takes the best ready job of the queue (highest priority, then
+// oldest) for the visibility timeout, or returns ErrEmpty. Jobs whose
+// last attempt timed out (their worker died, maybe because of them)
+// are moved to the dead-letter table first.
+func (q *Queue) Claim(ctx context.Context, queue string) (*Job, error) {
+	now := time.Now()
+	if err := q.reap(ctx, queue, now); err != nil {
+		return nil, err
+	}
+	pick := `SELECT id FROM ` + q.jobs + ` WHERE queue = ? AND run_at <= ? AND locked_until <= ?
+ AND attempts < max_attempts ORDER BY priority DESC, run_at, id LIMIT 1`
+	update := `UPDATE ` + q.jobs + ` SET attempts = attempts + 1, locked_until = ? WHERE id = `
+	lockedUntil := ms(now.Add(q.opts.Visibility))
+
+	if q.returning {
+		return scanJob(q.db.QueryRowContext(ctx,
+			update+`(`+pick+`) RETURNING `+jobColumns,
+			lockedUntil, queue, ms(now), ms(now)))
+	}
+
+	// Classic pattern for SQLite < 3.35: the write lock taken by
+	// BEGIN IMMEDIATE makes SELECT + UPDATE atomic.
+	conn, err := q.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return nil, err
+	}
+	var id int64
+	err = conn.QueryRowContext(ctx, pick, queue, ms(now), ms(now)).Scan(&id)
+	if err == nil {
+		_, err = conn.ExecContext(ctx, update+`?`, lockedUntil, id)
+	}
+	var job *Job
+	if err == nil {
+		job, err = scanJob(conn.QueryRowContext(ctx,
+			`SELECT `+jobColumns+` FROM `+q.jobs+` WHERE id = ?`, id))
+	}
+	if err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		if err == sql.ErrNoRows {
+			return nil, ErrEmpty
+		}
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		return nil, err
+	}
+	return job, nil
+}
+
+// reap moves to the dead-letter table the jobs of queue that are out
+// of attempts and whose last claim expired. A read checks first that
+// there is any, so that idle polling does not take the write lock.
+func (q *Queue) reap(ctx context.Context, queue string, now time.Time) error {
+	const expired = ` WHERE queue = ? AND attempts >= max_attempts AND locked_until > 0 AND locked_until <= ?`
+	var one int
+	err := q.db.QueryRowContext(ctx, `SELECT 1 FROM `+q.jobs+expired+` LIMIT 1`, queue, ms(now)).Scan(&one)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO `+q.dead+
+		` (id, queue, payload, priority, attempts, last_error, created_at, failed_at)
+ SELECT id, queue, payload, priority, attempts, 'visibility timeout expired', created_at, ? FROM `+q.jobs+expired,
+		ms(now), queue, ms(now))
+	var n int64
+	if err == nil {
+		n, err = res.RowsAffected()
+	}
+	if err == nil && n > 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+q.jobs+expired, queue, ms(now))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if n > 0 {
+		q.deadLettered.Add(float64(n), queue)
+	}
+	return nil
+}
+
+// execClaimed runs a statement on a claimed job, with the job ID and
+// attempt number as its last arguments, returning ErrLostClaim if it
+// changed no row.
+func execClaimed(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, query string, job *Job, args ...interface{}) error {
+	res, err := db.ExecContext(ctx, query, append(args, job.ID, job.Attempts)...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLostClaim
+	}
+	return nil
+}
+
+// Extend pushes the visibility timeout of a claimed job to now + d,
+// for jobs running longer than expected.
+func (q *Queue) Extend(ctx context.Context, job *Job, d time.Duration) error {
+	return execClaimed(ctx, q.db, `UPDATE `+q.jobs+` SET locked_until = ? WHERE id = ? AND attempts = ?`,
+		job, ms(time.Now().Add(d)))
+}
+
+// Complete removes a finished job.
+func (q *Queue) Complete(ctx context.Context, job *Job) error {
+	err := execClaimed(ctx, q.db, `DELETE FROM `+q.jobs+` WHERE id = ? AND attempts = ?`, job)
+	if err == nil {
+		q.completed.Add(1, job.Queue)
+	}
+	return err
+}
+
+// Backoff returns the retry delay after the given attempt.
+func (q *Queue) Backoff(attempt int) time.Duration {
+	d := q.opts.BackoffBase
+	for i := 1; i < attempt && d < q.opts.BackoffMax; i++ {
+		d *= 2
+	}
+	if d > q.opts.BackoffMax {
+		d = q.opts.BackoffMax
+	}
+	jitter := 0.8 + 0.4*rand.Float64()
+	return time.Duration(float64(d) * jitter)
+}
+
+// Fail records a failed attempt: the job is retried after a backoff,
+// or moved to the dead-letter table once out of attempts.
+func (q *Queue) Fail(ctx context.Context, job *Job, cause error) error {
+	msg := ""
+	if cause != nil {
+		msg = cause.Error()
+	}
+	q.failed.Add(1, job.Queue)
+
+	if job.Attempts < job.MaxAttempts {
+		return execClaimed(ctx, q.db, `UPDATE `+q.jobs+
+			` SET run_at = ?, locked_until = 0, last_error = ? WHERE id = ? AND attempts = ?`,
+			job, ms(time.Now().Add(q.Backoff(job.Attempts))), msg)
+	}
+
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = execClaimed(ctx, tx, `INSERT OR REPLACE INTO `+q.dead+
+		` (id, queue, payload, priority, attempts, last_error, created_at, failed_at)
+ SELECT id, queue, payload, priority, attempts, ?, created_at, ? FROM `+q.jobs+` WHERE id = ? AND attempts = ?`,
+		job, msg, ms(time.Now()))
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+q.jobs+` WHERE id = ?`, job.ID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	q.deadLettered.Add(1, job.Queue)
+	return nil
+}
+
+// Requeue moves a dead-lettered job back to its queue with fresh attempts.
+func (q *Queue) Requeue(ctx context.Context, id int64) error {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO `+q.jobs+
+		` (queue, payload, priority, max_attempts, run_at, created_at)
+ SELECT queue, payload, priority, ?, ?, created_at FROM `+q.dead+` WHERE id = ?`,
+		q.opts.MaxAttempts, ms(time.Now()), id)
+	if err == nil {
+		var n int64
+		if n, err = res.RowsAffected(); err == nil && n == 0 {
+			err = fmt.Errorf("sqlite3queue: no dead job %d", id)
+		}
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+q.dead+` WHERE id = ?`, id)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Len returns the number of jobs in the queue (ready, delayed or running).
+func (q *Queue) Len(ctx context.Context, queue string) (int, error) {
+	var n int
+	err := q.db.QueryRowContext(ctx, `SELECT count(*) FROM `+q.jobs+` WHERE queue = ?`, queue).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,82 @@
+package sqlite3queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Handler processes one job; returning an error fails the attempt.
+type Handler func(ctx context.Context, job *Job) error
+
+// WorkerOptions configure Run.
+type WorkerOptions struct {
+	// Workers is the number of concurrent handlers; 0 means 1.
+	Workers int
+	// PollInterval is how long an idle worker sleeps when the queue is
+	// empty; 0 means 1 second.
+	PollInterval time.Duration
+	// OnError receives queue errors (claim, complete, fail) that are not
+	// the handler's; nil ignores them.
+	OnError func(err error)
+}
+
+// Run processes jobs of the named queue until ctx is done, then waits
+// for running handlers to return. Handlers get a context cancelled at
+// shutdown; a job interrupted that way is failed (and retried later).
+// A handler panic fails the job instead of crashing the process.
+func (q *Queue) Run(ctx context.Context, queue string, h Handler, opts WorkerOptions) {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	report := func(err error) {
+		if err != nil && opts.OnError != nil {
+			opts.OnError(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				job, err := q.Claim(ctx, queue)
+				if err != nil {
+					if err != ErrEmpty && ctx.Err() == nil {
+						report(err)
+					}
+					select {
+					case <-ctx.Done():
+					case <-time.After(opts.PollInterval):
+					}
+					continue
+				}
+
+				herr := runHandler(ctx, h, job)
+				// use a fresh context: the outcome must be recorded even at shutdown
+				fctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				if herr == nil {
+					report(q.Complete(fctx, job))
+				} else {
+					report(q.Fail(fctx, job, herr))
+				}
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func runHandler(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("sqlite3queue: handler panic: %v", p)
+		}
+	}()
+	return h(ctx, job)
+}
@@ -0,0 +1,148 @@
+// Package sqlite3ratelimit is a token-bucket rate limiter whose state
+// lives in an SQLite table, so limits are durable and shared by all
+// processes using the same database file (CLIs, small services)
+// without an extra server.
+package sqlite3ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Options configure a Limiter.
+type Options struct {
+	// Rate is the number of tokens added per second.
+	Rate float64
+	// Burst is the bucket capacity (maximum tokens).
+	Burst float64
+	// Table holds one row per key; empty means "sqlite3_ratelimit".
+	Table string
+	// Now returns the current time; nil means time.Now.
+	Now func() time.Time
+}
+
+// Result is the outcome of AllowN.
+type Result struct {
+	Allowed    bool
+	Remaining  float64       // tokens left after this call
+	RetryAfter time.Duration // when not allowed: wait at least this long
+}
+
+// Limiter applies one rate to any number of keys.
+type Limiter struct {
+	db    *sql.DB
+	opts  Options
+	table string
+}
+
+// New creates the limiter table if needed.
+func New(ctx context.Context, db *sql.DB, opts Options) (*Limiter, error) {
+	if opts.Rate <= 0 || opts.Burst <= 0 {
+		return nil, fmt.Errorf("sqlite3ratelimit: Rate and Burst must be positive")
+	}
+	if opts.Table == "" {
+		opts.Table = "sqlite3_ratelimit"
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	l := &Limiter{db: db, opts: opts, table: sqlite3lex.QuoteIdent(opts.Table)}
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+l.table+` (
+ key TEXT PRIMARY KEY NOT NULL,
+ tokens REAL NOT NULL,
+ updated_at INTEGER NOT NULL
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3ratelimit: creating table: %w", err)
+	}
+	return l, nil
+}
+
+// Allow takes one token for key.
+func (l *Limiter) Allow(ctx context.Context, key string) (bool, error) {
+	r, err := l.AllowN(ctx, key, 1)
+	return r.Allowed, err
+}
+
+// AllowN takes n tokens for key if available; otherwise nothing is taken.
+// The read-refill-write cycle runs in a BEGIN IMMEDIATE transaction,
+// so concurrent processes never both spend the same tokens.
+func (l *Limiter) AllowN(ctx context.Context, key string, n float64) (Result, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return Result{}, err
+	}
+	rollback := func() { conn.ExecContext(context.Background(), "ROLLBACK") }
+
+	now := l.opts.Now()
+	nowMs := now.UnixNano() / 1e6
+	tokens := l.opts.Burst
+	var updated int64
+	err = conn.QueryRowContext(ctx, `SELECT tokens, updated_at FROM `+l.table+` WHERE key = ?`, key).
+		Scan(&tokens, &updated)
+	switch {
+	case err == sql.ErrNoRows:
+		tokens = l.opts.Burst
+	case err != nil:
+		rollback()
+		return Result{}, err
+	default:
+		if elapsed := float64(nowMs-updated) / 1000; elapsed > 0 {
+			tokens += elapsed * l.opts.Rate
+		}
+		if tokens > l.opts.Burst {
+			tokens = l.opts.Burst
+		}
+	}
+
+	var r Result
+	if tokens >= n {
+		tokens -= n
+		r.Allowed = true
+	} else {
+		r.RetryAfter = time.Duration((n - tokens) / l.opts.Rate * float64(time.Second))
+	}
+	r.Remaining = tokens
+
+	_, err = conn.ExecContext(ctx, `INSERT OR REPLACE INTO `+l.table+
+		` (key, tokens, updated_at) VALUES (?, ?, ?)`, key, tokens, nowMs)
+	if err != nil {
+		rollback()
+		return Result{}, err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		rollback()
+		return Result{}, err
+	}
+	return r, nil
+}
+
+// Reset forgets the state of key (its bucket is full again).
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	_, err := l.db.ExecContext(ctx, `DELETE FROM `+l.table+` WHERE key = ?`, key)
+	return err
+}
+
+// Cleanup deletes keys whose bucket has refilled completely: they are
+// indistinguishable from keys never seen. Run it periodically (e.g. as a
+// sqlite3maint task) to keep the table small. Returns the number deleted.
+func (l *Limiter) Cleanup(ctx context.Context) (int64, error) {
+	nowMs := l.opts.Now().UnixNano() / 1e6
+	// refilled when tokens + (now - updated_at)/1000 * rate >= burst
+	res, err := l.db.ExecContext(ctx, `DELETE FROM `+l.table+
+		` WHERE tokens + (? - updated_at) / 1000.0 * ? >= ?`,
+		nowMs, l.opts.Rate, l.opts.Burst)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,260 @@
+package sqlite3repl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3caps"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// StateTable keeps, in each target database, the last sequence
+// applied from each source.
+const StateTable = "sqlite3_repl_state"
+
+// ConflictKind says how a change did not fit the target.
+type ConflictKind string
+
+// Conflict kinds.
+const (
+	// ConflictExists: an inserted row already exists.
+	ConflictExists ConflictKind = "exists"
+	// ConflictNotFound: an updated or deleted row does not exist.
+	ConflictNotFound ConflictKind = "not_found"
+	// ConflictConstraint: the change violates a constraint of the target.
+	ConflictConstraint ConflictKind = "constraint"
+)
+
+// Conflict reports a change that could not be applied as is.
+type Conflict struct {
+	Change Change
+	Kind   ConflictKind
+	Err    error // for ConflictConstraint
+}
+
+// Policy decides how conflicts are resolved.
+type Policy int
+
+const (
+	// Overwrite makes the target row match the source: an existing row
+	// is replaced, a missing updated row is inserted, a missing deleted
+	// row is ignored. Constraint violations abort.
+	Overwrite Policy = iota
+	// Skip leaves the target as it is and goes on,
+	// also past constraint violations.
+	Skip
+	// Abort rolls the changeset back and returns ErrConflict.
+	Abort
+)
+
+// ErrConflict is returned (wrapped) when a changeset is aborted.
+var ErrConflict = errors.New("sqlite3repl: conflict")
+
+// Report is the outcome of applying a changeset.
+type Report struct {
+	Applied   int   // changes applied
+	Skipped   int   // changes already applied before (by sequence)
+	LastSeq   int64 // sequence now recorded for the source
+	Conflicts []Conflict
+}
+
+// Target receives changesets.
+type Target interface {
+	// LastSeq returns the last sequence applied from source (0 if none).
+	LastSeq(ctx context.Context, source string) (int64, error)
+	// Apply applies the changeset atomically, recording its last sequence.
+	Apply(ctx context.Context, cs *Changeset) (*Report, error)
+}
+
+// DBTarget is a Target database reachable through database/sql.
+type DBTarget struct {
+	DB     *sql.DB
+	Policy Policy
+}
+
+var _ Target = (*DBTarget)(nil)
+
+func initState(ctx context.Context, ex interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}) error {
+	_, err := ex.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+StateTable+
+		" (source TEXT PRIMARY KEY, seq INTEGER NOT NULL)")
+	return err
+}
+
+// LastSeq implements Target.
+func (t *DBTarget) LastSeq(ctx context.Context, source string) (int64, error) {
+	if err := initState(ctx, t.DB); err != nil {
+		return 0, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	var seq int64
+	err := t.DB.QueryRowContext(ctx, "SELECT seq FROM "+StateTable+" WHERE source = ?", source).Scan(&seq)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	return seq, nil
+}
+
+// Apply implements Target.
+func (t *DBTarget) Apply(ctx context.Context, cs *Changeset) (*Report, error) {
+	return ApplyChangeset(ctx, t.DB, cs, t.Policy)
+}
+
+// ApplyChangeset applies cs to db in one transaction, skipping the changes
+// at or below the sequence already recorded for cs.Source. It is the
+// receiving end for Targets behind a transport.
+func ApplyChangeset(ctx context.Context, db *sql.DB, cs *Changeset, policy Policy) (*Report, error) {
+	if err := sqlite3caps.RequireAtLeast("3.24.0", "sqlite3repl (upsert)"); err != nil {
+		return nil, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := initState(ctx, tx); err != nil {
+		return nil, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	r := &Report{}
+	err = tx.QueryRowContext(ctx, "SELECT seq FROM "+StateTable+" WHERE source = ?", cs.Source).Scan(&r.LastSeq)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("sqlite3repl: %w", err)
+	}
+
+	for _, c := range cs.Changes {
+		if c.Seq <= r.LastSeq {
+			r.Skipped++
+			continue
+		}
+		kind, err := applyChange(ctx, tx, c, policy)
+		if err != nil {
+			kind = ConflictConstraint
+		}
+		if kind != "" {
+			r.Conflicts = append(r.Conflicts, Conflict{Change: c, Kind: kind, Err: err})
+			if policy == Abort || (err != nil && policy != Skip) {
+				return r, fmt.Errorf("%w: change %d (%s on %s): %s", ErrConflict, c.Seq, c.Op, c.Table, kind)
+			}
+		} else {
+			r.Applied++
+		}
+		r.LastSeq = c.Seq
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO "+StateTable+"(source, seq) VALUES (?, ?)"+
+		" ON CONFLICT(source) DO UPDATE SET seq = excluded.seq", cs.Source, r.LastSeq)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	return r, nil
+}
+
+// applyChange applies one change; it returns the conflict kind
+// ("" for none) resolved according to policy.
+func applyChange(ctx context.Context, tx *sql.Tx, c Change, policy Policy) (ConflictKind, error) {
+	table := sqlite3lex.QuoteIdent(c.Table)
+	where, whereArgs := keyCond(c.Key)
+
+	switch c.Op {
+	case Insert:
+		cols, marks, args := insertParts(c.Row)
+		verb := "INSERT OR IGNORE"
+		if policy == Overwrite {
+			verb = "INSERT OR REPLACE"
+		}
+		n, err := exec(ctx, tx, verb+" INTO "+table+"("+cols+") VALUES ("+marks+")", args...)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			return ConflictExists, nil
+		}
+		return "", nil
+
+	case Update:
+		set, args := setParts(c.Row)
+		n, err := exec(ctx, tx, "UPDATE "+table+" SET "+set+" WHERE "+where, append(args, whereArgs...)...)
+		if err != nil || n > 0 {
+			return "", err
+		}
+		if policy == Overwrite {
+			cols, marks, args := insertParts(c.Row)
+			_, err := exec(ctx, tx, "INSERT OR REPLACE INTO "+table+"("+cols+") VALUES ("+marks+")", args...)
+			if err != nil {
+				return "", err
+			}
+		}
+		return ConflictNotFound, nil
+
+	case Delete:
+		n, err := exec(ctx, tx, "DELETE FROM "+table+" WHERE "+where, whereArgs...)
+		if err != nil || n > 0 {
+			return "", err
+		}
+		return ConflictNotFound, nil
+	}
+	return "", fmt.Errorf("sqlite3repl: unknown change kind %q", c.Op)
+}
+
+func exec(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int64, error) {
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// sortedKeys returns the column names of row in a fixed order.
+func sortedKeys(row map[string]interface{}) []string {
+	keys := make([]string, 0, len(row))
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func column(name string) string {
+	if name == "rowid" {
+		return name
+	}
+	return sqlite3lex.QuoteIdent(name)
+}
+
+func keyCond(key map[string]interface{}) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, k := range sortedKeys(key) {
+		conds = append(conds, column(k)+" IS ?")
+		args = append(args, key[k])
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func insertParts(row map[string]interface{}) (cols, marks string, args []interface{}) {
+	var cs, ms []string
+	for _, k := range sortedKeys(row) {
+		cs = append(cs, column(k))
+		ms = append(ms, "?")
+		args = append(args, row[k])
+	}
+	return strings.Join(cs, ", "), strings.Join(ms, ", "), args
+}
+
+func setParts(row map[string]interface{}) (string, []interface{}) {
+	var sets []string
+	var args []interface{}
+	for _, k := range sortedKeys(row) {
+		sets = append(sets, column(k)+" = ?")
+		args = append(args, row[k])
+	}
+	return strings.Join(sets, ", "), args
+}
@@ -0,0 +1,298 @@
+// Package sqlite3repl replicates changes one way, from a source database
+// to one or more targets, in changesets.
+//
+// The driver does not expose SQLite's session extension, so changes are
+// captured by triggers into a change log table of the source: each row
+// inserted, updated or deleted in a tracked table appends an entry with
+// its primary key and new column values, numbered by a sequence.
+// A Replicator reads the entries after the sequence each target last
+// applied, as a Changeset, and hands it to the target, which applies
+// it in one transaction together with the new sequence. Targets are
+// local databases (DBTarget) or anything implementing Target, e.g.
+// a client for a remote service calling ApplyChangeset on its side.
+//
+// Schema changes are not replicated: apply them to the targets first,
+// then call Track again on the source to rebuild the triggers.
+package sqlite3repl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// DefaultPrefix is the prefix of the tables and triggers used for
+// capturing changes when Source.Prefix is empty.
+const DefaultPrefix = "sqlite3_repl_"
+
+// Op is the kind of a change.
+type Op string
+
+// Change kinds.
+const (
+	Insert Op = "I"
+	Update Op = "U"
+	Delete Op = "D"
+)
+
+// Change is one row change.
+type Change struct {
+	Seq   int64                  `json:"seq"`
+	Table string                 `json:"table"`
+	Op    Op                     `json:"op"`
+	Key   map[string]interface{} `json:"key"`           // primary key before the change
+	Row   map[string]interface{} `json:"row,omitempty"` // all columns after it (not for Delete)
+}
+
+// Changeset is a batch of consecutive changes from one source.
+type Changeset struct {
+	Source  string   `json:"source"`
+	Changes []Change `json:"changes"`
+}
+
+// LastSeq returns the sequence of the last change, or 0 if empty.
+func (cs *Changeset) LastSeq() int64 {
+	if len(cs.Changes) == 0 {
+		return 0
+	}
+	return cs.Changes[len(cs.Changes)-1].Seq
+}
+
+// Source captures the changes of a database.
+type Source struct {
+	DB *sql.DB
+	// Name identifies the source in the targets' sequence tracking.
+	Name string
+	// Prefix of the change log table (<Prefix>log) and the triggers;
+	// "" means DefaultPrefix.
+	Prefix string
+}
+
+func (s *Source) prefix() string {
+	if s.Prefix == "" {
+		return DefaultPrefix
+	}
+	return s.Prefix
+}
+
+func (s *Source) logTable() string {
+	return sqlite3lex.QuoteIdent(s.prefix() + "log")
+}
+
+// Track creates the change log table, if needed, and (re)creates the
+// capturing triggers of the given tables. Tables without a declared
+// primary key are keyed by rowid, which must then be stable
+// (no VACUUM without INTEGER PRIMARY KEY).
+func (s *Source) Track(ctx context.Context, tables ...string) error {
+	stmts := []string{"CREATE TABLE IF NOT EXISTS " + s.logTable() + ` (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	tbl TEXT NOT NULL,
+	op  TEXT NOT NULL,
+	key TEXT NOT NULL,
+	row TEXT
+)`}
+	for _, table := range tables {
+		ts, err := s.triggers(ctx, table)
+		if err != nil {
+			return err
+		}
+		stmts = append(stmts, ts...)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite3repl: %w", err)
+	}
+	defer tx.Rollback()
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("sqlite3repl: %s: %w", stmt, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Untrack drops the capturing triggers of the given tables.
+func (s *Source) Untrack(ctx context.Context, tables ...string) error {
+	for _, table := range tables {
+		for _, op := range []string{"ai", "au", "ad"} {
+			stmt := "DROP TRIGGER IF EXISTS " + s.triggerName(table, op)
+			if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("sqlite3repl: %s: %w", stmt, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Source) triggerName(table, op string) string {
+	return sqlite3lex.QuoteIdent(s.prefix() + table + "_" + op)
+}
+
+// columns returns the columns of table and its primary key columns.
+func columns(ctx context.Context, db *sql.DB, table string) (cols, pk []string, err error) {
+	rows, err := db.QueryContext(ctx, "SELECT name, pk FROM pragma_table_info(?) ORDER BY cid", table)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	defer rows.Close()
+	pkPos := map[int]string{}
+	for rows.Next() {
+		var name string
+		var pos int
+		if err := rows.Scan(&name, &pos); err != nil {
+			return nil, nil, fmt.Errorf("sqlite3repl: %w", err)
+		}
+		cols = append(cols, name)
+		if pos > 0 {
+			pkPos[pos] = name
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	if len(cols) == 0 {
+		return nil, nil, fmt.Errorf("sqlite3repl: no such table %q", table)
+	}
+	for i := 1; i <= len(pkPos); i++ {
+		pk = append(pk, pkPos[i])
+	}
+	return cols, pk, nil
+}
+
+// jsonObject returns a json_object() call over the columns of ref
+// (NEW or OLD); BLOB values become {"$blob": "<hex>"}.
+func jsonObject(ref string, cols []string) string {
+	parts := make([]string, 0, 2*len(cols))
+	for _, c := range cols {
+		v := ref + "." + sqlite3lex.QuoteIdent(c)
+		if c == "rowid" {
+			v = ref + ".rowid"
+		}
+		parts = append(parts, sqlite3lex.QuoteString(c),
+			"CASE typeof("+v+") WHEN 'blob' THEN json_object('$blob', hex("+v+")) ELSE "+v+" END")
+	}
+	return "json_object(" + strings.Join(parts, ", ") + ")"
+}
+
+func (s *Source) triggers(ctx context.Context, table string) ([]string, error) {
+	cols, pk, err := columns(ctx, s.DB, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk) == 0 {
+		pk = []string{"rowid"}
+		cols = append([]string{"rowid"}, cols...)
+	}
+	name := sqlite3lex.QuoteString(table)
+	insert := func(op Op, keyRef, rowRef string) string {
+		row := "NULL"
+		if rowRef != "" {
+			row = jsonObject(rowRef, cols)
+		}
+		return "INSERT INTO " + s.logTable() + "(tbl, op, key, row) VALUES (" + name + ", '" +
+			string(op) + "', " + jsonObject(keyRef, pk) + ", " + row + ");"
+	}
+	quoted := sqlite3lex.QuoteIdent(table)
+	var stmts []string
+	for _, t := range []struct{ suffix, event, body string }{
+		{"ai", "AFTER INSERT", insert(Insert, "NEW", "NEW")},
+		{"au", "AFTER UPDATE", insert(Update, "OLD", "NEW")},
+		{"ad", "AFTER DELETE", insert(Delete, "OLD", "")},
+	} {
+		trigger := s.triggerName(table, t.suffix)
+		stmts = append(stmts, "DROP TRIGGER IF EXISTS "+trigger,
+			"CREATE TRIGGER "+trigger+" "+t.event+" ON "+quoted+" BEGIN "+t.body+" END")
+	}
+	return stmts, nil
+}
+
+// Capture returns up to limit changes (0 means 1000) after sequence since.
+func (s *Source) Capture(ctx context.Context, since int64, limit int) (*Changeset, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	rows, err := s.DB.QueryContext(ctx, "SELECT seq, tbl, op, key, row FROM "+s.logTable()+
+		" WHERE seq > ? ORDER BY seq LIMIT ?", since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	defer rows.Close()
+	cs := &Changeset{Source: s.Name}
+	for rows.Next() {
+		var c Change
+		var key string
+		var row sql.NullString
+		if err := rows.Scan(&c.Seq, &c.Table, &c.Op, &key, &row); err != nil {
+			return nil, fmt.Errorf("sqlite3repl: %w", err)
+		}
+		if c.Key, err = decodeRow(key); err != nil {
+			return nil, fmt.Errorf("sqlite3repl: change %d: %w", c.Seq, err)
+		}
+		if row.Valid {
+			if c.Row, err = decodeRow(row.String); err != nil {
+				return nil, fmt.Errorf("sqlite3repl: change %d: %w", c.Seq, err)
+			}
+		}
+		cs.Changes = append(cs.Changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite3repl: %w", err)
+	}
+	return cs, nil
+}
+
+// Prune deletes the log entries up to sequence upTo,
+// once every target has applied them.
+func (s *Source) Prune(ctx context.Context, upTo int64) error {
+	_, err := s.DB.ExecContext(ctx, "DELETE FROM "+s.logTable()+" WHERE seq <= ?", upTo)
+	if err != nil {
+		return fmt.Errorf("sqlite3repl: %w", err)
+	}
+	return nil
+}
+
+// decodeRow decodes a logged JSON object into column values:
+// integers as int64, other numbers as float64, {"$blob": hex} as []byte.
+func decodeRow(doc string) (map[string]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	var raw map[string]interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	for k, v := range raw {
+		cv, err := columnValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", k, err)
+		}
+		raw[k] = cv
+	}
+	return raw, nil
+}
+
+var errBadValue = errors.New("unexpected JSON value")
+
+func columnValue(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n, nil
+		}
+		return x.Float64()
+	case map[string]interface{}:
+		if h, ok := x["$blob"].(string); ok && len(x) == 1 {
+			return hex.DecodeString(h)
+		}
+		return nil, errBadValue
+	case nil, string:
+		return x, nil
+	}
+	return nil, errBadValue
+}
@@ -0,0 +1,127 @@
+package sqlite3repl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Replicator ships the changes of a Source to its Targets.
+type Replicator struct {
+	Source *Source
+	// Targets by name.
+	Targets map[string]Target
+	// BatchSize is the number of changes per changeset; 0 means 1000.
+	BatchSize int
+	// OnConflict, if not nil, is called for every conflict reported
+	// by a target.
+	OnConflict func(target string, c Conflict)
+	// OnError, if not nil, is called by Run for failed syncs.
+	OnError func(target string, err error)
+}
+
+// Lag is the replication state of one target.
+type Lag struct {
+	Target  string
+	Applied int64 // last sequence applied
+	Pending int64 // changes captured but not yet applied
+}
+
+// Sync brings every target up to date, then prunes the change log of the
+// entries all targets have. A failing target does not stop the others;
+// the first error is returned.
+func (r *Replicator) Sync(ctx context.Context) error {
+	var firstErr error
+	minSeq := int64(-1)
+	for _, name := range r.targetNames() {
+		seq, err := r.syncTarget(ctx, name, r.Targets[name])
+		if err != nil {
+			if r.OnError != nil {
+				r.OnError(name, err)
+			}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("sqlite3repl: target %s: %w", name, err)
+			}
+		}
+		if minSeq < 0 || seq < minSeq {
+			minSeq = seq
+		}
+	}
+	if minSeq > 0 {
+		if err := r.Source.Prune(ctx, minSeq); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (r *Replicator) targetNames() []string {
+	names := make([]string, 0, len(r.Targets))
+	for name := range r.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// syncTarget applies changesets until the target is current
+// and returns the last sequence it has.
+func (r *Replicator) syncTarget(ctx context.Context, name string, t Target) (int64, error) {
+	seq, err := t.LastSeq(ctx, r.Source.Name)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		cs, err := r.Source.Capture(ctx, seq, r.BatchSize)
+		if err != nil {
+			return seq, err
+		}
+		if len(cs.Changes) == 0 {
+			return seq, nil
+		}
+		report, err := t.Apply(ctx, cs)
+		if report != nil && r.OnConflict != nil {
+			for _, c := range report.Conflicts {
+				r.OnConflict(name, c)
+			}
+		}
+		if err != nil {
+			return seq, err
+		}
+		seq = report.LastSeq
+	}
+}
+
+// Lags returns the state of every target.
+func (r *Replicator) Lags(ctx context.Context) ([]Lag, error) {
+	var lags []Lag
+	for _, name := range r.targetNames() {
+		seq, err := r.Targets[name].LastSeq(ctx, r.Source.Name)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite3repl: target %s: %w", name, err)
+		}
+		l := Lag{Target: name, Applied: seq}
+		err = r.Source.DB.QueryRowContext(ctx, "SELECT count(*) FROM "+r.Source.logTable()+
+			" WHERE seq > ?", seq).Scan(&l.Pending)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite3repl: %w", err)
+		}
+		lags = append(lags, l)
+	}
+	return lags, nil
+}
+
+// Run calls Sync every interval until ctx is done.
+func (r *Replicator) Run(ctx context.Context, every time.Duration) error {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		r.Sync(ctx) // errors go to OnError; the next round retries
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package sqlite3scan
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3time"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// fieldScanner converts one column value into a struct field.
+type fieldScanner struct {
+	column string
+	field  reflect.Value
+}
+
+func (s *fieldScanner) Scan(src interface{}) error {
+	if err := assign(s.field, src); err != nil {
+		return fmt.Errorf("sqlite3scan: column %q: %w", s.column, err)
+	}
+	return nil
+}
+
+func assign(dst reflect.Value, src interface{}) error {
+	if dst.CanAddr() && dst.Addr().Type().Implements(scannerType) {
+		return dst.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+	if dst.Kind() == reflect.Ptr {
+		if src == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		v := reflect.New(dst.Type().Elem())
+		if err := assign(v.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	}
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	if dst.Type() == timeType {
+		t, err := toTime(src)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		switch v := src.(type) {
+		case string:
+			dst.SetString(v)
+		case []byte:
+			dst.SetString(string(v))
+		case time.Time:
+			dst.SetString(v.Format(time.RFC3339Nano))
+		default:
+			dst.SetString(fmt.Sprint(v))
+		}
+		return nil
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		switch v := src.(type) {
+		case []byte:
+			dst.SetBytes(append([]byte(nil), v...))
+		case string:
+			dst.SetBytes([]byte(v))
+		default:
+			dst.SetBytes([]byte(fmt.Sprint(v)))
+		}
+		return nil
+	case reflect.Bool:
+		b, err := toBool(src)
+		if err != nil {
+			return err
+		}
+		dst.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt(src)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %s", n, dst.Type())
+		}
+		dst.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := toInt(src)
+		if err != nil {
+			return err
+		}
+		if n < 0 || dst.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value %d overflows %s", n, dst.Type())
+		}
+		dst.SetUint(uint64(n))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(src)
+		if err != nil {
+			return err
+		}
+		dst.SetFloat(f)
+		return nil
+	case reflect.Interface:
+		if dst.NumMethod() == 0 {
+			if b, ok := src.([]byte); ok {
+				src = append([]byte(nil), b...)
+			}
+			dst.Set(reflect.ValueOf(src))
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot scan %T into %s", src, dst.Type())
+}
+
+func asText(src interface{}) (string, bool) {
+	switch v := src.(type) {
+	case string:
+		return strings.TrimSpace(v), true
+	case []byte:
+		return strings.TrimSpace(string(v)), true
+	}
+	return "", false
+}
+
+func toInt(src interface{}) (int64, error) {
+	switch v := src.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, fmt.Errorf("value %v is not an integer", v)
+		}
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	if s, ok := asText(src); ok {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return toInt(f)
+		}
+		return 0, fmt.Errorf("text %q is not an integer", s)
+	}
+	return 0, fmt.Errorf("cannot convert %T to an integer", src)
+}
+
+func toFloat(src interface{}) (float64, error) {
+	switch v := src.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	}
+	if s, ok := asText(src); ok {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("text %q is not a number", s)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to a number", src)
+}
+
+func toBool(src interface{}) (bool, error) {
+	switch v := src.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	case float64:
+		return v != 0, nil
+	}
+	if s, ok := asText(src); ok {
+		switch strings.ToLower(s) {
+		case "1", "t", "true", "y", "yes", "on":
+			return true, nil
+		case "0", "f", "false", "n", "no", "off", "":
+			return false, nil
+		}
+		return false, fmt.Errorf("text %q is not a boolean", s)
+	}
+	return false, fmt.Errorf("cannot convert %T to a boolean", src)
+}
+
+func toTime(src interface{}) (time.Time, error) {
+	return sqlite3time.Parse(src)
+}
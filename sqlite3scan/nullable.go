@@ -0,0 +1,118 @@
+package sqlite3scan
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+)
+
+// Nullable is a value of any type that may be NULL, replacing
+// sql.NullString, sql.NullInt64 and their siblings:
+//
+//	var email sqlite3scan.Nullable[string]
+//	err := row.Scan(&email)
+//	db.Exec("UPDATE users SET email = ?", email)
+//
+// Scanning converts as ScanStruct does; Value binds V, or NULL
+// when Valid is false.
+type Nullable[T any] struct {
+	V     T
+	Valid bool // V is set (the column was not NULL)
+}
+
+// Some returns a valid Nullable holding v.
+func Some[T any](v T) Nullable[T] {
+	return Nullable[T]{V: v, Valid: true}
+}
+
+// None returns an invalid (NULL) Nullable.
+func None[T any]() Nullable[T] {
+	return Nullable[T]{}
+}
+
+// FromPtr returns a Nullable holding *p, or NULL if p is nil.
+func FromPtr[T any](p *T) Nullable[T] {
+	if p == nil {
+		return Nullable[T]{}
+	}
+	return Some(*p)
+}
+
+// Scan implements sql.Scanner.
+func (n *Nullable[T]) Scan(src interface{}) error {
+	var zero T
+	if src == nil {
+		n.V, n.Valid = zero, false
+		return nil
+	}
+	if err := assign(reflect.ValueOf(&n.V).Elem(), src); err != nil {
+		n.V, n.Valid = zero, false
+		return fmt.Errorf("sqlite3scan: %w", err)
+	}
+	n.Valid = true
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (n Nullable[T]) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(n.V)
+}
+
+// OrZero returns V, or the zero value of T when NULL.
+func (n Nullable[T]) OrZero() T {
+	return n.V
+}
+
+// Or returns V, or def when NULL.
+func (n Nullable[T]) Or(def T) T {
+	if !n.Valid {
+		return def
+	}
+	return n.V
+}
+
+// Ptr returns a pointer to a copy of V, or nil when NULL.
+func (n Nullable[T]) Ptr() *T {
+	if !n.Valid {
+		return nil
+	}
+	v := n.V
+	return &v
+}
+
+type coalescer struct {
+	dest interface{}
+}
+
+// Coalesce wraps scan destinations so that NULL stores the zero value
+// of the destination instead of failing, for the queries that opt
+// into it:
+//
+//	err := row.Scan(sqlite3scan.Coalesce(&name, &age)...)
+//
+// Non-NULL values are converted as ScanStruct does.
+func Coalesce(dests ...interface{}) []interface{} {
+	wrapped := make([]interface{}, len(dests))
+	for i, d := range dests {
+		wrapped[i] = coalescer{d}
+	}
+	return wrapped
+}
+
+func (c coalescer) Scan(src interface{}) error {
+	v := reflect.ValueOf(c.dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("sqlite3scan: Coalesce destination %T is not a non-nil pointer", c.dest)
+	}
+	if src == nil {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		return nil
+	}
+	if err := assign(v.Elem(), src); err != nil {
+		return fmt.Errorf("sqlite3scan: %w", err)
+	}
+	return nil
+}
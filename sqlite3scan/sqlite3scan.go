@@ -0,0 +1,201 @@
+// Package sqlite3scan maps result rows to structs, for programs that
+// want to read rows into their types without an ORM.
+//
+// Columns are matched to exported struct fields by the `db` tag,
+// or else by the field name, case-insensitively; a tag of "-"
+// excludes the field. Fields of embedded structs are promoted,
+// as in Go. A column with no matching field is an error;
+// fields without a column keep their value.
+//
+// Values are converted in the spirit of SQLite's flexible typing:
+// NULL leaves a zero value (or a nil pointer, or an invalid sql.Null*),
+// numeric text scans into numbers, integers into bools, and any of
+// SQLite's date and time formats into time.Time (see sqlite3time.Parse).
+// Field types implementing sql.Scanner do their own conversion.
+package sqlite3scan
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrDest is returned for a destination of the wrong type.
+	ErrDest = errors.New("sqlite3scan: destination must be a non-nil pointer to a struct or to a slice of structs")
+)
+
+// ScanStruct reads all remaining rows into the slice dest points to
+// (of structs or pointers to structs), appending to it, and closes rows.
+func ScanStruct(rows *sql.Rows, dest interface{}) error {
+	defer rows.Close()
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return ErrDest
+	}
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	structType := elemType
+	if isPtr {
+		structType = elemType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return ErrDest
+	}
+
+	plan, err := newPlan(rows, structType)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		elem := reflect.New(structType)
+		if err := plan.scan(rows, elem.Elem()); err != nil {
+			return err
+		}
+		if isPtr {
+			slice.Set(reflect.Append(slice, elem))
+		} else {
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+	return rows.Err()
+}
+
+// ScanOne reads the first row into the struct dest points to
+// and closes rows; it returns sql.ErrNoRows if there is no row.
+func ScanOne(rows *sql.Rows, dest interface{}) error {
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := ScanRow(rows, dest); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// ScanRow reads the current row (after rows.Next returned true)
+// into the struct dest points to, for loops that do more per row.
+func ScanRow(rows *sql.Rows, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ErrDest
+	}
+	plan, err := newPlan(rows, v.Elem().Type())
+	if err != nil {
+		return err
+	}
+	return plan.scan(rows, v.Elem())
+}
+
+// plan maps each column of a result to a field index path.
+type plan struct {
+	columns []string
+	fields  [][]int
+}
+
+func newPlan(rows *sql.Rows, t reflect.Type) (*plan, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	byName := fieldsOf(t)
+	p := &plan{columns: columns, fields: make([][]int, len(columns))}
+	for i, col := range columns {
+		index, ok := byName[strings.ToLower(col)]
+		if !ok {
+			return nil, fmt.Errorf("sqlite3scan: no field of %s for column %q", t, col)
+		}
+		p.fields[i] = index
+	}
+	return p, nil
+}
+
+func (p *plan) scan(rows *sql.Rows, v reflect.Value) error {
+	dests := make([]interface{}, len(p.fields))
+	for i, index := range p.fields {
+		dests[i] = &fieldScanner{column: p.columns[i], field: fieldByIndexAlloc(v, index)}
+	}
+	return rows.Scan(dests...)
+}
+
+// fieldByIndexAlloc is v.FieldByIndex, allocating nil embedded pointers.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+var fieldCache sync.Map // reflect.Type -> map[string][]int
+
+// fieldsOf returns the index paths of the fields of struct type t
+// by lower-cased column name.
+func fieldsOf(t reflect.Type) map[string][]int {
+	if m, ok := fieldCache.Load(t); ok {
+		return m.(map[string][]int)
+	}
+	m := make(map[string][]int)
+	depth := make(map[string]int)
+	collectFields(t, nil, m, depth)
+	fieldCache.Store(t, m)
+	return m
+}
+
+func collectFields(t reflect.Type, prefix []int, m map[string][]int, depth map[string]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		index := append(append([]int(nil), prefix...), i)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct && !isScalar(ft) {
+			// As in encoding/json, a nil embedded pointer to an
+			// unexported type cannot be allocated: skip its fields.
+			if f.PkgPath != "" && f.Type.Kind() == reflect.Ptr {
+				continue
+			}
+			collectFields(ft, index, m, depth)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		name = strings.ToLower(name)
+		// As with Go's promoted fields, the shallowest one wins.
+		if d, ok := depth[name]; ok && d <= len(index) {
+			continue
+		}
+		m[name] = index
+		depth[name] = len(index)
+	}
+}
+
+// isScalar reports whether struct type t is scanned as one value.
+func isScalar(t reflect.Type) bool {
+	return t == timeType || reflect.PtrTo(t).Implements(scannerType)
+}
@@ -0,0 +1,53 @@
+package sqlite3scan
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/gimpldo/go-sqlite3"
+)
+
+type Embedded struct {
+	Name string
+}
+
+type inner struct {
+	X int
+}
+
+type withEmbedded struct {
+	ID int
+	*Embedded
+	*inner
+}
+
+// TestEmbeddedPointers scans into embedded pointers: exported ones are
+// allocated, the fields of unexported ones are not mapped (setting such
+// a pointer would panic).
+func TestEmbeddedPointers(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT 1 AS id, 'a' AS name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got withEmbedded
+	if err := ScanOne(rows, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 1 || got.Embedded == nil || got.Name != "a" || got.inner != nil {
+		t.Errorf("got %+v", got)
+	}
+
+	rows, err = db.Query("SELECT 1 AS id, 2 AS x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ScanOne(rows, &got); err == nil {
+		t.Error("column x of an unexported embedded pointer: no error")
+	}
+}
@@ -0,0 +1,222 @@
+package sqlite3seq
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Layout of the IDs generated by IDGen, from the most significant bit:
+// 1 unused (IDs stay positive), 41 bits of milliseconds since Epoch
+// (about 69 years), 10 bits of node number, 12 bits of per-millisecond
+// counter.
+const (
+	nodeBits    = 10
+	counterBits = 12
+	maxNodes    = 1 << nodeBits
+	maxCounter  = 1<<counterBits - 1
+)
+
+// Epoch is the zero time of IDGen timestamps.
+var Epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NodeLease is how long an IDGen holds its node number without
+// renewing it; it renews every third of it.
+var NodeLease = time.Minute
+
+// ErrClockBackwards is returned when the clock went back by more than
+// IDGen tolerates waiting for.
+var ErrClockBackwards = errors.New("sqlite3seq: clock moved backwards")
+
+var (
+	// ErrNoNode is returned by NewIDGen when all node numbers are leased.
+	ErrNoNode = errors.New("sqlite3seq: all node numbers are in use")
+	// ErrNodeLost is returned by IDGen.Next when the lease of the node
+	// number could not be renewed in time (another generator may get
+	// the number), and after Close.
+	ErrNodeLost = errors.New("sqlite3seq: node number lease lost")
+)
+
+// IDGen generates time-ordered, unique int64 IDs. Uniqueness between
+// processes comes from the node number, leased from a table of the
+// Store (<table>_nodes) for as long as the generator is alive: up to
+// 1024 generators can be live at the same time without collision.
+// Close releases the number.
+type IDGen struct {
+	store *Store
+	node  int64
+	owner string
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu         sync.Mutex
+	validUntil time.Time // lease expiry less the renewal interval
+	closed     bool
+	lastMs     int64
+	counter    int64
+}
+
+func (s *Store) nodesTable() string {
+	return sqlite3lex.QuoteIdent(s.name + "_nodes")
+}
+
+// NewIDGen leases a node number from the Store: a free one, or one
+// whose lease expired (its generator died or was closed).
+func (s *Store) NewIDGen(ctx context.Context) (*IDGen, error) {
+	nodes := s.nodesTable()
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+nodes+` (
+ node INTEGER PRIMARY KEY NOT NULL,
+ owner TEXT NOT NULL,
+ expires INTEGER NOT NULL
+)`); err != nil {
+		return nil, fmt.Errorf("sqlite3seq: creating table: %w", err)
+	}
+	var token [16]byte
+	if _, err := rand.Read(token[:]); err != nil {
+		return nil, err
+	}
+	g := &IDGen{store: s, owner: hex.EncodeToString(token[:]), stop: make(chan struct{}), done: make(chan struct{})}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return nil, err
+	}
+	rollback := func() { conn.ExecContext(context.Background(), "ROLLBACK") }
+
+	now := time.Now()
+	g.node = -1
+	err = conn.QueryRowContext(ctx, `SELECT node FROM `+nodes+` WHERE expires <= ? ORDER BY node LIMIT 1`,
+		ms(now)).Scan(&g.node)
+	if err == sql.ErrNoRows {
+		err = conn.QueryRowContext(ctx, `SELECT coalesce(max(node) + 1, 0) FROM `+nodes).Scan(&g.node)
+		if err == nil && g.node >= maxNodes {
+			err = ErrNoNode
+		}
+	}
+	if err == nil {
+		_, err = conn.ExecContext(ctx, `INSERT OR REPLACE INTO `+nodes+` (node, owner, expires) VALUES (?, ?, ?)`,
+			g.node, g.owner, ms(now.Add(NodeLease)))
+	}
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "COMMIT")
+	}
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+	g.validUntil = now.Add(NodeLease - g.interval())
+	go g.renewLoop()
+	return g, nil
+}
+
+func ms(t time.Time) int64 {
+	return t.UnixNano() / 1e6
+}
+
+func (g *IDGen) interval() time.Duration {
+	if d := NodeLease / 3; d > 0 {
+		return d
+	}
+	return time.Millisecond
+}
+
+// renewLoop renews the lease until Close. The IDs stop one renewal
+// interval before the lease would expire for the other processes,
+// a margin for clocks and for the generator's own delays.
+func (g *IDGen) renewLoop() {
+	defer close(g.done)
+	interval := g.interval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		res, err := g.store.db.ExecContext(ctx, `UPDATE `+g.store.nodesTable()+
+			` SET expires = ? WHERE node = ? AND owner = ?`, ms(now.Add(NodeLease)), g.node, g.owner)
+		cancel()
+		var n int64
+		if err == nil {
+			n, err = res.RowsAffected()
+		}
+		if err == nil && n == 0 {
+			return // taken over: validUntil runs out
+		}
+		if err == nil {
+			g.mu.Lock()
+			g.validUntil = now.Add(NodeLease - interval)
+			g.mu.Unlock()
+		}
+	}
+}
+
+// Close stops the renewal and releases the node number.
+func (g *IDGen) Close(ctx context.Context) error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil
+	}
+	g.closed = true
+	g.mu.Unlock()
+	close(g.stop)
+	<-g.done
+	_, err := g.store.db.ExecContext(ctx, `UPDATE `+g.store.nodesTable()+
+		` SET expires = 0 WHERE node = ? AND owner = ?`, g.node, g.owner)
+	return err
+}
+
+// Node returns the node number of the generator.
+func (g *IDGen) Node() int64 { return g.node }
+
+// Next returns a new ID; IDs of one generator are strictly increasing.
+func (g *IDGen) Next() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed || !time.Now().Before(g.validUntil) {
+		return 0, ErrNodeLost
+	}
+
+	now := time.Since(Epoch).Milliseconds()
+	if now < g.lastMs {
+		if g.lastMs-now > 1000 {
+			return 0, ErrClockBackwards
+		}
+		now = g.lastMs // small step back (NTP slew): keep using the last millisecond
+	}
+	if now == g.lastMs {
+		g.counter++
+		if g.counter > maxCounter {
+			// counter exhausted: wait for the next millisecond
+			for now <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Since(Epoch).Milliseconds()
+			}
+			g.counter = 0
+		}
+	} else {
+		g.counter = 0
+	}
+	g.lastMs = now
+	return now<<(nodeBits+counterBits) | g.node<<counterBits | g.counter, nil
+}
+
+// Time extracts the creation time from an ID made by IDGen.
+func Time(id int64) time.Time {
+	return Epoch.Add(time.Duration(id>>(nodeBits+counterBits)) * time.Millisecond)
+}
@@ -0,0 +1,115 @@
+// Package sqlite3seq generates identifiers that never collide between
+// processes writing to the same SQLite database file: named sequences
+// handed out in blocks, and time-ordered 64-bit IDs.
+package sqlite3seq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// DefaultTable holds the sequences when Store is created without a name.
+const DefaultTable = "sqlite3_sequences"
+
+// Store is the table of named counters.
+type Store struct {
+	db    *sql.DB
+	name  string // unquoted
+	table string
+}
+
+// NewStore creates the sequence table if needed; empty table means DefaultTable.
+func NewStore(ctx context.Context, db *sql.DB, table string) (*Store, error) {
+	if table == "" {
+		table = DefaultTable
+	}
+	s := &Store{db: db, name: table, table: sqlite3lex.QuoteIdent(table)}
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table+` (
+ name TEXT PRIMARY KEY NOT NULL,
+ next_value INTEGER NOT NULL
+)`)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3seq: creating table: %w", err)
+	}
+	return s, nil
+}
+
+// Reserve atomically allocates n consecutive values of the named
+// sequence and returns the first one. A new sequence starts at 1.
+func (s *Store) Reserve(ctx context.Context, name string, n int64) (int64, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("sqlite3seq: cannot reserve %d values", n)
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return 0, err
+	}
+	rollback := func() { conn.ExecContext(context.Background(), "ROLLBACK") }
+
+	first := int64(1)
+	err = conn.QueryRowContext(ctx, `SELECT next_value FROM `+s.table+` WHERE name = ?`, name).Scan(&first)
+	if err != nil && err != sql.ErrNoRows {
+		rollback()
+		return 0, err
+	}
+	_, err = conn.ExecContext(ctx, `INSERT OR REPLACE INTO `+s.table+` (name, next_value) VALUES (?, ?)`,
+		name, first+n)
+	if err != nil {
+		rollback()
+		return 0, err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		rollback()
+		return 0, err
+	}
+	return first, nil
+}
+
+// Sequence hands out values of one named sequence, reserving them
+// from the Store in blocks to avoid a write transaction per value.
+// Values are unique across processes and increasing within a process,
+// but not gap-free: the unused part of a block is lost when the
+// process exits.
+type Sequence struct {
+	store     *Store
+	name      string
+	blockSize int64
+
+	mu    sync.Mutex
+	next  int64
+	limit int64 // first value not reserved
+}
+
+// Sequence returns a handle on the named sequence; blockSize <= 0 means 100.
+func (s *Store) Sequence(name string, blockSize int64) *Sequence {
+	if blockSize <= 0 {
+		blockSize = 100
+	}
+	return &Sequence{store: s, name: name, blockSize: blockSize}
+}
+
+// Next returns the next value.
+func (q *Sequence) Next(ctx context.Context) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.next >= q.limit {
+		first, err := q.store.Reserve(ctx, q.name, q.blockSize)
+		if err != nil {
+			return 0, err
+		}
+		q.next, q.limit = first, first+q.blockSize
+	}
+	v := q.next
+	q.next++
+	return v, nil
+}
@@ -0,0 +1,218 @@
+package sqlite3ship
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3conn"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3metrics"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3stats"
+)
+
+// Replica keeps a read-only copy of a shipped database up to date
+// by replaying the segments as they arrive.
+//
+// Segments are replayed into a private working file, <Path>.work, and
+// the served file, Path, is refreshed from it with SQLite's online backup,
+// so that readers of Path always see a consistent database (the copy
+// is a transaction for them). The refresh copies the whole database,
+// which bounds the practical size of replicas.
+//
+// The replay state lives in memory: a new Replica (e.g. after a
+// restart) starts over from the latest base.
+type Replica struct {
+	Storage Storage
+	Prefix  string
+	Path    string
+	// Metrics, if not nil, receives sqlite3_ship_replica_lag_seconds.
+	Metrics *sqlite3metrics.Registry
+
+	once   sync.Once
+	lagG   sqlite3metrics.Gauge
+	mu     sync.Mutex
+	state  *genState
+	db     *sql.DB // writer pool for Path, used as backup destination
+	synced time.Time
+}
+
+// ReplicaStatus describes how current a Replica is.
+type ReplicaStatus struct {
+	// Shipped is when the last object applied was shipped.
+	Shipped time.Time `json:"shipped"`
+	// Synced is when the replica was last refreshed.
+	Synced time.Time `json:"synced"`
+	// Lag is the time since Shipped: changes made after it are
+	// missing, give or take the shipping interval.
+	Lag time.Duration `json:"lag_ns"`
+}
+
+// Open returns a read-only pool on the replica, for the application.
+// Sync must have succeeded once, so that Path exists.
+func (r *Replica) Open() (*sql.DB, error) {
+	return sqlite3conn.Open("file:"+r.Path, &sqlite3conn.Config{ReadOnly: true})
+}
+
+func (r *Replica) init() {
+	r.lagG = sqlite3metrics.OrNop(r.Metrics).Gauge("ship", "replica_lag_seconds",
+		"Age of the last shipped change applied to the replica.")
+}
+
+// Sync applies the segments shipped since the previous Sync,
+// starting from the latest base the first time or after a gap.
+// When only some of them could be applied, the replica is refreshed
+// with those and the error is returned: the replica is stale until
+// a later Sync succeeds.
+func (r *Replica) Sync(ctx context.Context) error {
+	r.once.Do(r.init)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	work := r.Path + ".work"
+	changed := false
+	var syncErr error
+	if r.state == nil {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(work + suffix)
+		}
+		st, err := restore(ctx, r.Storage, r.Prefix, work)
+		if st == nil {
+			return err
+		}
+		// After an error (a gap, a failed download or replay), serve
+		// what was restored, report the error, and retry the rest later.
+		r.state, changed, syncErr = st, true, err
+	} else {
+		objs, err := listObjects(ctx, r.Storage, r.Prefix)
+		if err != nil {
+			return err
+		}
+		var segs []object
+		for _, o := range objs {
+			if !isBase(o) && o.index > r.state.last.index {
+				segs = append(segs, o)
+			}
+		}
+		if len(segs) > 0 {
+			st, err := replay(ctx, r.Storage, r.Prefix, work, segs, r.state)
+			if errors.Is(err, ErrGap) {
+				r.state = nil // segments were pruned or lost: start over
+				return err
+			}
+			changed = st.last.index != r.state.last.index
+			r.state, syncErr = st, err
+		}
+	}
+	if changed {
+		if err := r.refresh(ctx, work); err != nil {
+			return err
+		}
+	}
+	r.synced = time.Now()
+	r.lagG.Set(time.Since(r.state.last.time).Seconds())
+	return syncErr
+}
+
+// refresh copies the working file over Path with the backup API.
+func (r *Replica) refresh(ctx context.Context, work string) error {
+	if r.db == nil {
+		db, err := sqlite3conn.Open("file:"+r.Path, &sqlite3conn.Config{MaxOpenConns: 1})
+		if err != nil {
+			return fmt.Errorf("sqlite3ship: %w", err)
+		}
+		r.db = db
+	}
+	src, err := sqlite3conn.Open("file:"+work+"?mode=ro", &sqlite3conn.Config{MaxOpenConns: 1})
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	defer src.Close()
+
+	dstConn, err := r.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	defer srcConn.Close()
+
+	err = dstConn.Raw(func(d interface{}) error {
+		return srcConn.Raw(func(s interface{}) error {
+			dc, ok1 := sqlite3conn.Unwrap(d)
+			sc, ok2 := sqlite3conn.Unwrap(s)
+			if !ok1 || !ok2 {
+				return fmt.Errorf("unexpected driver connections %T, %T", d, s)
+			}
+			b, err := dc.Backup("main", sc, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: refresh %s: %w", r.Path, err)
+	}
+	return nil
+}
+
+// Status returns how current the replica is; the zero value before
+// the first successful Sync.
+func (r *Replica) Status() ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == nil {
+		return ReplicaStatus{}
+	}
+	return ReplicaStatus{
+		Shipped: r.state.last.time,
+		Synced:  r.synced,
+		Lag:     time.Since(r.state.last.time),
+	}
+}
+
+// Source returns Status as a sqlite3stats.Source.
+func (r *Replica) Source() sqlite3stats.Source {
+	return func() interface{} { return r.Status() }
+}
+
+// Run calls Sync every interval until ctx is done; errors go to onError
+// (which may be nil) and the next round retries.
+func (r *Replica) Run(ctx context.Context, every time.Duration, onError func(error)) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if err := r.Sync(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close releases the replica's own connections
+// (not those of pools returned by Open).
+func (r *Replica) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.db == nil {
+		return nil
+	}
+	err := r.db.Close()
+	r.db = nil
+	return err
+}
@@ -0,0 +1,191 @@
+package sqlite3ship
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3conn"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lifecycle"
+)
+
+var (
+	// ErrNoBackup is returned by Restore when there is no base copy.
+	ErrNoBackup = errors.New("sqlite3ship: no base backup found")
+	// ErrGap is returned when the archived segments of a WAL generation
+	// are not contiguous: the database can only be restored up to the gap.
+	ErrGap = errors.New("sqlite3ship: missing WAL segment")
+)
+
+func sortObjects(objs []object) {
+	sort.Slice(objs, func(i, j int) bool { return objs[i].index < objs[j].index })
+}
+
+func isBase(o object) bool {
+	return strings.HasPrefix(o.name, baseDir)
+}
+
+// plan returns the latest base and the segments to replay over it,
+// in order.
+func plan(objs []object) (base object, segs []object, err error) {
+	found := false
+	for _, o := range objs {
+		if isBase(o) {
+			base, found = o, true
+		}
+	}
+	if !found {
+		return base, nil, ErrNoBackup
+	}
+	for _, o := range objs {
+		if !isBase(o) && (o.index > base.index || o.generation == base.generation) {
+			segs = append(segs, o)
+		}
+	}
+	return base, segs, nil
+}
+
+// fetch copies the uncompressed content of an object to w.
+func fetch(ctx context.Context, st Storage, name string, w io.Writer) error {
+	r, err := st.Get(ctx, name)
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: get %s: %w", name, err)
+	}
+	defer r.Close()
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: %s: %w", name, err)
+	}
+	if _, err := io.Copy(w, zr); err != nil {
+		return fmt.Errorf("sqlite3ship: %s: %w", name, err)
+	}
+	return nil
+}
+
+// Restore recreates, at path (which must not exist), the database
+// shipped under prefix, as of the last segment shipped.
+func Restore(ctx context.Context, st Storage, prefix, path string) error {
+	_, err := restore(ctx, st, prefix, path)
+	return err
+}
+
+// restore is Restore returning the replay state, to continue from.
+func restore(ctx context.Context, st Storage, prefix, path string) (*genState, error) {
+	objs, err := listObjects(ctx, st, prefix)
+	if err != nil {
+		return nil, err
+	}
+	base, segs, err := plan(objs)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3ship: %w", err)
+	}
+	err = fetch(ctx, st, prefix+base.name, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	cur := &genState{last: base}
+	return replay(ctx, st, prefix, path, segs, cur)
+}
+
+// genState is how far a WAL generation was replayed into a file.
+type genState struct {
+	generation string
+	end        int64  // WAL offset replayed up to
+	wal        []byte // header and frames of the generation so far
+	last       object // the last object applied (base or segment)
+}
+
+// replay applies segments to the database file at path, one WAL
+// generation at a time: the frames are written as the -wal file,
+// which SQLite recovers and checkpoints on open. cur is the state
+// of the previous replay (or holds just the base); the returned state
+// allows continuing later (see Replica). Segments only count as
+// replayed in it once applied, so that replaying again after an
+// error retries those that were not.
+func replay(ctx context.Context, st Storage, prefix, path string, segs []object, cur *genState) (*genState, error) {
+	for len(segs) > 0 {
+		gen := segs[0].generation
+		next := &genState{generation: gen, end: walHeaderSize, last: cur.last}
+		if cur.generation == gen {
+			next.end, next.wal = cur.end, cur.wal[:len(cur.wal):len(cur.wal)] // appends copy
+		}
+		added := false
+		// apply applies the frames gathered so far (up to an error:
+		// a gap, a failed download) and makes them the current state.
+		apply := func(err error) (*genState, error) {
+			if added {
+				if aerr := applyWAL(ctx, path, next.wal); aerr != nil {
+					return cur, aerr
+				}
+			}
+			cur = next
+			return cur, err
+		}
+		i := 0
+		for ; i < len(segs) && segs[i].generation == gen; i++ {
+			seg := segs[i]
+			if seg.offset > next.end {
+				return apply(fmt.Errorf("%w: generation %s at offset %d", ErrGap, gen, next.end))
+			}
+			var buf bytes.Buffer
+			if err := fetch(ctx, st, prefix+seg.name, &buf); err != nil {
+				return apply(err)
+			}
+			data := buf.Bytes()
+			if len(data) < walHeaderSize {
+				return apply(fmt.Errorf("sqlite3ship: %s: truncated segment", seg.name))
+			}
+			next.last = seg
+			segEnd := seg.offset + int64(len(data)-walHeaderSize)
+			if segEnd <= next.end {
+				continue // replayed already
+			}
+			// Only the frames past those replayed: a segment overlaps
+			// them when shipped again from the start of its generation.
+			if next.wal == nil {
+				next.wal = append([]byte(nil), data[:walHeaderSize]...)
+			}
+			next.wal = append(next.wal, data[walHeaderSize+(next.end-seg.offset):]...)
+			next.end = segEnd
+			added = true
+		}
+		if _, err := apply(nil); err != nil {
+			return cur, err
+		}
+		segs = segs[i:]
+	}
+	return cur, nil
+}
+
+// applyWAL checkpoints the given WAL content into the database at path.
+// Replaying frames already in the database is harmless: they are full
+// page images, applied in order.
+func applyWAL(ctx context.Context, path string, wal []byte) error {
+	os.Remove(path + "-shm")
+	if err := os.WriteFile(path+"-wal", wal, 0o644); err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	db, err := sqlite3conn.Open("file:"+path, &sqlite3conn.Config{MaxOpenConns: 1})
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	defer db.Close()
+	if _, _, err := sqlite3lifecycle.Checkpoint(ctx, db, "TRUNCATE"); err != nil {
+		return fmt.Errorf("sqlite3ship: replay into %s: %w", path, err)
+	}
+	return db.Close()
+}
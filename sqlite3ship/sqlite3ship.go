@@ -0,0 +1,414 @@
+// Package sqlite3ship ships backups of a WAL-mode database to object
+// storage: periodic base copies of the database file plus the WAL
+// frames committed in between, archived in segments, so that the
+// database can be restored (Restore) to the last shipped segment,
+// typically seconds old, or kept as a read replica (Replica).
+//
+// The Shipper must be the only one checkpointing the database: every
+// connection of the application must run with
+// 'PRAGMA wal_autocheckpoint=0' (see sqlite3conn.Config.Pragmas), and
+// nothing else may run wal_checkpoint (sqlite3lifecycle.Shutdown does:
+// call Shipper.Close first). Otherwise a checkpoint could recycle WAL
+// frames before they are archived, and the chain of segments would
+// have a hole. The pool needs at least two connections: checkpoints run
+// while the Shipper holds one. The Shipper checkpoints, itself, once the WAL has grown
+// past Options.CheckpointBytes, after archiving the frames concerned.
+package sqlite3ship
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lifecycle"
+)
+
+// ErrAutoCheckpoint is returned by NewShipper when the database
+// connections checkpoint automatically.
+var ErrAutoCheckpoint = errors.New("sqlite3ship: connections must run with PRAGMA wal_autocheckpoint=0")
+
+// Options configure a Shipper.
+type Options struct {
+	// Prefix is prepended to the object names, e.g. "backups/orders/".
+	Prefix string
+	// Interval between WAL shipments; 0 means 10 seconds.
+	Interval time.Duration
+	// BaseEvery is the interval between base copies; 0 means 24 hours.
+	BaseEvery time.Duration
+	// CheckpointBytes is the WAL size past which the Shipper
+	// checkpoints; 0 means 4 MiB.
+	CheckpointBytes int64
+	// KeepBases is the number of base copies (with the segments needed
+	// to restore from them) kept by retention; 0 means 3.
+	KeepBases int
+	// OnError, if not nil, is called by Run for failed steps.
+	OnError func(error)
+}
+
+// Shipper ships a database to a Storage.
+type Shipper struct {
+	db   *sql.DB
+	st   Storage
+	opts Options
+	path string
+
+	mu        sync.Mutex
+	next      int64  // index of the next object
+	gen       string // WAL generation being shipped
+	off       int64  // WAL offset shipped up to
+	sum       walSum // running WAL checksum at off
+	lastBase  time.Time
+	lastShip  time.Time
+	closeOnce sync.Once
+}
+
+// NewShipper returns a Shipper for db, whose main database must be
+// a file in WAL mode. Shipping resumes after the objects already
+// in st under opts.Prefix: within the current WAL generation, after
+// its last segment (see resume).
+func NewShipper(ctx context.Context, db *sql.DB, st Storage, opts Options) (*Shipper, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.BaseEvery <= 0 {
+		opts.BaseEvery = 24 * time.Hour
+	}
+	if opts.CheckpointBytes <= 0 {
+		opts.CheckpointBytes = 4 << 20
+	}
+	if opts.KeepBases <= 0 {
+		opts.KeepBases = 3
+	}
+	s := &Shipper{db: db, st: st, opts: opts}
+
+	var mode string
+	var auto int
+	err := db.QueryRowContext(ctx, "SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&s.path)
+	if err == nil {
+		err = db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode)
+	}
+	if err == nil {
+		err = db.QueryRowContext(ctx, "PRAGMA wal_autocheckpoint").Scan(&auto)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3ship: %w", err)
+	}
+	if s.path == "" || mode != "wal" {
+		return nil, errNoWAL
+	}
+	if auto != 0 {
+		return nil, ErrAutoCheckpoint
+	}
+
+	objs, err := listObjects(ctx, st, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objs {
+		if o.index >= s.next {
+			s.next = o.index + 1
+		}
+		if isBase(o) && o.time.After(s.lastBase) {
+			s.lastBase = o.time
+		}
+	}
+	if err := s.resume(ctx, objs); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// resume sets the generation and offset to ship from, when objs has
+// segments of the current WAL generation (shipped before a restart):
+// shipping the generation again from its first frame would make
+// segments overlapping the archived ones.
+func (s *Shipper) resume(ctx context.Context, objs []object) error {
+	f, err := os.Open(s.path + "-wal")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	defer f.Close()
+	h, err := readWALHeader(f)
+	if err == errNoWAL || err == errTornHeader {
+		return nil // empty WAL: nothing shipped from it
+	}
+	if err != nil {
+		return err
+	}
+	var last *object
+	for i, o := range objs {
+		if !isBase(o) && o.generation == h.generation() {
+			last = &objs[i]
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := fetch(ctx, s.st, s.opts.Prefix+last.name, &buf); err != nil {
+		return err
+	}
+	if buf.Len() < walHeaderSize {
+		return fmt.Errorf("sqlite3ship: %s: truncated segment", last.name)
+	}
+	s.gen, s.off = last.generation, last.offset+int64(buf.Len()-walHeaderSize)
+	s.sum = lastSum(buf.Bytes(), h)
+	return nil
+}
+
+// listObjects returns the bases and segments under prefix, by index.
+func listObjects(ctx context.Context, st Storage, prefix string) ([]object, error) {
+	names, err := st.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3ship: list: %w", err)
+	}
+	var objs []object
+	for _, name := range names {
+		if o, ok := parseObject(name[len(prefix):]); ok {
+			objs = append(objs, o)
+		}
+	}
+	sortObjects(objs)
+	return objs, nil
+}
+
+func (s *Shipper) put(ctx context.Context, name string, write func(io.Writer) error) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := write(zw); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := s.st.Put(ctx, s.opts.Prefix+name, &buf); err != nil {
+		return fmt.Errorf("sqlite3ship: put %s: %w", name, err)
+	}
+	s.next++
+	return nil
+}
+
+// ShipWAL archives the WAL frames committed since the last shipment.
+func (s *Shipper) ShipWAL(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shipWAL(ctx)
+}
+
+func (s *Shipper) shipWAL(ctx context.Context) error {
+	f, err := os.Open(s.path + "-wal")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil // no connection open, or everything checkpointed
+		}
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	if st.Size() < walHeaderSize {
+		return nil
+	}
+	h, err := readWALHeader(f)
+	if err == errTornHeader {
+		return nil // the WAL is restarting: no frame yet
+	}
+	if err != nil {
+		return err
+	}
+	if h.generation() != s.gen {
+		s.gen, s.off, s.sum = h.generation(), walHeaderSize, h.checksum()
+	}
+	end, sum, err := committedEnd(f, st.Size(), h, s.off, s.sum)
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	if end <= s.off {
+		return nil
+	}
+	now := time.Now()
+	err = s.put(ctx, segmentName(s.next, s.gen, s.off, now), func(w io.Writer) error {
+		if _, err := w.Write(h.raw[:]); err != nil {
+			return err
+		}
+		_, err := io.Copy(w, io.NewSectionReader(f, s.off, end-s.off))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.off, s.sum, s.lastShip = end, sum, now
+	return nil
+}
+
+// Checkpoint archives the committed WAL frames and checkpoints them into
+// the database, so that the WAL restarts from the beginning.
+//
+// While it works, it holds a read transaction opened before archiving:
+// SQLite does not checkpoint frames newer than an open read transaction,
+// nor restart the WAL under it, so no frame can be recycled unarchived.
+func (s *Shipper) Checkpoint(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkpoint(ctx)
+}
+
+func (s *Shipper) checkpoint(ctx context.Context) error {
+	guard, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	defer guard.Close()
+	if _, err := guard.ExecContext(ctx, "BEGIN"); err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	defer guard.ExecContext(context.Background(), "ROLLBACK")
+	var n int
+	if err := guard.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+
+	if err := s.shipWAL(ctx); err != nil {
+		return err
+	}
+	if _, _, err := sqlite3lifecycle.Checkpoint(ctx, s.db, "PASSIVE"); err != nil {
+		return fmt.Errorf("sqlite3ship: checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Base ships a copy of the database file. The file only changes when
+// checkpointed, which the Shipper itself does, so it is copied as is
+// (without blocking the application) and holds every frame of the
+// current WAL generation up to the last checkpoint; restoring replays
+// the whole generation over it.
+func (s *Shipper) Base(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Make sure the generation the copy belongs to is being shipped.
+	if err := s.shipWAL(ctx); err != nil {
+		return err
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("sqlite3ship: %w", err)
+	}
+	defer f.Close()
+	now := time.Now()
+	err = s.put(ctx, baseName(s.next, s.gen, now), func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.lastBase = now
+	return nil
+}
+
+// Prune deletes the bases beyond the KeepBases most recent ones, and
+// the segments only they needed.
+func (s *Shipper) Prune(ctx context.Context) error {
+	objs, err := listObjects(ctx, s.st, s.opts.Prefix)
+	if err != nil {
+		return err
+	}
+	var bases []object
+	for _, o := range objs {
+		if isBase(o) {
+			bases = append(bases, o)
+		}
+	}
+	if len(bases) <= s.opts.KeepBases {
+		return nil
+	}
+	oldest := bases[len(bases)-s.opts.KeepBases]
+	// The oldest kept base needs its whole WAL generation.
+	keepFrom := oldest.index
+	for _, o := range objs {
+		if !isBase(o) && o.generation == oldest.generation && o.index < keepFrom {
+			keepFrom = o.index
+		}
+	}
+	for _, o := range objs {
+		if o.index < keepFrom || (isBase(o) && o.index < oldest.index) {
+			if err := s.st.Delete(ctx, s.opts.Prefix+o.name); err != nil {
+				return fmt.Errorf("sqlite3ship: delete %s: %w", o.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Run ships until ctx is done: WAL segments every Interval, a checkpoint
+// when the WAL is larger than CheckpointBytes, and a base copy (then
+// pruning) every BaseEvery, the first one right away if none is newer.
+// A final shipment is made before returning.
+func (s *Shipper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		s.step(ctx)
+		select {
+		case <-ctx.Done():
+			return s.ShipWAL(context.Background())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Shipper) step(ctx context.Context) {
+	report := func(err error) {
+		if err != nil && s.opts.OnError != nil && ctx.Err() == nil {
+			s.opts.OnError(err)
+		}
+	}
+	s.mu.Lock()
+	baseDue := time.Since(s.lastBase) >= s.opts.BaseEvery
+	s.mu.Unlock()
+	if baseDue {
+		err := s.Base(ctx)
+		report(err)
+		if err == nil {
+			report(s.Prune(ctx))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.shipWAL(ctx); err != nil {
+		report(err)
+		return
+	}
+	if s.off >= s.opts.CheckpointBytes {
+		report(s.checkpoint(ctx))
+	}
+}
+
+// LastShipped returns the time of the last WAL segment shipped.
+func (s *Shipper) LastShipped() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastShip
+}
+
+// Close ships the remaining frames; after it, the application may
+// checkpoint (e.g. with sqlite3lifecycle.Shutdown) and close the database.
+func (s *Shipper) Close(ctx context.Context) error {
+	var err error
+	s.closeOnce.Do(func() { err = s.ShipWAL(ctx) })
+	return err
+}
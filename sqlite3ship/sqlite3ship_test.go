@@ -0,0 +1,197 @@
+package sqlite3ship
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3conn"
+)
+
+// TestRestartRestore ships, restarts the Shipper (a new one on the same
+// database and storage, the WAL generation unchanged), ships again and
+// restores: the chain of segments must stay restorable.
+func TestRestartRestore(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		resume bool // false: the restarted Shipper ships the generation again from its start
+	}{
+		{"resume", true},
+		{"overlap", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			st := DirStorage(filepath.Join(dir, "store"))
+			db, err := sqlite3conn.Open("file:"+filepath.Join(dir, "src.db"), &sqlite3conn.Config{
+				JournalMode: "WAL",
+				Pragmas:     []string{"PRAGMA wal_autocheckpoint=0"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			db.SetMaxOpenConns(2)
+			insert := func(n int) {
+				t.Helper()
+				for i := 0; i < n; i++ {
+					if _, err := db.Exec("INSERT INTO t (v) VALUES (?)", i); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, v INTEGER)"); err != nil {
+				t.Fatal(err)
+			}
+
+			s1, err := NewShipper(ctx, db, st, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s1.Base(ctx); err != nil {
+				t.Fatal(err)
+			}
+			insert(10)
+			if err := s1.ShipWAL(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			s2, err := NewShipper(ctx, db, st, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s2.gen != s1.gen || s2.off != s1.off {
+				t.Errorf("resumed at %s/%d, want %s/%d", s2.gen, s2.off, s1.gen, s1.off)
+			}
+			if !tc.resume {
+				s2.gen, s2.off = "", 0
+			}
+			insert(5)
+			if err := s2.ShipWAL(ctx); err != nil {
+				t.Fatal(err)
+			}
+			insert(3)
+			if err := s2.ShipWAL(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, "restored.db")
+			if err := Restore(ctx, st, "", path); err != nil {
+				t.Fatal(err)
+			}
+			rdb, err := sqlite3conn.Open("file:"+path, &sqlite3conn.Config{ReadOnly: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rdb.Close()
+			var n int
+			if err := rdb.QueryRow("SELECT count(*) FROM t").Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			if n != 18 {
+				t.Errorf("restored %d rows, want 18", n)
+			}
+		})
+	}
+}
+
+// TestTornCommitFrame ships a WAL whose last commit frame has stale
+// page data, as when it is read while SQLite writes it: the frame must
+// not be shipped, and must be once complete, the running checksum
+// carrying over to the next segment.
+func TestTornCommitFrame(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := DirStorage(filepath.Join(dir, "store"))
+	src := filepath.Join(dir, "src.db")
+	db, err := sqlite3conn.Open("file:"+src, &sqlite3conn.Config{
+		JournalMode: "WAL",
+		Pragmas:     []string{"PRAGMA wal_autocheckpoint=0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, v INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewShipper(ctx, db, st, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Base(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := db.Exec("INSERT INTO t (v) VALUES (?)", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.OpenFile(src+"-wal", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := readWALHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tear the last frame, a commit frame: its page data is not written yet.
+	torn := fi.Size() - h.frameSize()
+	pos := torn + walFrameHeaderSize + int64(h.pageSize) - 1
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, pos); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{^b[0]}, pos); err != nil {
+		t.Fatal(err)
+	}
+
+	restoreCount := func(name string) int {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := Restore(ctx, st, "", path); err != nil {
+			t.Fatal(err)
+		}
+		rdb, err := sqlite3conn.Open("file:"+path, &sqlite3conn.Config{ReadOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rdb.Close()
+		var n int
+		if err := rdb.QueryRow("SELECT count(*) FROM t").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := s.ShipWAL(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s.off != torn {
+		t.Errorf("shipped up to %d, want %d (before the torn frame)", s.off, torn)
+	}
+	if n := restoreCount("r1.db"); n != 2 {
+		t.Errorf("restored %d rows, want 2", n)
+	}
+
+	// The writer completes the frame.
+	if _, err := f.WriteAt(b, pos); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ShipWAL(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s.off != fi.Size() {
+		t.Errorf("shipped up to %d, want %d", s.off, fi.Size())
+	}
+	if n := restoreCount("r2.db"); n != 3 {
+		t.Errorf("restored %d rows, want 3", n)
+	}
+}
@@ -0,0 +1,104 @@
+package sqlite3ship
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Storage is an object store holding the backups. Object names use
+// '/' as separator. S3, GCS and the like are adapted by the application
+// with their SDK (each method maps to one call: PutObject, GetObject,
+// ListObjectsV2, DeleteObject), which keeps their dependencies out of
+// this package; DirStorage stores into a local (or mounted) directory.
+type Storage interface {
+	// Put stores the content of r under name, replacing any object
+	// of that name; it must be atomic (readers never see a partial object).
+	Put(ctx context.Context, name string, r io.Reader) error
+	// Get returns the content of the object; a missing object
+	// is an error satisfying errors.Is(err, os.ErrNotExist).
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the names of the objects starting with prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes the object; deleting a missing object is not an error.
+	Delete(ctx context.Context, name string) error
+}
+
+// DirStorage is a Storage keeping objects as files under a directory.
+type DirStorage string
+
+var _ Storage = DirStorage("")
+
+func (d DirStorage) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// Put implements Storage, writing a temporary file renamed into place.
+func (d DirStorage) Put(ctx context.Context, name string, r io.Reader) error {
+	p := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Get implements Storage.
+func (d DirStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(d.path(name))
+}
+
+// List implements Storage.
+func (d DirStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(string(d), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(string(d), p)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// Delete implements Storage.
+func (d DirStorage) Delete(ctx context.Context, name string) error {
+	err := os.Remove(d.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
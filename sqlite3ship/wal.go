@@ -0,0 +1,191 @@
+package sqlite3ship
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WAL file layout (https://www.sqlite.org/fileformat.html#the_write_ahead_log).
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+)
+
+var (
+	errNoWAL = errors.New("sqlite3ship: no WAL file (is the database in WAL mode?)")
+	// errTornHeader is returned for a WAL header whose checksum does
+	// not match: it is being written, and the WAL has no frames yet.
+	errTornHeader = errors.New("sqlite3ship: WAL header being written")
+)
+
+// walHeader is the header of a WAL file; its salts change every time
+// the WAL restarts, identifying a generation of frames.
+type walHeader struct {
+	raw      [walHeaderSize]byte
+	pageSize int
+	order    binary.ByteOrder // of the words summed by the checksums
+}
+
+// walSum is the running checksum of a WAL generation: each frame
+// stores the checksum of its header start and page data added to that
+// of the frame before it (of the WAL header for the first frame).
+type walSum [2]uint32
+
+// add returns s with the 8-byte words of b added.
+func (s walSum) add(order binary.ByteOrder, b []byte) walSum {
+	for i := 0; i+8 <= len(b); i += 8 {
+		s[0] += order.Uint32(b[i:]) + s[1]
+		s[1] += order.Uint32(b[i+4:]) + s[0]
+	}
+	return s
+}
+
+// storedSum reads a checksum as stored in the WAL (big-endian).
+func storedSum(b []byte) walSum {
+	return walSum{binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])}
+}
+
+// checksum returns the checksum of the header, the start of the
+// running checksum of its generation.
+func (h *walHeader) checksum() walSum {
+	return storedSum(h.raw[24:32])
+}
+
+func (h *walHeader) generation() string {
+	return hex.EncodeToString(h.raw[16:24])
+}
+
+func (h *walHeader) frameSize() int64 {
+	return int64(walFrameHeaderSize + h.pageSize)
+}
+
+func readWALHeader(f io.ReaderAt) (*walHeader, error) {
+	h := &walHeader{}
+	if _, err := f.ReadAt(h.raw[:], 0); err != nil {
+		if err == io.EOF {
+			return nil, errNoWAL
+		}
+		return nil, err
+	}
+	switch magic := binary.BigEndian.Uint32(h.raw[0:4]); magic {
+	case 0x377f0682:
+		h.order = binary.LittleEndian
+	case 0x377f0683:
+		h.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("sqlite3ship: bad WAL magic %#x", magic)
+	}
+	if (walSum{}).add(h.order, h.raw[:24]) != h.checksum() {
+		return nil, errTornHeader
+	}
+	h.pageSize = int(binary.BigEndian.Uint32(h.raw[8:12]))
+	if h.pageSize == 1 {
+		h.pageSize = 65536
+	}
+	return h, nil
+}
+
+// committedEnd returns the end offset of the last commit frame at or
+// after off that belongs to the generation of h, in a WAL file of the
+// given size, and the running checksum there; sum is the one at off.
+// Frames past it are uncommitted, left over from an earlier
+// generation, or still being written: SQLite writes a frame header
+// before its page data and shipping takes no lock against writers, so
+// only the frames whose checksum checks out count, as for SQLite's own
+// WAL recovery.
+func committedEnd(f io.ReaderAt, size int64, h *walHeader, off int64, sum walSum) (int64, walSum, error) {
+	end, endSum := off, sum
+	frame := make([]byte, h.frameSize())
+	for pos := off; pos+h.frameSize() <= size; pos += h.frameSize() {
+		if _, err := f.ReadAt(frame, pos); err != nil {
+			return 0, walSum{}, err
+		}
+		if string(frame[8:16]) != string(h.raw[16:24]) {
+			break
+		}
+		sum = sum.add(h.order, frame[:8]).add(h.order, frame[walFrameHeaderSize:])
+		if sum != storedSum(frame[16:24]) {
+			break
+		}
+		if binary.BigEndian.Uint32(frame[4:8]) != 0 { // database size after commit
+			end, endSum = pos+h.frameSize(), sum
+		}
+	}
+	return end, endSum, nil
+}
+
+// lastSum returns the running checksum at the end of a segment
+// (the WAL header followed by whole frames).
+func lastSum(seg []byte, h *walHeader) walSum {
+	if len(seg) < walHeaderSize+int(h.frameSize()) {
+		return h.checksum()
+	}
+	last := seg[len(seg)-int(h.frameSize()):]
+	return storedSum(last[16:24])
+}
+
+// Object names, under the Shipper prefix:
+//
+//	base/<index>-<generation>-<unix ms>.db.gz
+//	wal/<index>-<generation>-<offset>-<unix ms>.wal.gz
+//
+// index is a counter increasing with every object, so that names sort
+// in shipping order; generation identifies the WAL generation
+// (base: the one current when the copy was taken); offset is the
+// position in the WAL file of the first frame of the segment.
+const (
+	baseDir = "base/"
+	walDir  = "wal/"
+)
+
+type object struct {
+	name       string
+	index      int64
+	generation string
+	offset     int64 // segments only
+	time       time.Time
+}
+
+func baseName(index int64, gen string, t time.Time) string {
+	return fmt.Sprintf("%s%010d-%s-%d.db.gz", baseDir, index, gen, t.UnixMilli())
+}
+
+func segmentName(index int64, gen string, off int64, t time.Time) string {
+	return fmt.Sprintf("%s%010d-%s-%016x-%d.wal.gz", walDir, index, gen, off, t.UnixMilli())
+}
+
+// parseObject parses the name (without the Shipper prefix) of a base
+// or segment; ok is false for other names.
+func parseObject(name string) (o object, ok bool) {
+	o.name = name
+	var ms int64
+	switch {
+	case strings.HasPrefix(name, baseDir) && strings.HasSuffix(name, ".db.gz"):
+		parts := strings.Split(strings.TrimSuffix(name[len(baseDir):], ".db.gz"), "-")
+		if len(parts) != 3 {
+			return o, false
+		}
+		if _, err := fmt.Sscanf(parts[0]+" "+parts[2], "%d %d", &o.index, &ms); err != nil {
+			return o, false
+		}
+		o.generation = parts[1]
+	case strings.HasPrefix(name, walDir) && strings.HasSuffix(name, ".wal.gz"):
+		parts := strings.Split(strings.TrimSuffix(name[len(walDir):], ".wal.gz"), "-")
+		if len(parts) != 4 {
+			return o, false
+		}
+		if _, err := fmt.Sscanf(parts[0]+" "+parts[2]+" "+parts[3], "%d %x %d", &o.index, &o.offset, &ms); err != nil {
+			return o, false
+		}
+		o.generation = parts[1]
+	default:
+		return o, false
+	}
+	o.time = time.UnixMilli(ms)
+	return o, true
+}
@@ -0,0 +1,196 @@
+// Package sqlite3soft implements the soft-delete convention: rows are
+// marked deleted by setting a deleted_at column instead of being removed,
+// queries filter them out, and a maintenance routine purges them for good
+// once they are old enough.
+package sqlite3soft
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3maint"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3time"
+)
+
+// DefaultColumn is the column name used when Table.Column is empty.
+const DefaultColumn = "deleted_at"
+
+// ErrNotFound is returned by Delete and Restore when no row matched
+// (missing, or already in the requested state).
+var ErrNotFound = errors.New("sqlite3soft: no such row")
+
+// Table describes one soft-deleted table.
+type Table struct {
+	// Name is the table name.
+	Name string
+	// Key is the column identifying rows;
+	// "" means the rowid (set it for WITHOUT ROWID tables).
+	Key string
+	// Column holds the deletion time, NULL for live rows;
+	// "" means DefaultColumn.
+	Column string
+	// Time is the storage format of Column; the zero value is
+	// sqlite3time.TextUTC, which compares correctly as text.
+	Time sqlite3time.Codec
+	// Now returns the deletion time; nil means time.Now.
+	Now func() time.Time
+}
+
+func (t *Table) column() string {
+	if t.Column == "" {
+		return DefaultColumn
+	}
+	return t.Column
+}
+
+func (t *Table) key() string {
+	if t.Key == "" {
+		return "rowid"
+	}
+	return sqlite3lex.QuoteIdent(t.Key)
+}
+
+func (t *Table) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+// Install adds the deletion column to the table if it is missing, and an
+// index on it (partial, on the deleted rows only) to make purges cheap.
+// It also creates the view <name>_live showing the live rows when
+// withView is true. Running it again is harmless.
+func (t *Table) Install(ctx context.Context, db *sql.DB, withView bool) error {
+	var n int
+	err := db.QueryRowContext(ctx,
+		"SELECT count(*) FROM pragma_table_info(?) WHERE name = ? COLLATE NOCASE",
+		t.Name, t.column()).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("sqlite3soft: %w", err)
+	}
+	table, col := sqlite3lex.QuoteIdent(t.Name), sqlite3lex.QuoteIdent(t.column())
+	var stmts []string
+	if n == 0 {
+		stmts = append(stmts, "ALTER TABLE "+table+" ADD COLUMN "+col)
+	}
+	stmts = append(stmts, "CREATE INDEX IF NOT EXISTS "+
+		sqlite3lex.QuoteIdent(t.Name+"_"+t.column())+" ON "+table+"("+col+") WHERE "+col+" IS NOT NULL")
+	if withView {
+		stmts = append(stmts, "CREATE VIEW IF NOT EXISTS "+sqlite3lex.QuoteIdent(t.Name+"_live")+
+			" AS SELECT * FROM "+table+" WHERE "+col+" IS NULL")
+	}
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("sqlite3soft: %s: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// Live returns the condition selecting live rows, qualified with
+// alias unless it is "": e.g. `"u"."deleted_at" IS NULL`.
+func (t *Table) Live(alias string) string {
+	return qualified(alias, t.column()) + " IS NULL"
+}
+
+// Deleted returns the condition selecting soft-deleted rows.
+func (t *Table) Deleted(alias string) string {
+	return qualified(alias, t.column()) + " IS NOT NULL"
+}
+
+func qualified(alias, column string) string {
+	if alias == "" {
+		return sqlite3lex.QuoteIdent(column)
+	}
+	return sqlite3lex.QuoteIdent(alias) + "." + sqlite3lex.QuoteIdent(column)
+}
+
+// Where combines an existing WHERE condition (without the keyword;
+// "" for none) with the Live condition:
+//
+//	q := "SELECT * FROM users u WHERE " + users.Where("u", "u.email = ?")
+func (t *Table) Where(alias, cond string) string {
+	if strings.TrimSpace(cond) == "" {
+		return t.Live(alias)
+	}
+	return "(" + cond + ") AND " + t.Live(alias)
+}
+
+// Delete soft-deletes the live row with the given key.
+func (t *Table) Delete(ctx context.Context, db *sql.DB, key interface{}) error {
+	return t.set(ctx, db, key, t.Time.Value(t.now()), t.Live(""))
+}
+
+// Restore undeletes the soft-deleted row with the given key.
+func (t *Table) Restore(ctx context.Context, db *sql.DB, key interface{}) error {
+	return t.set(ctx, db, key, nil, t.Deleted(""))
+}
+
+func (t *Table) set(ctx context.Context, db *sql.DB, key, value interface{}, cond string) error {
+	res, err := db.ExecContext(ctx, "UPDATE "+sqlite3lex.QuoteIdent(t.Name)+
+		" SET "+sqlite3lex.QuoteIdent(t.column())+" = ? WHERE "+t.key()+" = ? AND "+cond,
+		value, key)
+	if err != nil {
+		return fmt.Errorf("sqlite3soft: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SoftDelete soft-deletes the row of table whose rowid is id,
+// using the DefaultColumn convention.
+func SoftDelete(ctx context.Context, db *sql.DB, table string, id interface{}) error {
+	t := Table{Name: table}
+	return t.Delete(ctx, db, id)
+}
+
+// Purge removes the rows soft-deleted before cutoff, in batches of
+// batch rows (0 means 1000) so that the write lock is released between
+// them, and returns the number of rows removed.
+func (t *Table) Purge(ctx context.Context, db *sql.DB, cutoff time.Time, batch int) (int64, error) {
+	if batch <= 0 {
+		batch = 1000
+	}
+	table, col := sqlite3lex.QuoteIdent(t.Name), sqlite3lex.QuoteIdent(t.column())
+	stmt := "DELETE FROM " + table + " WHERE " + t.key() + " IN (SELECT " + t.key() + " FROM " + table +
+		" WHERE " + col + " IS NOT NULL AND " + col + " < ? LIMIT ?)"
+	var total int64
+	for {
+		res, err := db.ExecContext(ctx, stmt, t.Time.Value(cutoff), batch)
+		if err != nil {
+			return total, fmt.Errorf("sqlite3soft: purge %s: %w", t.Name, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("sqlite3soft: purge %s: %w", t.Name, err)
+		}
+		total += n
+		if n < int64(batch) {
+			return total, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+// PurgeTask returns a sqlite3maint.Task purging, every interval,
+// the rows soft-deleted more than retention ago.
+func (t *Table) PurgeTask(retention, every time.Duration) sqlite3maint.Task {
+	return sqlite3maint.Task{
+		Name:  "soft_purge_" + t.Name,
+		Every: every,
+		Run: func(ctx context.Context, db *sql.DB) error {
+			_, err := t.Purge(ctx, db, t.now().Add(-retention), 0)
+			return err
+		},
+	}
+}
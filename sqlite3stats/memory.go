@@ -0,0 +1,36 @@
+package sqlite3stats
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// SetSoftHeapLimit sets the advisory limit of SQLite's heap
+// (process-wide, PRAGMA soft_heap_limit): past it, SQLite frees
+// page cache memory to stay under it, without failing allocations.
+// n <= 0 removes the limit. It returns the previous limit.
+func SetSoftHeapLimit(ctx context.Context, db *sql.DB, n int64) (int64, error) {
+	return setHeapLimit(ctx, db, "soft_heap_limit", n)
+}
+
+// SetHardHeapLimit sets the hard limit of SQLite's heap (process-wide,
+// PRAGMA hard_heap_limit, SQLite 3.31+): allocations past it fail
+// with SQLITE_NOMEM. n <= 0 removes the limit. It returns the
+// previous limit.
+func SetHardHeapLimit(ctx context.Context, db *sql.DB, n int64) (int64, error) {
+	return setHeapLimit(ctx, db, "hard_heap_limit", n)
+}
+
+func setHeapLimit(ctx context.Context, db *sql.DB, pragma string, n int64) (int64, error) {
+	if n < 0 {
+		n = 0
+	}
+	var prev int64
+	if err := db.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(&prev); err != nil {
+		return 0, err
+	}
+	// PRAGMA arguments cannot be bound parameters.
+	_, err := db.ExecContext(ctx, "PRAGMA "+pragma+" = "+strconv.FormatInt(n, 10))
+	return prev, err
+}
@@ -0,0 +1,123 @@
+// Package sqlite3stats collects point-in-time statistics from the other
+// sqlite3-util-go instruments (write accounting, lock waits, latency
+// histograms, ...) under one registry, readable as a snapshot or served
+// as JSON from a debug endpoint.
+//
+// Unlike sqlite3metrics, which exports monotonic counters and gauges
+// to a monitoring backend, a stats Source returns an arbitrary
+// JSON-encodable value computed when asked for: tables of the top N
+// offenders, the currently longest-open transaction and the like.
+package sqlite3stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Source returns the current statistics of one instrument.
+// The value must be encodable with encoding/json.
+type Source func() interface{}
+
+// Registry is a set of named Sources; it is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	sources map[string]Source
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{sources: make(map[string]Source)}
+}
+
+// Default is the Registry used by the package-level functions.
+var Default = NewRegistry()
+
+// Register adds (or replaces) the Source published as name.
+func (r *Registry) Register(name string, src Source) {
+	r.mu.Lock()
+	r.sources[name] = src
+	r.mu.Unlock()
+}
+
+// Unregister removes the Source published as name, if any.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	delete(r.sources, name)
+	r.mu.Unlock()
+}
+
+// Names returns the registered names, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.sources))
+	for name := range r.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get calls the Source published as name;
+// the second result is false if there is none.
+func (r *Registry) Get(name string) (interface{}, bool) {
+	r.mu.RLock()
+	src, ok := r.sources[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return src(), true
+}
+
+// Snapshot calls every Source and returns the values by name.
+func (r *Registry) Snapshot() map[string]interface{} {
+	r.mu.RLock()
+	sources := make(map[string]Source, len(r.sources))
+	for name, src := range r.sources {
+		sources[name] = src
+	}
+	r.mu.RUnlock()
+
+	// Sources run without the lock held: they may take their own locks.
+	snap := make(map[string]interface{}, len(sources))
+	for name, src := range sources {
+		snap[name] = src()
+	}
+	return snap
+}
+
+// Handler serves the Snapshot as JSON, or only one Source
+// when the "source" query parameter names it (404 if unknown).
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var v interface{}
+		if name := req.URL.Query().Get("source"); name != "" {
+			var ok bool
+			if v, ok = r.Get(name); !ok {
+				http.NotFound(w, req)
+				return
+			}
+		} else {
+			v = r.Snapshot()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+	})
+}
+
+// Register adds (or replaces) a Source in the Default registry.
+func Register(name string, src Source) { Default.Register(name, src) }
+
+// Unregister removes a Source from the Default registry.
+func Unregister(name string) { Default.Unregister(name) }
+
+// Snapshot returns the Snapshot of the Default registry.
+func Snapshot() map[string]interface{} { return Default.Snapshot() }
+
+// Handler serves the Default registry as JSON.
+func Handler() http.Handler { return Default.Handler() }
@@ -0,0 +1,182 @@
+package sqlite3stats
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// TableWrites counts, per table, the rows inserted, updated and deleted
+// and an approximation of the bytes written, to show which tables drive
+// write load and WAL growth.
+//
+// Row counts come from the update hook (which SQLite does not call
+// for WITHOUT ROWID tables, nor for truncate-optimized "DELETE FROM t"
+// without a WHERE clause). Bytes are estimated from the trace: the
+// length of each statement with its bound values expanded is split
+// among the tables it changed, in proportion to their changed rows.
+// Statements changing rows inside triggers are attributed
+// to the statement that fired them.
+type TableWrites struct {
+	mu     sync.Mutex
+	tables map[string]*TableWriteStats
+}
+
+// TableWriteStats are the counters of one table.
+type TableWriteStats struct {
+	Schema  string `json:"schema"`
+	Table   string `json:"table"`
+	Inserts int64  `json:"inserts"`
+	Updates int64  `json:"updates"`
+	Deletes int64  `json:"deletes"`
+	Bytes   int64  `json:"bytes_approx"`
+}
+
+// Rows returns the total number of rows changed.
+func (s TableWriteStats) Rows() int64 {
+	return s.Inserts + s.Updates + s.Deletes
+}
+
+// NewTableWrites returns empty counters.
+func NewTableWrites() *TableWrites {
+	return &TableWrites{tables: make(map[string]*TableWriteStats)}
+}
+
+// writeConn is the per-connection state shared by the update hook
+// and the trace callback, both called on the goroutine running
+// the statement.
+type writeConn struct {
+	t       *TableWrites
+	pending map[string]*TableWriteStats // rows changed by the current statement
+	rows    int64
+	size    int64 // length of the current statement, expanded
+}
+
+// ConnectHook returns a function, to use as (or call from)
+// sqlite3.SQLiteDriver.ConnectHook, that registers the update hook
+// and installs trace on the connection with a callback accounting
+// the written bytes before calling trace.Callback.
+//
+// The connection's trace must not be set elsewhere
+// (leave sqlite3conn.Config.Trace nil and pass it here instead);
+// trace may be nil when no other tracing is wanted.
+func (t *TableWrites) ConnectHook(trace *sqlite3.TraceConfig) func(*sqlite3.SQLiteConn) error {
+	return func(conn *sqlite3.SQLiteConn) error {
+		wc := &writeConn{t: t, pending: make(map[string]*TableWriteStats)}
+		conn.RegisterUpdateHook(wc.updateHook)
+
+		cfg := sqlite3.TraceConfig{
+			EventMask:       sqlite3.TraceStmt | sqlite3.TraceProfile,
+			WantExpandedSQL: true,
+		}
+		var userMask uint32
+		next := func(sqlite3.TraceInfo) int { return 0 }
+		if trace != nil && trace.Callback != nil {
+			cfg.EventMask |= trace.EventMask
+			userMask = uint32(trace.EventMask)
+			next = trace.Callback
+		}
+		cfg.Callback = func(info sqlite3.TraceInfo) int {
+			switch info.EventCode {
+			case sqlite3.TraceStmt:
+				if !strings.HasPrefix(info.StmtOrTrigger, "--") {
+					wc.reset()
+					// Profile events carry no text: keep the size for them.
+					wc.size = int64(len(info.ExpandedSQL))
+				}
+			case sqlite3.TraceProfile:
+				wc.flush(wc.size)
+			}
+			if info.EventCode&userMask == 0 {
+				return 0
+			}
+			return next(info)
+		}
+		return conn.SetTrace(&cfg)
+	}
+}
+
+func (wc *writeConn) updateHook(op int, schema, table string, rowid int64) {
+	key := schema + "." + table
+	s := wc.pending[key]
+	if s == nil {
+		s = &TableWriteStats{Schema: schema, Table: table}
+		wc.pending[key] = s
+	}
+	switch op {
+	case sqlite3.SQLITE_INSERT:
+		s.Inserts++
+	case sqlite3.SQLITE_UPDATE:
+		s.Updates++
+	case sqlite3.SQLITE_DELETE:
+		s.Deletes++
+	default:
+		return
+	}
+	wc.rows++
+}
+
+func (wc *writeConn) reset() {
+	if len(wc.pending) != 0 {
+		// The previous statement ended without a Profile event
+		// (it failed): count its rows anyway, without bytes.
+		wc.flush(0)
+	}
+}
+
+// flush adds the rows of the current statement to the totals,
+// spreading size bytes over the changed tables.
+func (wc *writeConn) flush(size int64) {
+	if len(wc.pending) == 0 {
+		return
+	}
+	t := wc.t
+	t.mu.Lock()
+	for key, p := range wc.pending {
+		s := t.tables[key]
+		if s == nil {
+			s = &TableWriteStats{Schema: p.Schema, Table: p.Table}
+			t.tables[key] = s
+		}
+		s.Inserts += p.Inserts
+		s.Updates += p.Updates
+		s.Deletes += p.Deletes
+		s.Bytes += size * p.Rows() / wc.rows
+		delete(wc.pending, key)
+	}
+	t.mu.Unlock()
+	wc.rows = 0
+}
+
+// Stats returns the counters of every table that was written,
+// the most written (by approximate bytes, then rows) first.
+func (t *TableWrites) Stats() []TableWriteStats {
+	t.mu.Lock()
+	stats := make([]TableWriteStats, 0, len(t.tables))
+	for _, s := range t.tables {
+		stats = append(stats, *s)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Bytes != stats[j].Bytes {
+			return stats[i].Bytes > stats[j].Bytes
+		}
+		return stats[i].Rows() > stats[j].Rows()
+	})
+	return stats
+}
+
+// Source returns Stats as a Source, for Registry.Register.
+func (t *TableWrites) Source() Source {
+	return func() interface{} { return t.Stats() }
+}
+
+// Reset zeroes all counters.
+func (t *TableWrites) Reset() {
+	t.mu.Lock()
+	t.tables = make(map[string]*TableWriteStats)
+	t.mu.Unlock()
+}
@@ -0,0 +1,325 @@
+// Package sqlite3tenant manages one SQLite database file per tenant:
+// databases are opened on demand from a path template, configured with
+// the standard sqlite3conn.Config, and closed again (least recently used
+// first) when too many are open.
+package sqlite3tenant
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3conn"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lifecycle"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3probe"
+)
+
+// TenantPlaceholder is replaced by the tenant ID in Options.PathTemplate.
+const TenantPlaceholder = "{tenant}"
+
+// ErrInvalidTenantID is returned for IDs that could escape the directory
+// of the path template or are otherwise unsuitable as a filename.
+var ErrInvalidTenantID = errors.New("sqlite3tenant: invalid tenant ID")
+
+// ErrClosed is returned by Acquire after Close.
+var ErrClosed = errors.New("sqlite3tenant: manager closed")
+
+var validTenantID = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// Options configure a Manager.
+type Options struct {
+	// PathTemplate is the database filename, with TenantPlaceholder
+	// standing for the tenant ID, e.g. "/var/lib/app/tenants/{tenant}.db".
+	PathTemplate string
+
+	// DSNParams, if not empty, is appended to the filename as URI
+	// query parameters (without the leading '?'), e.g. "_txlock=immediate".
+	DSNParams string
+
+	// Config is applied to every connection of every tenant database.
+	Config *sqlite3conn.Config
+
+	// MaxOpen caps the number of tenant databases open at the same time
+	// (0 means no limit). Databases currently acquired are never evicted,
+	// so the cap can be exceeded while all of them are in use.
+	MaxOpen int
+
+	// CreateDirs creates missing parent directories of tenant files.
+	CreateDirs bool
+
+	// CloseTimeout bounds the graceful shutdown of an evicted database
+	// (see sqlite3lifecycle.Shutdown); 0 means 5 seconds.
+	CloseTimeout time.Duration
+}
+
+// TenantStats describes one tenant known to a Manager.
+type TenantStats struct {
+	TenantID string
+	Path     string
+	Open     bool
+	InUse    int // current Acquire calls not yet released
+	Opens    int64
+	Acquires int64
+	LastUsed time.Time
+	OpenedAt time.Time
+	DB       sql.DBStats // zero when not open
+}
+
+type tenant struct {
+	id       string
+	path     string
+	db       *sql.DB
+	refs     int
+	opens    int64
+	acquires int64
+	lastUsed time.Time
+	openedAt time.Time
+	elem     *list.Element // position in Manager.lru while open
+}
+
+// Manager opens, hands out and closes per-tenant databases.
+// It is safe for concurrent use.
+type Manager struct {
+	opts Options
+
+	mu      sync.Mutex
+	tenants map[string]*tenant
+	lru     *list.List // of *tenant, most recently used at the front
+	closed  bool
+}
+
+// NewManager returns a Manager; nothing is opened until Acquire.
+func NewManager(opts Options) (*Manager, error) {
+	if !strings.Contains(opts.PathTemplate, TenantPlaceholder) {
+		return nil, fmt.Errorf("sqlite3tenant: path template %q lacks %s",
+			opts.PathTemplate, TenantPlaceholder)
+	}
+	if opts.CloseTimeout == 0 {
+		opts.CloseTimeout = 5 * time.Second
+	}
+	return &Manager{
+		opts:    opts,
+		tenants: make(map[string]*tenant),
+		lru:     list.New(),
+	}, nil
+}
+
+// Path returns the database filename of a tenant.
+func (m *Manager) Path(tenantID string) (string, error) {
+	if !validTenantID.MatchString(tenantID) || strings.Contains(tenantID, "..") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTenantID, tenantID)
+	}
+	return strings.Replace(m.opts.PathTemplate, TenantPlaceholder, tenantID, -1), nil
+}
+
+// Handle is a tenant database acquired from a Manager.
+// Release it when done; the DB must not be used afterwards.
+type Handle struct {
+	DB *sql.DB
+
+	m    *Manager
+	t    *tenant
+	once sync.Once
+}
+
+// Release returns the handle to its Manager.
+func (h *Handle) Release() {
+	h.once.Do(func() {
+		h.m.release(h.t)
+	})
+}
+
+// Acquire returns the database of a tenant, opening it if needed.
+func (m *Manager) Acquire(ctx context.Context, tenantID string) (*Handle, error) {
+	path, err := m.Path(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrClosed
+	}
+	t, ok := m.tenants[tenantID]
+	if !ok {
+		t = &tenant{id: tenantID, path: path}
+		m.tenants[tenantID] = t
+	}
+	t.refs++
+	t.acquires++
+	t.lastUsed = time.Now()
+	if t.db != nil {
+		m.lru.MoveToFront(t.elem)
+		m.mu.Unlock()
+		return &Handle{DB: t.db, m: m, t: t}, nil
+	}
+	m.mu.Unlock()
+
+	// Opening happens outside the lock; a concurrent Acquire of the same
+	// tenant may open it too, the loser's pool is closed below.
+	db, err := m.open(ctx, path)
+
+	m.mu.Lock()
+	if err != nil {
+		t.refs--
+		m.mu.Unlock()
+		return nil, err
+	}
+	if m.closed {
+		// Close ran while opening: it could not close this pool.
+		t.refs--
+		m.mu.Unlock()
+		db.Close()
+		return nil, ErrClosed
+	}
+	if t.db != nil {
+		m.lru.MoveToFront(t.elem)
+		m.mu.Unlock()
+		db.Close()
+		return &Handle{DB: t.db, m: m, t: t}, nil
+	}
+	t.db = db
+	t.opens++
+	t.openedAt = time.Now()
+	t.elem = m.lru.PushFront(t)
+	victims := m.evictLocked()
+	m.mu.Unlock()
+
+	m.closeAll(victims)
+	return &Handle{DB: db, m: m, t: t}, nil
+}
+
+// With acquires the tenant database, calls fn and releases it.
+func (m *Manager) With(ctx context.Context, tenantID string, fn func(*sql.DB) error) error {
+	h, err := m.Acquire(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer h.Release()
+	return fn(h.DB)
+}
+
+func (m *Manager) open(ctx context.Context, path string) (*sql.DB, error) {
+	if m.opts.CreateDirs {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return nil, err
+		}
+	}
+	dsn := path
+	if m.opts.DSNParams != "" {
+		dsn = sqlite3probe.FileURI(path) + "?" + m.opts.DSNParams
+	}
+	db, err := sqlite3conn.Open(dsn, m.opts.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlite3tenant: opening %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func (m *Manager) release(t *tenant) {
+	m.mu.Lock()
+	t.refs--
+	t.lastUsed = time.Now()
+	victims := m.evictLocked()
+	m.mu.Unlock()
+
+	m.closeAll(victims)
+}
+
+// evictLocked detaches least recently used, unreferenced databases
+// while more than MaxOpen are open; the caller closes them after
+// unlocking.
+func (m *Manager) evictLocked() []*sql.DB {
+	if m.opts.MaxOpen <= 0 {
+		return nil
+	}
+	var victims []*sql.DB
+	for e := m.lru.Back(); e != nil && m.lru.Len() > m.opts.MaxOpen; {
+		prev := e.Prev()
+		t := e.Value.(*tenant)
+		if t.refs == 0 {
+			victims = append(victims, t.db)
+			m.lru.Remove(e)
+			t.db, t.elem = nil, nil
+		}
+		e = prev
+	}
+	return victims
+}
+
+func (m *Manager) closeAll(dbs []*sql.DB) error {
+	var firstErr error
+	for _, db := range dbs {
+		ctx, cancel := context.WithTimeout(context.Background(), m.opts.CloseTimeout)
+		err := sqlite3lifecycle.Shutdown(ctx, db)
+		cancel()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Stats returns one entry per tenant seen so far, sorted by tenant ID.
+func (m *Manager) Stats() []TenantStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]TenantStats, 0, len(m.tenants))
+	for _, t := range m.tenants {
+		s := TenantStats{
+			TenantID: t.id,
+			Path:     t.path,
+			Open:     t.db != nil,
+			InUse:    t.refs,
+			Opens:    t.opens,
+			Acquires: t.acquires,
+			LastUsed: t.lastUsed,
+			OpenedAt: t.openedAt,
+		}
+		if t.db != nil {
+			s.DB = t.db.Stats()
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].TenantID < stats[j].TenantID })
+	return stats
+}
+
+// OpenCount returns the number of tenant databases currently open.
+func (m *Manager) OpenCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// Close shuts down every open tenant database (handles still acquired
+// become unusable) and makes further Acquire calls fail.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	var dbs []*sql.DB
+	for e := m.lru.Front(); e != nil; e = e.Next() {
+		t := e.Value.(*tenant)
+		dbs = append(dbs, t.db)
+		t.db, t.elem = nil, nil
+	}
+	m.lru.Init()
+	m.mu.Unlock()
+
+	return m.closeAll(dbs)
+}
@@ -0,0 +1,258 @@
+// Package sqlite3time stores time.Time values in the three ways SQLite's
+// date and time functions understand (ISO-8601 text, Unix time and
+// Julian day numbers) with the choice made explicit in a Codec,
+// and reads them back from any of them.
+//
+// SQLite has no time type: a column holds whatever was written, and
+// the driver's own conversion (text with the zone of the time.Time
+// value, parsed back only for columns declared DATE, DATETIME or
+// TIMESTAMP) depends on the declared type and on the "_loc" DSN
+// parameter. Binding c.Value(t) and scanning into c.Into(&t) instead
+// makes the stored format and the time zone policy independent of both.
+package sqlite3time
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is a storage format.
+type Format int
+
+const (
+	// Text is SQLite's own format, "YYYY-MM-DD HH:MM:SS.SSS" in UTC,
+	// as produced by datetime() and strftime(); it sorts chronologically.
+	// Sub-millisecond precision is lost.
+	Text Format = iota
+	// RFC3339 is "YYYY-MM-DDTHH:MM:SS.nnnnnnnnnZ" in UTC, with all nine
+	// fraction digits so that it sorts chronologically; SQLite's
+	// functions accept it.
+	RFC3339
+	// UnixSeconds is an INTEGER of seconds since 1970-01-01 UTC
+	// (the 'unixepoch' modifier); sub-second precision is lost.
+	UnixSeconds
+	// UnixMillis is an INTEGER of milliseconds since 1970-01-01 UTC.
+	UnixMillis
+	// JulianDay is a REAL number of days since noon in Greenwich on
+	// November 24, 4714 B.C., as julianday() returns; its precision
+	// is about a tenth of a millisecond for current dates.
+	JulianDay
+)
+
+var formatNames = [...]string{"text", "rfc3339", "unixseconds", "unixmillis", "julianday"}
+
+func (f Format) String() string {
+	if f >= 0 && int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+	return "Format(" + strconv.Itoa(int(f)) + ")"
+}
+
+const (
+	textLayout    = "2006-01-02 15:04:05.000"
+	rfc3339Layout = "2006-01-02T15:04:05.000000000Z07:00"
+
+	// julianUnixEpoch is the Julian day number of 1970-01-01 00:00 UTC.
+	julianUnixEpoch = 2440587.5
+	secondsPerDay   = 86400
+)
+
+// textLayouts are the text formats Parse accepts: those of SQLite's
+// date and time functions, with optional 'T', fraction and zone,
+// and the one go-sqlite3 writes time.Time values in.
+var textLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04Z07:00",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01-02 15:04:05.999999999 -0700 MST", // time.Time.String
+}
+
+// Codec converts between time.Time and one storage Format.
+// The zero value stores Text and reads times in UTC.
+type Codec struct {
+	Format Format
+
+	// Location is the time zone of the times read back
+	// (stored times are always UTC); nil means UTC.
+	Location *time.Location
+}
+
+// Common codecs.
+var (
+	TextUTC    = Codec{Format: Text}
+	RFC3339UTC = Codec{Format: RFC3339}
+	Unix       = Codec{Format: UnixSeconds}
+	UnixMilli  = Codec{Format: UnixMillis}
+	Julian     = Codec{Format: JulianDay}
+	TextLocal  = Codec{Format: Text, Location: time.Local}
+)
+
+// Encode returns the value storing t.
+func (c Codec) Encode(t time.Time) driver.Value {
+	t = t.UTC()
+	switch c.Format {
+	case RFC3339:
+		return t.Format(rfc3339Layout)
+	case UnixSeconds:
+		return t.Unix()
+	case UnixMillis:
+		return t.UnixNano() / int64(time.Millisecond)
+	case JulianDay:
+		return julianUnixEpoch + float64(t.UnixNano())/1e9/secondsPerDay
+	}
+	return t.Format(textLayout)
+}
+
+// Decode converts a column value of any storage format into a time
+// in c.Location. Text is parsed in any of the formats SQLite accepts
+// (without a zone, it is UTC). Numbers are read according to c.Format:
+// integers are Unix milliseconds for UnixMillis and Unix seconds
+// otherwise; reals are Julian days for JulianDay and Unix seconds
+// otherwise. NULL is an error: scan into a pointer for nullable columns.
+func (c Codec) Decode(src interface{}) (time.Time, error) {
+	t, err := c.decode(src)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc), nil
+}
+
+func (c Codec) decode(src interface{}) (time.Time, error) {
+	switch v := src.(type) {
+	case nil:
+		return time.Time{}, fmt.Errorf("sqlite3time: NULL is not a time")
+	case time.Time:
+		return v, nil
+	case int64:
+		if c.Format == UnixMillis {
+			return time.Unix(0, v*int64(time.Millisecond)), nil
+		}
+		return time.Unix(v, 0), nil
+	case float64:
+		if c.Format == JulianDay {
+			v = (v - julianUnixEpoch) * secondsPerDay
+		}
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))), nil
+	case []byte:
+		return ParseText(string(v))
+	case string:
+		return ParseText(v)
+	}
+	return time.Time{}, fmt.Errorf("sqlite3time: cannot convert %T to a time", src)
+}
+
+// ParseText parses the text formats of SQLite's date and time functions,
+// with optional 'T' separator, fraction and zone ("Z" or "±HH:MM");
+// a time without zone is UTC.
+func ParseText(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range textLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("sqlite3time: %q is not a date and time", s)
+}
+
+// Parse is TextUTC.Decode: it reads any storage format,
+// taking numbers as Unix seconds.
+func Parse(src interface{}) (time.Time, error) {
+	return TextUTC.Decode(src)
+}
+
+type valuer struct {
+	c Codec
+	t time.Time
+}
+
+// Value returns a driver.Valuer binding t in format c,
+// e.g. db.Exec("INSERT INTO t(at) VALUES (?)", sqlite3time.Unix.Value(now)).
+func (c Codec) Value(t time.Time) driver.Valuer {
+	return valuer{c, t}
+}
+
+func (v valuer) Value() (driver.Value, error) {
+	return v.c.Encode(v.t), nil
+}
+
+type scanner struct {
+	c    Codec
+	dest interface{}
+}
+
+// Into returns a sql.Scanner decoding a column into dest, a *time.Time
+// or, for nullable columns, a **time.Time (set to nil for NULL).
+func (c Codec) Into(dest interface{}) sql.Scanner {
+	return scanner{c, dest}
+}
+
+func (s scanner) Scan(src interface{}) error {
+	switch d := s.dest.(type) {
+	case *time.Time:
+		t, err := s.c.Decode(src)
+		if err != nil {
+			return err
+		}
+		*d = t
+	case **time.Time:
+		if src == nil {
+			*d = nil
+			return nil
+		}
+		t, err := s.c.Decode(src)
+		if err != nil {
+			return err
+		}
+		*d = &t
+	default:
+		return fmt.Errorf("sqlite3time: cannot scan into %T", s.dest)
+	}
+	return nil
+}
+
+// SQL returns an SQL expression converting expr, a date and time value
+// SQLite understands (text, or a Julian day number), into format f,
+// e.g. for migrating a column: UnixSeconds.SQL("created") is
+// "CAST(strftime('%s', created) AS INTEGER)".
+func (f Format) SQL(expr string) string {
+	switch f {
+	case RFC3339:
+		return "strftime('%Y-%m-%dT%H:%M:%f000000Z', " + expr + ")"
+	case UnixSeconds:
+		return "CAST(strftime('%s', " + expr + ") AS INTEGER)"
+	case UnixMillis:
+		return "CAST(round((julianday(" + expr + ") - 2440587.5) * 86400000) AS INTEGER)"
+	case JulianDay:
+		return "julianday(" + expr + ")"
+	}
+	return "strftime('%Y-%m-%d %H:%M:%f', " + expr + ")"
+}
+
+// Normalize returns an SQL expression converting expr, a column stored
+// in format f, into SQLite's text format, as date and time functions
+// and comparisons with datetime('now') expect.
+func (f Format) Normalize(expr string) string {
+	switch f {
+	case UnixSeconds:
+		return "strftime('%Y-%m-%d %H:%M:%f', " + expr + ", 'unixepoch')"
+	case UnixMillis:
+		return "strftime('%Y-%m-%d %H:%M:%f', " + expr + " / 1000.0, 'unixepoch')"
+	}
+	return "strftime('%Y-%m-%d %H:%M:%f', " + expr + ")"
+}
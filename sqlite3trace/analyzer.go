@@ -0,0 +1,255 @@
+package sqlite3trace
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3metrics"
+)
+
+// Names of the heuristics reported in SecurityEvent.Rule.
+const (
+	RuleStacked      = "stacked-statements" // a statement following a ';'-terminated one that embedded literals
+	RuleTautology    = "tautology"          // OR 1=1, OR 'a'='a', OR TRUE ...
+	RuleTrailComment = "trailing-comment"   // comment right after a string literal, ending the statement
+	RulePragma       = "pragma"             // PRAGMA not in the allowed list
+	RuleAttach       = "attach"             // ATTACH or DETACH
+)
+
+// SecurityEvent is emitted by the Analyzer for a suspicious statement.
+type SecurityEvent struct {
+	Time       time.Time
+	Rule       string
+	Detail     string
+	ConnHandle uintptr
+	SQL        string // statement text as prepared (sqlite3.TraceInfo.StmtOrTrigger)
+	Expanded   string // with bound parameters, if the trace config asked for it
+}
+
+// AnalyzerOptions configure an Analyzer.
+type AnalyzerOptions struct {
+	// OnEvent receives security events; it runs synchronously inside
+	// the trace callback, so it should be fast.
+	OnEvent func(SecurityEvent)
+
+	// FlagPragma and FlagAttach enable the RulePragma and RuleAttach checks;
+	// turn them on when no code path is supposed to run these statements
+	// after connection setup (e.g. request handlers).
+	FlagPragma bool
+	FlagAttach bool
+	// AllowedPragmas (case-insensitive names) are never flagged.
+	AllowedPragmas []string
+
+	// Metrics, if not nil, counts events in
+	// sqlite3_trace_security_events_total{rule}.
+	Metrics *sqlite3metrics.Registry
+}
+
+// Analyzer is a trace pipeline stage flagging statements that look
+// like the result of SQL injection. It is a cheap heuristic layer,
+// not a guarantee: it looks for traces typical of user input pasted
+// into SQL text (literals where parameters belong, tautologies,
+// truncating comments, stacked statements).
+//
+// Only TraceStmt events are analyzed, so the mask must include Stmt.
+type Analyzer struct {
+	opts    AnalyzerOptions
+	allowed map[string]bool
+	events  sqlite3metrics.Counter
+
+	mu sync.Mutex
+	// prevLiteralTerm remembers, per connection, whether the previous
+	// statement ended with ';' and embedded string literals.
+	prevLiteralTerm map[uintptr]bool
+}
+
+// NewAnalyzer returns an Analyzer.
+func NewAnalyzer(opts AnalyzerOptions) *Analyzer {
+	a := &Analyzer{
+		opts:            opts,
+		allowed:         make(map[string]bool),
+		prevLiteralTerm: make(map[uintptr]bool),
+	}
+	for _, p := range opts.AllowedPragmas {
+		a.allowed[strings.ToLower(p)] = true
+	}
+	a.events = sqlite3metrics.OrNop(opts.Metrics).Counter("trace", "security_events_total",
+		"Suspicious statements flagged by the trace analyzer.", "rule")
+	return a
+}
+
+// Callback returns a trace callback that analyzes each event
+// and then passes it to next (which may be nil).
+func (a *Analyzer) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		for _, ev := range a.Analyze(info) {
+			a.events.Add(1, ev.Rule)
+			if a.opts.OnEvent != nil {
+				a.opts.OnEvent(ev)
+			}
+		}
+		return next(info)
+	}
+}
+
+// Analyze returns the security events for one trace event.
+func (a *Analyzer) Analyze(info sqlite3.TraceInfo) []SecurityEvent {
+	if info.EventCode == sqlite3.TraceClose {
+		a.mu.Lock()
+		delete(a.prevLiteralTerm, info.ConnHandle)
+		a.mu.Unlock()
+		return nil
+	}
+	if info.EventCode != sqlite3.TraceStmt {
+		return nil
+	}
+	text := info.StmtOrTrigger
+	if strings.HasPrefix(text, "--") {
+		return nil // trigger subprogram marker, not application SQL
+	}
+
+	var events []SecurityEvent
+	emit := func(rule, detail string) {
+		events = append(events, SecurityEvent{
+			Time:       time.Now(),
+			Rule:       rule,
+			Detail:     detail,
+			ConnHandle: info.ConnHandle,
+			SQL:        text,
+			Expanded:   info.ExpandedSQL,
+		})
+	}
+
+	toks := sqlite3lex.Tokenize(text)
+	sig := significant(toks)
+	if len(sig) == 0 {
+		return nil
+	}
+	first := strings.ToUpper(sig[0].Text)
+
+	a.mu.Lock()
+	stacked := a.prevLiteralTerm[info.ConnHandle]
+	a.prevLiteralTerm[info.ConnHandle] = endsWithSemicolon(sig) && hasStringLiteral(sig)
+	a.mu.Unlock()
+	if stacked && first != "SELECT" && first != "COMMIT" && first != "END" && first != "ROLLBACK" {
+		emit(RuleStacked, first+" after a ';'-terminated statement with embedded literals")
+	}
+
+	if d := findTautology(sig); d != "" {
+		emit(RuleTautology, d)
+	}
+	if d := findTrailingComment(toks); d != "" {
+		emit(RuleTrailComment, d)
+	}
+
+	switch first {
+	case "PRAGMA":
+		if a.opts.FlagPragma {
+			name := pragmaName(sig)
+			if !a.allowed[name] {
+				emit(RulePragma, "PRAGMA "+name)
+			}
+		}
+	case "ATTACH", "DETACH":
+		if a.opts.FlagAttach {
+			emit(RuleAttach, first)
+		}
+	}
+	return events
+}
+
+func significant(toks []sqlite3lex.Token) []sqlite3lex.Token {
+	var sig []sqlite3lex.Token
+	for _, t := range toks {
+		if t.Significant() {
+			sig = append(sig, t)
+		}
+	}
+	return sig
+}
+
+// pragmaName returns the lowercased name in "PRAGMA [schema.]name ...".
+func pragmaName(sig []sqlite3lex.Token) string {
+	if len(sig) > 3 && sig[2].IsPunct(".") {
+		return strings.ToLower(sig[3].Text)
+	}
+	if len(sig) > 1 {
+		return strings.ToLower(sig[1].Text)
+	}
+	return ""
+}
+
+func endsWithSemicolon(sig []sqlite3lex.Token) bool {
+	return len(sig) > 0 && sig[len(sig)-1].IsPunct(";")
+}
+
+func hasStringLiteral(sig []sqlite3lex.Token) bool {
+	for _, t := range sig {
+		if t.Kind == sqlite3lex.String {
+			return true
+		}
+	}
+	return false
+}
+
+// findTautology looks for OR followed by an always-true term:
+// two identical literals compared with = == IS LIKE, or a lone
+// TRUE / non-zero number closing the condition.
+func findTautology(sig []sqlite3lex.Token) string {
+	for i := 0; i < len(sig)-1; i++ {
+		if !sig[i].Is("OR") {
+			continue
+		}
+		rest := sig[i+1:]
+		if len(rest) >= 3 && rest[0].IsLiteral() &&
+			(rest[1].IsPunct("=") || rest[1].IsPunct("==") || rest[1].Is("IS") || rest[1].Is("LIKE")) &&
+			rest[2].Kind == rest[0].Kind && strings.EqualFold(rest[2].Text, rest[0].Text) {
+			return "OR " + rest[0].Text + " " + rest[1].Text + " " + rest[2].Text
+		}
+		if rest[0].Is("TRUE") || rest[0].Kind == sqlite3lex.Number && strings.Trim(rest[0].Text, "0.") != "" {
+			if len(rest) == 1 || rest[1].IsPunct(")") || rest[1].IsPunct(";") ||
+				rest[1].Is("OR") || rest[1].Is("ORDER") || rest[1].Is("LIMIT") || rest[1].Is("GROUP") {
+				return "OR " + rest[0].Text
+			}
+		}
+	}
+	return ""
+}
+
+// findTrailingComment reports a comment that directly follows a string
+// literal and is followed by nothing significant: the shape of input
+// like "x' --" closing a quote and commenting out the rest. The
+// comments this package writes or reads, TagQuery tags and trace
+// directives, do not count.
+func findTrailingComment(toks []sqlite3lex.Token) string {
+	last := -1
+	for i, t := range toks {
+		if t.Significant() && !t.IsPunct(";") {
+			last = i
+		}
+	}
+	if last < 0 || toks[last].Kind != sqlite3lex.String {
+		return ""
+	}
+	for _, t := range toks[last+1:] {
+		if t.Kind == sqlite3lex.Comment && !isAnnotation(t.Text) {
+			return "comment after closing literal " + toks[last].Text
+		}
+	}
+	return ""
+}
+
+// isAnnotation tells whether the comment text is a trace directive or
+// has the sqlcommenter form of TagQuery.
+func isAnnotation(text string) bool {
+	if commentDirective(text) != DirectiveNone {
+		return true
+	}
+	return strings.HasPrefix(text, "/*") &&
+		parseTagComment(strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")) != nil
+}
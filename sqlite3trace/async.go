@@ -0,0 +1,160 @@
+package sqlite3trace
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3metrics"
+)
+
+// FullPolicy says what an AsyncSink does with an event when its buffer is full.
+type FullPolicy int
+
+const (
+	DropNewest FullPolicy = iota // drop the event being emitted
+	DropOldest                   // drop the oldest buffered event to make room
+	Block                        // wait for room, slowing the statements down
+)
+
+var fullPolicyNames = map[FullPolicy]string{
+	DropNewest: "drop-newest",
+	DropOldest: "drop-oldest",
+	Block:      "block",
+}
+
+func (p FullPolicy) String() string {
+	if n, ok := fullPolicyNames[p]; ok {
+		return n
+	}
+	return fmt.Sprintf("FullPolicy(%d)", int(p))
+}
+
+// ParseFullPolicy returns the FullPolicy named s (as by String).
+func ParseFullPolicy(s string) (FullPolicy, error) {
+	for p, n := range fullPolicyNames {
+		if s == n {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("sqlite3trace: unknown full policy %q", s)
+}
+
+// ErrSinkClosed is returned by the Emit of a closed AsyncSink.
+var ErrSinkClosed = errors.New("sqlite3trace: sink closed")
+
+// AsyncOptions configure an AsyncSink.
+type AsyncOptions struct {
+	// Buffer is the number of events held; 0 means 1024.
+	Buffer int
+	// Full is what happens to events when the buffer is full.
+	Full FullPolicy
+	// OnError, if not nil, receives the errors of the wrapped Sink.
+	OnError func(error)
+	// Metrics, if not nil, counts the dropped events in
+	// sqlite3_trace_dropped_events_total.
+	Metrics *sqlite3metrics.Registry
+}
+
+// AsyncSink takes the writing of another Sink off the trace callback,
+// which runs on the hot path of every statement: Emit only queues the
+// event, and a goroutine hands the queued events to the wrapped Sink.
+type AsyncSink struct {
+	sink    Sink
+	full    FullPolicy
+	onError func(error)
+	drops   sqlite3metrics.Counter
+	dropped int64 // atomic
+
+	mu     sync.RWMutex // held for reading while queuing, for writing by Close
+	closed bool
+	ch     chan *TraceRecord
+	done   chan struct{}
+}
+
+var _ Sink = (*AsyncSink)(nil)
+
+// NewAsyncSink returns an AsyncSink writing to s;
+// Close must be called to flush it and stop its goroutine.
+func NewAsyncSink(s Sink, opts AsyncOptions) *AsyncSink {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 1024
+	}
+	a := &AsyncSink{
+		sink:    s,
+		full:    opts.Full,
+		onError: opts.OnError,
+		drops: sqlite3metrics.OrNop(opts.Metrics).Counter("trace", "dropped_events_total",
+			"Trace events dropped by an asynchronous sink with a full buffer."),
+		ch:   make(chan *TraceRecord, opts.Buffer),
+		done: make(chan struct{}),
+	}
+	go a.loop()
+	return a
+}
+
+func (a *AsyncSink) loop() {
+	defer close(a.done)
+	for rec := range a.ch {
+		if err := a.sink.Emit(rec); err != nil && a.onError != nil {
+			a.onError(err)
+		}
+	}
+}
+
+// Emit implements Sink, queuing rec.
+func (a *AsyncSink) Emit(rec *TraceRecord) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrSinkClosed
+	}
+	switch a.full {
+	case Block:
+		a.ch <- rec
+		return nil
+	case DropOldest:
+		for {
+			select {
+			case a.ch <- rec:
+				return nil
+			default:
+			}
+			select {
+			case <-a.ch:
+				a.drop()
+			default: // emptied meanwhile by the writer
+			}
+		}
+	}
+	select {
+	case a.ch <- rec:
+	default:
+		a.drop()
+	}
+	return nil
+}
+
+func (a *AsyncSink) drop() {
+	atomic.AddInt64(&a.dropped, 1)
+	a.drops.Add(1)
+}
+
+// Dropped returns the number of events dropped so far.
+func (a *AsyncSink) Dropped() int64 {
+	return atomic.LoadInt64(&a.dropped)
+}
+
+// Close stops accepting events, and returns once the queued ones
+// are written.
+func (a *AsyncSink) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.ch)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
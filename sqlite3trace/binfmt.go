@@ -0,0 +1,219 @@
+package sqlite3trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3tracemask"
+)
+
+// binaryMark starts each record of the binary format; it cannot
+// start a JSON record, which lets NewRecordReader tell them apart.
+const binaryMark = 0xA7
+
+// maxBinaryRecord bounds the length read for one record.
+const maxBinaryRecord = 64 << 20
+
+// ErrCorrupt is returned (wrapped) when reading a damaged binary trace.
+var ErrCorrupt = errors.New("sqlite3trace: corrupt binary trace")
+
+// BinaryFormatter renders each event in a compact binary form, for
+// high-volume capture where JSON costs too much CPU and disk; read it
+// back with NewBinaryReader or NewRecordReader.
+//
+// A record is the byte 0xA7, then the length of the rest as an
+// unsigned varint, then the fields of TraceRecord in this order:
+// version, event code, connection and statement handles (uvarints);
+// time in Unix nanoseconds, run time, error code, extended error code
+// (varints); autocommit (a byte 0 or 1); connection label, statement,
+// expanded statement (uvarint length and bytes); the number of tags
+// and each name and value (as the strings); the begin time in Unix
+// nanoseconds (0 for none) and the rows (varints). Event and error names are
+// derived from the codes when reading. Fields added in later versions
+// go at the end, so older readers skip them.
+type BinaryFormatter struct{}
+
+// AppendFormat implements Formatter.
+func (BinaryFormatter) AppendFormat(dst []byte, rec *TraceRecord) []byte {
+	var body []byte
+	body = binary.AppendUvarint(body, uint64(rec.Version))
+	body = binary.AppendUvarint(body, uint64(rec.EventCode))
+	body = binary.AppendUvarint(body, uint64(rec.Conn))
+	body = binary.AppendUvarint(body, uint64(rec.Stmt))
+	body = binary.AppendVarint(body, rec.Time.UnixNano())
+	body = binary.AppendVarint(body, rec.NS)
+	body = binary.AppendVarint(body, int64(rec.ErrCode))
+	body = binary.AppendVarint(body, int64(rec.ErrExtended))
+	if rec.AutoCommit {
+		body = append(body, 1)
+	} else {
+		body = append(body, 0)
+	}
+	for _, s := range []string{rec.ConnLabel, rec.SQL, rec.ExpandedSQL} {
+		body = appendBinaryString(body, s)
+	}
+	keys := make([]string, 0, len(rec.Tags))
+	for k := range rec.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	body = binary.AppendUvarint(body, uint64(len(keys)))
+	for _, k := range keys {
+		body = appendBinaryString(body, k)
+		body = appendBinaryString(body, rec.Tags[k])
+	}
+	var begin int64
+	if rec.Begin != nil {
+		begin = rec.Begin.UnixNano()
+	}
+	body = binary.AppendVarint(body, begin)
+	body = binary.AppendVarint(body, rec.Rows)
+
+	dst = append(dst, binaryMark)
+	dst = binary.AppendUvarint(dst, uint64(len(body)))
+	return append(dst, body...)
+}
+
+func appendBinaryString(dst []byte, s string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(s)))
+	return append(dst, s...)
+}
+
+type binaryReader struct {
+	r   *bufio.Reader
+	n   int
+	buf []byte
+}
+
+// NewBinaryReader returns a RecordReader for the output of BinaryFormatter.
+func NewBinaryReader(r io.Reader) RecordReader {
+	return &binaryReader{r: bufio.NewReader(r)}
+}
+
+func (r *binaryReader) Read() (*TraceRecord, error) {
+	mark, err := r.r.ReadByte()
+	if err != nil {
+		return nil, err // io.EOF at the end
+	}
+	r.n++
+	if mark != binaryMark {
+		return nil, fmt.Errorf("%w: record %d: bad mark 0x%x", ErrCorrupt, r.n, mark)
+	}
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil || size > maxBinaryRecord {
+		return nil, fmt.Errorf("%w: record %d: bad length", ErrCorrupt, r.n)
+	}
+	if uint64(cap(r.buf)) < size {
+		r.buf = make([]byte, size)
+	}
+	body := r.buf[:size]
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return nil, fmt.Errorf("%w: record %d: %v", ErrCorrupt, r.n, err)
+	}
+	rec, ok := decodeBinary(body)
+	if !ok {
+		return nil, fmt.Errorf("%w: record %d: truncated", ErrCorrupt, r.n)
+	}
+	return rec, nil
+}
+
+// binaryDecoder reads the fields of a record, remembering
+// whether one was missing or malformed.
+type binaryDecoder struct {
+	b  []byte
+	ok bool
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.ok, d.b = false, nil
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *binaryDecoder) varint() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.ok, d.b = false, nil
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *binaryDecoder) flag() byte {
+	if len(d.b) == 0 {
+		d.ok = false
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *binaryDecoder) str() string {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.ok, d.b = false, nil
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+func decodeBinary(body []byte) (*TraceRecord, bool) {
+	d := &binaryDecoder{b: body, ok: true}
+	rec := &TraceRecord{
+		Version:   int(d.uvarint()),
+		EventCode: uint32(d.uvarint()),
+		Conn:      Handle(d.uvarint()),
+		Stmt:      Handle(d.uvarint()),
+	}
+	rec.Time = time.Unix(0, d.varint())
+	rec.NS = d.varint()
+	rec.ErrCode = int(d.varint())
+	rec.ErrExtended = int(d.varint())
+	rec.AutoCommit = d.flag() != 0
+	rec.ConnLabel = d.str()
+	rec.SQL = d.str()
+	rec.ExpandedSQL = d.str()
+	if n := d.uvarint(); n > uint64(len(d.b)) {
+		d.ok, d.b = false, nil // each tag takes bytes: a corrupt count
+	} else if n > 0 {
+		rec.Tags = make(map[string]string, n)
+		for i := uint64(0); i < n; i++ {
+			k := d.str()
+			rec.Tags[k] = d.str()
+		}
+	}
+	if len(d.b) > 0 { // absent in the records of older writers
+		if begin := d.varint(); begin != 0 {
+			t := time.Unix(0, begin)
+			rec.Begin = &t
+		}
+		rec.Rows = d.varint()
+	}
+	rec.Event = strings.ToLower(sqlite3tracemask.EventName(rec.EventCode))
+	rec.ErrName = ErrName(rec.ErrCode)
+	return rec, d.ok
+}
+
+// NewRecordReader returns a RecordReader for trace files in either
+// format, telling them apart by their first byte.
+func NewRecordReader(r io.Reader) RecordReader {
+	br := bufio.NewReader(r)
+	if first, err := br.Peek(1); err == nil && first[0] == binaryMark {
+		return NewBinaryReader(br)
+	}
+	return NewJSONReader(br)
+}
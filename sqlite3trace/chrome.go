@@ -0,0 +1,150 @@
+package sqlite3trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// chromeEvent is one entry of the Trace Event Format
+// (understood by chrome://tracing and https://ui.perfetto.dev).
+type chromeEvent struct {
+	Name  string                 `json:"name"`
+	Cat   string                 `json:"cat,omitempty"`
+	Ph    string                 `json:"ph"`
+	Ts    float64                `json:"ts"` // microseconds
+	Pid   int                    `json:"pid"`
+	Tid   int                    `json:"tid"`
+	Scope string                 `json:"s,omitempty"`
+	Args  map[string]interface{} `json:"args,omitempty"`
+}
+
+const chromeNameMax = 80
+
+// shortName cuts sql to chromeNameMax bytes, on a rune boundary.
+func shortName(sql string) string {
+	if len(sql) <= chromeNameMax {
+		return sql
+	}
+	n := chromeNameMax - 3
+	for n > 0 && !utf8.RuneStart(sql[n]) {
+		n--
+	}
+	return sql[:n] + "..."
+}
+
+// WriteChromeTrace converts recorded events into the Trace Event Format
+// JSON, one track (thread) per connection: each statement becomes a
+// begin/end pair spanning from its TraceStmt event to its TraceProfile
+// event. When the Stmt event is missing (not in the mask, or dropped
+// from the ring buffer), the begin is computed from the Profile duration.
+// Row and Close events, and the Stmt events of trigger subprograms
+// (which have no Profile event of their own), become instant events.
+func WriteChromeTrace(w io.Writer, events []Event) error {
+	if len(events) == 0 {
+		_, err := io.WriteString(w, `{"traceEvents":[]}`)
+		return err
+	}
+	origin := events[0].Time
+	for _, ev := range events {
+		start := ev.Time
+		if ev.Info.EventCode == sqlite3.TraceProfile {
+			start = start.Add(-time.Duration(ev.Info.RunTimeNanosec))
+		}
+		if start.Before(origin) {
+			origin = start
+		}
+	}
+	us := func(t time.Time) float64 {
+		return float64(t.Sub(origin).Nanoseconds()) / 1e3
+	}
+
+	tids := make(map[uintptr]int)
+	var out []chromeEvent
+	tid := func(conn uintptr) int {
+		if t, ok := tids[conn]; ok {
+			return t
+		}
+		t := len(tids) + 1
+		tids[conn] = t
+		out = append(out, chromeEvent{
+			Name: "thread_name", Ph: "M", Pid: 1, Tid: t,
+			Args: map[string]interface{}{"name": fmt.Sprintf("conn 0x%x", conn)},
+		})
+		return t
+	}
+
+	type key struct{ conn, stmt uintptr }
+	open := make(map[key]bool) // statements with a B event not yet closed
+	var texts stmtTracker      // Profile events carry no statement text
+
+	for _, ev := range events {
+		info := ev.Info
+		texts.fill(&info)
+		t := tid(info.ConnHandle)
+		k := key{info.ConnHandle, info.StmtHandle}
+		switch info.EventCode {
+		case sqlite3.TraceStmt:
+			if strings.HasPrefix(info.StmtOrTrigger, "--") {
+				out = append(out, chromeEvent{
+					Name: shortName(info.StmtOrTrigger), Cat: "trigger", Ph: "i", Scope: "t",
+					Ts: us(ev.Time), Pid: 1, Tid: t,
+				})
+				break
+			}
+			open[k] = true
+			out = append(out, chromeEvent{
+				Name: shortName(info.StmtOrTrigger), Cat: "stmt", Ph: "B",
+				Ts: us(ev.Time), Pid: 1, Tid: t,
+				Args: map[string]interface{}{
+					"sql":  info.StmtOrTrigger,
+					"stmt": fmt.Sprintf("0x%x", info.StmtHandle),
+				},
+			})
+		case sqlite3.TraceProfile:
+			if !open[k] {
+				out = append(out, chromeEvent{
+					Name: shortName(info.StmtOrTrigger), Cat: "stmt", Ph: "B",
+					Ts:  us(ev.Time.Add(-time.Duration(info.RunTimeNanosec))),
+					Pid: 1, Tid: t,
+					Args: map[string]interface{}{
+						"sql":  info.StmtOrTrigger,
+						"stmt": fmt.Sprintf("0x%x", info.StmtHandle),
+					},
+				})
+			}
+			delete(open, k)
+			args := map[string]interface{}{"ns": info.RunTimeNanosec}
+			if info.ExpandedSQL != "" {
+				args["expanded"] = info.ExpandedSQL
+			}
+			if info.DBError.Code != 0 {
+				args["error"] = info.DBError.Error()
+			}
+			out = append(out, chromeEvent{
+				Name: shortName(info.StmtOrTrigger), Cat: "stmt", Ph: "E",
+				Ts: us(ev.Time), Pid: 1, Tid: t, Args: args,
+			})
+		case sqlite3.TraceRow:
+			out = append(out, chromeEvent{
+				Name: "row", Cat: "row", Ph: "i", Scope: "t",
+				Ts: us(ev.Time), Pid: 1, Tid: t,
+			})
+		case sqlite3.TraceClose:
+			out = append(out, chromeEvent{
+				Name: "close", Cat: "conn", Ph: "i", Scope: "t",
+				Ts: us(ev.Time), Pid: 1, Tid: t,
+			})
+		}
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{out, "ns"})
+}
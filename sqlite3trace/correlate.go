@@ -0,0 +1,107 @@
+package sqlite3trace
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// Correlator is a trace pipeline stage sending one record per statement
+// run to a Sink, instead of one per event as Output does: it matches the
+// Stmt event starting a run with the Profile event ending it (by
+// connection and statement handle) and emits the Profile record with the
+// statement text, Begin (when the Stmt event came) and Rows (the number
+// of Row events in between). So the log has one line per statement:
+//
+//	{"event":"profile","sql":"SELECT ...","ns":52000,"begin":"...","rows":3,...}
+//
+// The mask must include Stmt and Profile, and Row to count the rows.
+// The Stmt and Row events are not emitted, the Close events are;
+// Profile events without a Stmt event are emitted as they are.
+type Correlator struct {
+	sink    Sink
+	onError func(error)
+
+	mu   sync.Mutex
+	runs map[stmtKey]*stmtRun
+}
+
+type stmtRun struct {
+	begin         time.Time
+	sql, expanded string
+	rows          int64
+}
+
+// NewCorrelator returns a Correlator sending to s; onError, if not nil,
+// receives the errors of s.
+func NewCorrelator(s Sink, onError func(error)) *Correlator {
+	return &Correlator{sink: s, onError: onError, runs: make(map[stmtKey]*stmtRun)}
+}
+
+// Callback returns a trace callback correlating every event and passing
+// it to next (which may be nil).
+func (c *Correlator) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		if rec := c.correlate(info); rec != nil {
+			if err := c.sink.Emit(rec); err != nil && c.onError != nil {
+				c.onError(err)
+			}
+		}
+		return next(info)
+	}
+}
+
+// correlate accounts info to its run, returning the record to emit, if any.
+func (c *Correlator) correlate(info sqlite3.TraceInfo) *TraceRecord {
+	k := stmtKey{info.ConnHandle, info.StmtHandle}
+	c.mu.Lock()
+	var run *stmtRun
+	switch info.EventCode {
+	case sqlite3.TraceStmt:
+		if !strings.HasPrefix(info.StmtOrTrigger, "--") { // not a trigger program
+			c.runs[k] = &stmtRun{begin: time.Now(), sql: info.StmtOrTrigger, expanded: info.ExpandedSQL}
+		}
+		c.mu.Unlock()
+		return nil
+	case sqlite3.TraceRow:
+		if run := c.runs[k]; run != nil {
+			run.rows++
+		}
+		c.mu.Unlock()
+		return nil
+	case sqlite3.TraceProfile:
+		run = c.runs[k]
+		delete(c.runs, k)
+	case sqlite3.TraceClose:
+		for k := range c.runs {
+			if k.conn == info.ConnHandle {
+				delete(c.runs, k)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	if run == nil {
+		return NewTraceRecord(info)
+	}
+	if info.StmtOrTrigger == "" {
+		info.StmtOrTrigger = run.sql
+	}
+	if info.ExpandedSQL == "" {
+		info.ExpandedSQL = run.expanded
+	}
+	rec := NewTraceRecord(info)
+	rec.Begin = &run.begin
+	rec.Rows = run.rows
+	return rec
+}
+
+// Pending returns the number of statements started and not yet finished.
+func (c *Correlator) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.runs)
+}
@@ -0,0 +1,219 @@
+package sqlite3trace
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceTable receives the records of a DBSink.
+const TraceTable = "sqlite3_trace"
+
+const traceTableSchema = `CREATE TABLE IF NOT EXISTS ` + TraceTable + ` (
+	time_ns      INTEGER NOT NULL, -- Unix time in nanoseconds
+	event        TEXT NOT NULL,
+	event_code   INTEGER NOT NULL,
+	conn         INTEGER NOT NULL,
+	conn_label   TEXT,
+	stmt         INTEGER,
+	autocommit   INTEGER NOT NULL,
+	sql          TEXT,
+	expanded_sql TEXT,
+	ns           INTEGER,
+	begin_ns     INTEGER, -- see Correlator
+	rows         INTEGER,
+	err_code     INTEGER,
+	err_extended INTEGER,
+	err_name     TEXT,
+	tags         TEXT -- JSON object
+)`
+
+// DBSinkOptions configure a DBSink.
+type DBSinkOptions struct {
+	// BatchSize is the number of records inserted per transaction;
+	// 0 means 500.
+	BatchSize int
+	// FlushEvery bounds how long records wait for a batch to fill;
+	// 0 means one second.
+	FlushEvery time.Duration
+	// Buffer is the number of records queued; 0 means 10000.
+	// Records arriving when it is full are dropped.
+	Buffer int
+	// OnError, if not nil, receives the errors of the inserts.
+	OnError func(error)
+}
+
+// DBSink writes the records into the TraceTable of an SQLite database
+// of its own, for post-hoc analysis in SQL:
+//
+//	SELECT sql, count(*), sum(ns)/1e6 AS ms FROM sqlite3_trace
+//	WHERE event = 'profile' GROUP BY sql ORDER BY ms DESC LIMIT 10;
+//
+// Emit only queues the record; a goroutine inserts them in batches,
+// on a connection that is not traced (the database is opened with the
+// plain "sqlite3" driver). Close must be called to flush it.
+type DBSink struct {
+	db   *sql.DB
+	opts DBSinkOptions
+
+	mu      sync.RWMutex // held for reading while queuing, for writing by Close
+	closed  bool
+	ch      chan *TraceRecord
+	done    chan struct{}
+	dropped int64 // atomic
+}
+
+var _ Sink = (*DBSink)(nil)
+
+// OpenDBSink opens (or creates) the database file path in WAL mode,
+// creates the TraceTable if needed, and starts the writer.
+func OpenDBSink(ctx context.Context, path string, opts DBSinkOptions) (*DBSink, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushEvery <= 0 {
+		opts.FlushEvery = time.Second
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 10000
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3trace: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{"PRAGMA journal_mode=WAL", "PRAGMA synchronous=NORMAL", traceTableSchema} {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("sqlite3trace: %w", err)
+		}
+	}
+	s := &DBSink{
+		db:   db,
+		opts: opts,
+		ch:   make(chan *TraceRecord, opts.Buffer),
+		done: make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Emit implements Sink, queuing rec.
+func (s *DBSink) Emit(rec *TraceRecord) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrSinkClosed
+	}
+	select {
+	case s.ch <- rec:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+	return nil
+}
+
+// Dropped returns the number of records dropped with a full buffer.
+func (s *DBSink) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+func (s *DBSink) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.FlushEvery)
+	defer ticker.Stop()
+	batch := make([]*TraceRecord, 0, s.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.insert(batch); err != nil && s.opts.OnError != nil {
+			s.opts.OnError(err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case rec, ok := <-s.ch:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) >= s.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *DBSink) insert(batch []*TraceRecord) error {
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite3trace: %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO "+TraceTable+
+		" (time_ns, event, event_code, conn, conn_label, stmt, autocommit, sql, expanded_sql,"+
+		" ns, begin_ns, rows, err_code, err_extended, err_name, tags)"+
+		" VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("sqlite3trace: %w", err)
+	}
+	defer stmt.Close()
+	for _, r := range batch {
+		var begin, tags interface{}
+		if r.Begin != nil {
+			begin = r.Begin.UnixNano()
+		}
+		if len(r.Tags) > 0 {
+			data, _ := json.Marshal(r.Tags)
+			tags = string(data)
+		}
+		_, err := stmt.ExecContext(ctx, r.Time.UnixNano(), r.Event, int64(r.EventCode),
+			int64(r.Conn), nullString(r.ConnLabel), nullInt(int64(r.Stmt)), r.AutoCommit,
+			nullString(r.SQL), nullString(r.ExpandedSQL), nullInt(r.NS), begin, nullInt(r.Rows),
+			nullInt(int64(r.ErrCode)), nullInt(int64(r.ErrExtended)), nullString(r.ErrName), tags)
+		if err != nil {
+			return fmt.Errorf("sqlite3trace: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite3trace: %w", err)
+	}
+	return nil
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func nullInt(v int64) interface{} {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+// Close stops accepting records, writes the queued ones
+// and closes the database.
+func (s *DBSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+	s.mu.Unlock()
+	<-s.done
+	return s.db.Close()
+}
@@ -0,0 +1,95 @@
+package sqlite3trace
+
+import (
+	"strings"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Directive is a per-statement tracing override, written in the
+// statement as a comment: /* trace:off */ or /* trace:verbose */
+// (or the "--" form). SQLite keeps comments in the statement text it
+// reports, so no driver support is needed.
+type Directive int
+
+const (
+	DirectiveNone    Directive = iota // no directive: the Overrides mask applies
+	DirectiveOff                      // drop every event of the statement
+	DirectiveVerbose                  // pass every event of the statement
+)
+
+// ParseDirective returns the directive of a statement; the first
+// "trace:" comment counts. Unknown directives are ignored.
+func ParseDirective(sql string) Directive {
+	if !strings.Contains(sql, "trace:") {
+		return DirectiveNone // fast path: most statements have none
+	}
+	for _, t := range sqlite3lex.Tokenize(sql) {
+		if t.Kind != sqlite3lex.Comment {
+			continue
+		}
+		if d := commentDirective(t.Text); d != DirectiveNone {
+			return d
+		}
+	}
+	return DirectiveNone
+}
+
+// commentDirective returns the directive written by the comment text,
+// "--" or "/*" form.
+func commentDirective(text string) Directive {
+	if strings.HasPrefix(text, "--") {
+		text = text[2:]
+	} else {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+	}
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "trace:off":
+		return DirectiveOff
+	case "trace:verbose":
+		return DirectiveVerbose
+	}
+	return DirectiveNone
+}
+
+// Overrides is a trace pipeline stage applying statement directives:
+// it passes the events of statements without a directive according to
+// its mask, drops all events of "trace:off" statements (hot or
+// sensitive queries), and passes all events of "trace:verbose" ones.
+//
+// Verbose statements can only get the events SQLite produces, so the
+// TraceConfig mask must include them (e.g. Row), with Overrides
+// filtering them out for the other statements.
+type Overrides struct {
+	mask  uint32
+	texts stmtTracker
+}
+
+// NewOverrides returns an Overrides stage passing the events in mask
+// (sqlite3tracemask.Config.EventMask) for statements without directive.
+func NewOverrides(mask uint) *Overrides {
+	return &Overrides{mask: uint32(mask)}
+}
+
+// Callback returns a trace callback filtering events for next.
+// Close events are always passed.
+func (o *Overrides) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		o.texts.fill(&info)
+		if info.EventCode == sqlite3.TraceClose {
+			return next(info)
+		}
+		switch ParseDirective(info.StmtOrTrigger) {
+		case DirectiveOff:
+			return 0
+		case DirectiveVerbose:
+			return next(info)
+		}
+		if info.EventCode&o.mask == 0 {
+			return 0
+		}
+		return next(info)
+	}
+}
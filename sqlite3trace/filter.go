@@ -0,0 +1,109 @@
+package sqlite3trace
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// filterCacheSize bounds the decisions a Filter remembers.
+const filterCacheSize = 1000
+
+// Filter is a trace pipeline stage dropping the events of statements
+// by their text, to keep noisy statements (PRAGMAs, bookkeeping
+// queries, ...) out of the output. Place it before the output stages.
+//
+// A statement passes if it matches an include pattern (or there are
+// none) and no exclude pattern. Patterns are case-insensitive globs
+// matching the whole statement, leading space aside: '*' matches any
+// text, '?' any character ("PRAGMA *", "* FROM sessions *"), or
+// regular expressions between slashes ("/^SELECT .* FROM jobs/").
+// Events without statement text (Close) always pass.
+type Filter struct {
+	include, exclude []*regexp.Regexp
+	texts            stmtTracker
+
+	mu    sync.Mutex
+	cache map[string]bool
+}
+
+// NewFilter returns a Filter with the include and exclude patterns.
+func NewFilter(include, exclude []string) (*Filter, error) {
+	f := &Filter{cache: make(map[string]bool)}
+	var err error
+	if f.include, err = compilePatterns(include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compilePatterns(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		var expr string
+		if len(p) >= 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			expr = p[1 : len(p)-1]
+		} else {
+			expr = "(?is)^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(p)) + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("sqlite3trace: filter pattern %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Pass reports whether the statement sql passes the filter.
+func (f *Filter) Pass(sql string) bool {
+	f.mu.Lock()
+	pass, ok := f.cache[sql]
+	f.mu.Unlock()
+	if ok {
+		return pass
+	}
+
+	text := strings.TrimLeft(sql, " \t\r\n")
+	pass = len(f.include) == 0
+	for _, re := range f.include {
+		if re.MatchString(text) {
+			pass = true
+			break
+		}
+	}
+	for _, re := range f.exclude {
+		if pass && re.MatchString(text) {
+			pass = false
+		}
+	}
+
+	f.mu.Lock()
+	if len(f.cache) >= filterCacheSize {
+		f.cache = make(map[string]bool)
+	}
+	f.cache[sql] = pass
+	f.mu.Unlock()
+	return pass
+}
+
+// Callback returns a trace callback passing to next (which may be nil)
+// the events of the statements that pass. The Profile and Row events
+// are judged by the text of their Stmt event, so the mask should
+// include Stmt.
+func (f *Filter) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		f.texts.fill(&info)
+		if info.StmtOrTrigger != "" && !f.Pass(info.StmtOrTrigger) {
+			return 0
+		}
+		return next(info)
+	}
+}
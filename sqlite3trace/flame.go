@@ -0,0 +1,120 @@
+package sqlite3trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// Folder aggregates the time reported by TraceProfile events into
+// the "folded stacks" format read by flamegraph tools (flamegraph.pl,
+// inferno, speedscope): one line per stack, frames separated by ';',
+// followed by the total in nanoseconds.
+//
+// The stack is the caller-provided tags (e.g. component, then request
+// type) followed by the statement, normalized (see Normalize).
+// Statements are aggregated by Fingerprint.
+type Folder struct {
+	tags  func(sqlite3.TraceInfo) []string
+	texts stmtTracker
+
+	mu     sync.Mutex
+	totals map[stackKey]int64
+	stmts  map[string]string // fingerprint -> statement frame
+}
+
+// stackKey identifies a stack: its tag frames, then a statement.
+type stackKey struct {
+	tags        string
+	fingerprint string
+}
+
+// NewFolder returns a Folder; tags may be nil (statements only).
+func NewFolder(tags func(sqlite3.TraceInfo) []string) *Folder {
+	return &Folder{
+		tags:   tags,
+		totals: make(map[stackKey]int64),
+		stmts:  make(map[string]string),
+	}
+}
+
+// Callback returns a trace callback aggregating Profile events and
+// then passing every event to next (which may be nil).
+func (f *Folder) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		f.texts.fill(&info)
+		if info.EventCode == sqlite3.TraceProfile {
+			var tags []string
+			if f.tags != nil {
+				tags = f.tags(info)
+			}
+			f.Add(tags, info.StmtOrTrigger, info.RunTimeNanosec)
+		}
+		return next(info)
+	}
+}
+
+// frame makes s usable as one frame: no ';' (the frame separator)
+// and no line breaks.
+func frame(s string) string {
+	s = strings.Replace(s, ";", ",", -1)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Add accounts ns nanoseconds to the stack tags + Normalize(sql).
+func (f *Folder) Add(tags []string, sql string, ns int64) {
+	frames := make([]string, 0, len(tags)+1)
+	for _, t := range tags {
+		frames = append(frames, frame(t))
+	}
+	stmt := Normalize(sql)
+	key := stackKey{tags: strings.Join(frames, ";"), fingerprint: fingerprintOf(stmt)}
+
+	f.mu.Lock()
+	if _, ok := f.stmts[key.fingerprint]; !ok {
+		f.stmts[key.fingerprint] = frame(stmt)
+	}
+	f.totals[key] += ns
+	f.mu.Unlock()
+}
+
+// WriteFolded writes the aggregated stacks, sorted.
+func (f *Folder) WriteFolded(w io.Writer) error {
+	f.mu.Lock()
+	stacks := make([]string, 0, len(f.totals))
+	totals := make(map[string]int64, len(f.totals))
+	for k, ns := range f.totals {
+		stack := f.stmts[k.fingerprint]
+		if k.tags != "" {
+			stack = k.tags + ";" + stack
+		}
+		// Distinct keys can give one stack, as frame() rewrites
+		// separators and line breaks: sum them.
+		if _, ok := totals[stack]; !ok {
+			stacks = append(stacks, stack)
+		}
+		totals[stack] += ns
+	}
+	f.mu.Unlock()
+	sort.Strings(stacks)
+
+	bw := bufio.NewWriter(w)
+	for _, stack := range stacks {
+		fmt.Fprintf(bw, "%s %d\n", stack, totals[stack])
+	}
+	return bw.Flush()
+}
+
+// Reset discards the aggregated data.
+func (f *Folder) Reset() {
+	f.mu.Lock()
+	f.totals = make(map[stackKey]int64)
+	f.stmts = make(map[string]string)
+	f.mu.Unlock()
+}
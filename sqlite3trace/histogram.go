@@ -0,0 +1,151 @@
+package sqlite3trace
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Histogram layout: values below subBuckets are counted exactly;
+// above, every power-of-two range is split into subBuckets linear
+// buckets, so any recorded value is known within 1/subBuckets
+// (about 1.6%), like an HDR histogram with 2 significant digits.
+// The buckets of a range (512 bytes) are allocated when a value first
+// falls in it, so a histogram of latencies spanning a few orders of
+// magnitude takes a few KiB rather than the 29 KiB of all buckets.
+const (
+	subBucketBits = 6
+	subBuckets    = 1 << subBucketBits
+	numRanges     = 64 - subBucketBits + 1
+)
+
+// Histogram records non-negative int64 values (nanoseconds here)
+// with bounded relative error. The zero value is ready to use;
+// it is not safe for concurrent use.
+type Histogram struct {
+	ranges [numRanges]*[subBuckets]uint64 // nil until used
+	count  uint64
+	sum    float64
+	min    int64
+	max    int64
+}
+
+func bucketOf(v int64) int {
+	if v < subBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits - 1
+	return (shift+1)*subBuckets + int(v>>uint(shift)) - subBuckets
+}
+
+// bucketRange returns the smallest and largest value of bucket i.
+func bucketRange(i int) (lo, hi int64) {
+	if i < subBuckets {
+		return int64(i), int64(i)
+	}
+	shift := uint(i/subBuckets - 1)
+	m := int64(i%subBuckets + subBuckets)
+	return m << shift, (m+1)<<shift - 1
+}
+
+// Record adds a value; negative values count as 0.
+func (h *Histogram) Record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	i := bucketOf(v)
+	h.rangeOf(i)[i%subBuckets]++
+	h.count++
+	h.sum += float64(v)
+}
+
+// rangeOf returns the buckets of the range of bucket i, allocating them.
+func (h *Histogram) rangeOf(i int) *[subBuckets]uint64 {
+	r := h.ranges[i/subBuckets]
+	if r == nil {
+		r = new([subBuckets]uint64)
+		h.ranges[i/subBuckets] = r
+	}
+	return r
+}
+
+// Merge adds the contents of other to h.
+func (h *Histogram) Merge(other *Histogram) {
+	if other.count == 0 {
+		return
+	}
+	if h.count == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	for i, o := range other.ranges {
+		if o == nil {
+			continue
+		}
+		r := h.rangeOf(i * subBuckets)
+		for j, c := range o {
+			r[j] += c
+		}
+	}
+	h.count += other.count
+	h.sum += other.sum
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() uint64 { return h.count }
+
+// Min and Max return the exact extremes (0 when empty).
+func (h *Histogram) Min() int64 { return h.min }
+func (h *Histogram) Max() int64 { return h.max }
+
+// Mean returns the exact average (0 when empty).
+func (h *Histogram) Mean() float64 {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / float64(h.count)
+}
+
+// Percentile returns the value below or at which p percent (0-100)
+// of the recorded values fall, within the bucket precision
+// (the midpoint of the bucket is reported, clamped to Min/Max).
+func (h *Histogram) Percentile(p float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.min
+	}
+	if p >= 100 {
+		return h.max
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.count)))
+	var cum uint64
+	for ri, r := range h.ranges {
+		if r == nil {
+			continue
+		}
+		for j, c := range r {
+			cum += c
+			if cum >= rank {
+				lo, hi := bucketRange(ri*subBuckets + j)
+				v := lo + (hi-lo)/2
+				if v < h.min {
+					v = h.min
+				}
+				if v > h.max {
+					v = h.max
+				}
+				return v
+			}
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,49 @@
+package sqlite3trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// JSONFormatter renders each event as a JSON object on its own line
+// (JSON Lines), for jq, Loki, Elasticsearch and the like; the fields
+// are those of TraceRecord:
+//
+//	{"v":1,"time":"2024-05-01T12:00:00.123456Z","event":"profile","event_code":2,
+//	 "conn":"0x1a2b","stmt":"0x3c4d","autocommit":true,"sql":"SELECT 1","ns":5200}
+//
+// (on one line). NewJSONReader reads them back.
+type JSONFormatter struct{}
+
+// AppendFormat implements Formatter.
+func (JSONFormatter) AppendFormat(dst []byte, rec *TraceRecord) []byte {
+	b := bytes.NewBuffer(dst)
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false) // keep "a < b" readable
+	enc.Encode(rec)          // cannot fail with these field types; adds the '\n'
+	return b.Bytes()
+}
+
+type jsonReader struct {
+	dec  *json.Decoder
+	line int
+}
+
+// NewJSONReader returns a RecordReader for the output of JSONFormatter.
+func NewJSONReader(r io.Reader) RecordReader {
+	return &jsonReader{dec: json.NewDecoder(r)}
+}
+
+func (r *jsonReader) Read() (*TraceRecord, error) {
+	rec := &TraceRecord{}
+	if err := r.dec.Decode(rec); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("sqlite3trace: record %d: %w", r.line+1, err)
+	}
+	r.line++
+	return rec, nil
+}
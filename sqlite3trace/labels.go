@@ -0,0 +1,53 @@
+package sqlite3trace
+
+import (
+	"sync"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// connLabels maps connection handles to their labels.
+var connLabels sync.Map // uintptr -> string
+
+// ConnLabel returns the label given to the connection with handle
+// (TraceInfo.ConnHandle) by LabelConnectHook, or "".
+// The formatters and sinks of this package show it next to the handle.
+func ConnLabel(handle uintptr) string {
+	if l, ok := connLabels.Load(handle); ok {
+		return l.(string)
+	}
+	return ""
+}
+
+// LabelConnectHook returns a function, to use as (or call from)
+// sqlite3.SQLiteDriver.ConnectHook, installing trace on each connection
+// with its events labeled (see ConnLabel), e.g. "reader-pool" or
+// "migrations" for the connections of one driver registration.
+//
+// The driver does not expose the connection handle, so the label
+// is bound to it at the first event; the label is dropped after the
+// Close event, so the mask should include Close.
+func LabelConnectHook(label string, trace *sqlite3.TraceConfig) func(*sqlite3.SQLiteConn) error {
+	return func(conn *sqlite3.SQLiteConn) error {
+		cfg := *trace
+		cfg.Callback = labelCallback(label, orNop(trace.Callback))
+		return conn.SetTrace(&cfg)
+	}
+}
+
+// labelCallback returns the callback of one connection.
+func labelCallback(label string, next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	var bound uintptr // events of a connection do not run concurrently
+	return func(info sqlite3.TraceInfo) int {
+		if info.ConnHandle != bound {
+			connLabels.Store(info.ConnHandle, label)
+			bound = info.ConnHandle
+		}
+		ret := next(info)
+		if info.EventCode == sqlite3.TraceClose {
+			connLabels.Delete(info.ConnHandle)
+			bound = 0
+		}
+		return ret
+	}
+}
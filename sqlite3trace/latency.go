@@ -0,0 +1,211 @@
+package sqlite3trace
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// OtherFingerprint collects statements beyond LatencyRecorder's
+// fingerprint limit.
+const OtherFingerprint = "(other)"
+
+// LatencyRecorder is a trace pipeline stage keeping a latency Histogram
+// per statement Fingerprint, and one over all statements, fed by
+// TraceProfile events.
+type LatencyRecorder struct {
+	maxFingerprints int
+	texts           stmtTracker
+
+	mu      sync.Mutex
+	since   time.Time
+	overall Histogram
+	byFP    map[string]*fpLatency
+}
+
+// fpLatency is the histogram of one fingerprint.
+type fpLatency struct {
+	stmt string // Normalize form
+	h    Histogram
+}
+
+// NewLatencyRecorder returns a LatencyRecorder tracking at most
+// maxFingerprints distinct statements (0 means 1000); the rest are
+// recorded under OtherFingerprint.
+//
+// Each statement tracked takes its normalized text plus 512 bytes per
+// power of two its latencies span: typically a few KiB, so a few MiB
+// for 1000 statements, and at worst 29 KiB (29 MiB for 1000).
+func NewLatencyRecorder(maxFingerprints int) *LatencyRecorder {
+	if maxFingerprints <= 0 {
+		maxFingerprints = 1000
+	}
+	return &LatencyRecorder{
+		maxFingerprints: maxFingerprints,
+		since:           time.Now(),
+		byFP:            make(map[string]*fpLatency),
+	}
+}
+
+// Callback returns a trace callback recording Profile events and
+// passing every event to next (which may be nil). The statement text
+// comes from the Stmt events, so the mask must include Stmt.
+func (r *LatencyRecorder) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		r.texts.fill(&info)
+		if info.EventCode == sqlite3.TraceProfile {
+			r.Record(info.StmtOrTrigger, info.RunTimeNanosec)
+		}
+		return next(info)
+	}
+}
+
+// Record adds one statement run of ns nanoseconds.
+func (r *LatencyRecorder) Record(sql string, ns int64) {
+	stmt := Normalize(sql)
+	fp := fingerprintOf(stmt)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.byFP[fp]
+	if !ok {
+		if len(r.byFP) >= r.maxFingerprints {
+			fp, stmt = OtherFingerprint, ""
+			l = r.byFP[fp]
+		}
+		if l == nil {
+			l = &fpLatency{stmt: stmt}
+			r.byFP[fp] = l
+		}
+	}
+	l.h.Record(ns)
+	r.overall.Record(ns)
+}
+
+// LatencyStats summarizes one histogram; durations are nanoseconds.
+type LatencyStats struct {
+	Fingerprint string  `json:"fingerprint,omitempty"`
+	Statement   string  `json:"statement,omitempty"` // Normalize form
+	Count       uint64  `json:"count"`
+	Min         int64   `json:"min_ns"`
+	Mean        float64 `json:"mean_ns"`
+	P50         int64   `json:"p50_ns"`
+	P90         int64   `json:"p90_ns"`
+	P99         int64   `json:"p99_ns"`
+	P999        int64   `json:"p999_ns"`
+	Max         int64   `json:"max_ns"`
+}
+
+func statsOf(fp, stmt string, h *Histogram) LatencyStats {
+	return LatencyStats{
+		Fingerprint: fp,
+		Statement:   stmt,
+		Count:       h.Count(),
+		Min:         h.Min(),
+		Mean:        h.Mean(),
+		P50:         h.Percentile(50),
+		P90:         h.Percentile(90),
+		P99:         h.Percentile(99),
+		P999:        h.Percentile(99.9),
+		Max:         h.Max(),
+	}
+}
+
+// LatencySnapshot is the state of a LatencyRecorder at one time.
+type LatencySnapshot struct {
+	Since      time.Time      `json:"since"`
+	Time       time.Time      `json:"time"`
+	Overall    LatencyStats   `json:"overall"`
+	Statements []LatencyStats `json:"statements"` // by total time, descending
+}
+
+// Snapshot summarizes everything recorded since creation or the last reset.
+func (r *LatencyRecorder) Snapshot() *LatencySnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshotLocked()
+}
+
+func (r *LatencyRecorder) snapshotLocked() *LatencySnapshot {
+	s := &LatencySnapshot{
+		Since:   r.since,
+		Time:    time.Now(),
+		Overall: statsOf("", "", &r.overall),
+	}
+	for fp, l := range r.byFP {
+		s.Statements = append(s.Statements, statsOf(fp, l.stmt, &l.h))
+	}
+	sort.Slice(s.Statements, func(i, j int) bool {
+		a, b := s.Statements[i], s.Statements[j]
+		return a.Mean*float64(a.Count) > b.Mean*float64(b.Count)
+	})
+	return s
+}
+
+// Percentile returns the p-th percentile (0-100) for one fingerprint
+// (as produced for the statement text), or over all statements when
+// sql is "". The second result is false if nothing was recorded.
+func (r *LatencyRecorder) Percentile(sql string, p float64) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := &r.overall
+	if sql != "" {
+		l, ok := r.byFP[Fingerprint(sql)]
+		if !ok {
+			return 0, false
+		}
+		h = &l.h
+	}
+	if h.Count() == 0 {
+		return 0, false
+	}
+	return time.Duration(h.Percentile(p)), true
+}
+
+// Reset discards everything recorded.
+func (r *LatencyRecorder) Reset() {
+	r.mu.Lock()
+	r.resetLocked()
+	r.mu.Unlock()
+}
+
+func (r *LatencyRecorder) resetLocked() {
+	r.since = time.Now()
+	r.overall = Histogram{}
+	r.byFP = make(map[string]*fpLatency)
+}
+
+// WriteJSON writes a snapshot as JSON.
+func (r *LatencyRecorder) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r.Snapshot())
+}
+
+// SnapshotEvery calls fn with a snapshot every interval until ctx is done.
+// With reset, each snapshot covers only its interval (the recorder is
+// reset atomically with taking the snapshot); otherwise snapshots are
+// cumulative.
+func (r *LatencyRecorder) SnapshotEvery(ctx context.Context, interval time.Duration, reset bool,
+	fn func(*LatencySnapshot)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.mu.Lock()
+		s := r.snapshotLocked()
+		if reset {
+			r.resetLocked()
+		}
+		r.mu.Unlock()
+		fn(s)
+	}
+}
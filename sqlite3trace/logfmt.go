@@ -0,0 +1,46 @@
+package sqlite3trace
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// LogfmtFormatter renders each event as a logfmt line, with the main
+// fields of TraceRecord, under their JSON names:
+//
+//	event=profile conn=0x1a2b stmt=0x3c4d sql="SELECT 1" ns=5200
+//
+// Values with spaces, quotes, '=' or control characters are quoted,
+// with Go escapes (\", \\, \n, ...).
+type LogfmtFormatter struct{}
+
+// AppendFormat implements Formatter.
+func (LogfmtFormatter) AppendFormat(dst []byte, rec *TraceRecord) []byte {
+	for i, f := range rec.fields() {
+		if i > 0 {
+			dst = append(dst, ' ')
+		}
+		dst = append(dst, f.key...)
+		dst = append(dst, '=')
+		if f.isNum {
+			dst = strconv.AppendInt(dst, f.num, 10)
+		} else {
+			dst = appendLogfmtValue(dst, f.str)
+		}
+	}
+	return append(dst, '\n')
+}
+
+func appendLogfmtValue(dst []byte, s string) []byte {
+	if s == "" {
+		return append(dst, `""`...)
+	}
+	needsQuote := !utf8.ValidString(s) || strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f
+	}) >= 0
+	if !needsQuote {
+		return append(dst, s...)
+	}
+	return strconv.AppendQuote(dst, s)
+}
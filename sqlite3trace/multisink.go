@@ -0,0 +1,104 @@
+package sqlite3trace
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MultiSink delivers every record to several sinks, as the "tee" of
+// a text Output on stderr and a JSON file. The sinks are isolated:
+// the error or panic of one does not keep the record from the others.
+type MultiSink struct {
+	sinks []Sink
+}
+
+var _ Sink = (*MultiSink)(nil)
+
+// NewMultiSink returns a MultiSink emitting to sinks, in that order.
+func NewMultiSink(sinks ...Sink) *MultiSink {
+	return &MultiSink{sinks: append([]Sink(nil), sinks...)}
+}
+
+// SinkError is the failure of one sink of a MultiSink.
+type SinkError struct {
+	Index int // in the NewMultiSink arguments
+	Err   error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("sink %d: %v", e.Index, e.Err)
+}
+
+func (e *SinkError) Unwrap() error { return e.Err }
+
+// MultiSinkError is returned by MultiSink when some of its sinks fail.
+type MultiSinkError struct {
+	Errs []*SinkError
+}
+
+func (e *MultiSinkError) Error() string {
+	sf := make([]string, len(e.Errs))
+	for i, se := range e.Errs {
+		sf[i] = se.Error()
+	}
+	return "sqlite3trace: " + strings.Join(sf, "; ")
+}
+
+// Unwrap returns the errors of the sinks, for errors.Is and errors.As.
+func (e *MultiSinkError) Unwrap() []error {
+	errs := make([]error, len(e.Errs))
+	for i, se := range e.Errs {
+		errs[i] = se
+	}
+	return errs
+}
+
+// Emit implements Sink. The error, if any, is a *MultiSinkError.
+func (m *MultiSink) Emit(rec *TraceRecord) error {
+	var me *MultiSinkError
+	for i, s := range m.sinks {
+		if err := emitSafe(s, rec); err != nil {
+			if me == nil {
+				me = &MultiSinkError{}
+			}
+			me.Errs = append(me.Errs, &SinkError{Index: i, Err: err})
+		}
+	}
+	if me == nil {
+		return nil
+	}
+	return me
+}
+
+func emitSafe(s Sink, rec *TraceRecord) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return s.Emit(rec)
+}
+
+// Close closes the sinks that are io.Closers (an AsyncSink, a DBSink,
+// ...), all of them even if some fail; the error, if any, is
+// a *MultiSinkError.
+func (m *MultiSink) Close() error {
+	var me *MultiSinkError
+	for i, s := range m.sinks {
+		c, ok := s.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			if me == nil {
+				me = &MultiSinkError{}
+			}
+			me.Errs = append(me.Errs, &SinkError{Index: i, Err: err})
+		}
+	}
+	if me == nil {
+		return nil
+	}
+	return me
+}
@@ -0,0 +1,146 @@
+package sqlite3trace
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Normalize returns the form of sql shared by the runs of the same
+// logical statement, to group them in aggregates and metrics:
+//
+//	select * from t   -- by id
+//	 where id in (1, 2, 3) and note = 'x';
+//
+// becomes "SELECT * FROM t WHERE id IN (...) AND note = ?". The literals
+// (with their sign) and the parameters become '?', the lists of them
+// after IN become "(...)" whatever their length, the comments (which
+// may carry per-request tags, see TagQuery) and a trailing ';' are
+// dropped, and the keywords are in upper case; the other identifiers
+// keep their case. The tokens are separated by one space, except after
+// '(' and '.', before ')', ',' and '.', and between a function name
+// and its '('.
+func Normalize(sql string) string {
+	toks := sqlite3lex.SignificantTokens(sql)
+	for len(toks) > 0 && toks[len(toks)-1].IsPunct(";") {
+		toks = toks[:len(toks)-1]
+	}
+	var b strings.Builder
+	b.Grow(len(sql))
+	var prev sqlite3lex.Token // last written
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if isSign(toks, i) {
+			continue
+		}
+		if b.Len() > 0 && needSpace(prev, t) {
+			b.WriteByte(' ')
+		}
+		prev = t
+		switch {
+		case t.IsLiteral() || t.Kind == sqlite3lex.Param:
+			b.WriteByte('?')
+		case t.IsPunct("(") && i > 0 && toks[i-1].Is("IN"):
+			if end := valueListEnd(toks, i); end > i+1 {
+				b.WriteString("(...)")
+				i, prev = end, toks[end]
+				continue
+			}
+			b.WriteString(t.Text)
+		case t.Kind == sqlite3lex.Ident && sqlKeywords[strings.ToUpper(t.Text)]:
+			b.WriteString(strings.ToUpper(t.Text))
+		default:
+			b.WriteString(t.Text)
+		}
+	}
+	return b.String()
+}
+
+// needSpace reports whether Normalize separates t from the token
+// before it, prev; the spacing of the source text is not kept.
+func needSpace(prev, t sqlite3lex.Token) bool {
+	switch {
+	case prev.IsPunct("(") || prev.IsPunct("."):
+		return false
+	case t.IsPunct(")") || t.IsPunct(",") || t.IsPunct(".") || t.IsPunct(";"):
+		return false
+	case t.IsPunct("("):
+		// function call or column list: f(x), t(a, b)
+		return !(prev.Kind == sqlite3lex.QuotedIdent ||
+			prev.Kind == sqlite3lex.Ident && !sqlKeywords[strings.ToUpper(prev.Text)])
+	}
+	return true
+}
+
+// isSign reports whether toks[i] is the sign of a number literal:
+// a '-' or '+' before a number, after an operator, a '(' or ',',
+// a keyword, or nothing.
+func isSign(toks []sqlite3lex.Token, i int) bool {
+	t := toks[i]
+	if !(t.IsPunct("-") || t.IsPunct("+")) || i+1 >= len(toks) || toks[i+1].Kind != sqlite3lex.Number {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	prev := toks[i-1]
+	return prev.Kind == sqlite3lex.Punct && !prev.IsPunct(")") ||
+		prev.Kind == sqlite3lex.Ident && sqlKeywords[strings.ToUpper(prev.Text)]
+}
+
+// sqlKeywords are the keywords of SQLite (https://sqlite.org/lang_keywords.html).
+var sqlKeywords = make(map[string]bool)
+
+func init() {
+	for _, kw := range strings.Fields(`
+		ABORT ACTION ADD AFTER ALL ALTER ALWAYS ANALYZE AND AS ASC ATTACH
+		AUTOINCREMENT BEFORE BEGIN BETWEEN BY CASCADE CASE CAST CHECK COLLATE
+		COLUMN COMMIT CONFLICT CONSTRAINT CREATE CROSS CURRENT CURRENT_DATE
+		CURRENT_TIME CURRENT_TIMESTAMP DATABASE DEFAULT DEFERRABLE DEFERRED
+		DELETE DESC DETACH DISTINCT DO DROP EACH ELSE END ESCAPE EXCEPT EXCLUDE
+		EXCLUSIVE EXISTS EXPLAIN FAIL FILTER FIRST FOLLOWING FOR FOREIGN FROM
+		FULL GENERATED GLOB GROUP GROUPS HAVING IF IGNORE IMMEDIATE IN INDEX
+		INDEXED INITIALLY INNER INSERT INSTEAD INTERSECT INTO IS ISNULL JOIN
+		KEY LAST LEFT LIKE LIMIT MATCH MATERIALIZED NATURAL NO NOT NOTHING
+		NOTNULL NULL NULLS OF OFFSET ON OR ORDER OTHERS OUTER OVER PARTITION
+		PLAN PRAGMA PRECEDING PRIMARY QUERY RAISE RANGE RECURSIVE REFERENCES
+		REGEXP REINDEX RELEASE RENAME REPLACE RESTRICT RETURNING RIGHT ROLLBACK
+		ROW ROWS SAVEPOINT SELECT SET TABLE TEMP TEMPORARY THEN TIES TO
+		TRANSACTION TRIGGER UNBOUNDED UNION UNIQUE UPDATE USING VACUUM VALUES
+		VIEW VIRTUAL WHEN WHERE WINDOW WITH WITHOUT`) {
+		sqlKeywords[kw] = true
+	}
+}
+
+// valueListEnd returns the index of the ')' closing the '(' at
+// toks[open] if only literals, parameters and commas (and signs)
+// come in between, or -1.
+func valueListEnd(toks []sqlite3lex.Token, open int) int {
+	for i := open + 1; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t.IsPunct(")"):
+			return i
+		case t.IsLiteral(), t.Kind == sqlite3lex.Param,
+			t.IsPunct(","), t.IsPunct("-"), t.IsPunct("+"):
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// Fingerprint returns a short hash of Normalize(sql), 16 hex digits,
+// to name a statement in metric labels and logs.
+func Fingerprint(sql string) string {
+	return fingerprintOf(Normalize(sql))
+}
+
+// fingerprintOf is Fingerprint for a statement already normalized.
+func fingerprintOf(normalized string) string {
+	h := fnv.New64a()
+	h.Write([]byte(normalized))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
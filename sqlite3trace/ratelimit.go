@@ -0,0 +1,105 @@
+package sqlite3trace
+
+import (
+	"sync"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// RateLimiter is a trace pipeline stage passing at most a rate of
+// events (a token bucket), to protect log pipelines from statement
+// storms. The events over the limit are dropped and counted; the count
+// is reported to the summary function when events pass again, or else
+// once the bucket has refilled (from a timer goroutine):
+//
+//	func(n int64) { log.Printf("sqlite3 trace: suppressed %d events", n) }
+type RateLimiter struct {
+	rate    float64 // tokens per second
+	burst   float64
+	summary func(suppressed int64)
+
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	suppressed int64 // since the last summary
+	total      int64
+}
+
+// NewRateLimiter returns a RateLimiter passing perSecond events on
+// average, and up to burst at once (burst < 1 means 1);
+// summary may be nil.
+func NewRateLimiter(perSecond float64, burst int, summary func(suppressed int64)) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    perSecond,
+		burst:   float64(burst),
+		summary: summary,
+		tokens:  float64(burst),
+		last:    time.Now(),
+	}
+}
+
+// Allow takes a token if there is one, reporting whether an event may
+// pass, and the number of events suppressed before it (to report).
+func (l *RateLimiter) Allow() (ok bool, suppressed int64) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		l.suppressed++
+		l.total++
+		if l.suppressed == 1 && l.summary != nil && l.rate > 0 {
+			refill := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+			time.AfterFunc(refill, func() { l.Flush() })
+		}
+		return false, 0
+	}
+	l.tokens--
+	suppressed, l.suppressed = l.suppressed, 0
+	return true, suppressed
+}
+
+// Flush reports the events suppressed since the last summary, if any,
+// to the summary function and returns their number, e.g. when tracing
+// stops.
+func (l *RateLimiter) Flush() int64 {
+	l.mu.Lock()
+	n := l.suppressed
+	l.suppressed = 0
+	l.mu.Unlock()
+	if n > 0 && l.summary != nil {
+		l.summary(n)
+	}
+	return n
+}
+
+// Suppressed returns the number of events dropped so far.
+func (l *RateLimiter) Suppressed() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// Callback returns a trace callback passing the events within the
+// rate to next (which may be nil).
+func (l *RateLimiter) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		ok, suppressed := l.Allow()
+		if !ok {
+			return 0
+		}
+		if suppressed > 0 && l.summary != nil {
+			l.summary(suppressed)
+		}
+		return next(info)
+	}
+}
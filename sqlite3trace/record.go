@@ -0,0 +1,234 @@
+package sqlite3trace
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3tracemask"
+)
+
+// TraceRecordVersion is the version of the TraceRecord schema, written
+// in each record ("v"). It changes only when a field changes meaning
+// or disappears; new fields may be added within a version.
+const TraceRecordVersion = 1
+
+// TraceRecord is a trace event as the formatters, sinks and offline
+// readers of this package see it: decoupled from sqlite3.TraceInfo,
+// timestamped, with derived fields, and with stable JSON names.
+type TraceRecord struct {
+	Version    int       `json:"v"`
+	Time       time.Time `json:"time"`       // when the event was reported
+	Event      string    `json:"event"`      // "stmt", "profile", "row", "close"
+	EventCode  uint32    `json:"event_code"` // sqlite3.TraceStmt, ...
+	Conn       Handle    `json:"conn"`
+	ConnLabel  string    `json:"conn_label,omitempty"` // see ConnLabel
+	Stmt       Handle    `json:"stmt,omitempty"`
+	AutoCommit bool      `json:"autocommit"`
+
+	SQL         string `json:"sql,omitempty"`
+	ExpandedSQL string `json:"expanded_sql,omitempty"`
+	NS          int64  `json:"ns,omitempty"` // Profile: run time
+
+	// Set in the records of a Correlator, which stand for the whole run
+	// of a statement: when it began (its Stmt event), and the rows it
+	// produced (its Row events, if traced).
+	Begin *time.Time `json:"begin,omitempty"`
+	Rows  int64      `json:"rows,omitempty"`
+
+	ErrCode     int    `json:"err_code,omitempty"`
+	ErrExtended int    `json:"err_extended,omitempty"`
+	ErrName     string `json:"err_name,omitempty"` // "SQLITE_BUSY"
+
+	Tags map[string]string `json:"tags,omitempty"` // see TagQuery
+}
+
+// Handle is a connection or statement handle,
+// encoded as text in hex ("0x1a2b").
+type Handle uint64
+
+func (h Handle) String() string {
+	return "0x" + strconv.FormatUint(uint64(h), 16)
+}
+
+// MarshalText encodes h as String does: JSON numbers lose precision
+// beyond 2^53.
+func (h Handle) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes the form of MarshalText.
+func (h *Handle) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseUint(strings.TrimPrefix(string(text), "0x"), 16, 64)
+	if err != nil {
+		return fmt.Errorf("sqlite3trace: invalid handle %q", text)
+	}
+	*h = Handle(v)
+	return nil
+}
+
+// NewTraceRecord returns the record of info, timestamped now.
+func NewTraceRecord(info sqlite3.TraceInfo) *TraceRecord {
+	return &TraceRecord{
+		Version:     TraceRecordVersion,
+		Time:        time.Now(),
+		Event:       strings.ToLower(sqlite3tracemask.EventName(info.EventCode)),
+		EventCode:   info.EventCode,
+		Conn:        Handle(info.ConnHandle),
+		ConnLabel:   ConnLabel(info.ConnHandle),
+		Stmt:        Handle(info.StmtHandle),
+		AutoCommit:  info.AutoCommit,
+		SQL:         info.StmtOrTrigger,
+		ExpandedSQL: info.ExpandedSQL,
+		NS:          info.RunTimeNanosec,
+		ErrCode:     int(info.DBError.Code),
+		ErrExtended: int(info.DBError.ExtendedCode),
+		ErrName:     ErrName(int(info.DBError.Code)),
+		Tags:        ParseTags(info.StmtOrTrigger),
+	}
+}
+
+// TraceInfo returns r as a sqlite3.TraceInfo, to feed the pipeline
+// stages (see Replay); the error has codes but no message.
+func (r *TraceRecord) TraceInfo() sqlite3.TraceInfo {
+	return sqlite3.TraceInfo{
+		EventCode:      r.EventCode,
+		AutoCommit:     r.AutoCommit,
+		ConnHandle:     uintptr(r.Conn),
+		StmtHandle:     uintptr(r.Stmt),
+		StmtOrTrigger:  r.SQL,
+		ExpandedSQL:    r.ExpandedSQL,
+		RunTimeNanosec: r.NS,
+		DBError: sqlite3.Error{
+			Code:         sqlite3.ErrNo(r.ErrCode),
+			ExtendedCode: sqlite3.ErrNoExtended(r.ErrExtended),
+		},
+	}
+}
+
+// RecordReader reads TraceRecords back from a trace file, for offline
+// analysis; Read returns io.EOF after the last one.
+type RecordReader interface {
+	Read() (*TraceRecord, error)
+}
+
+// Replay passes the records of rr, as TraceInfo, to cb (a pipeline of
+// stages such as LatencyRecorder, Folder or Analyzer) until the end.
+func Replay(rr RecordReader, cb sqlite3.TraceUserCallback) error {
+	for {
+		rec, err := rr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cb(rec.TraceInfo())
+	}
+}
+
+// Start returns when the statement started running: Begin if set;
+// for Profile events, Time less the run time; Time for the others.
+func (r *TraceRecord) Start() time.Time {
+	if r.Begin != nil {
+		return *r.Begin
+	}
+	if r.NS > 0 {
+		return r.Time.Add(-time.Duration(r.NS))
+	}
+	return r.Time
+}
+
+// Failed reports whether the event carries a database error.
+func (r *TraceRecord) Failed() bool {
+	return r.ErrCode != 0 || r.ErrExtended != 0
+}
+
+var errNames = map[int]string{
+	1: "SQLITE_ERROR", 2: "SQLITE_INTERNAL", 3: "SQLITE_PERM", 4: "SQLITE_ABORT",
+	5: "SQLITE_BUSY", 6: "SQLITE_LOCKED", 7: "SQLITE_NOMEM", 8: "SQLITE_READONLY",
+	9: "SQLITE_INTERRUPT", 10: "SQLITE_IOERR", 11: "SQLITE_CORRUPT", 12: "SQLITE_NOTFOUND",
+	13: "SQLITE_FULL", 14: "SQLITE_CANTOPEN", 15: "SQLITE_PROTOCOL", 16: "SQLITE_EMPTY",
+	17: "SQLITE_SCHEMA", 18: "SQLITE_TOOBIG", 19: "SQLITE_CONSTRAINT", 20: "SQLITE_MISMATCH",
+	21: "SQLITE_MISUSE", 22: "SQLITE_NOLFS", 23: "SQLITE_AUTH", 24: "SQLITE_FORMAT",
+	25: "SQLITE_RANGE", 26: "SQLITE_NOTADB", 27: "SQLITE_NOTICE", 28: "SQLITE_WARNING",
+	100: "SQLITE_ROW", 101: "SQLITE_DONE",
+}
+
+// ErrName returns the name of a primary SQLite result code ("SQLITE_BUSY"),
+// "" for 0, or the number for unknown codes.
+func ErrName(code int) string {
+	if code == 0 {
+		return ""
+	}
+	if n, ok := errNames[code&0xff]; ok {
+		return n
+	}
+	return strconv.Itoa(code)
+}
+
+func (r *TraceRecord) beginText() string {
+	if r.Begin == nil {
+		return ""
+	}
+	return r.Begin.Format(time.RFC3339Nano)
+}
+
+// field is a key and value of a record, for the key=value formats.
+type field struct {
+	key   string
+	str   string
+	num   int64
+	isNum bool
+}
+
+// fields returns the main non-empty fields of r, in the order and
+// with the names of its JSON encoding (leaving out v, time, event_code
+// and autocommit, which the key=value formats show otherwise or not at
+// all); each tag is a field named "tags.<name>".
+func (r *TraceRecord) fields() []field {
+	fs := []field{{key: "event", str: r.Event}, {key: "conn", str: r.Conn.String()}}
+	stmt := ""
+	if r.Stmt != 0 {
+		stmt = r.Stmt.String()
+	}
+	for _, f := range []field{
+		{key: "conn_label", str: r.ConnLabel},
+		{key: "stmt", str: stmt},
+		{key: "sql", str: r.SQL},
+		{key: "expanded_sql", str: r.ExpandedSQL},
+		{key: "begin", str: r.beginText()},
+	} {
+		if f.str != "" {
+			fs = append(fs, f)
+		}
+	}
+	for _, f := range []field{
+		{key: "ns", num: r.NS},
+		{key: "rows", num: r.Rows},
+		{key: "err_code", num: int64(r.ErrCode)},
+		{key: "err_extended", num: int64(r.ErrExtended)},
+	} {
+		if f.num != 0 {
+			f.isNum = true
+			fs = append(fs, f)
+		}
+	}
+	if r.ErrName != "" {
+		fs = append(fs, field{key: "err_name", str: r.ErrName})
+	}
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fs = append(fs, field{key: "tags." + k, str: r.Tags[k]})
+	}
+	return fs
+}
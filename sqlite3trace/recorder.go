@@ -0,0 +1,83 @@
+package sqlite3trace
+
+import (
+	"sync"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// Event is a trace event with the time the callback received it.
+type Event struct {
+	Time time.Time
+	Info sqlite3.TraceInfo
+}
+
+// Recorder is a trace pipeline stage keeping the most recent events
+// in a fixed-size ring buffer, for exporters and debug endpoints.
+type Recorder struct {
+	mu      sync.Mutex
+	buf     []Event
+	next    int  // index of the slot to write next
+	full    bool // buf has wrapped at least once
+	dropped uint64
+}
+
+// NewRecorder returns a Recorder keeping up to capacity events.
+func NewRecorder(capacity int) *Recorder {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &Recorder{buf: make([]Event, capacity)}
+}
+
+// Callback returns a trace callback recording each event and then
+// passing it to next (which may be nil).
+func (r *Recorder) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		r.Record(Event{Time: time.Now(), Info: info})
+		return next(info)
+	}
+}
+
+// Record adds an event, overwriting the oldest one when full.
+func (r *Recorder) Record(ev Event) {
+	r.mu.Lock()
+	if r.full {
+		r.dropped++
+	}
+	r.buf[r.next] = ev
+	r.next++
+	if r.next == len(r.buf) {
+		r.next = 0
+		r.full = true
+	}
+	r.mu.Unlock()
+}
+
+// Events returns a copy of the recorded events, oldest first.
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Event(nil), r.buf[:r.next]...)
+	}
+	out := make([]Event, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// Dropped returns how many events were overwritten before being read.
+func (r *Recorder) Dropped() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// Reset empties the buffer.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.next, r.full, r.dropped = 0, false, 0
+	r.mu.Unlock()
+}
@@ -0,0 +1,56 @@
+package sqlite3trace
+
+import (
+	"strings"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Redact returns sql with its string, blob and number literals
+// replaced by '?', e.g. for a statement expanded with its bound values.
+func Redact(sql string) string {
+	toks := sqlite3lex.Tokenize(sql)
+	var b strings.Builder
+	b.Grow(len(sql))
+	for _, t := range toks {
+		if t.IsLiteral() {
+			b.WriteByte('?')
+		} else {
+			b.WriteString(t.Text)
+		}
+	}
+	return b.String()
+}
+
+// Redactor is a trace pipeline stage masking the literals of the
+// statements (see Redact) before the next stages see them, so that
+// traces can be on in production without leaking personal data.
+// ExpandedSQL, which carries the bound values, is always redacted;
+// StmtOrTrigger only if asked, as literals written in the application
+// SQL are usually constants.
+type Redactor struct {
+	stmts bool
+}
+
+// NewRedactor returns a Redactor; stmts also redacts StmtOrTrigger.
+func NewRedactor(stmts bool) *Redactor {
+	return &Redactor{stmts: stmts}
+}
+
+// Callback returns a trace callback redacting each event and then
+// passing it to next (which may be nil). Place it before the stages
+// producing output.
+func (r *Redactor) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		if info.ExpandedSQL != "" {
+			info.ExpandedSQL = Redact(info.ExpandedSQL)
+		}
+		if r.stmts && info.StmtOrTrigger != "" {
+			info.StmtOrTrigger = Redact(info.StmtOrTrigger)
+		}
+		return next(info)
+	}
+}
@@ -0,0 +1,218 @@
+package sqlite3trace
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateOptions configure a RotatingFile.
+type RotateOptions struct {
+	// MaxSize is the size in bytes past which the file is rotated;
+	// 0 means 100 MiB.
+	MaxSize int64
+	// MaxAge removes the rotated files older than it; 0 keeps them.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept; 0 keeps them all.
+	MaxBackups int
+	// Compress gzips the rotated files (in the background).
+	Compress bool
+}
+
+// backupTimeFormat names the rotated files, sorting in time order.
+const backupTimeFormat = "20060102T150405.000000000"
+
+// RotatingFile is an io.WriteCloser for a WriterSink that starts a new
+// file when the current one reaches a size, so that statement tracing
+// can be left on in long-running services without filling the disk.
+// Rotated files are renamed path.<time>, plus .gz when compressed.
+// It is safe for concurrent use.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu     sync.Mutex
+	f      *os.File // nil after a failed rotation: reopened by the next Write
+	size   int64
+	limit  int64 // size past which to rotate: MaxSize, more after a failed rotation
+	closed bool
+
+	cleanMu sync.Mutex // serializes compression and removal
+	wg      sync.WaitGroup
+}
+
+// OpenRotatingFile opens (appending) or creates the file path.
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 100 << 20
+	}
+	r := &RotatingFile{path: path, opts: opts}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.limit = f, fi.Size(), r.opts.MaxSize
+	return nil
+}
+
+// Write implements io.Writer, rotating first if p would take the file
+// past MaxSize (a p larger than MaxSize goes alone in a file).
+// A failed rotation fails that Write only: writing goes on in the
+// current file, rotation is tried again after another MaxSize bytes.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.limit {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate starts a new file now.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	err := r.f.Close()
+	r.f = nil
+	backup := r.path + "." + time.Now().Format(backupTimeFormat)
+	if err == nil {
+		err = os.Rename(r.path, backup)
+	}
+	if err == nil {
+		err = r.open()
+	}
+	if err != nil {
+		// Go on appending to path (the old file, or the new one if
+		// only its opening failed); if even that fails, Write retries.
+		if r.open() == nil {
+			r.limit = r.size + r.opts.MaxSize
+		}
+		return err
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.cleanMu.Lock()
+		defer r.cleanMu.Unlock()
+		if r.opts.Compress {
+			compressFile(backup) // on failure the file stays uncompressed
+		}
+		r.removeOld()
+	}()
+	return nil
+}
+
+// Close closes the file, after the background work of past rotations.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	r.closed = true
+	if r.f != nil {
+		err = r.f.Close()
+		r.f = nil
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+func compressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
+
+// removeOld applies MaxBackups and MaxAge to the rotated files.
+func (r *RotatingFile) removeOld() {
+	if r.opts.MaxBackups <= 0 && r.opts.MaxAge <= 0 {
+		return
+	}
+	dir, base := filepath.Split(r.path)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var backups []string // newest first
+	for _, e := range entries {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(e.Name(), base+"."), ".gz")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil && !e.IsDir() {
+			backups = append(backups, e.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, name := range backups {
+		full := filepath.Join(dir, name)
+		old := r.opts.MaxBackups > 0 && i >= r.opts.MaxBackups
+		if !old && r.opts.MaxAge > 0 {
+			if fi, err := os.Stat(full); err == nil && time.Since(fi.ModTime()) > r.opts.MaxAge {
+				old = true
+			}
+		}
+		if old {
+			os.Remove(full)
+		}
+	}
+}
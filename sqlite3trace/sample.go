@@ -0,0 +1,78 @@
+package sqlite3trace
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// SampleRate is how the events of one type are sampled: one in Every
+// (deterministic: the 1st, the Every+1th, ...), or else each with
+// Probability. The zero value passes everything.
+type SampleRate struct {
+	Every       int
+	Probability float64
+}
+
+// Sampler is a trace pipeline stage passing a sample of the events,
+// with a rate per event type, so that tracing can stay on in
+// high-traffic services at a low cost. Events are sampled
+// independently: a Profile event may pass without its Stmt event.
+type Sampler struct {
+	rates map[uint32]*sampled
+
+	mu  sync.Mutex // guards rnd
+	rnd *rand.Rand
+}
+
+type sampled struct {
+	SampleRate
+	n uint64 // atomic: events seen, for Every
+}
+
+// NewSampler returns a Sampler with the rates keyed by event code
+// (sqlite3.TraceStmt, ...); events of other types all pass.
+// seed drives the probabilistic sampling; 0 means a random seed.
+func NewSampler(rates map[uint32]SampleRate, seed int64) *Sampler {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s := &Sampler{rates: make(map[uint32]*sampled), rnd: rand.New(rand.NewSource(seed))}
+	for code, r := range rates {
+		s.rates[code] = &sampled{SampleRate: r}
+	}
+	return s
+}
+
+// Sample reports whether an event of type code passes.
+func (s *Sampler) Sample(code uint32) bool {
+	r, ok := s.rates[code]
+	if !ok {
+		return true
+	}
+	if r.Every > 1 {
+		return (atomic.AddUint64(&r.n, 1)-1)%uint64(r.Every) == 0
+	}
+	if r.Probability > 0 && r.Probability < 1 {
+		s.mu.Lock()
+		f := s.rnd.Float64()
+		s.mu.Unlock()
+		return f < r.Probability
+	}
+	return true
+}
+
+// Callback returns a trace callback passing the sampled events to
+// next (which may be nil).
+func (s *Sampler) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		if !s.Sample(info.EventCode) {
+			return 0
+		}
+		return next(info)
+	}
+}
@@ -0,0 +1,75 @@
+package sqlite3trace
+
+import (
+	"io"
+	"sync"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// Sink is where an Output stage sends the trace events: a writer
+// with a Formatter, a logger, ... Emit runs inside the trace callback,
+// on the goroutine running the statement, so it should be fast;
+// it must not modify rec, which other sinks may share.
+type Sink interface {
+	Emit(rec *TraceRecord) error
+}
+
+// Formatter renders trace events for a WriterSink.
+type Formatter interface {
+	// AppendFormat appends the rendering of rec to dst, as one line
+	// ending with '\n' for the text formats, and returns the extended
+	// buffer.
+	AppendFormat(dst []byte, rec *TraceRecord) []byte
+}
+
+// Output is a trace pipeline stage sending every event to a Sink,
+// as a TraceRecord. The Profile and Row events get the statement text
+// of their Stmt event (when the mask includes Stmt).
+type Output struct {
+	sink    Sink
+	onError func(error)
+	texts   stmtTracker
+}
+
+// NewOutput returns an Output sending to s; onError, if not nil,
+// receives the errors of s.
+func NewOutput(s Sink, onError func(error)) *Output {
+	return &Output{sink: s, onError: onError}
+}
+
+// Callback returns a trace callback emitting every event and passing
+// it to next (which may be nil).
+func (o *Output) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		o.texts.fill(&info)
+		if err := o.sink.Emit(NewTraceRecord(info)); err != nil && o.onError != nil {
+			o.onError(err)
+		}
+		return next(info)
+	}
+}
+
+// WriterSink writes the events to an io.Writer, one Formatter line
+// each; it is safe for concurrent use.
+type WriterSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	f   Formatter
+	buf []byte
+}
+
+// NewWriterSink returns a WriterSink writing to w with f.
+func NewWriterSink(w io.Writer, f Formatter) *WriterSink {
+	return &WriterSink{w: w, f: f}
+}
+
+// Emit implements Sink.
+func (s *WriterSink) Emit(rec *TraceRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = s.f.AppendFormat(s.buf[:0], rec)
+	_, err := s.w.Write(s.buf)
+	return err
+}
@@ -0,0 +1,72 @@
+//go:build go1.21
+
+package sqlite3trace
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// SlogSink is a Sink emitting each event as a log/slog record, so that
+// traces interleave with the application's own structured logs.
+// The attributes are the main fields of TraceRecord under their JSON
+// names (as with LogfmtFormatter), plus "duration" for Profile events;
+// the record time is the event's.
+type SlogSink struct {
+	h          slog.Handler
+	msg        string
+	level      slog.Level
+	errorLevel slog.Leveler
+}
+
+// SlogOptions configure a SlogSink.
+type SlogOptions struct {
+	// Message of the records; "" means "sqlite3 trace".
+	Message string
+	// Level of the records; the zero value is slog.LevelInfo.
+	Level slog.Level
+	// ErrorLevel is the minimum level of events reporting a database
+	// error: they get the more severe of Level and ErrorLevel.
+	// nil means slog.LevelWarn; a *slog.LevelVar can change it later.
+	ErrorLevel slog.Leveler
+}
+
+// NewSlogSink returns a SlogSink handing records to h
+// (e.g. slog.Default().Handler()).
+func NewSlogSink(h slog.Handler, opts SlogOptions) *SlogSink {
+	s := &SlogSink{h: h, msg: opts.Message, level: opts.Level, errorLevel: opts.ErrorLevel}
+	if s.msg == "" {
+		s.msg = "sqlite3 trace"
+	}
+	if s.errorLevel == nil {
+		s.errorLevel = slog.LevelWarn
+	}
+	return s
+}
+
+// Emit implements Sink.
+func (s *SlogSink) Emit(r *TraceRecord) error {
+	ctx := context.Background()
+	level := s.level
+	if el := s.errorLevel.Level(); r.Failed() && level < el {
+		level = el
+	}
+	if !s.h.Enabled(ctx, level) {
+		return nil
+	}
+	rec := slog.NewRecord(r.Time, level, s.msg, 0)
+	for _, f := range r.fields() {
+		if f.isNum {
+			rec.AddAttrs(slog.Int64(f.key, f.num))
+		} else {
+			rec.AddAttrs(slog.String(f.key, f.str))
+		}
+	}
+	if r.EventCode == sqlite3.TraceProfile {
+		rec.AddAttrs(slog.Duration("duration", time.Duration(r.NS)))
+	}
+	return s.h.Handle(ctx, rec)
+}
@@ -0,0 +1,68 @@
+package sqlite3trace
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// SlowFilter is a trace pipeline stage making a slow-query log: it
+// passes only the Profile events of statements that ran for at least
+// a threshold, optionally preceded by their Stmt event (held back
+// until the statement finishes). The other events are dropped.
+// The mask must include Profile, and Stmt for the statement text.
+type SlowFilter struct {
+	min      int64 // ns
+	withStmt bool
+	texts    stmtTracker
+
+	mu      sync.Mutex
+	pending map[stmtKey]sqlite3.TraceInfo // Stmt events, if withStmt
+}
+
+// NewSlowFilter returns a SlowFilter passing the statements running for
+// min or longer; withStmt passes their Stmt event too.
+func NewSlowFilter(min time.Duration, withStmt bool) *SlowFilter {
+	return &SlowFilter{min: int64(min), withStmt: withStmt, pending: make(map[stmtKey]sqlite3.TraceInfo)}
+}
+
+// Callback returns a trace callback passing the events of the slow
+// statements to next (which may be nil).
+func (s *SlowFilter) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		s.texts.fill(&info)
+		k := stmtKey{info.ConnHandle, info.StmtHandle}
+		switch info.EventCode {
+		case sqlite3.TraceStmt:
+			if s.withStmt && !strings.HasPrefix(info.StmtOrTrigger, "--") {
+				s.mu.Lock()
+				s.pending[k] = info
+				s.mu.Unlock()
+			}
+		case sqlite3.TraceProfile:
+			s.mu.Lock()
+			stmt, held := s.pending[k]
+			delete(s.pending, k)
+			s.mu.Unlock()
+			if info.RunTimeNanosec < s.min {
+				return 0
+			}
+			if held {
+				next(stmt)
+			}
+			return next(info)
+		case sqlite3.TraceClose:
+			s.mu.Lock()
+			for k := range s.pending {
+				if k.conn == info.ConnHandle {
+					delete(s.pending, k)
+				}
+			}
+			s.mu.Unlock()
+		}
+		return 0
+	}
+}
@@ -0,0 +1,58 @@
+// Package sqlite3trace contains the building blocks of a trace pipeline
+// for the SQL Trace Hook (sqlite3_trace_v2): stages that wrap
+// a sqlite3.TraceUserCallback, analyze or record the events,
+// and pass them on.
+//
+// The stages are meant to be stacked in the single Callback slot
+// of sqlite3.TraceConfig, with the mask chosen via sqlite3tracemask.
+package sqlite3trace
+
+import (
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// nopCallback is used as the end of a pipeline when no next stage is given.
+func nopCallback(sqlite3.TraceInfo) int {
+	return 0
+}
+
+// orNop returns cb, or a callback doing nothing if cb is nil.
+func orNop(cb sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	if cb == nil {
+		return nopCallback
+	}
+	return cb
+}
+
+// ChainCallbacks returns a callback passing each event to every one of
+// cbs, in order, so that independent consumers (metrics, logging,
+// a Recorder, ...) share the single Callback slot of sqlite3.TraceConfig
+// without being stacked as stages. Nil callbacks are skipped.
+//
+// Every consumer sees every event, whatever the others return; the
+// result is the first non-zero return value, or 0. (SQLite currently
+// ignores it, and asks callbacks to return 0.) A panicking consumer
+// is not isolated: the panic propagates as with a single callback.
+func ChainCallbacks(cbs ...sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	var chain []sqlite3.TraceUserCallback
+	for _, cb := range cbs {
+		if cb != nil {
+			chain = append(chain, cb)
+		}
+	}
+	switch len(chain) {
+	case 0:
+		return nopCallback
+	case 1:
+		return chain[0]
+	}
+	return func(info sqlite3.TraceInfo) int {
+		ret := 0
+		for _, cb := range chain {
+			if r := cb(info); r != 0 && ret == 0 {
+				ret = r
+			}
+		}
+		return ret
+	}
+}
@@ -0,0 +1,137 @@
+package sqlite3trace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// SQLLayout says how a TextFormatter lays out statement texts,
+// which application code often writes on several indented lines.
+type SQLLayout int
+
+const (
+	SQLQuoted   SQLLayout = iota // as written, quoted: newlines show as \n
+	SQLOneLine                   // on one line, whitespace collapsed (outside literals)
+	SQLIndented                  // multi-line texts on lines of their own, reindented
+)
+
+var sqlLayoutNames = map[SQLLayout]string{
+	SQLQuoted:   "quoted",
+	SQLOneLine:  "one-line",
+	SQLIndented: "indented",
+}
+
+func (l SQLLayout) String() string {
+	if n, ok := sqlLayoutNames[l]; ok {
+		return n
+	}
+	return fmt.Sprintf("SQLLayout(%d)", int(l))
+}
+
+// ParseSQLLayout returns the SQLLayout named s (as by String).
+func ParseSQLLayout(s string) (SQLLayout, error) {
+	for l, n := range sqlLayoutNames {
+		if s == n {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("sqlite3trace: unknown SQL layout %q", s)
+}
+
+// CollapseSQL returns sql on one line: every run of whitespace
+// outside the literals and quoted identifiers becomes one space,
+// and "--" comments become "/* */" ones (or are dropped if they
+// contain "*/").
+func CollapseSQL(sql string) string {
+	var b strings.Builder
+	space := false
+	for _, t := range sqlite3lex.Tokenize(sql) {
+		text := t.Text
+		switch t.Kind {
+		case sqlite3lex.Space:
+			space = true
+			continue
+		case sqlite3lex.Comment:
+			body := text
+			if strings.HasPrefix(text, "--") {
+				body = strings.TrimPrefix(text, "--")
+				if strings.Contains(body, "*/") {
+					space = true
+					continue
+				}
+			} else {
+				body = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+			}
+			text = "/* " + strings.Join(strings.Fields(body), " ") + " */"
+			if strings.TrimSpace(body) == "" {
+				text = "/**/"
+			}
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// reindentSQL splits sql into lines without the leading and trailing
+// blank lines, the trailing spaces, and the indentation common to
+// the lines after the first (which usually follows an opening quote
+// in the source code, so has none). The lines continuing a literal
+// or a comment are left as they are.
+func reindentSQL(sql string) []string {
+	sql = strings.ReplaceAll(sql, "\r\n", "\n")
+	// inside[i]: line i starts within a multi-line token
+	var inside []bool
+	for _, t := range sqlite3lex.Tokenize(sql) {
+		n := strings.Count(t.Text, "\n")
+		for j := 0; j < n; j++ {
+			inside = append(inside, t.Kind != sqlite3lex.Space)
+		}
+	}
+	lines := strings.Split(sql, "\n")
+	inside = append([]bool{false}, inside...)
+	for i := range lines {
+		if !inside[i] {
+			lines[i] = strings.TrimRight(lines[i], " \t\r")
+		}
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines, inside = lines[1:], inside[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines, inside = lines[:len(lines)-1], inside[:len(inside)-1]
+	}
+	indent := -1
+	for i, line := range lines {
+		if inside[i] || line == "" || (i == 0 && len(lines) > 1) {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	// The first line usually starts right after the opening quote, at
+	// indent 0: it keeps its own indent unless it is itself indented.
+	if indent > 0 && len(lines) > 1 {
+		if first := len(lines[0]) - len(strings.TrimLeft(lines[0], " \t")); first > 0 && first < indent {
+			indent = first
+		}
+	}
+	for i, line := range lines {
+		if inside[i] || indent <= 0 {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if n > indent {
+			n = indent
+		}
+		lines[i] = line[n:]
+	}
+	return lines
+}
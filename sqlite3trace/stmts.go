@@ -0,0 +1,61 @@
+package sqlite3trace
+
+import (
+	"strings"
+	"sync"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+type stmtKey struct{ conn, stmt uintptr }
+
+type stmtText struct {
+	sql, expanded string
+}
+
+// stmtTracker remembers the text of the statements being run, by
+// connection and statement handle: SQLite reports it with TraceStmt
+// events only, while the TraceProfile and TraceRow events of the same
+// run carry just the handle. The zero value is ready to use.
+type stmtTracker struct {
+	mu sync.Mutex
+	m  map[stmtKey]stmtText
+}
+
+// fill records the text of Stmt events and copies it into the Profile
+// and Row events of the same statement; a Profile event ends the run.
+func (t *stmtTracker) fill(info *sqlite3.TraceInfo) {
+	k := stmtKey{info.ConnHandle, info.StmtHandle}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch info.EventCode {
+	case sqlite3.TraceStmt:
+		if strings.HasPrefix(info.StmtOrTrigger, "--") {
+			return // trigger program: the statement keeps its text
+		}
+		if t.m == nil {
+			t.m = make(map[stmtKey]stmtText)
+		}
+		t.m[k] = stmtText{info.StmtOrTrigger, info.ExpandedSQL}
+	case sqlite3.TraceProfile, sqlite3.TraceRow:
+		st, ok := t.m[k]
+		if !ok {
+			return
+		}
+		if info.StmtOrTrigger == "" {
+			info.StmtOrTrigger = st.sql
+		}
+		if info.ExpandedSQL == "" {
+			info.ExpandedSQL = st.expanded
+		}
+		if info.EventCode == sqlite3.TraceProfile {
+			delete(t.m, k)
+		}
+	case sqlite3.TraceClose:
+		for k := range t.m {
+			if k.conn == info.ConnHandle {
+				delete(t.m, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package sqlite3trace
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// The trace callback does not see the context of the statement, so
+// context values reach the trace records through the statement text:
+// TagQuery appends them as a comment, which SQLite keeps in the text
+// it reports, and the records parse them back (see ParseTags).
+//
+// The comment follows the sqlcommenter format, also understood by
+// other tools: /*request_id='abc',user='42'*/, keys and values
+// URL-encoded. Tagged queries differ by their values, so tag only
+// statements that are not worth caching as prepared statements, or
+// only the values worth it (a request ID, not a timestamp).
+
+type tagsKey struct{}
+
+// WithTag returns a context carrying the tag name=value, in addition
+// to those of ctx, for TagQuery.
+func WithTag(ctx context.Context, name, value string) context.Context {
+	old, _ := ctx.Value(tagsKey{}).(map[string]string)
+	tags := make(map[string]string, len(old)+1)
+	for k, v := range old {
+		tags[k] = v
+	}
+	tags[name] = value
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+// ContextTags returns the tags of ctx (nil if none); do not modify it.
+func ContextTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
+	return tags
+}
+
+// TagQuery returns query with the tags of ctx appended as a comment,
+// or query itself when ctx has none:
+//
+//	db.ExecContext(ctx, sqlite3trace.TagQuery(ctx, "UPDATE t SET ..."), args...)
+func TagQuery(ctx context.Context, query string) string {
+	tags := ContextTags(ctx)
+	if len(tags) == 0 {
+		return query
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	query = strings.TrimRight(query, " \t\r\n;")
+	b.WriteString(query)
+	if endsWithLineComment(query) {
+		b.WriteByte('\n')
+	}
+	b.WriteString(" /*")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		// QueryEscape leaves no '*', '/' or quote that could end the comment.
+		b.WriteString(escapeTag(k))
+		b.WriteString("='")
+		b.WriteString(escapeTag(tags[k]))
+		b.WriteByte('\'')
+	}
+	b.WriteString("*/")
+	return b.String()
+}
+
+func endsWithLineComment(query string) bool {
+	toks := sqlite3lex.Tokenize(query)
+	return len(toks) > 0 && strings.HasPrefix(toks[len(toks)-1].Text, "--")
+}
+
+func escapeTag(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "*", "%2A")
+}
+
+// ParseTags returns the tags appended to sql by TagQuery (nil if none):
+// those of its last comment, if that has the sqlcommenter form.
+func ParseTags(sql string) map[string]string {
+	if !strings.Contains(sql, "*/") {
+		return nil // fast path: most statements have no comment
+	}
+	toks := sqlite3lex.Tokenize(sql)
+	for i := len(toks) - 1; i >= 0; i-- {
+		t := toks[i]
+		if t.Kind == sqlite3lex.Space || t.IsPunct(";") {
+			continue
+		}
+		if t.Kind != sqlite3lex.Comment || !strings.HasPrefix(t.Text, "/*") {
+			return nil
+		}
+		return parseTagComment(strings.TrimSuffix(strings.TrimPrefix(t.Text, "/*"), "*/"))
+	}
+	return nil
+}
+
+func parseTagComment(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok || len(v) < 2 || v[0] != '\'' || v[len(v)-1] != '\'' {
+			return nil
+		}
+		key, err1 := url.QueryUnescape(k)
+		value, err2 := url.QueryUnescape(v[1 : len(v)-1])
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		tags[key] = value
+	}
+	return tags
+}
@@ -0,0 +1,203 @@
+package sqlite3trace
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3tracemask"
+)
+
+// TextFormatter renders each event as a line for people to read:
+//
+//	ev Profile, conn 0x1a2b (reader-pool), stmt 0x3c4d {"SELECT ?"} expanded {"SELECT 1"}; 5200 ns
+//
+// The statement text is shown quoted in curly braces: of the paired
+// ASCII characters they are the least used in SQL, so the better
+// delimiters. (Braces inside it suggest template syntax or string
+// interpolation that was not applied: a bug in the application.)
+// The zero value shows everything, durations in nanoseconds, without color,
+// the statement texts as written (see SQLLayout).
+//
+// With Color, the line has ANSI escapes for a terminal: the SQL verbs
+// (SELECT, INSERT, BEGIN, ...) bold, the durations of at least Slow
+// in red and the DB errors in bold red. Set it with UseColor, so that
+// it is off when the output is not a terminal.
+type TextFormatter struct {
+	Prefix       string        // starts each line, e.g. "Trace: "
+	HideHandles  bool          // leave out the connection and statement handles (and label)
+	HideExpanded bool          // leave out the expanded SQL
+	Millis       bool          // durations in milliseconds instead of nanoseconds
+	Color        bool          // ANSI colors
+	Slow         time.Duration // with Color, durations from which to show in red; 0 means none
+	Layout       SQLLayout     // how to lay out the statement texts
+}
+
+// With the SQLIndented layout, a multi-line statement text goes
+// on the following lines, each with the Prefix and this indentation,
+// and the closing brace on one more line:
+//
+//	ev Stmt, conn 0x1a2b, stmt 0x3c4d {
+//	    SELECT id, note
+//	      FROM t1
+//	     WHERE note LIKE ?
+//	}
+const sqlIndent = "    "
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiRed     = "\x1b[31m"
+	ansiBoldRed = "\x1b[1;31m"
+)
+
+// UseColor reports whether w is a terminal that should get colors:
+// an *os.File on a character device, unless the environment sets
+// NO_COLOR (https://no-color.org) or TERM=dumb.
+func UseColor(w io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// sqlVerbs are the keywords that start SQLite statements.
+var sqlVerbs = map[string]bool{
+	"ALTER": true, "ANALYZE": true, "ATTACH": true, "BEGIN": true,
+	"COMMIT": true, "CREATE": true, "DELETE": true, "DETACH": true,
+	"DROP": true, "END": true, "EXPLAIN": true, "INSERT": true,
+	"PRAGMA": true, "REINDEX": true, "RELEASE": true, "REPLACE": true,
+	"ROLLBACK": true, "SAVEPOINT": true, "SELECT": true, "UPDATE": true,
+	"UPSERT": true, "VACUUM": true, "VALUES": true, "WITH": true,
+}
+
+// appendSQL appends sql in braces, laid out as f.Layout says,
+// with its verbs bold when f.Color.
+func (f *TextFormatter) appendSQL(dst []byte, sql string) []byte {
+	switch f.Layout {
+	case SQLOneLine:
+		sql = CollapseSQL(sql)
+	case SQLIndented:
+		if strings.Contains(sql, "\n") {
+			dst = append(dst, "{\n"...)
+			for _, line := range reindentSQL(sql) {
+				dst = append(dst, f.Prefix...)
+				dst = append(dst, sqlIndent...)
+				dst = f.appendVerbs(dst, line, false)
+				dst = append(dst, '\n')
+			}
+			dst = append(dst, f.Prefix...)
+			return append(dst, '}')
+		}
+	}
+	dst = append(dst, '{')
+	dst = f.appendVerbs(dst, sql, true)
+	return append(dst, '}')
+}
+
+// appendVerbs appends sql (quoted if quote) with its verbs bold
+// when f.Color.
+func (f *TextFormatter) appendVerbs(dst []byte, sql string, quote bool) []byte {
+	if !f.Color {
+		if quote {
+			return strconv.AppendQuote(dst, sql)
+		}
+		return append(dst, sql...)
+	}
+	if quote {
+		dst = append(dst, '"')
+	}
+	for _, t := range sqlite3lex.Tokenize(sql) {
+		text := t.Text
+		if quote {
+			text = strconv.Quote(text)
+			text = text[1 : len(text)-1]
+		}
+		if t.Kind == sqlite3lex.Ident && sqlVerbs[strings.ToUpper(t.Text)] {
+			dst = append(dst, ansiBold...)
+			dst = append(dst, text...)
+			dst = append(dst, ansiReset...)
+		} else {
+			dst = append(dst, text...)
+		}
+	}
+	if quote {
+		dst = append(dst, '"')
+	}
+	return dst
+}
+
+// AppendFormat implements Formatter.
+func (f *TextFormatter) AppendFormat(dst []byte, rec *TraceRecord) []byte {
+	dst = append(dst, f.Prefix...)
+	dst = append(dst, "ev "...)
+	dst = append(dst, sqlite3tracemask.EventName(rec.EventCode)...)
+	if !f.HideHandles {
+		dst = append(dst, ", conn "...)
+		dst = append(dst, rec.Conn.String()...)
+		if rec.ConnLabel != "" {
+			dst = append(dst, " ("...)
+			dst = append(dst, rec.ConnLabel...)
+			dst = append(dst, ')')
+		}
+		if rec.Stmt != 0 {
+			dst = append(dst, ", stmt "...)
+			dst = append(dst, rec.Stmt.String()...)
+		}
+	}
+	if rec.SQL != "" {
+		dst = append(dst, ' ')
+		dst = f.appendSQL(dst, rec.SQL)
+	}
+	if !f.HideExpanded && rec.ExpandedSQL != "" && rec.ExpandedSQL != rec.SQL {
+		dst = append(dst, " expanded "...)
+		dst = f.appendSQL(dst, rec.ExpandedSQL)
+	}
+	if rec.EventCode == sqlite3.TraceProfile {
+		dst = append(dst, "; "...)
+		slow := f.Color && f.Slow > 0 && time.Duration(rec.NS) >= f.Slow
+		if slow {
+			dst = append(dst, ansiRed...)
+		}
+		if f.Millis {
+			dst = strconv.AppendFloat(dst, float64(rec.NS)/1e6, 'f', 3, 64)
+			dst = append(dst, " ms"...)
+		} else {
+			dst = strconv.AppendInt(dst, rec.NS, 10)
+			dst = append(dst, " ns"...)
+		}
+		if slow {
+			dst = append(dst, ansiReset...)
+		}
+	}
+	if rec.Rows > 0 {
+		dst = append(dst, "; "...)
+		dst = strconv.AppendInt(dst, rec.Rows, 10)
+		dst = append(dst, " rows"...)
+	}
+	if rec.Failed() {
+		dst = append(dst, "; "...)
+		if f.Color {
+			dst = append(dst, ansiBoldRed...)
+		}
+		dst = append(dst, "DB error "...)
+		dst = append(dst, rec.ErrName...)
+		dst = append(dst, " (extended "...)
+		dst = strconv.AppendInt(dst, int64(rec.ErrExtended), 10)
+		dst = append(dst, ')')
+		if f.Color {
+			dst = append(dst, ansiReset...)
+		}
+	}
+	return append(dst, '\n')
+}
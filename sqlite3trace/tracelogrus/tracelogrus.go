@@ -0,0 +1,89 @@
+// Package tracelogrus is a sqlite3trace.Sink writing trace events
+// through logrus, for codebases logging with it.
+package tracelogrus
+
+import (
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+	"github.com/sirupsen/logrus"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3trace"
+)
+
+// Sink writes each event as a log entry whose logrus.Fields are the
+// main fields of sqlite3trace.TraceRecord under their JSON names, plus
+// "duration" for Profile events. The entries go out at the level given
+// to New; a failed statement raises its entry to logrus.WarnLevel when
+// that level is less severe, so that errors pass a Warn threshold.
+type Sink struct {
+	log   *logrus.Logger
+	msg   string
+	level logrus.Level
+}
+
+var _ sqlite3trace.Sink = (*Sink)(nil)
+
+// New returns a Sink logging to log (nil means logrus.StandardLogger())
+// at level, with message msg ("" means "sqlite3 trace").
+func New(log *logrus.Logger, level logrus.Level, msg string) *Sink {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+	if msg == "" {
+		msg = "sqlite3 trace"
+	}
+	return &Sink{log: log, msg: msg, level: level}
+}
+
+// Emit implements sqlite3trace.Sink.
+func (s *Sink) Emit(rec *sqlite3trace.TraceRecord) error {
+	level := s.level
+	if rec.Failed() && level > logrus.WarnLevel { // logrus levels grow with verbosity
+		level = logrus.WarnLevel
+	}
+	if !s.log.IsLevelEnabled(level) {
+		return nil
+	}
+	s.log.WithFields(Fields(rec)).WithTime(rec.Time).Log(level, s.msg)
+	return nil
+}
+
+// Fields returns the fields of a record, as the Sink logs them.
+func Fields(rec *sqlite3trace.TraceRecord) logrus.Fields {
+	f := logrus.Fields{
+		"event": rec.Event,
+		"conn":  rec.Conn.String(),
+	}
+	if rec.ConnLabel != "" {
+		f["conn_label"] = rec.ConnLabel
+	}
+	if rec.Stmt != 0 {
+		f["stmt"] = rec.Stmt.String()
+	}
+	if rec.SQL != "" {
+		f["sql"] = rec.SQL
+	}
+	if rec.ExpandedSQL != "" {
+		f["expanded_sql"] = rec.ExpandedSQL
+	}
+	if rec.EventCode == sqlite3.TraceProfile {
+		f["ns"] = rec.NS
+		f["duration"] = time.Duration(rec.NS)
+	}
+	if rec.Begin != nil {
+		f["begin"] = *rec.Begin
+	}
+	if rec.Rows != 0 {
+		f["rows"] = rec.Rows
+	}
+	if rec.Failed() {
+		f["err_code"] = rec.ErrCode
+		f["err_extended"] = rec.ErrExtended
+		f["err_name"] = rec.ErrName
+	}
+	if rec.Tags != nil {
+		f["tags"] = rec.Tags
+	}
+	return f
+}
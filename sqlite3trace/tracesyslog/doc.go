@@ -0,0 +1,5 @@
+// Package tracesyslog is a sqlite3trace.Sink writing trace events to
+// the local or a remote syslog, for environments where syslog is the
+// only sanctioned log path. It relies on log/syslog, so it is empty
+// on Windows and Plan 9.
+package tracesyslog
@@ -0,0 +1,98 @@
+//go:build !windows && !plan9
+
+package tracesyslog
+
+import (
+	"bytes"
+	"log/syslog"
+	"sync"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3trace"
+)
+
+// Options configure a Sink.
+type Options struct {
+	// Network and Addr of a remote syslog ("udp", "logs:514");
+	// empty for the local one.
+	Network, Addr string
+	// Facility of the messages; 0 (LOG_KERN, not for programs)
+	// means syslog.LOG_USER.
+	Facility syslog.Priority
+	// Tag of the messages; "" means the program name.
+	Tag string
+	// Severity chooses the severity of each record; nil means
+	// syslog.LOG_WARNING for records with a database error,
+	// syslog.LOG_INFO for the others.
+	Severity func(*sqlite3trace.TraceRecord) syslog.Priority
+	// Formatter renders the message; nil means sqlite3trace.LogfmtFormatter.
+	Formatter sqlite3trace.Formatter
+}
+
+// Sink sends each record as one syslog message.
+type Sink struct {
+	w        *syslog.Writer
+	severity func(*sqlite3trace.TraceRecord) syslog.Priority
+	f        sqlite3trace.Formatter
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+var _ sqlite3trace.Sink = (*Sink)(nil)
+
+// New connects to syslog.
+func New(opts Options) (*Sink, error) {
+	if opts.Facility == 0 {
+		opts.Facility = syslog.LOG_USER
+	}
+	w, err := syslog.Dial(opts.Network, opts.Addr, opts.Facility|syslog.LOG_INFO, opts.Tag)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sink{w: w, severity: opts.Severity, f: opts.Formatter}
+	if s.severity == nil {
+		s.severity = defaultSeverity
+	}
+	if s.f == nil {
+		s.f = sqlite3trace.LogfmtFormatter{}
+	}
+	return s, nil
+}
+
+func defaultSeverity(rec *sqlite3trace.TraceRecord) syslog.Priority {
+	if rec.Failed() {
+		return syslog.LOG_WARNING
+	}
+	return syslog.LOG_INFO
+}
+
+// Emit implements sqlite3trace.Sink.
+func (s *Sink) Emit(rec *sqlite3trace.TraceRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = s.f.AppendFormat(s.buf[:0], rec)
+	msg := string(bytes.TrimRight(s.buf, "\n"))
+	// The Writer methods keep the facility given to Dial.
+	switch s.severity(rec) & 0x07 {
+	case syslog.LOG_EMERG:
+		return s.w.Emerg(msg)
+	case syslog.LOG_ALERT:
+		return s.w.Alert(msg)
+	case syslog.LOG_CRIT:
+		return s.w.Crit(msg)
+	case syslog.LOG_ERR:
+		return s.w.Err(msg)
+	case syslog.LOG_WARNING:
+		return s.w.Warning(msg)
+	case syslog.LOG_NOTICE:
+		return s.w.Notice(msg)
+	case syslog.LOG_DEBUG:
+		return s.w.Debug(msg)
+	}
+	return s.w.Info(msg)
+}
+
+// Close closes the connection to syslog.
+func (s *Sink) Close() error {
+	return s.w.Close()
+}
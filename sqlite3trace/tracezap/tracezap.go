@@ -0,0 +1,85 @@
+// Package tracezap is a sqlite3trace.Sink writing trace events through
+// a *zap.Logger with typed fields.
+package tracezap
+
+import (
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3trace"
+)
+
+// Sink writes each event as a log entry whose fields are the main
+// fields of sqlite3trace.TraceRecord under their JSON names, plus
+// "duration" for Profile events. Events reporting a database error are
+// logged at Warn level, the others at the Sink's level.
+type Sink struct {
+	log   *zap.Logger
+	msg   string
+	level zapcore.Level
+}
+
+var _ sqlite3trace.Sink = (*Sink)(nil)
+
+// New returns a Sink logging to log at level, with message msg
+// ("" means "sqlite3 trace").
+func New(log *zap.Logger, level zapcore.Level, msg string) *Sink {
+	if msg == "" {
+		msg = "sqlite3 trace"
+	}
+	return &Sink{log: log, msg: msg, level: level}
+}
+
+// Emit implements sqlite3trace.Sink.
+func (s *Sink) Emit(rec *sqlite3trace.TraceRecord) error {
+	level := s.level
+	if rec.Failed() && level < zapcore.WarnLevel {
+		level = zapcore.WarnLevel
+	}
+	ce := s.log.Check(level, s.msg)
+	if ce == nil {
+		return nil // level disabled: skip building the fields
+	}
+	ce.Time = rec.Time
+	fields := []zap.Field{
+		zap.String("event", rec.Event),
+		zap.Stringer("conn", rec.Conn),
+	}
+	if rec.ConnLabel != "" {
+		fields = append(fields, zap.String("conn_label", rec.ConnLabel))
+	}
+	if rec.Stmt != 0 {
+		fields = append(fields, zap.Stringer("stmt", rec.Stmt))
+	}
+	if rec.SQL != "" {
+		fields = append(fields, zap.String("sql", rec.SQL))
+	}
+	if rec.ExpandedSQL != "" {
+		fields = append(fields, zap.String("expanded_sql", rec.ExpandedSQL))
+	}
+	if rec.EventCode == sqlite3.TraceProfile {
+		fields = append(fields,
+			zap.Int64("ns", rec.NS),
+			zap.Duration("duration", time.Duration(rec.NS)))
+	}
+	if rec.Begin != nil {
+		fields = append(fields, zap.Time("begin", *rec.Begin))
+	}
+	if rec.Rows != 0 {
+		fields = append(fields, zap.Int64("rows", rec.Rows))
+	}
+	if rec.Failed() {
+		fields = append(fields,
+			zap.Int("err_code", rec.ErrCode),
+			zap.Int("err_extended", rec.ErrExtended),
+			zap.String("err_name", rec.ErrName))
+	}
+	if rec.Tags != nil {
+		fields = append(fields, zap.Any("tags", rec.Tags))
+	}
+	ce.Write(fields...)
+	return nil
+}
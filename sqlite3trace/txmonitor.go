@@ -0,0 +1,264 @@
+package sqlite3trace
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3metrics"
+	"github.com/gimpldo/sqlite3-util-go/sqlite3stats"
+)
+
+// TxMonitorOptions configure a TxMonitor.
+type TxMonitorOptions struct {
+	// KeepBusy is the number of recent BUSY events kept (0 means 32).
+	KeepBusy int
+
+	// Metrics, if not nil, records lock waits in
+	// sqlite3_trace_lock_wait_seconds and counts BUSY errors in
+	// sqlite3_trace_busy_total.
+	Metrics *sqlite3metrics.Registry
+}
+
+// TxMonitor is a trace pipeline stage for diagnosing stalls on the
+// database write lock: it measures how long transactions waited to
+// get the lock, remembers which statements failed with SQLITE_BUSY
+// and what the other connections were doing at the time,
+// and follows the open transactions.
+//
+// Lock waits are measured on BEGIN IMMEDIATE and BEGIN EXCLUSIVE,
+// which do nothing but wait for the lock (with busy_timeout set);
+// a deferred transaction waits in its first write statement,
+// where the wait cannot be told apart from the work.
+//
+// Transactions are followed through the AutoCommit flag of the events,
+// so the mask must include Stmt and Profile (and Close, to forget
+// closed connections).
+type TxMonitor struct {
+	keepBusy int
+	waits    sqlite3metrics.Histogram
+	busyN    sqlite3metrics.Counter
+	texts    stmtTracker
+
+	mu       sync.Mutex
+	waitHist Histogram
+	open     map[uintptr]*txState
+	busy     []BusyEvent // ring of the last keepBusy events
+	busyNext int
+	busyAll  int64
+}
+
+type txState struct {
+	start   time.Time
+	lastSQL string
+	writing bool
+}
+
+// OpenTx describes a transaction open at the time of a snapshot.
+type OpenTx struct {
+	Conn    uintptr       `json:"conn"`
+	Start   time.Time     `json:"start"`
+	Age     time.Duration `json:"age_ns"`
+	Writing bool          `json:"writing"`  // it ran a statement that may write
+	LastSQL string        `json:"last_sql"` // the statement it ran last
+}
+
+// BusyEvent describes a statement that failed with SQLITE_BUSY.
+type BusyEvent struct {
+	Time time.Time     `json:"time"`
+	Conn uintptr       `json:"conn"`
+	SQL  string        `json:"sql"`
+	Wait time.Duration `json:"wait_ns"` // time spent in the statement
+	// Holders are the other transactions that had run a possibly
+	// writing statement: the lock holder is among them,
+	// unless it runs in another process.
+	Holders []OpenTx `json:"holders,omitempty"`
+}
+
+// TxStats is a snapshot of a TxMonitor.
+type TxStats struct {
+	LockWaits  LatencyStats `json:"lock_waits"`
+	BusyTotal  int64        `json:"busy_total"`
+	RecentBusy []BusyEvent  `json:"recent_busy"` // newest first
+	Open       []OpenTx     `json:"open"`        // oldest first
+}
+
+// NewTxMonitor returns a TxMonitor.
+func NewTxMonitor(opts TxMonitorOptions) *TxMonitor {
+	if opts.KeepBusy <= 0 {
+		opts.KeepBusy = 32
+	}
+	m := sqlite3metrics.OrNop(opts.Metrics)
+	return &TxMonitor{
+		keepBusy: opts.KeepBusy,
+		waits: m.Histogram("trace", "lock_wait_seconds",
+			"Time BEGIN IMMEDIATE/EXCLUSIVE waited for the write lock.", nil),
+		busyN: m.Counter("trace", "busy_total",
+			"Statements that failed with SQLITE_BUSY."),
+		open: make(map[uintptr]*txState),
+	}
+}
+
+// Callback returns a trace callback following transactions and
+// then passing every event to next (which may be nil).
+func (t *TxMonitor) Callback(next sqlite3.TraceUserCallback) sqlite3.TraceUserCallback {
+	next = orNop(next)
+	return func(info sqlite3.TraceInfo) int {
+		t.texts.fill(&info)
+		t.observe(info, time.Now())
+		return next(info)
+	}
+}
+
+func (t *TxMonitor) observe(info sqlite3.TraceInfo, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch info.EventCode {
+	case sqlite3.TraceClose:
+		delete(t.open, info.ConnHandle)
+		return
+	case sqlite3.TraceStmt, sqlite3.TraceProfile:
+	default:
+		return
+	}
+	if strings.HasPrefix(info.StmtOrTrigger, "--") {
+		return // trigger program, part of the current statement
+	}
+
+	tx := t.open[info.ConnHandle]
+	if info.AutoCommit {
+		// Either no transaction, or it just ended (the Profile event
+		// of COMMIT/ROLLBACK comes after it took effect).
+		delete(t.open, info.ConnHandle)
+	} else if tx == nil {
+		start := now
+		if info.EventCode == sqlite3.TraceProfile {
+			start = now.Add(-time.Duration(info.RunTimeNanosec))
+		}
+		tx = &txState{start: start}
+		t.open[info.ConnHandle] = tx
+	}
+	if tx != nil && info.EventCode == sqlite3.TraceStmt {
+		tx.lastSQL = info.StmtOrTrigger
+		if mayWrite(info.StmtOrTrigger) {
+			tx.writing = true
+		}
+	}
+
+	if info.EventCode != sqlite3.TraceProfile {
+		return
+	}
+	if isLockingBegin(info.StmtOrTrigger) {
+		t.waitHist.Record(info.RunTimeNanosec)
+		t.waits.Observe(time.Duration(info.RunTimeNanosec).Seconds())
+	}
+	if info.DBError.Code == sqlite3.ErrBusy {
+		t.recordBusy(info, now)
+	}
+}
+
+func (t *TxMonitor) recordBusy(info sqlite3.TraceInfo, now time.Time) {
+	ev := BusyEvent{
+		Time: now,
+		Conn: info.ConnHandle,
+		SQL:  info.StmtOrTrigger,
+		Wait: time.Duration(info.RunTimeNanosec),
+	}
+	for conn, tx := range t.open {
+		if conn != info.ConnHandle && tx.writing {
+			ev.Holders = append(ev.Holders, tx.describe(conn, now))
+		}
+	}
+	sortOpen(ev.Holders)
+
+	if len(t.busy) < t.keepBusy {
+		t.busy = append(t.busy, ev)
+	} else {
+		t.busy[t.busyNext] = ev
+	}
+	t.busyNext = (t.busyNext + 1) % t.keepBusy
+	t.busyAll++
+	t.busyN.Add(1)
+}
+
+func (tx *txState) describe(conn uintptr, now time.Time) OpenTx {
+	return OpenTx{
+		Conn:    conn,
+		Start:   tx.start,
+		Age:     now.Sub(tx.start),
+		Writing: tx.writing,
+		LastSQL: tx.lastSQL,
+	}
+}
+
+func sortOpen(txs []OpenTx) {
+	sort.Slice(txs, func(i, j int) bool { return txs[i].Start.Before(txs[j].Start) })
+}
+
+// isLockingBegin reports whether sql is BEGIN IMMEDIATE or BEGIN EXCLUSIVE.
+func isLockingBegin(sql string) bool {
+	toks := sqlite3lex.SignificantTokens(sql)
+	return len(toks) >= 2 && toks[0].Is("BEGIN") &&
+		(toks[1].Is("IMMEDIATE") || toks[1].Is("EXCLUSIVE"))
+}
+
+// mayWrite reports whether sql may take the write lock; it errs
+// on the side of yes for statements it does not recognize.
+func mayWrite(sql string) bool {
+	switch sqlite3lex.FirstKeyword(sql) {
+	case "SELECT", "VALUES", "EXPLAIN", "BEGIN", "COMMIT", "END", "ROLLBACK",
+		"SAVEPOINT", "RELEASE":
+		return isLockingBegin(sql)
+	case "WITH":
+		// A CTE may prefix INSERT/UPDATE/DELETE: look for them.
+		for _, tok := range sqlite3lex.SignificantTokens(sql) {
+			if tok.Is("INSERT") || tok.Is("UPDATE") || tok.Is("DELETE") || tok.Is("REPLACE") {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Stats returns a snapshot: lock wait percentiles, recent BUSY events
+// and the open transactions.
+func (t *TxMonitor) Stats() *TxStats {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := &TxStats{
+		LockWaits: statsOf("", "", &t.waitHist),
+		BusyTotal: t.busyAll,
+	}
+	for i := 1; i <= len(t.busy); i++ {
+		j := (t.busyNext - i + len(t.busy)) % len(t.busy)
+		s.RecentBusy = append(s.RecentBusy, t.busy[j])
+	}
+	for conn, tx := range t.open {
+		s.Open = append(s.Open, tx.describe(conn, now))
+	}
+	sortOpen(s.Open)
+	return s
+}
+
+// Oldest returns the longest-open transaction;
+// the second result is false if none is open.
+func (t *TxMonitor) Oldest() (OpenTx, bool) {
+	s := t.Stats()
+	if len(s.Open) == 0 {
+		return OpenTx{}, false
+	}
+	return s.Open[0], true
+}
+
+// Source returns Stats as a sqlite3stats.Source, to serve the snapshot
+// from the stats debug endpoint.
+func (t *TxMonitor) Source() sqlite3stats.Source {
+	return func() interface{} { return t.Stats() }
+}
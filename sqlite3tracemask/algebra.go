@@ -0,0 +1,31 @@
+package sqlite3tracemask
+
+// Union returns the events in c or in other.
+func (c Config) Union(other Config) Config {
+	return Config{
+		Stmt:    c.Stmt || other.Stmt,
+		Profile: c.Profile || other.Profile,
+		Row:     c.Row || other.Row,
+		Close:   c.Close || other.Close,
+	}
+}
+
+// Intersect returns the events in both c and other.
+func (c Config) Intersect(other Config) Config {
+	return Config{
+		Stmt:    c.Stmt && other.Stmt,
+		Profile: c.Profile && other.Profile,
+		Row:     c.Row && other.Row,
+		Close:   c.Close && other.Close,
+	}
+}
+
+// Subtract returns the events in c but not in other.
+func (c Config) Subtract(other Config) Config {
+	return Config{
+		Stmt:    c.Stmt && !other.Stmt,
+		Profile: c.Profile && !other.Profile,
+		Row:     c.Row && !other.Row,
+		Close:   c.Close && !other.Close,
+	}
+}
@@ -0,0 +1,205 @@
+package sqlite3tracemask
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// AtomicMask is a trace mask that can be changed while the program
+// runs, taking effect on the connections already open, e.g. to turn
+// on Row events for a few minutes of debugging from an admin endpoint
+// or a signal handler.
+//
+// Its connections are those opened through its Driver, which keeps
+// them in a registry. Store calls SetTrace with the new mask on the
+// connections idle in the pool; those in use get it when they go back
+// to the pool (a *sql.Conn held for long gets it when closed). SetTrace
+// is never called on a connection while it runs statements or is being
+// closed, which would be unsafe. SQLite is asked for the events of the
+// current mask only, so events turned off cost nothing.
+type AtomicMask struct {
+	v atomic.Value // Config
+
+	mu    sync.Mutex
+	conns map[*maskConn]struct{}
+}
+
+// NewAtomicMask returns an AtomicMask holding c.
+func NewAtomicMask(c Config) *AtomicMask {
+	m := &AtomicMask{conns: make(map[*maskConn]struct{})}
+	m.v.Store(c)
+	return m
+}
+
+// Load returns the current mask.
+func (m *AtomicMask) Load() Config {
+	return m.v.Load().(Config)
+}
+
+// EventMask returns the current mask as Config.EventMask does.
+func (m *AtomicMask) EventMask() uint {
+	c := m.Load()
+	return c.EventMask()
+}
+
+// Store makes c the current mask and applies it to the idle
+// connections, returning the first SetTrace error (the connections
+// that failed try again when next taken from the pool). It must not
+// be called from a trace callback.
+func (m *AtomicMask) Store(c Config) error {
+	m.v.Store(c)
+	m.mu.Lock()
+	conns := make([]*maskConn, 0, len(m.conns))
+	for conn := range m.conns {
+		conns = append(conns, conn)
+	}
+	m.mu.Unlock()
+
+	var first error
+	for _, conn := range conns {
+		conn.mu.Lock()
+		if conn.idle {
+			if err := conn.apply(); err != nil && first == nil {
+				first = err
+			}
+		}
+		conn.mu.Unlock()
+	}
+	return first
+}
+
+// Conns returns the number of open connections of the Driver.
+func (m *AtomicMask) Conns() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.conns)
+}
+
+// Driver returns a driver opening connections with d (whose
+// connections must be *sqlite3.SQLiteConn, as those of
+// sqlite3.SQLiteDriver) and installing callback (which may be nil)
+// with the current mask on them, for sql.Register:
+//
+//	sql.Register("sqlite3_traced", mask.Driver(&sqlite3.SQLiteDriver{}, callback, false))
+func (m *AtomicMask) Driver(d driver.Driver, callback sqlite3.TraceUserCallback, wantExpandedSQL bool) driver.Driver {
+	return maskDriver{d: d, m: m, callback: callback, expanded: wantExpandedSQL}
+}
+
+type maskDriver struct {
+	d        driver.Driver
+	m        *AtomicMask
+	callback sqlite3.TraceUserCallback
+	expanded bool
+}
+
+func (d maskDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.d.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	sc, ok := conn.(*sqlite3.SQLiteConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("sqlite3tracemask: unexpected driver connection %T", conn)
+	}
+	c := &maskConn{SQLiteConn: sc, m: d.m, callback: d.callback, expanded: d.expanded}
+	if err := c.apply(); err != nil {
+		sc.Close()
+		return nil, err
+	}
+	// A Store between apply and here is applied when c is returned.
+	d.m.mu.Lock()
+	d.m.conns[c] = struct{}{}
+	d.m.mu.Unlock()
+	return c, nil
+}
+
+// maskConn is a connection of an AtomicMask's Driver. database/sql
+// calls IsValid when it returns to the pool and ResetSession when it
+// is taken again: in between, it is idle and Store may change its mask.
+type maskConn struct {
+	*sqlite3.SQLiteConn
+	m        *AtomicMask
+	callback sqlite3.TraceUserCallback
+	expanded bool
+
+	mu     sync.Mutex
+	idle   bool
+	closed bool
+	mask   uint // installed
+}
+
+func (c *maskConn) Unwrap() *sqlite3.SQLiteConn { return c.SQLiteConn }
+
+// apply installs the current mask if it is not installed yet;
+// c.mu is held or c not shared yet.
+func (c *maskConn) apply() error {
+	mask := c.m.EventMask()
+	if c.callback == nil {
+		mask = 0
+	}
+	if c.closed || mask == c.mask {
+		return nil
+	}
+	var tc *sqlite3.TraceConfig
+	if mask != 0 {
+		tc = &sqlite3.TraceConfig{
+			Callback:        c.callback,
+			EventMask:       mask,
+			WantExpandedSQL: c.expanded,
+		}
+	}
+	if err := c.SetTrace(tc); err != nil {
+		return fmt.Errorf("sqlite3tracemask: %w", err)
+	}
+	c.mask = mask
+	return nil
+}
+
+// IsValid implements driver.Validator: the connection goes back to the
+// pool, with the current mask (or is discarded if that fails).
+func (c *maskConn) IsValid() bool {
+	if v, ok := interface{}(c.SQLiteConn).(driver.Validator); ok && !v.IsValid() {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.apply() != nil {
+		return false
+	}
+	c.idle = true
+	return true
+}
+
+// ResetSession implements driver.SessionResetter: the connection is
+// taken from the pool.
+func (c *maskConn) ResetSession(ctx context.Context) error {
+	c.mu.Lock()
+	c.idle = false
+	err := c.apply()
+	c.mu.Unlock()
+	if err != nil {
+		return driver.ErrBadConn
+	}
+	if r, ok := interface{}(c.SQLiteConn).(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// Close leaves the registry first, so that no Store runs SetTrace
+// on the connection while SQLite closes it.
+func (c *maskConn) Close() error {
+	c.m.mu.Lock()
+	delete(c.m.conns, c)
+	c.m.mu.Unlock()
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	return c.SQLiteConn.Close()
+}
@@ -0,0 +1,23 @@
+package sqlite3tracemask
+
+// AddEvents returns mask with the events (sqlite3.TraceStmt, ...) added,
+// for callers holding a raw mask such as sqlite3.TraceConfig.EventMask.
+func AddEvents(mask uint, events ...uint) uint {
+	for _, e := range events {
+		mask |= e
+	}
+	return mask
+}
+
+// RemoveEvents returns mask without the events.
+func RemoveEvents(mask uint, events ...uint) uint {
+	for _, e := range events {
+		mask &^= e
+	}
+	return mask
+}
+
+// HasEvent reports whether mask has all the bits of event.
+func HasEvent(mask, event uint) bool {
+	return event != 0 && mask&event == event
+}
@@ -0,0 +1,61 @@
+package sqlite3tracemask
+
+// Builder builds a Config by chaining, for programs that set tracing
+// up in code rather than from flags:
+//
+//	c := sqlite3tracemask.NewMask().Stmt().Profile().Build()
+type Builder struct {
+	c Config
+}
+
+// NewMask returns a Builder with no events.
+func NewMask() *Builder {
+	return &Builder{}
+}
+
+// Stmt adds the Stmt event.
+func (b *Builder) Stmt() *Builder {
+	b.c.Stmt = true
+	return b
+}
+
+// Profile adds the Profile event.
+func (b *Builder) Profile() *Builder {
+	b.c.Profile = true
+	return b
+}
+
+// Row adds the Row event.
+func (b *Builder) Row() *Builder {
+	b.c.Row = true
+	return b
+}
+
+// Close adds the Close event.
+func (b *Builder) Close() *Builder {
+	b.c.Close = true
+	return b
+}
+
+// All adds every event.
+func (b *Builder) All() *Builder {
+	b.c = Config{Stmt: true, Profile: true, Row: true, Close: true}
+	return b
+}
+
+// With adds the events of c.
+func (b *Builder) With(c Config) *Builder {
+	b.c = b.c.Union(c)
+	return b
+}
+
+// Without removes the events of c.
+func (b *Builder) Without(c Config) *Builder {
+	b.c = b.c.Subtract(c)
+	return b
+}
+
+// Build returns the Config built; b can go on being used.
+func (b *Builder) Build() Config {
+	return b.c
+}
@@ -0,0 +1,71 @@
+package sqlite3tracemask
+
+import "strings"
+
+// CompletionKind says what a Completion value is.
+type CompletionKind string
+
+// Completion kinds.
+const (
+	CodeCompletion   CompletionKind = "code"   // letter of the short form
+	NameCompletion   CompletionKind = "name"   // name of the long form
+	PresetCompletion CompletionKind = "preset" // name of DefaultPresets, for Preset
+)
+
+// Completion is a valid mask value, for shell completion
+// (cobra's ValidArgsFunction, zsh _describe, ...).
+type Completion struct {
+	Value       string
+	Description string
+	Kind        CompletionKind
+}
+
+// Completions returns the short codes, the long names and the presets.
+func Completions() []Completion {
+	var comps []Completion
+	for _, e := range (Config{}).events() {
+		desc := strings.TrimPrefix(e.usage, "Event: ")
+		name := strings.ToLower(e.name)
+		comps = append(comps,
+			Completion{Value: name[:1], Description: desc, Kind: CodeCompletion},
+			Completion{Value: name, Description: desc, Kind: NameCompletion})
+	}
+	comps = append(comps,
+		Completion{Value: "a", Description: "all events", Kind: CodeCompletion},
+		Completion{Value: "all", Description: "all events", Kind: NameCompletion})
+	for _, name := range PresetNames() {
+		c, _ := Preset(name)
+		comps = append(comps, Completion{Value: name, Description: c.String(), Kind: PresetCompletion})
+	}
+	return comps
+}
+
+// CompleteNames returns the completions of a partly typed long form
+// mask: for "stmt,pr", "stmt,profile". Names already in it
+// are not offered again.
+func CompleteNames(toComplete string) []string {
+	head, last := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		head, last = toComplete[:i+1], toComplete[i+1:]
+	}
+	neg := strings.HasPrefix(last, "-")
+	if neg {
+		last = last[1:]
+	}
+	used := map[string]bool{}
+	for _, n := range strings.Split(head, ",") {
+		used[strings.TrimPrefix(strings.TrimSpace(n), "-")] = true
+	}
+	var out []string
+	for _, c := range Completions() {
+		if c.Kind != NameCompletion || used[c.Value] || !strings.HasPrefix(c.Value, strings.ToLower(last)) {
+			continue
+		}
+		if neg {
+			out = append(out, head+"-"+c.Value)
+		} else {
+			out = append(out, head+c.Value)
+		}
+	}
+	return out
+}
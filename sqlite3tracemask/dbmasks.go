@@ -0,0 +1,120 @@
+package sqlite3tracemask
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// DBMasks choose the trace mask of each connection by the database it
+// opens, for processes using several SQLite files: trace the one being
+// investigated at full verbosity and the others quietly.
+// It is safe for concurrent use.
+type DBMasks struct {
+	mu    sync.RWMutex
+	rules []dbMaskRule
+	def   Config
+}
+
+type dbMaskRule struct {
+	pattern string
+	c       Config
+}
+
+// NewDBMasks returns DBMasks giving def to databases no rule matches.
+func NewDBMasks(def Config) *DBMasks {
+	return &DBMasks{def: def}
+}
+
+// Add gives c to the databases matching pattern, a filepath.Match
+// pattern tried against the whole filename and against its base name:
+// "/srv/app/cache/*.db", "orders.db" ('*' does not match '/', so a
+// directory must be given in full). In-memory and temporary databases
+// are named ":memory:". Rules are tried in the order they were added.
+func (m *DBMasks) Add(pattern string, c Config) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("sqlite3tracemask: pattern %q: %w", pattern, err)
+	}
+	m.mu.Lock()
+	m.rules = append(m.rules, dbMaskRule{pattern, c})
+	m.mu.Unlock()
+	return nil
+}
+
+// Match returns the mask of the database filename.
+func (m *DBMasks) Match(filename string) Config {
+	if filename == "" {
+		filename = ":memory:"
+	}
+	base := filepath.Base(filename)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if ok, _ := filepath.Match(r.pattern, filename); ok {
+			return r.c
+		}
+		if ok, _ := filepath.Match(r.pattern, base); ok {
+			return r.c
+		}
+	}
+	return m.def
+}
+
+// ConnectHook returns a function, to use as (or call from)
+// sqlite3.SQLiteDriver.ConnectHook, that installs callback with the
+// mask matching the main database of the connection (if not empty).
+// Rules added later apply to the connections opened later.
+func (m *DBMasks) ConnectHook(callback sqlite3.TraceUserCallback, wantExpandedSQL bool) func(*sqlite3.SQLiteConn) error {
+	return func(conn *sqlite3.SQLiteConn) error {
+		filename, err := mainFilename(conn)
+		if err != nil {
+			return fmt.Errorf("sqlite3tracemask: %w", err)
+		}
+		c := m.Match(filename)
+		mask := c.EventMask()
+		if mask == 0 || callback == nil {
+			return nil
+		}
+		return conn.SetTrace(&sqlite3.TraceConfig{
+			Callback:        callback,
+			EventMask:       mask,
+			WantExpandedSQL: wantExpandedSQL,
+		})
+	}
+}
+
+// mainFilename returns the file of the main database of conn
+// ("" if in memory or temporary).
+func mainFilename(conn *sqlite3.SQLiteConn) (string, error) {
+	rows, err := conn.Query("PRAGMA database_list", nil)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	row := make([]driver.Value, len(rows.Columns())) // seq, name, file
+	for {
+		if err := rows.Next(row); err == io.EOF {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		if len(row) < 3 || string(asBytes(row[1])) != "main" {
+			continue
+		}
+		return string(asBytes(row[2])), nil
+	}
+}
+
+func asBytes(v driver.Value) []byte {
+	switch v := v.(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package sqlite3tracemask
+
+import (
+	"fmt"
+	"strings"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// Usage messages are based on SQLite 3.14 documentation
+// (as of September 2, 2016) for SQL Trace Hook = sqlite3_trace_v2().
+const (
+	stmtUsage    = "Event: statement first begins running, possibly the start of each trigger subprogram"
+	profileUsage = "Event: statement finishes, gives estimated number of nanoseconds it took to run"
+	rowUsage     = "Event: a statement generates a single row of result"
+	closeUsage   = "Event: database connection closes"
+)
+
+type eventDesc struct {
+	name  string
+	on    bool
+	usage string
+}
+
+func (c Config) events() []eventDesc {
+	return []eventDesc{
+		{"Stmt", c.Stmt, stmtUsage},
+		{"Profile", c.Profile, profileUsage},
+		{"Row", c.Row, rowUsage},
+		{"Close", c.Close, closeUsage},
+	}
+}
+
+// String returns the enabled events as "Stmt|Profile", or "none".
+func (c Config) String() string {
+	var sf []string
+	for _, e := range c.events() {
+		if e.on {
+			sf = append(sf, e.name)
+		}
+	}
+	if len(sf) == 0 {
+		return "none"
+	}
+	return strings.Join(sf, "|")
+}
+
+// Describe returns one line per enabled event, naming it and saying
+// when SQLite reports it, for logs and help output.
+func (c Config) Describe() string {
+	var b strings.Builder
+	for _, e := range c.events() {
+		if e.on {
+			b.WriteString(e.name + ": " + strings.TrimPrefix(e.usage, "Event: ") + "\n")
+		}
+	}
+	if b.Len() == 0 {
+		return "No trace events.\n"
+	}
+	return b.String()
+}
+
+// EventName returns the name of a trace event code (TraceInfo.EventCode):
+// "Stmt", "Profile", "Row" or "Close"; other codes in hex, "0x20".
+func EventName(code uint32) string {
+	switch uint(code) {
+	case sqlite3.TraceStmt:
+		return "Stmt"
+	case sqlite3.TraceProfile:
+		return "Profile"
+	case sqlite3.TraceRow:
+		return "Row"
+	case sqlite3.TraceClose:
+		return "Close"
+	}
+	return fmt.Sprintf("0x%x", code)
+}
+
+// EventNames returns the names of the events of mask, in bit order;
+// the bits of no known event come last, together in hex.
+func EventNames(mask uint) []string {
+	c, err := FromEventMask(mask)
+	names := []string{}
+	for _, e := range c.events() {
+		if e.on {
+			names = append(names, e.name)
+		}
+	}
+	if err != nil {
+		names = append(names, fmt.Sprintf("0x%x", mask&^c.EventMask()))
+	}
+	return names
+}
+
+// UsageText documents the mask syntax (short codes, long names and
+// the presets of DefaultPresets) in one block, for a program's help.
+func UsageText() string {
+	var b strings.Builder
+	b.WriteString("SQLite trace events, as letters (\"sp\") or comma-separated names (\"stmt,profile\"):\n")
+	for _, e := range (Config{}).events() {
+		fmt.Fprintf(&b, "  %c  %-8s %s\n", strings.ToLower(e.name)[0], strings.ToLower(e.name),
+			strings.TrimPrefix(e.usage, "Event: "))
+	}
+	b.WriteString("  a  all      all of the above ('*' too)\n")
+	b.WriteString("Uppercase letters, or letters after '-' (until '+'), clear events: \"a-r\" is all but Row;\n")
+	b.WriteString("so does '-' before a name: \"all,-row\".\n")
+	if names := PresetNames(); len(names) > 0 {
+		b.WriteString("Presets:\n")
+		for _, name := range names {
+			c, _ := Preset(name)
+			fmt.Fprintf(&b, "  %-10s %s\n", name, c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,26 @@
+package sqlite3tracemask
+
+import "strings"
+
+// Equal reports whether a and b have the same events.
+func Equal(a, b Config) bool {
+	return a == b
+}
+
+// Diff describes how b differs from a, as the events added and
+// removed: "+Row -Close"; "" when they are equal. It suits logging
+// a mask change: log.Printf("trace mask changed: %s", Diff(old, new)).
+func Diff(a, b Config) string {
+	var sf []string
+	for _, e := range b.Subtract(a).events() {
+		if e.on {
+			sf = append(sf, "+"+e.name)
+		}
+	}
+	for _, e := range a.Subtract(b).events() {
+		if e.on {
+			sf = append(sf, "-"+e.name)
+		}
+	}
+	return strings.Join(sf, " ")
+}
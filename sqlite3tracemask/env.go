@@ -0,0 +1,45 @@
+package sqlite3tracemask
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FromEnv builds a Config from environment variables: the short form
+// in <prefix>_TRACE_MASK (e.g. SQLITE_TRACE_MASK=sp) and per-event
+// booleans <prefix>_TRACE_STMT, _TRACE_PROFILE, _TRACE_ROW and
+// _TRACE_CLOSE (anything strconv.ParseBool accepts), combined like the
+// flags. An empty prefix means "SQLITE".
+func FromEnv(prefix string) (Config, error) {
+	if prefix == "" {
+		prefix = "SQLITE"
+	}
+	var c Config
+	if err := DecodeStringArgStrict(&c, os.Getenv(prefix+"_TRACE_MASK")); err != nil {
+		return Config{}, fmt.Errorf("%s_TRACE_MASK: %w", prefix, err)
+	}
+
+	for _, b := range []struct {
+		name string
+		dest *bool
+	}{
+		{"_TRACE_STMT", &c.Stmt},
+		{"_TRACE_PROFILE", &c.Profile},
+		{"_TRACE_ROW", &c.Row},
+		{"_TRACE_CLOSE", &c.Close},
+	} {
+		v, ok := os.LookupEnv(prefix + b.name)
+		if !ok || v == "" {
+			continue
+		}
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("sqlite3tracemask: %s%s=%q: not a boolean", prefix, b.name, v)
+		}
+		if on {
+			*b.dest = true
+		}
+	}
+	return c, nil
+}
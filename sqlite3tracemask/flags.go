@@ -0,0 +1,97 @@
+package sqlite3tracemask
+
+import (
+	"flag"
+	"strings"
+)
+
+// FlagOptions change how the flags are registered and generated.
+type FlagOptions struct {
+	// FlagSet receives the flags; nil means flag.CommandLine.
+	FlagSet *flag.FlagSet
+	// Prefix is prepended to the flag names, e.g. "sqlite-" for
+	// --sqlite-trace-stmt and --sqlite-trace-mask, to avoid collisions
+	// with an application's own --trace-* flags.
+	Prefix string
+}
+
+func (o FlagOptions) flagSet() *flag.FlagSet {
+	if o.FlagSet == nil {
+		return flag.CommandLine
+	}
+	return o.FlagSet
+}
+
+// PrepareBoolArgsParsing registers the flags of PrepareBoolArgsParsing.
+func (o FlagOptions) PrepareBoolArgsParsing(dest *Config) {
+	fs := o.flagSet()
+	fs.BoolVar(&dest.Stmt, o.Prefix+stmtArg, false, stmtUsage)
+	fs.BoolVar(&dest.Profile, o.Prefix+profileArg, false, profileUsage)
+	fs.BoolVar(&dest.Row, o.Prefix+rowArg, false, rowUsage)
+	fs.BoolVar(&dest.Close, o.Prefix+closeArg, false, closeUsage)
+}
+
+// PrepareStringArgParsing registers the flag of PrepareStringArgParsing.
+func (o FlagOptions) PrepareStringArgParsing(dest *string) {
+	o.flagSet().StringVar(dest, o.Prefix+"trace-mask", "",
+		"Supported SQLite trace event codes: s=Stmt, p=Profile, r=Row, c=Close, a=all"+
+			" (uppercase, or after '-', to clear); or names: stmt,profile,row,close,all")
+}
+
+// PrepareHookBoolArgsParsing registers the flags of PrepareHookBoolArgsParsing.
+func (o FlagOptions) PrepareHookBoolArgsParsing(dest *HookConfig) {
+	o.PrepareBoolArgsParsing(&dest.Trace)
+	fs := o.flagSet()
+	fs.BoolVar(&dest.Update, o.Prefix+updateArg, false,
+		"Hook: a row is inserted, updated or deleted (not for WITHOUT ROWID tables)")
+	fs.BoolVar(&dest.Commit, o.Prefix+commitArg, false,
+		"Hook: a transaction is about to commit")
+	fs.BoolVar(&dest.Rollback, o.Prefix+rollbackArg, false,
+		"Hook: a transaction is rolled back")
+	fs.BoolVar(&dest.WAL, o.Prefix+walArg, false,
+		"Hook: a transaction was committed to the WAL")
+}
+
+// PrepareHookStringArgParsing registers the flag of PrepareHookStringArgParsing.
+func (o FlagOptions) PrepareHookStringArgParsing(dest *string) {
+	o.flagSet().StringVar(dest, o.Prefix+"hook-mask", "",
+		"SQLite trace events and hooks: s=Stmt, p=Profile, r=Row, c=Close,"+
+			" u=Update, m=Commit, b=Rollback, w=WAL, a=all (uppercase, or after '-', to clear);"+
+			" or names: stmt,...,update,commit,rollback,wal,all")
+}
+
+// GenerateBoolArgs returns the long form of c with the flag names of o.
+func (o FlagOptions) GenerateBoolArgs(c *Config) string {
+	return "--" + strings.Join(o.boolArgs(c), " --")
+}
+
+// GenerateHookBoolArgs returns the long form of h with the flag names of o.
+func (o FlagOptions) GenerateHookBoolArgs(h *HookConfig) string {
+	sf := o.boolArgs(&h.Trace)
+	for _, f := range []struct {
+		on   bool
+		name string
+	}{{h.Update, updateArg}, {h.Commit, commitArg}, {h.Rollback, rollbackArg}, {h.WAL, walArg}} {
+		if f.on {
+			sf = append(sf, o.Prefix+f.name)
+		}
+	}
+	return "--" + strings.Join(sf, " --")
+}
+
+func (o FlagOptions) boolArgs(c *Config) []string {
+	sf := []string{} // 'sf' stands for "String Fragments"
+	if c.Stmt {
+		sf = append(sf, o.Prefix+stmtArg)
+	}
+	if c.Profile {
+		sf = append(sf, o.Prefix+profileArg)
+	}
+	if c.Row {
+		sf = append(sf, o.Prefix+rowArg)
+	}
+	if c.Close {
+		sf = append(sf, o.Prefix+closeArg)
+	}
+	return sf
+}
@@ -0,0 +1,188 @@
+package sqlite3tracemask
+
+import (
+	"errors"
+	"flag"
+	"strings"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+)
+
+// HookConfig extends Config to the other observation hooks of SQLite:
+// data changes (update hook), transaction ends (commit and rollback
+// hooks) and WAL commits (WAL hook). Its short form adds the letters
+// u=Update, m=Commit, b=Rollback, w=WAL to those of Config;
+// 'a' sets everything.
+type HookConfig struct {
+	Trace    Config
+	Update   bool
+	Commit   bool
+	Rollback bool
+	WAL      bool
+}
+
+const (
+	updateArg   = "hook-update"
+	commitArg   = "hook-commit"
+	rollbackArg = "hook-rollback"
+	walArg      = "hook-wal"
+)
+
+// PrepareHookBoolArgsParsing registers the flags of Config plus
+// --hook-update, --hook-commit, --hook-rollback and --hook-wal.
+func PrepareHookBoolArgsParsing(dest *HookConfig) {
+	PrepareHookBoolArgsParsingOn(flag.CommandLine, dest)
+}
+
+// PrepareHookBoolArgsParsingOn is like PrepareHookBoolArgsParsing
+// but registers the flags on fs.
+func PrepareHookBoolArgsParsingOn(fs *flag.FlagSet, dest *HookConfig) {
+	FlagOptions{FlagSet: fs}.PrepareHookBoolArgsParsing(dest)
+}
+
+// PrepareHookStringArgParsing registers --hook-mask for the short form.
+func PrepareHookStringArgParsing(dest *string) {
+	PrepareHookStringArgParsingOn(flag.CommandLine, dest)
+}
+
+// PrepareHookStringArgParsingOn is like PrepareHookStringArgParsing
+// but registers the flag on fs.
+func PrepareHookStringArgParsingOn(fs *flag.FlagSet, dest *string) {
+	FlagOptions{FlagSet: fs}.PrepareHookStringArgParsing(dest)
+}
+
+func (h *HookConfig) setLetter(l rune, on bool) bool {
+	switch l {
+	case 'a':
+		h.Trace.setLetter(l, on)
+		h.Update, h.Commit, h.Rollback, h.WAL = on, on, on, on
+	case 'u':
+		h.Update = on
+	case 'm':
+		h.Commit = on
+	case 'b':
+		h.Rollback = on
+	case 'w':
+		h.WAL = on
+	default:
+		return h.Trace.setLetter(l, on)
+	}
+	return true
+}
+
+// DecodeHookStringArg is DecodeStringArg for HookConfig.
+func DecodeHookStringArg(dest *HookConfig, s string) {
+	decodeMask(s, dest.setLetter)
+}
+
+// DecodeHookStringArgStrict is DecodeStringArgStrict for HookConfig.
+func DecodeHookStringArgStrict(dest *HookConfig, s string) error {
+	h := *dest
+	if err := decodeMask(s, h.setLetter); err != nil {
+		return err
+	}
+	*dest = h
+	return nil
+}
+
+// GenerateStringArg returns the short form of h, "a" when all is set.
+func (h *HookConfig) GenerateStringArg() string {
+	hooks := ""
+	for _, f := range []struct {
+		on     bool
+		letter string
+	}{{h.Update, "u"}, {h.Commit, "m"}, {h.Rollback, "b"}, {h.WAL, "w"}} {
+		if f.on {
+			hooks += f.letter
+		}
+	}
+	trace := h.Trace.GenerateStringArg()
+	if trace == "a" {
+		if hooks == "umbw" {
+			return "a"
+		}
+		trace = "sprc"
+	}
+	return trace + hooks
+}
+
+// GenerateLongStringArg returns h as names, "all" when all is set.
+func (h *HookConfig) GenerateLongStringArg() string {
+	if h.GenerateStringArg() == "a" {
+		return "all"
+	}
+	sf := []string{}
+	switch s := h.Trace.GenerateLongStringArg(); s {
+	case "":
+	case "all":
+		sf = append(sf, "stmt,profile,row,close")
+	default:
+		sf = append(sf, s)
+	}
+	for _, f := range []struct {
+		on   bool
+		name string
+	}{{h.Update, "update"}, {h.Commit, "commit"}, {h.Rollback, "rollback"}, {h.WAL, "wal"}} {
+		if f.on {
+			sf = append(sf, f.name)
+		}
+	}
+	return strings.Join(sf, ",")
+}
+
+// GenerateBoolArgs returns the long form of h.
+func (h *HookConfig) GenerateBoolArgs() string {
+	return FlagOptions{}.GenerateHookBoolArgs(h)
+}
+
+// Hooks are the callbacks HookConfig.Apply registers.
+type Hooks struct {
+	Trace    sqlite3.TraceUserCallback
+	Update   func(op int, db, table string, rowid int64)
+	Commit   func() int // non-zero turns the commit into a rollback
+	Rollback func()
+	WAL      func(db string, pages int) int
+}
+
+// WALHookRegisterer is implemented by driver connections exposing
+// sqlite3_wal_hook.
+type WALHookRegisterer interface {
+	RegisterWALHook(callback func(db string, pages int) int)
+}
+
+// ErrNoWALHook is returned by Apply when WAL is set but the driver
+// connection has no WAL hook.
+var ErrNoWALHook = errors.New("sqlite3tracemask: the driver does not expose the WAL hook")
+
+// Apply registers on conn the callbacks of hooks that h enables
+// (nil callbacks are skipped), typically from a ConnectHook.
+// Registering replaces the previous hook of the same kind.
+func (h *HookConfig) Apply(conn *sqlite3.SQLiteConn, hooks Hooks) error {
+	if mask := h.Trace.EventMask(); mask != 0 && hooks.Trace != nil {
+		err := conn.SetTrace(&sqlite3.TraceConfig{
+			Callback:        hooks.Trace,
+			EventMask:       mask,
+			WantExpandedSQL: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if h.Update && hooks.Update != nil {
+		conn.RegisterUpdateHook(hooks.Update)
+	}
+	if h.Commit && hooks.Commit != nil {
+		conn.RegisterCommitHook(hooks.Commit)
+	}
+	if h.Rollback && hooks.Rollback != nil {
+		conn.RegisterRollbackHook(hooks.Rollback)
+	}
+	if h.WAL && hooks.WAL != nil {
+		w, ok := interface{}(conn).(WALHookRegisterer)
+		if !ok {
+			return ErrNoWALHook
+		}
+		w.RegisterWALHook(hooks.WAL)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package sqlite3tracemask
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// MarshalJSON encodes c in the short form, e.g. "sp".
+func (c Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.GenerateStringArg())
+}
+
+// UnmarshalJSON accepts the short form ("sp", decoded strictly)
+// or an object of booleans: {"stmt": true, "profile": true}.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		var nc Config
+		if err := DecodeStringArgStrict(&nc, s); err != nil {
+			return err
+		}
+		*c = nc
+		return nil
+	}
+
+	var obj struct {
+		Stmt    bool `json:"stmt"`
+		Profile bool `json:"profile"`
+		Row     bool `json:"row"`
+		Close   bool `json:"close"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&obj); err != nil {
+		return fmt.Errorf("sqlite3tracemask: want a mask string or an object of booleans: %w", err)
+	}
+	*c = Config(obj)
+	return nil
+}
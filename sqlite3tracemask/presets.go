@@ -0,0 +1,77 @@
+package sqlite3tracemask
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Built-in presets, in every Presets.
+var builtinPresets = map[string]Config{
+	"perf":  {Profile: true},
+	"debug": {Stmt: true, Profile: true, Row: true, Close: true},
+	"audit": {Stmt: true, Close: true},
+}
+
+// ErrUnknownPreset is returned (wrapped, with the name) by Preset.
+var ErrUnknownPreset = errors.New("sqlite3tracemask: unknown preset")
+
+// Presets name Configs by intent ("perf", "audit", ...);
+// it is safe for concurrent use.
+type Presets struct {
+	mu      sync.RWMutex
+	presets map[string]Config
+}
+
+// NewPresets returns the built-in presets: "perf" (Profile),
+// "debug" (all events) and "audit" (Stmt and Close).
+func NewPresets() *Presets {
+	p := &Presets{presets: make(map[string]Config, len(builtinPresets))}
+	for name, c := range builtinPresets {
+		p.presets[name] = c
+	}
+	return p
+}
+
+// DefaultPresets are used by the package-level functions.
+var DefaultPresets = NewPresets()
+
+// Register adds (or replaces, built-ins included) the preset name.
+func (p *Presets) Register(name string, c Config) {
+	p.mu.Lock()
+	p.presets[name] = c
+	p.mu.Unlock()
+}
+
+// Preset returns the Config of the preset name.
+func (p *Presets) Preset(name string) (Config, error) {
+	p.mu.RLock()
+	c, ok := p.presets[name]
+	p.mu.RUnlock()
+	if !ok {
+		return Config{}, fmt.Errorf("%w: %q", ErrUnknownPreset, name)
+	}
+	return c, nil
+}
+
+// Names returns the preset names, sorted.
+func (p *Presets) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.presets))
+	for name := range p.presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset returns a preset of DefaultPresets.
+func Preset(name string) (Config, error) { return DefaultPresets.Preset(name) }
+
+// RegisterPreset adds (or replaces) a preset in DefaultPresets.
+func RegisterPreset(name string, c Config) { DefaultPresets.Register(name, c) }
+
+// PresetNames returns the names of DefaultPresets.
+func PresetNames() []string { return DefaultPresets.Names() }
@@ -0,0 +1,83 @@
+package sqlite3tracemask
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Loader reads the mask to apply, for StartReloader.
+type Loader func() (Config, error)
+
+// EnvLoader reads the mask with FromEnv(prefix). The environment of a
+// running process only changes from within, so this suits programs
+// which set it themselves (e.g. from a control socket) before raising
+// SIGHUP.
+func EnvLoader(prefix string) Loader {
+	return func() (Config, error) { return FromEnv(prefix) }
+}
+
+// FileLoader reads the mask from the file path, holding a mask string
+// (short or long form, decoded strictly; blank lines and lines
+// starting with '#' are ignored, the others are combined).
+// A missing file means no events.
+func FileLoader(path string) Loader {
+	return func() (Config, error) {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return Config{}, nil
+		} else if err != nil {
+			return Config{}, fmt.Errorf("sqlite3tracemask: %w", err)
+		}
+		var c Config
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if err := DecodeStringArgStrict(&c, line); err != nil {
+				return Config{}, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		return c, nil
+	}
+}
+
+// Reload stores in m the mask read by load, returning the previous
+// mask; if load fails m is left as it was. An error of Store means
+// the mask was stored but some idle connections only get it when
+// next used.
+func Reload(m *AtomicMask, load Loader) (old Config, err error) {
+	old = m.Load()
+	c, err := load()
+	if err != nil {
+		return old, err
+	}
+	return old, m.Store(c)
+}
+
+// StartReloader reloads m with load each time the process gets SIGHUP,
+// until ctx is done, letting operators turn tracing on and off in
+// a long-running daemon. onReload, if not nil, is called after each
+// reload (with the error of Reload), e.g. to log Diff(old, new).
+func StartReloader(ctx context.Context, m *AtomicMask, load Loader, onReload func(old, new Config, err error)) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sig:
+			}
+			old, err := Reload(m, load)
+			if onReload != nil {
+				onReload(old, m.Load(), err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,32 @@
+package sqlite3tracemask
+
+import "fmt"
+
+// Settings are trace settings as found in a configuration file
+// (see the traceconf subpackage for TOML and YAML): the events, as a
+// mask string and/or booleans (combined like the flags), and where
+// the trace goes.
+type Settings struct {
+	Mask    string `json:"mask,omitempty" toml:"mask" yaml:"mask"`
+	Stmt    bool   `json:"stmt,omitempty" toml:"stmt" yaml:"stmt"`
+	Profile bool   `json:"profile,omitempty" toml:"profile" yaml:"profile"`
+	Row     bool   `json:"row,omitempty" toml:"row" yaml:"row"`
+	Close   bool   `json:"close,omitempty" toml:"close" yaml:"close"`
+
+	// Output is where the trace is written: a file path, "-" for the
+	// standard output, "" for nowhere; its use is up to the program.
+	Output string `json:"output,omitempty" toml:"output" yaml:"output"`
+
+	// Options hold further settings (filters, sampling, ...) by name,
+	// for the program or later versions of this package to interpret.
+	Options map[string]string `json:"options,omitempty" toml:"options" yaml:"options"`
+}
+
+// Config returns the events of s; the mask is decoded strictly.
+func (s *Settings) Config() (Config, error) {
+	var c Config
+	if err := DecodeStringArgStrict(&c, s.Mask); err != nil {
+		return Config{}, fmt.Errorf("mask: %w", err)
+	}
+	return c.Union(Config{Stmt: s.Stmt, Profile: s.Profile, Row: s.Row, Close: s.Close}), nil
+}
@@ -1,8 +1,11 @@
 package sqlite3tracemask
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	sqlite3 "github.com/gimpldo/go-sqlite3"
 )
@@ -22,40 +25,180 @@ const (
 )
 
 func PrepareBoolArgsParsing(dest *Config) {
-	// Usage messages (last argument of 'flag.BoolVar') are based on
-	// SQLite 3.14 documentation (as of September 2, 2016)
-	// for SQL Trace Hook = sqlite3_trace_v2():
-	flag.BoolVar(&dest.Stmt, stmtArg, false,
-		"Event: statement first begins running, possibly the start of each trigger subprogram")
-	flag.BoolVar(&dest.Profile, profileArg, false,
-		"Event: statement finishes, gives estimated number of nanoseconds it took to run")
-	flag.BoolVar(&dest.Row, rowArg, false,
-		"Event: a statement generates a single row of result")
-	flag.BoolVar(&dest.Close, closeArg, false,
-		"Event: database connection closes")
+	PrepareBoolArgsParsingOn(flag.CommandLine, dest)
+}
+
+// PrepareBoolArgsParsingOn is like PrepareBoolArgsParsing
+// but registers the flags on fs instead of flag.CommandLine.
+func PrepareBoolArgsParsingOn(fs *flag.FlagSet, dest *Config) {
+	FlagOptions{FlagSet: fs}.PrepareBoolArgsParsing(dest)
 }
 
 func PrepareStringArgParsing(dest *string) {
-	flag.StringVar(dest, "trace-mask", "",
-		"Supported SQLite trace event codes: s=Stmt, p=Profile, r=Row, c=Close")
+	PrepareStringArgParsingOn(flag.CommandLine, dest)
+}
+
+// PrepareStringArgParsingOn is like PrepareStringArgParsing
+// but registers the flag on fs instead of flag.CommandLine.
+func PrepareStringArgParsingOn(fs *flag.FlagSet, dest *string) {
+	FlagOptions{FlagSet: fs}.PrepareStringArgParsing(dest)
 }
 
+// DecodeStringArg sets in dest the events of s (see PrepareStringArgParsing).
+// Events can also be cleared, to subtract from a default already in
+// dest: by an uppercase letter ("R" clears Row), or by any letter after
+// a '-' (until a '+'): "sp-r" sets Stmt and Profile and clears Row.
+// 'a' or '*' stands for all events: "a-r" is all except Row.
+// Other characters are ignored (see DecodeStringArgStrict).
+//
+// The long form, event names separated by commas, is also accepted:
+// "stmt,profile" (see GenerateLongStringArg). Names are case-insensitive,
+// "all" stands for all events and a leading '-' clears: "all,-row".
+// A string is taken in the long form if it has a comma or is one name.
 func DecodeStringArg(dest *Config, s string) {
-	for _, c := range s {
-		switch c {
-		case 's':
-			dest.Stmt = true
-		case 'p':
-			dest.Profile = true
-		case 'r':
-			dest.Row = true
-		case 'c':
-			dest.Close = true
+	decodeStringArg(dest, s)
+}
+
+// DecodeStringArgStrict is like DecodeStringArg but fails, leaving dest
+// unchanged, if s has characters that are not event codes (or names
+// that are not event names): the error is a *DecodeError listing them.
+func DecodeStringArgStrict(dest *Config, s string) error {
+	c := *dest
+	if err := decodeStringArg(&c, s); err != nil {
+		return err
+	}
+	*dest = c
+	return nil
+}
+
+// InvalidRune is a character of a mask string that is not an event code.
+type InvalidRune struct {
+	Pos  int // byte offset
+	Rune rune
+}
+
+// DecodeError is returned by DecodeStringArgStrict.
+type DecodeError struct {
+	Arg     string
+	Invalid []InvalidRune // short form
+	Names   []string      // long form: unknown names
+}
+
+func (e *DecodeError) Error() string {
+	if len(e.Names) > 0 {
+		return fmt.Sprintf("sqlite3tracemask: invalid event names in %q: %s", e.Arg, strings.Join(e.Names, ", "))
+	}
+	sf := make([]string, len(e.Invalid))
+	for i, r := range e.Invalid {
+		sf[i] = fmt.Sprintf("%q at %d", r.Rune, r.Pos)
+	}
+	return fmt.Sprintf("sqlite3tracemask: invalid event codes in %q: %s", e.Arg, strings.Join(sf, ", "))
+}
+
+func decodeStringArg(dest *Config, s string) *DecodeError {
+	return decodeMask(s, dest.setLetter)
+}
+
+// decodeMask decodes s in the short or the long form with set
+// (see decodeLetters), returning nil or the invalid parts.
+func decodeMask(s string, set func(c rune, on bool) bool) *DecodeError {
+	if isLongForm(s) {
+		if names := decodeNames(s, set); len(names) > 0 {
+			return &DecodeError{Arg: s, Names: names}
 		}
+	} else if invalid := decodeLetters(s, set); len(invalid) > 0 {
+		return &DecodeError{Arg: s, Invalid: invalid}
+	}
+	return nil
+}
+
+// longNames map the names of the long form to their letters.
+var longNames = map[string]rune{
+	"all":      'a',
+	"stmt":     's',
+	"profile":  'p',
+	"row":      'r',
+	"close":    'c',
+	"update":   'u',
+	"commit":   'm',
+	"rollback": 'b',
+	"wal":      'w',
+}
+
+func isLongForm(s string) bool {
+	if strings.Contains(s, ",") {
+		return true
 	}
+	_, ok := longNames[strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "-"))]
+	return ok
 }
 
+// decodeNames is decodeLetters for the long form; it returns
+// the names that are not event names.
+func decodeNames(s string, set func(c rune, on bool) bool) (unknown []string) {
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		on := !strings.HasPrefix(name, "-")
+		l, ok := longNames[strings.ToLower(strings.TrimPrefix(name, "-"))]
+		if !ok || !set(l, on) {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// decodeLetters implements the clearing syntax of DecodeStringArg,
+// calling set for each event letter (lowered); set returns false
+// for letters that are not event codes.
+func decodeLetters(s string, set func(c rune, on bool) bool) (invalid []InvalidRune) {
+	mode := true
+	for i, c := range s {
+		on := mode
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+			on = false
+		}
+		switch {
+		case c == '-':
+			mode = false
+		case c == '+':
+			mode = true
+		case c == '*':
+			set('a', on)
+		case !set(c, on):
+			r, _ := utf8.DecodeRuneInString(s[i:]) // as written, not lowered
+			invalid = append(invalid, InvalidRune{Pos: i, Rune: r})
+		}
+	}
+	return invalid
+}
+
+func (c *Config) setLetter(l rune, on bool) bool {
+	switch l {
+	case 'a':
+		c.Stmt, c.Profile, c.Row, c.Close = on, on, on, on
+	case 's':
+		c.Stmt = on
+	case 'p':
+		c.Profile = on
+	case 'r':
+		c.Row = on
+	case 'c':
+		c.Close = on
+	default:
+		return false
+	}
+	return true
+}
+
+// GenerateStringArg returns the short form of c, "a" when all events are set.
 func (c *Config) GenerateStringArg() string {
+	if c.Stmt && c.Profile && c.Row && c.Close {
+		return "a"
+	}
 	sf := []string{} // 'sf' stands for "String Fragments"
 	if c.Stmt {
 		sf = append(sf, "s")
@@ -72,21 +215,23 @@ func (c *Config) GenerateStringArg() string {
 	return strings.Join(sf, "")
 }
 
-func (c *Config) GenerateBoolArgs() string {
-	sf := []string{} // 'sf' stands for "String Fragments"
-	if c.Stmt {
-		sf = append(sf, stmtArg)
+// GenerateLongStringArg returns the long form of c: "stmt,profile",
+// "all" when all events are set.
+func (c *Config) GenerateLongStringArg() string {
+	if c.Stmt && c.Profile && c.Row && c.Close {
+		return "all"
 	}
-	if c.Profile {
-		sf = append(sf, profileArg)
-	}
-	if c.Row {
-		sf = append(sf, rowArg)
-	}
-	if c.Close {
-		sf = append(sf, closeArg)
+	sf := []string{}
+	for _, e := range c.events() {
+		if e.on {
+			sf = append(sf, strings.ToLower(e.name))
+		}
 	}
-	return "--" + strings.Join(sf, " --")
+	return strings.Join(sf, ",")
+}
+
+func (c *Config) GenerateBoolArgs() string {
+	return FlagOptions{}.GenerateBoolArgs(c)
 }
 
 func (c *Config) EventMask() uint {
@@ -105,3 +250,22 @@ func (c *Config) EventMask() uint {
 	}
 	return mask
 }
+
+// ErrUnknownBits is returned (wrapped, with the bits) by FromEventMask.
+var ErrUnknownBits = errors.New("sqlite3tracemask: unknown trace event bits")
+
+// FromEventMask is the inverse of EventMask. Bits that are not trace
+// events known here give an error wrapping ErrUnknownBits; the Config
+// of the known bits is returned anyway.
+func FromEventMask(mask uint) (Config, error) {
+	c := Config{
+		Stmt:    mask&sqlite3.TraceStmt != 0,
+		Profile: mask&sqlite3.TraceProfile != 0,
+		Row:     mask&sqlite3.TraceRow != 0,
+		Close:   mask&sqlite3.TraceClose != 0,
+	}
+	if rest := mask &^ c.EventMask(); rest != 0 {
+		return c, fmt.Errorf("%w: 0x%x", ErrUnknownBits, rest)
+	}
+	return c, nil
+}
@@ -0,0 +1,97 @@
+// Package traceconf reads sqlite3tracemask.Settings from the
+// [sqlite3trace] section of TOML files, or the sqlite3trace key
+// of YAML files, for programs configured from a file:
+//
+//	[sqlite3trace]
+//	mask = "sp"
+//	output = "/var/log/app/sql.trace"
+package traceconf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3tracemask"
+)
+
+// Section is the name of the section (or top-level key) read.
+const Section = "sqlite3trace"
+
+// LoadTOML reads the settings of the [sqlite3trace] section; a file
+// without it gives zero Settings. Unknown keys in the section are
+// errors (to catch typos); other sections are ignored.
+func LoadTOML(r io.Reader) (*sqlite3tracemask.Settings, error) {
+	var doc struct {
+		S sqlite3tracemask.Settings `toml:"sqlite3trace"`
+	}
+	md, err := toml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("traceconf: %w", err)
+	}
+	for _, key := range md.Undecoded() {
+		if len(key) > 1 && key[0] == Section && key[1] != "options" {
+			return nil, fmt.Errorf("traceconf: unknown key %q", key.String())
+		}
+	}
+	return &doc.S, nil
+}
+
+// LoadYAML is LoadTOML for YAML documents.
+func LoadYAML(r io.Reader) (*sqlite3tracemask.Settings, error) {
+	var doc map[string]yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("traceconf: %w", err)
+	}
+	s := &sqlite3tracemask.Settings{}
+	node, ok := doc[Section]
+	if !ok {
+		return s, nil
+	}
+	// Node.Decode cannot reject unknown keys: decode again strictly.
+	raw, err := yaml.Marshal(&node)
+	if err != nil {
+		return nil, fmt.Errorf("traceconf: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(s); err != nil {
+		return nil, fmt.Errorf("traceconf: %s: %w", Section, err)
+	}
+	return s, nil
+}
+
+// LoadFile reads path with LoadTOML or LoadYAML, by its extension
+// (.toml, .yaml or .yml).
+func LoadFile(path string) (*sqlite3tracemask.Settings, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return LoadTOML(f)
+	case ".yaml", ".yml":
+		return LoadYAML(f)
+	}
+	return nil, fmt.Errorf("traceconf: %s: unknown file type (want .toml, .yaml or .yml)", path)
+}
+
+// Loader returns a sqlite3tracemask.Loader reading the events
+// of the file path with LoadFile, for StartReloader.
+func Loader(path string) sqlite3tracemask.Loader {
+	return func() (sqlite3tracemask.Config, error) {
+		s, err := LoadFile(path)
+		if err != nil {
+			return sqlite3tracemask.Config{}, err
+		}
+		return s.Config()
+	}
+}
@@ -0,0 +1,94 @@
+// Package tracepflag registers the sqlite3tracemask flags on a
+// github.com/spf13/pflag FlagSet, for cobra-based programs:
+//
+//	tracepflag.RegisterPFlags(cmd.Flags(), &traceConfig)
+//	tracepflag.Options{Shorthand: "T"}.RegisterMaskPFlag(cmd.Flags(), &traceMask)
+//
+// The flags have the names, usage and defaults of those of
+// sqlite3tracemask.FlagOptions.
+package tracepflag
+
+import (
+	"flag"
+
+	"github.com/spf13/pflag"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3tracemask"
+)
+
+// GroupAnnotation is the flag annotation holding Options.Group,
+// for help templates that list flags by group.
+const GroupAnnotation = "sqlite3tracemask_group"
+
+// Options change how the flags are registered.
+type Options struct {
+	// Prefix is prepended to the flag names (see sqlite3tracemask.FlagOptions).
+	Prefix string
+	// Shorthand is the one-letter shorthand of the mask flag
+	// (--trace-mask or --hook-mask); "" for none.
+	Shorthand string
+	// Group, if set, is recorded under GroupAnnotation on every flag.
+	Group string
+}
+
+// RegisterPFlags registers --trace-stmt, --trace-profile, --trace-row
+// and --trace-close on fs.
+func RegisterPFlags(fs *pflag.FlagSet, dest *sqlite3tracemask.Config) {
+	Options{}.RegisterPFlags(fs, dest)
+}
+
+// RegisterMaskPFlag registers --trace-mask on fs, for the short form
+// (to decode with sqlite3tracemask.DecodeStringArg).
+func RegisterMaskPFlag(fs *pflag.FlagSet, dest *string) {
+	Options{}.RegisterMaskPFlag(fs, dest)
+}
+
+// RegisterPFlags is the package RegisterPFlags with the options of o.
+func (o Options) RegisterPFlags(fs *pflag.FlagSet, dest *sqlite3tracemask.Config) {
+	o.add(fs, "", func(gfs *flag.FlagSet) {
+		o.flagOptions(gfs).PrepareBoolArgsParsing(dest)
+	})
+}
+
+// RegisterMaskPFlag is the package RegisterMaskPFlag with the options of o.
+func (o Options) RegisterMaskPFlag(fs *pflag.FlagSet, dest *string) {
+	o.add(fs, o.Shorthand, func(gfs *flag.FlagSet) {
+		o.flagOptions(gfs).PrepareStringArgParsing(dest)
+	})
+}
+
+// RegisterHookPFlags registers the flags of RegisterPFlags plus
+// --hook-update, --hook-commit, --hook-rollback and --hook-wal.
+func (o Options) RegisterHookPFlags(fs *pflag.FlagSet, dest *sqlite3tracemask.HookConfig) {
+	o.add(fs, "", func(gfs *flag.FlagSet) {
+		o.flagOptions(gfs).PrepareHookBoolArgsParsing(dest)
+	})
+}
+
+// RegisterHookMaskPFlag registers --hook-mask on fs (to decode with
+// sqlite3tracemask.DecodeHookStringArg).
+func (o Options) RegisterHookMaskPFlag(fs *pflag.FlagSet, dest *string) {
+	o.add(fs, o.Shorthand, func(gfs *flag.FlagSet) {
+		o.flagOptions(gfs).PrepareHookStringArgParsing(dest)
+	})
+}
+
+func (o Options) flagOptions(gfs *flag.FlagSet) sqlite3tracemask.FlagOptions {
+	return sqlite3tracemask.FlagOptions{FlagSet: gfs, Prefix: o.Prefix}
+}
+
+// add has prepare register the flags on a scratch flag.FlagSet, then
+// moves them to fs, so that both kinds of flags share one definition.
+// The shorthand is given to the single flag prepared, if any.
+func (o Options) add(fs *pflag.FlagSet, shorthand string, prepare func(*flag.FlagSet)) {
+	gfs := flag.NewFlagSet("", flag.ContinueOnError)
+	prepare(gfs)
+	gfs.VisitAll(func(gf *flag.Flag) {
+		pf := pflag.PFlagFromGoFlag(gf) // bool flags need no value
+		pf.Shorthand = shorthand
+		fs.AddFlag(pf)
+		if o.Group != "" {
+			fs.SetAnnotation(pf.Name, GroupAnnotation, []string{o.Group})
+		}
+	})
+}
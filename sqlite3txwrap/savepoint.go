@@ -0,0 +1,160 @@
+package sqlite3txwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Execer runs statements; savepoints need the same connection
+// for all of them: a *sql.Tx or a *sql.Conn, not a *sql.DB.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+var (
+	// ErrPool is returned by NewSavepoints for a *sql.DB, whose
+	// statements may each run on a different connection.
+	ErrPool = errors.New("sqlite3txwrap: savepoints need a *sql.Tx or *sql.Conn, not a pool")
+	// ErrUnknownSavepoint is returned for a name that is not active.
+	ErrUnknownSavepoint = errors.New("sqlite3txwrap: no such active savepoint")
+	// ErrDuplicateSavepoint is returned by Save for a name already
+	// active: SQLite allows it, but RollbackTo and Release would then
+	// only reach the innermost one.
+	ErrDuplicateSavepoint = errors.New("sqlite3txwrap: savepoint name already active")
+)
+
+// Savepoints keeps track of the savepoints (nested partial
+// transactions) of one connection or transaction, so that code does
+// not build SAVEPOINT statements by hand and misuse (releasing an
+// unknown or already released savepoint) is an error before it
+// reaches SQLite.
+//
+// Only savepoints made through it are known: do not mix with
+// SAVEPOINT statements run directly.
+type Savepoints struct {
+	ex Execer
+
+	mu    sync.Mutex
+	stack []string // active savepoints, outermost first
+	seq   int
+}
+
+// NewSavepoints returns a Savepoints for ex.
+func NewSavepoints(ex Execer) (*Savepoints, error) {
+	if _, ok := ex.(*sql.DB); ok {
+		return nil, ErrPool
+	}
+	return &Savepoints{ex: ex}, nil
+}
+
+func (s *Savepoints) find(name string) int {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if s.stack[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Save starts a savepoint and returns its name: name, or when name is
+// "" a generated unique one ("sp1", "sp2", ...).
+func (s *Savepoints) Save(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		for name == "" || s.find(name) >= 0 {
+			s.seq++
+			name = "sp" + strconv.Itoa(s.seq)
+		}
+	} else if s.find(name) >= 0 {
+		return "", fmt.Errorf("%w: %q", ErrDuplicateSavepoint, name)
+	}
+	if _, err := s.ex.ExecContext(ctx, "SAVEPOINT "+sqlite3lex.QuoteIdent(name)); err != nil {
+		return "", err
+	}
+	s.stack = append(s.stack, name)
+	return name, nil
+}
+
+// RollbackTo undoes the changes made since savepoint name was started.
+// Savepoints started after it are gone; name itself stays active
+// (as in SQLite) and must still be released.
+func (s *Savepoints) RollbackTo(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownSavepoint, name)
+	}
+	if _, err := s.ex.ExecContext(ctx, "ROLLBACK TO "+sqlite3lex.QuoteIdent(name)); err != nil {
+		return err
+	}
+	s.stack = s.stack[:i+1]
+	return nil
+}
+
+// Release ends savepoint name and those started after it, keeping
+// their changes (committing them if name is the outermost savepoint
+// of a connection outside any transaction).
+func (s *Savepoints) Release(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %q", ErrUnknownSavepoint, name)
+	}
+	if _, err := s.ex.ExecContext(ctx, "RELEASE "+sqlite3lex.QuoteIdent(name)); err != nil {
+		return err
+	}
+	s.stack = s.stack[:i]
+	return nil
+}
+
+// Active returns the names of the active savepoints, outermost first.
+func (s *Savepoints) Active() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.stack...)
+}
+
+// Depth returns the number of active savepoints.
+func (s *Savepoints) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.stack)
+}
+
+// Do runs fn in a new savepoint, releasing it if fn returns nil and
+// otherwise rolling back to it and releasing it (undoing fn's changes
+// only), then returning fn's error. As with the package function Do,
+// a panic in fn is not recovered; the savepoint is rolled back.
+func (s *Savepoints) Do(ctx context.Context, fn func() error) (err error) {
+	name, err := s.Save(ctx, "")
+	if err != nil {
+		return err
+	}
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			if rbErr := s.RollbackTo(ctx, name); rbErr != nil {
+				if err == nil {
+					err = rbErr
+				}
+				return
+			}
+		}
+		if relErr := s.Release(ctx, name); err == nil {
+			err = relErr
+		}
+	}()
+
+	err = fn()
+	panicked = false
+	return err
+}
@@ -0,0 +1,133 @@
+// Package sqlite3txwrap runs work in transactions and savepoints,
+// and runs the same statement under the four execution strategies
+// database/sql offers (directly on the pool, in a transaction,
+// prepared, prepared in a transaction) so their behavior and cost
+// can be compared, as the trysqlite3trace1 example does with the
+// trace hook on.
+package sqlite3txwrap
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3metrics"
+)
+
+// Options configure Do.
+type Options struct {
+	// TxOptions are passed to BeginTx; nil means the defaults.
+	TxOptions *sql.TxOptions
+	// Rollback rolls the transaction back even when the work succeeded,
+	// for dry runs and tests that must leave the database unchanged.
+	Rollback bool
+
+	// Metrics, if not nil, receives sqlite3_txwrap_* metrics: the
+	// outcome and duration of each transaction of Do, and the items,
+	// errors and duration of each Run, by strategy.
+	Metrics *sqlite3metrics.Registry
+}
+
+// Do runs fn in a transaction: it commits if fn returns nil
+// (or rolls back, with opts.Rollback) and rolls back otherwise,
+// returning fn's error or else the commit's. opts may be nil.
+//
+// If fn panics, the transaction is rolled back and the panic goes on:
+// Do does not recover it, so the stack trace of the original panic
+// is kept.
+func Do(ctx context.Context, db *sql.DB, opts *Options, fn func(*sql.Tx) error) (err error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	start := time.Now()
+	tx, err := db.BeginTx(ctx, opts.TxOptions)
+	if err != nil {
+		observeTx(opts, "error", start)
+		return err
+	}
+	panicked := true
+	defer func() {
+		// Checking a flag instead of calling recover() lets the panic
+		// continue unchanged.
+		if panicked || err != nil || opts.Rollback {
+			tx.Rollback()
+			outcome := "rollback"
+			if panicked {
+				outcome = "panic"
+			}
+			observeTx(opts, outcome, start)
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			observeTx(opts, "error", start)
+		} else {
+			observeTx(opts, "commit", start)
+		}
+	}()
+
+	err = fn(tx)
+	panicked = false
+	return err
+}
+
+// observeTx records a transaction of Do that started at start and
+// ended with outcome: commit, rollback, panic, or error (of Begin or
+// Commit).
+func observeTx(opts *Options, outcome string, start time.Time) {
+	if opts.Metrics == nil {
+		return
+	}
+	m := opts.Metrics
+	m.Counter("txwrap", "transactions_total",
+		"Transactions run by Do, by outcome.", "outcome").Add(1, outcome)
+	m.Histogram("txwrap", "transaction_duration_seconds",
+		"Duration of the transactions run by Do, by outcome.", nil, "outcome").
+		Observe(time.Since(start).Seconds(), outcome)
+}
+
+// Querier is what *sql.DB, *sql.Tx and *sql.Conn have in common.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// Stmt is one statement, bound to where it runs, as given to the
+// work function of Run: a *sql.Stmt for the prepared strategies.
+type Stmt interface {
+	ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row
+}
+
+// textStmt runs its query text on each call, for the unprepared strategies.
+type textStmt struct {
+	q     Querier
+	query string
+}
+
+func (s textStmt) ExecContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
+	return s.q.ExecContext(ctx, s.query, args...)
+}
+
+func (s textStmt) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
+	return s.q.QueryContext(ctx, s.query, args...)
+}
+
+func (s textStmt) QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row {
+	return s.q.QueryRowContext(ctx, s.query, args...)
+}
+
+// Bind returns query as a Stmt on q, prepared or not; the returned
+// function releases it.
+func Bind(ctx context.Context, q Querier, query string, prepared bool) (Stmt, func() error, error) {
+	if !prepared {
+		return textStmt{q, query}, func() error { return nil }, nil
+	}
+	st, err := q.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, st.Close, nil
+}
@@ -0,0 +1,160 @@
+package sqlite3txwrap
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3metrics"
+)
+
+// Strategy is a way of executing a statement many times.
+type Strategy int
+
+const (
+	Direct     Strategy = iota // each execution on the pool, in its own implicit transaction
+	Tx                         // all executions in one transaction
+	Prepared                   // prepared once, each execution in its own implicit transaction
+	TxPrepared                 // prepared once in a transaction, all executions in it
+)
+
+// Strategies lists every Strategy, in the order Compare runs them.
+var Strategies = []Strategy{Direct, Tx, Prepared, TxPrepared}
+
+var strategyNames = map[Strategy]string{
+	Direct:     "direct",
+	Tx:         "tx",
+	Prepared:   "prepared",
+	TxPrepared: "tx-prepared",
+}
+
+func (s Strategy) String() string {
+	if n, ok := strategyNames[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// InTx reports whether s runs in an explicit transaction.
+func (s Strategy) InTx() bool { return s == Tx || s == TxPrepared }
+
+// IsPrepared reports whether s prepares the statement once.
+func (s Strategy) IsPrepared() bool { return s == Prepared || s == TxPrepared }
+
+// ParseStrategy returns the Strategy named s (as by String).
+func ParseStrategy(s string) (Strategy, error) {
+	for st, n := range strategyNames {
+		if strings.EqualFold(s, n) {
+			return st, nil
+		}
+	}
+	return 0, fmt.Errorf("sqlite3txwrap: unknown strategy %q", s)
+}
+
+// Result describes one Run.
+type Result struct {
+	Strategy Strategy
+	Items    int           // items processed
+	Elapsed  time.Duration // including Begin, Prepare and Commit
+	Err      error
+}
+
+// PerItem returns the mean time per item.
+func (r Result) PerItem() time.Duration {
+	if r.Items == 0 {
+		return 0
+	}
+	return r.Elapsed / time.Duration(r.Items)
+}
+
+func (r Result) String() string {
+	s := fmt.Sprintf("%-11s %6d items in %v (%v/item)", r.Strategy, r.Items, r.Elapsed, r.PerItem())
+	if r.Err != nil {
+		s += ": " + r.Err.Error()
+	}
+	return s
+}
+
+// Run executes query once per item with strategy s, calling fn with
+// the statement bound as the strategy wants, and stops at the first
+// error (rolling back for the transaction strategies). opts may be
+// nil; its Metrics applies to every strategy, the rest to the
+// transaction strategies.
+//
+//	res, err := sqlite3txwrap.Run(ctx, db, sqlite3txwrap.TxPrepared, nil,
+//		"INSERT INTO t (k, v) VALUES (?, ?)", rows,
+//		func(ctx context.Context, st sqlite3txwrap.Stmt, r Row) error {
+//			_, err := st.ExecContext(ctx, r.K, r.V)
+//			return err
+//		})
+func Run[T any](ctx context.Context, db *sql.DB, s Strategy, opts *Options, query string, items []T,
+	fn func(ctx context.Context, st Stmt, item T) error) (Result, error) {
+
+	res := Result{Strategy: s}
+	start := time.Now()
+	each := func(q Querier) error {
+		st, release, err := Bind(ctx, q, query, s.IsPrepared())
+		if err != nil {
+			return err
+		}
+		defer release()
+		for _, item := range items {
+			if err := fn(ctx, st, item); err != nil {
+				return err
+			}
+			res.Items++
+		}
+		return nil
+	}
+	switch s {
+	case Direct, Prepared:
+		res.Err = each(db)
+	case Tx, TxPrepared:
+		res.Err = Do(ctx, db, opts, func(tx *sql.Tx) error { return each(tx) })
+	default:
+		res.Err = fmt.Errorf("sqlite3txwrap: unknown strategy %d", int(s))
+	}
+	res.Elapsed = time.Since(start)
+	if res.Err != nil {
+		res.Err = fmt.Errorf("sqlite3txwrap: %s: %w", s, res.Err)
+	}
+	if opts != nil {
+		observeRun(opts.Metrics, res)
+	}
+	return res, res.Err
+}
+
+// observeRun records the Result of a Run in m, if not nil.
+func observeRun(m *sqlite3metrics.Registry, res Result) {
+	if m == nil {
+		return
+	}
+	strategy := res.Strategy.String()
+	m.Counter("txwrap", "run_items_total",
+		"Items processed by Run, by strategy.", "strategy").Add(float64(res.Items), strategy)
+	m.Histogram("txwrap", "run_duration_seconds",
+		"Duration of Run, by strategy.", nil, "strategy").Observe(res.Elapsed.Seconds(), strategy)
+	if res.Err != nil {
+		m.Counter("txwrap", "run_errors_total",
+			"Runs stopped by an error, by strategy.", "strategy").Add(1, strategy)
+	}
+}
+
+// Compare runs the same work with each of strategies (all of them
+// when none is given), one after the other, and returns their results;
+// an error does not stop the following strategies.
+func Compare[T any](ctx context.Context, db *sql.DB, opts *Options, query string, items []T,
+	fn func(ctx context.Context, st Stmt, item T) error, strategies ...Strategy) []Result {
+
+	if len(strategies) == 0 {
+		strategies = Strategies
+	}
+	results := make([]Result, 0, len(strategies))
+	for _, s := range strategies {
+		res, _ := Run(ctx, db, s, opts, query, items, fn)
+		results = append(results, res)
+	}
+	return results
+}
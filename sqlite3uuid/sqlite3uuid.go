@@ -0,0 +1,248 @@
+// Package sqlite3uuid stores UUIDs as compact 16-byte BLOBs (instead of
+// 36-byte text) and generates random (version 4) and time-ordered
+// (version 7) ones.
+//
+// For primary keys, prefer version 7: BLOBs compare with memcmp(),
+// so v7 keys sort by creation time and new rows are appended at the
+// right edge of the B-tree, while random v4 keys land anywhere,
+// splitting pages all over the index and spreading writes over the
+// WAL. With a UUID primary key, declare the table WITHOUT ROWID so
+// that the key is stored once, in the table B-tree itself:
+//
+//	CREATE TABLE item(id BLOB PRIMARY KEY CHECK(length(id) = 16), ...) WITHOUT ROWID
+package sqlite3uuid
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// UUID is a UUID stored as a 16-byte BLOB; it also scans from text
+// (canonical, braced, urn:uuid: or plain hex), for columns written
+// by other programs.
+type UUID [16]byte
+
+// Nil is the all-zero UUID.
+var Nil UUID
+
+// ErrInvalid is returned for malformed UUIDs.
+var ErrInvalid = errors.New("sqlite3uuid: invalid UUID")
+
+// NewV4 returns a random (version 4) UUID.
+func NewV4() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return Nil, fmt.Errorf("sqlite3uuid: %w", err)
+	}
+	u.setVersion(4)
+	return u, nil
+}
+
+// v7 state: the last millisecond used and the 12-bit counter within it,
+// so that UUIDs made by this process are strictly increasing.
+var v7 struct {
+	mu  sync.Mutex
+	ms  int64
+	seq uint16
+}
+
+// NewV7 returns a time-ordered (version 7) UUID: 48 bits of Unix
+// milliseconds, a 12-bit counter keeping UUIDs from this process
+// increasing within a millisecond, and 62 random bits.
+func NewV7() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return Nil, fmt.Errorf("sqlite3uuid: %w", err)
+	}
+
+	v7.mu.Lock()
+	ms := time.Now().UnixMilli()
+	if ms > v7.ms {
+		v7.ms = ms
+		v7.seq = binary.BigEndian.Uint16(u[6:8]) & 0x7ff // random start, leaving room
+	} else {
+		v7.seq++
+		if v7.seq > 0xfff {
+			v7.ms++ // counter exhausted (or clock went back): borrow the next millisecond
+			v7.seq = 0
+		}
+	}
+	ms, seq := v7.ms, v7.seq
+	v7.mu.Unlock()
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(ms))
+	copy(u[0:6], ts[2:8])
+	binary.BigEndian.PutUint16(u[6:8], seq)
+	u.setVersion(7)
+	return u, nil
+}
+
+// MustV4 and MustV7 are NewV4 and NewV7 panicking on error
+// (which only happens if the system random source fails).
+func MustV4() UUID { return must(NewV4()) }
+func MustV7() UUID { return must(NewV7()) }
+
+func must(u UUID, err error) UUID {
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func (u *UUID) setVersion(v byte) {
+	u[6] = u[6]&0x0f | v<<4
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+}
+
+// Version returns the version number of u.
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Time returns the creation time of a version 7 UUID
+// (the zero time for other versions).
+func (u UUID) Time() time.Time {
+	if u.Version() != 7 {
+		return time.Time{}
+	}
+	var ts [8]byte
+	copy(ts[2:], u[0:6])
+	return time.UnixMilli(int64(binary.BigEndian.Uint64(ts[:])))
+}
+
+// Parse parses the canonical form ("xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"),
+// also braced or with the urn:uuid: prefix, and 32 hex digits.
+func Parse(s string) (UUID, error) {
+	switch {
+	case len(s) == 38 && s[0] == '{' && s[37] == '}':
+		s = s[1:37]
+	case len(s) == 45 && (s[:9] == "urn:uuid:" || s[:9] == "URN:UUID:"):
+		s = s[9:]
+	}
+	var u UUID
+	switch len(s) {
+	case 36:
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return Nil, ErrInvalid
+		}
+		s = s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+		fallthrough
+	case 32:
+		if _, err := hex.Decode(u[:], []byte(s)); err != nil {
+			return Nil, ErrInvalid
+		}
+		return u, nil
+	}
+	return Nil, ErrInvalid
+}
+
+// MustParse is Parse panicking on error, for constants.
+func MustParse(s string) UUID {
+	u, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// String returns the canonical lower-case form.
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// IsNil reports whether u is the Nil UUID.
+func (u UUID) IsNil() bool {
+	return u == Nil
+}
+
+// Value implements driver.Valuer, binding u as a 16-byte BLOB.
+func (u UUID) Value() (driver.Value, error) {
+	return u[:], nil
+}
+
+// Scan implements sql.Scanner, accepting a 16-byte BLOB or any text
+// form Parse accepts. NULL is an error: use a *UUID for nullable columns.
+func (u *UUID) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		if len(v) == 16 {
+			copy(u[:], v)
+			return nil
+		}
+		return u.Scan(string(v))
+	case string:
+		p, err := Parse(v)
+		if err != nil {
+			return fmt.Errorf("sqlite3uuid: cannot scan %q: %w", v, err)
+		}
+		*u = p
+		return nil
+	}
+	return fmt.Errorf("sqlite3uuid: cannot scan %T into a UUID", src)
+}
+
+// MarshalText implements encoding.TextMarshaler (used by encoding/json).
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (u *UUID) UnmarshalText(b []byte) error {
+	p, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*u = p
+	return nil
+}
+
+// Text is a UUID stored in canonical text form, for existing schemas
+// with TEXT UUID columns; it scans the same forms as UUID.
+type Text UUID
+
+// Value implements driver.Valuer, binding the canonical text form.
+func (t Text) Value() (driver.Value, error) {
+	return UUID(t).String(), nil
+}
+
+// Scan implements sql.Scanner.
+func (t *Text) Scan(src interface{}) error {
+	return (*UUID)(t).Scan(src)
+}
+
+// String returns the canonical form.
+func (t Text) String() string {
+	return UUID(t).String()
+}
+
+// TextSQL returns an SQL expression formatting expr, a 16-byte BLOB
+// UUID, in canonical text form, for ad-hoc queries and views.
+func TextSQL(expr string) string {
+	h := "lower(hex(" + expr + "))"
+	return "substr(" + h + ", 1, 8) || '-' || substr(" + h + ", 9, 4) || '-' || substr(" +
+		h + ", 13, 4) || '-' || substr(" + h + ", 17, 4) || '-' || substr(" + h + ", 21, 12)"
+}
+
+// BlobSQL returns an SQL expression converting expr, a UUID in
+// canonical text form, into a 16-byte BLOB, for migrating TEXT columns.
+// It needs unhex(), new in SQLite 3.41.0.
+func BlobSQL(expr string) string {
+	return "unhex(replace(" + expr + ", '-', ''))"
+}
@@ -0,0 +1,15 @@
+// Package sqlite3vtab turns Go data sources into SQLite virtual tables,
+// so in-memory Go data (metrics, configuration, OS information, ...)
+// can be queried with SQL.
+//
+// It needs a driver built with virtual table support: build with
+// '-tags sqlite_vtable', like go-sqlite3 itself.
+//
+// A data source implements Source; each query gets a fresh Iterator:
+//
+//	ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+//		return sqlite3vtab.Register(conn, "goroutines", goroutineSource{})
+//	}
+//	...
+//	db.Query("SELECT id, state FROM goroutines WHERE state = ?", "running")
+package sqlite3vtab
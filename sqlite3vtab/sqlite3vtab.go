@@ -0,0 +1,243 @@
+//go:build sqlite_vtable
+
+package sqlite3vtab
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/gimpldo/go-sqlite3"
+
+	"github.com/gimpldo/sqlite3-util-go/sqlite3lex"
+)
+
+// Source describes a virtual table and produces iterators over it.
+type Source interface {
+	// Columns returns the column names (optionally followed by a type,
+	// e.g. "size INTEGER"), fixed for the lifetime of the table.
+	Columns() []string
+	// Open returns a new iterator; called once per table scan.
+	Open() (Iterator, error)
+}
+
+// Iterator produces the rows of one scan.
+type Iterator interface {
+	// Filter (re)starts the scan. eq maps column indexes to the values
+	// the query requires them to be equal to; the iterator may use them
+	// to skip rows early or ignore them (SQLite checks them again).
+	Filter(eq map[int]interface{}) error
+	// Next returns the next row, one value per column, or io.EOF.
+	// Supported value types: nil, integers, floats, bool, string,
+	// []byte, time.Time (stored as RFC 3339 text), fmt.Stringer.
+	Next() ([]interface{}, error)
+	// Close releases the iterator.
+	Close() error
+}
+
+// Register makes src available on conn as the table temp.<name>
+// (module "go_<name>"). Call it from a ConnectHook so that every
+// connection of the pool has the table.
+func Register(conn *sqlite3.SQLiteConn, name string, src Source) error {
+	module := "go_" + name
+	if err := conn.CreateModule(module, &goModule{src: src}); err != nil {
+		return fmt.Errorf("sqlite3vtab: registering %s: %w", module, err)
+	}
+	_, err := conn.Exec(fmt.Sprintf("CREATE VIRTUAL TABLE temp.%s USING %s",
+		sqlite3lex.QuoteIdent(name), sqlite3lex.QuoteIdent(module)), nil)
+	if err != nil {
+		return fmt.Errorf("sqlite3vtab: creating table %s: %w", name, err)
+	}
+	return nil
+}
+
+type goModule struct {
+	src Source
+}
+
+func (m *goModule) Create(c *sqlite3.SQLiteConn, args []string) (sqlite3.VTab, error) {
+	return m.Connect(c, args)
+}
+
+func (m *goModule) Connect(c *sqlite3.SQLiteConn, args []string) (sqlite3.VTab, error) {
+	err := c.DeclareVTab("CREATE TABLE x(" + strings.Join(m.src.Columns(), ", ") + ")")
+	if err != nil {
+		return nil, err
+	}
+	return &goTable{src: m.src}, nil
+}
+
+func (m *goModule) DestroyModule() {}
+
+type goTable struct {
+	src Source
+}
+
+// BestIndex asks SQLite to pass the values of usable equality constraints
+// to Filter; their column indexes travel in IdxStr ("0,3").
+func (t *goTable) BestIndex(cst []sqlite3.InfoConstraint, ob []sqlite3.InfoOrderBy) (*sqlite3.IndexResult, error) {
+	used := make([]bool, len(cst))
+	var cols []string
+	for i, c := range cst {
+		if c.Usable && c.Op == sqlite3.OpEQ {
+			used[i] = true
+			cols = append(cols, strconv.Itoa(c.Column))
+		}
+	}
+	cost := 1e6
+	if len(cols) > 0 {
+		cost = 1e3
+	}
+	return &sqlite3.IndexResult{
+		Used:          used,
+		IdxStr:        strings.Join(cols, ","),
+		EstimatedCost: cost,
+	}, nil
+}
+
+func (t *goTable) Disconnect() error { return nil }
+func (t *goTable) Destroy() error    { return nil }
+
+func (t *goTable) Open() (sqlite3.VTabCursor, error) {
+	it, err := t.src.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &goCursor{it: it}, nil
+}
+
+type goCursor struct {
+	it    Iterator
+	row   []interface{}
+	eof   bool
+	rowid int64
+}
+
+func (c *goCursor) Close() error {
+	return c.it.Close()
+}
+
+func (c *goCursor) Filter(idxNum int, idxStr string, vals []interface{}) error {
+	eq := make(map[int]interface{})
+	if idxStr != "" {
+		for i, s := range strings.Split(idxStr, ",") {
+			col, err := strconv.Atoi(s)
+			if err != nil || i >= len(vals) {
+				return fmt.Errorf("sqlite3vtab: bad index string %q", idxStr)
+			}
+			eq[col] = vals[i]
+		}
+	}
+	if err := c.it.Filter(eq); err != nil {
+		return err
+	}
+	c.rowid = 0
+	return c.Next()
+}
+
+func (c *goCursor) Next() error {
+	row, err := c.it.Next()
+	if err == io.EOF {
+		c.eof, c.row = true, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.eof, c.row = false, row
+	c.rowid++
+	return nil
+}
+
+func (c *goCursor) EOF() bool {
+	return c.eof
+}
+
+func (c *goCursor) Rowid() (int64, error) {
+	return c.rowid, nil
+}
+
+func (c *goCursor) Column(ctx *sqlite3.SQLiteContext, col int) error {
+	if col < 0 || col >= len(c.row) {
+		ctx.ResultNull()
+		return nil
+	}
+	switch v := c.row[col].(type) {
+	case nil:
+		ctx.ResultNull()
+	case int:
+		ctx.ResultInt64(int64(v))
+	case int8:
+		ctx.ResultInt64(int64(v))
+	case int16:
+		ctx.ResultInt64(int64(v))
+	case int32:
+		ctx.ResultInt64(int64(v))
+	case int64:
+		ctx.ResultInt64(v)
+	case uint:
+		ctx.ResultInt64(int64(v))
+	case uint8:
+		ctx.ResultInt64(int64(v))
+	case uint16:
+		ctx.ResultInt64(int64(v))
+	case uint32:
+		ctx.ResultInt64(int64(v))
+	case uint64:
+		ctx.ResultInt64(int64(v))
+	case float32:
+		ctx.ResultDouble(float64(v))
+	case float64:
+		ctx.ResultDouble(v)
+	case bool:
+		ctx.ResultBool(v)
+	case string:
+		ctx.ResultText(v)
+	case []byte:
+		ctx.ResultBlob(v)
+	case time.Time:
+		ctx.ResultText(v.Format(time.RFC3339Nano))
+	case fmt.Stringer:
+		ctx.ResultText(v.String())
+	default:
+		ctx.ResultText(fmt.Sprint(v))
+	}
+	return nil
+}
+
+// Rows is a Source over a function returning all rows at once,
+// for small tables where streaming is not worth the trouble.
+type Rows struct {
+	Cols []string
+	Load func() ([][]interface{}, error)
+}
+
+func (r *Rows) Columns() []string { return r.Cols }
+
+func (r *Rows) Open() (Iterator, error) {
+	return &rowsIterator{load: r.Load}, nil
+}
+
+type rowsIterator struct {
+	load func() ([][]interface{}, error)
+	rows [][]interface{}
+	i    int
+}
+
+func (it *rowsIterator) Filter(map[int]interface{}) error {
+	rows, err := it.load()
+	it.rows, it.i = rows, 0
+	return err
+}
+
+func (it *rowsIterator) Next() ([]interface{}, error) {
+	if it.i >= len(it.rows) {
+		return nil, io.EOF
+	}
+	it.i++
+	return it.rows[it.i-1], nil
+}
+
+func (it *rowsIterator) Close() error { return nil }